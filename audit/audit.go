@@ -0,0 +1,166 @@
+// Package audit records every mutation the watchdog performs on GitHub in
+// an append-only log, so that security and compliance can reconstruct
+// exactly what the bot did and when.
+//
+// Entries are written as JSON lines:
+//
+//	{"time":"...","actor":"app","installation":42,"action":"create_comment","repo":"org/repo","sha":"...","payload":{...}}
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// Actor of all entries. Mutations are made with the GitHub App's
+// installation tokens.
+const Actor = "app"
+
+// Entry is a single mutation
+type Entry struct {
+	Time         time.Time   `json:"time"`
+	Actor        string      `json:"actor"`
+	Installation int64       `json:"installation"`
+	Action       string      `json:"action"`
+	Repo         string      `json:"repo"`
+	SHA          string      `json:"sha"`
+	Payload      interface{} `json:"payload"`
+	// Error is set if the mutation failed
+	Error string `json:"error,omitempty"`
+}
+
+// Log appends entries to a writer
+type Log struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New creates a log that writes to w
+func New(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Open creates a log that appends to the file at path
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return New(f), nil
+}
+
+// Write appends an entry
+func (l *Log) Write(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// client records the mutations of an scm.Client
+type client struct {
+	scm.Client
+	log          *Log
+	installation int64
+}
+
+// Client wraps c so that all mutations are written to l
+func Client(c scm.Client, l *Log, installation int64) scm.Client {
+	return &client{Client: c, log: l, installation: installation}
+}
+
+func (c *client) record(action, owner, repo, sha string, payload interface{}, err error) {
+	e := Entry{
+		Time:         time.Now().UTC(),
+		Actor:        Actor,
+		Installation: c.installation,
+		Action:       action,
+		Repo:         owner + "/" + repo,
+		SHA:          sha,
+		Payload:      payload,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if werr := c.log.Write(e); werr != nil {
+		// Never fail a mutation because of the audit log, but make it loud
+		log.Printf("could not write the audit log entry for %s on '%s' in '%s/%s': %v\n", action, sha, owner, repo, werr)
+	}
+}
+
+func (c *client) CreateComment(ctx context.Context, owner, repo, sha, body string) (int64, error) {
+	id, err := c.Client.CreateComment(ctx, owner, repo, sha, body)
+	c.record("create_comment", owner, repo, sha, map[string]interface{}{"id": id, "body": body}, err)
+	return id, err
+}
+
+func (c *client) UpdateComment(ctx context.Context, owner, repo string, id int64, body string) error {
+	err := c.Client.UpdateComment(ctx, owner, repo, id, body)
+	c.record("update_comment", owner, repo, "", map[string]interface{}{"id": id, "body": body}, err)
+	return err
+}
+
+func (c *client) CreateStatus(ctx context.Context, owner, repo, sha string, status *scm.Status) error {
+	err := c.Client.CreateStatus(ctx, owner, repo, sha, status)
+	c.record("create_status", owner, repo, sha, status, err)
+	return err
+}
+
+func (c *client) CreateCheckRun(ctx context.Context, owner, repo string, run *scm.CheckRun) error {
+	err := c.Client.CreateCheckRun(ctx, owner, repo, run)
+	c.record("create_check_run", owner, repo, run.HeadSHA, run, err)
+	return err
+}
+
+func (c *client) ReviewDeployment(ctx context.Context, owner, repo string, review *scm.DeploymentReview) error {
+	err := c.Client.ReviewDeployment(ctx, owner, repo, review)
+	c.record("review_deployment", owner, repo, "", review, err)
+	return err
+}
+
+func (c *client) UploadLFSObject(ctx context.Context, owner, repo, oid string, content []byte) error {
+	err := c.Client.UploadLFSObject(ctx, owner, repo, oid, content)
+	c.record("upload_lfs_object", owner, repo, "", map[string]interface{}{"oid": oid, "size": len(content)}, err)
+	return err
+}
+
+func (c *client) CommitFiles(ctx context.Context, owner, repo string, change *scm.Change) (string, error) {
+	sha, err := c.Client.CommitFiles(ctx, owner, repo, change)
+	paths := make([]string, 0, len(change.Files))
+	for p := range change.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	c.record("commit_files", owner, repo, sha, map[string]interface{}{
+		"branch":  change.Branch,
+		"parent":  change.Parent,
+		"message": change.Message,
+		"paths":   paths,
+	}, err)
+	return sha, err
+}
+
+func (c *client) CreatePullRequest(ctx context.Context, owner, repo string, pr *scm.PullRequest) (string, error) {
+	url, err := c.Client.CreatePullRequest(ctx, owner, repo, pr)
+	c.record("create_pull_request", owner, repo, "", map[string]interface{}{"url": url, "pull_request": pr}, err)
+	return url, err
+}
+
+func (c *client) CreateIssue(ctx context.Context, owner, repo, title, body string) (string, error) {
+	url, err := c.Client.CreateIssue(ctx, owner, repo, title, body)
+	c.record("create_issue", owner, repo, "", map[string]interface{}{"url": url, "title": title}, err)
+	return url, err
+}
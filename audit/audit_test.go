@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.InjectError("POST", "repos/test-org/test-repo/statuses/", http.StatusBadGateway, 1)
+
+	var buf bytes.Buffer
+	c := Client(scm.NewGitHub(server.Client()), New(&buf), 42)
+
+	_, err := c.CreateComment(context.Background(), "test-org", "test-repo", "abc123", "hello")
+	assert.Nil(t, err)
+	err = c.CreateStatus(context.Background(), "test-org", "test-repo", "abc123", &scm.Status{Context: "LFSWatchDog", State: "success"})
+	assert.NotNil(t, err)
+	// Reads are not recorded
+	c.GetFileContent(context.Background(), "test-org", "test-repo", "abc123", "README.md")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var comment, status Entry
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &comment))
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &status))
+
+	assert.Equal(t, Actor, comment.Actor)
+	assert.Equal(t, int64(42), comment.Installation)
+	assert.Equal(t, "create_comment", comment.Action)
+	assert.Equal(t, "test-org/test-repo", comment.Repo)
+	assert.Equal(t, "abc123", comment.SHA)
+	assert.Equal(t, map[string]interface{}{"id": float64(1), "body": "hello"}, comment.Payload)
+	assert.Empty(t, comment.Error)
+
+	assert.Equal(t, "create_status", status.Action)
+	assert.NotEmpty(t, status.Error)
+}
@@ -0,0 +1,191 @@
+// Package cache provides a memory bounded LRU cache with optional expiry.
+//
+// Every cache is named and exports hit, miss, eviction and size metrics
+// labeled with its name, so that long running deployments can verify that
+// caches neither leak memory nor thrash.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+)
+
+var (
+	hits      = metrics.NewCounter("lfswatchdog_cache_hits_total", "Cache lookups that found a fresh entry.", "cache")
+	misses    = metrics.NewCounter("lfswatchdog_cache_misses_total", "Cache lookups that found no fresh entry.", "cache")
+	evictions = metrics.NewCounter("lfswatchdog_cache_evictions_total", "Entries evicted to stay within the cache bounds.", "cache")
+	entries   = metrics.NewGauge("lfswatchdog_cache_entries", "Number of entries in the cache.", "cache")
+	sizeBytes = metrics.NewGauge("lfswatchdog_cache_bytes", "Approximate size of the cache entries in bytes.", "cache")
+)
+
+// Sizer is implemented by values that know their approximate memory footprint.
+// Values that don't implement Sizer count as one byte.
+type Sizer interface {
+	Size() int
+}
+
+// Options bound a cache. Zero values mean unbounded.
+type Options struct {
+	MaxEntries int
+	MaxBytes   int
+	// TTL is the time after which entries are no longer returned by Get
+	TTL time.Duration
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	size    int
+	expires time.Time
+}
+
+// Cache is a concurrency safe LRU cache
+type Cache struct {
+	name    string
+	options Options
+
+	sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int
+}
+
+// New creates a cache whose metrics are labeled with name
+func New(name string, options Options) *Cache {
+	return &Cache{
+		name:    name,
+		options: options,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value for key if present and not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	value, fresh, ok := c.GetStale(key)
+	if !ok || !fresh {
+		return nil, false
+	}
+	return value, true
+}
+
+// GetStale returns the value for key even if it expired.
+// fresh reports whether the entry is still within its TTL.
+func (c *Cache) GetStale(key string) (value interface{}, fresh bool, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		misses.Inc(c.name)
+		return nil, false, false
+	}
+	e := element.Value.(*entry)
+	fresh = e.expires.IsZero() || time.Now().Before(e.expires)
+	if fresh {
+		hits.Inc(c.name)
+	} else {
+		misses.Inc(c.name)
+	}
+	c.ll.MoveToFront(element)
+	return e.value, fresh, true
+}
+
+// Add adds or replaces the value for key and evicts the least recently
+// used entries if the cache exceeds its bounds
+func (c *Cache) Add(key string, value interface{}) {
+	size := 1
+	if s, ok := value.(Sizer); ok {
+		size = s.Size()
+	}
+	var expires time.Time
+	if c.options.TTL > 0 {
+		expires = time.Now().Add(c.options.TTL)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		e := element.Value.(*entry)
+		c.bytes += size - e.size
+		e.value, e.size, e.expires = value, size, expires
+		c.ll.MoveToFront(element)
+	} else {
+		c.items[key] = c.ll.PushFront(&entry{key, value, size, expires})
+		c.bytes += size
+	}
+
+	for c.ll.Len() > 0 && c.exceeded() {
+		c.removeElement(c.ll.Back())
+		evictions.Inc(c.name)
+	}
+	c.updateGauges()
+}
+
+// Remove removes key from the cache
+func (c *Cache) Remove(key string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+		c.updateGauges()
+	}
+}
+
+// Clear removes all entries from the cache
+func (c *Cache) Clear() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes = 0
+	c.updateGauges()
+}
+
+// Range calls fn for all entries that are not expired, most recently used
+// first, until fn returns false. It neither counts as a lookup nor changes
+// the order of the entries, and fn must not modify the cache.
+func (c *Cache) Range(fn func(key string, value interface{}) bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	for element := c.ll.Front(); element != nil; element = element.Next() {
+		e := element.Value.(*entry)
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			continue
+		}
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Len returns the number of entries in the cache
+func (c *Cache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache) exceeded() bool {
+	return (c.options.MaxEntries > 0 && c.ll.Len() > c.options.MaxEntries) ||
+		(c.options.MaxBytes > 0 && c.bytes > c.options.MaxBytes)
+}
+
+func (c *Cache) removeElement(element *list.Element) {
+	e := c.ll.Remove(element).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+func (c *Cache) updateGauges() {
+	entries.Set(float64(c.ll.Len()), c.name)
+	sizeBytes.Set(float64(c.bytes), c.name)
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type sized int
+
+func (s sized) Size() int { return int(s) }
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New("test-lru", Options{MaxEntries: 2})
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Get("a")
+	c.Add("c", 3)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestEvictsByBytes(t *testing.T) {
+	c := New("test-bytes", Options{MaxBytes: 100})
+	c.Add("a", sized(60))
+	c.Add("b", sized(30))
+	c.Add("c", sized(30))
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 2, c.Len())
+
+	// Entries larger than the cache are not retained
+	c.Add("d", sized(101))
+	_, ok = c.Get("d")
+	assert.False(t, ok)
+}
+
+func TestClear(t *testing.T) {
+	c := New("test-clear", Options{MaxBytes: 100})
+	c.Add("a", sized(60))
+	c.Clear()
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	c.Add("b", sized(90))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestExpiry(t *testing.T) {
+	c := New("test-ttl", Options{TTL: time.Millisecond})
+	c.Add("a", 1)
+	time.Sleep(2 * time.Millisecond)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	v, fresh, ok := c.GetStale("a")
+	assert.True(t, ok)
+	assert.False(t, fresh)
+	assert.Equal(t, 1, v)
+}
+
+func TestRange(t *testing.T) {
+	c := New("test-range", Options{MaxEntries: 3})
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3)
+
+	var keys []string
+	c.Range(func(key string, value interface{}) bool {
+		keys = append(keys, key)
+		return key != "b"
+	})
+	assert.Equal(t, []string{"c", "b"}, keys)
+
+	// Ranging doesn't protect entries from eviction
+	c.Add("d", 4)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
+
+func TestMetrics(t *testing.T) {
+	c := New("test-metrics", Options{MaxEntries: 1})
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Get("b")
+	c.Get("a")
+
+	var out bytes.Buffer
+	metrics.Write(&out)
+	for _, line := range []string{
+		`lfswatchdog_cache_hits_total{cache="test-metrics"} 1`,
+		`lfswatchdog_cache_misses_total{cache="test-metrics"} 1`,
+		`lfswatchdog_cache_evictions_total{cache="test-metrics"} 1`,
+		`lfswatchdog_cache_entries{cache="test-metrics"} 1`,
+	} {
+		assert.True(t, strings.Contains(out.String(), line+"\n"), line)
+	}
+}
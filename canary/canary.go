@@ -0,0 +1,93 @@
+// Package canary periodically evaluates a file in a designated canary
+// repository, so that broken App credentials or GitHub API issues are
+// detected before users notice missing comments and statuses.
+package canary
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+var (
+	up          = metrics.NewGauge("lfswatchdog_canary_up", "Whether the last canary evaluation succeeded.")
+	failures    = metrics.NewCounter("lfswatchdog_canary_failures_total", "Failed canary evaluations.")
+	lastSuccess = metrics.NewGauge("lfswatchdog_canary_last_success_timestamp_seconds", "Unix time of the last successful canary evaluation.")
+)
+
+// Options describe the canary evaluation
+type Options struct {
+	Installation int64
+	Owner        string
+	Repo         string
+	// Ref the File is measured at
+	Ref      string
+	File     string
+	Interval time.Duration
+}
+
+// ClientFactory creates a client for an installation. A new client is
+// created for every evaluation to exercise the App credentials.
+type ClientFactory interface {
+	NewClient(installationID int64) (scm.Client, error)
+}
+
+// Run evaluates the canary every interval until ctx is done
+func Run(ctx context.Context, clients ClientFactory, options Options) {
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Check(ctx, clients, options); err != nil {
+			log.Printf("canary evaluation of '%s' in '%s/%s' failed: %v\n", options.File, options.Owner, options.Repo, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check evaluates the canary once and updates the canary metrics
+func Check(ctx context.Context, clients ClientFactory, options Options) error {
+	err := check(ctx, clients, options)
+	if err != nil {
+		up.Set(0)
+		failures.Inc()
+		return err
+	}
+	up.Set(1)
+	lastSuccess.Set(float64(time.Now().Unix()))
+	return nil
+}
+
+func check(ctx context.Context, clients ClientFactory, options Options) error {
+	client, err := clients.NewClient(options.Installation)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, options.Interval)
+	defer cancel()
+
+	// The default configuration keeps the canary independent of the
+	// repository's configuration
+	_, err = watchdog.Evaluate(ctx, client, watchdog.EvalRequest{
+		Owner:  options.Owner,
+		Repo:   options.Repo,
+		SHA:    options.Ref,
+		Files:  []string{options.File},
+		Config: watchdog.DefaultConfig(),
+	})
+	if err != nil {
+		return fmt.Errorf("could not evaluate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package canary
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"github.com/stretchr/testify/assert"
+)
+
+type clients struct {
+	server *githubtest.Server
+}
+
+func (c clients) NewClient(installationID int64) (scm.Client, error) {
+	return scm.NewGitHub(c.server.Client()), nil
+}
+
+func TestCheck(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFileWithSize("test-org/canary", "main", "README.md", 100)
+
+	options := Options{Owner: "test-org", Repo: "canary", Ref: "main", File: "README.md", Interval: time.Minute}
+
+	err := Check(context.Background(), clients{server}, options)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(exposition(), "lfswatchdog_canary_up 1\n"))
+
+	server.InjectError("GET", "repos/test-org/canary/contents/", http.StatusBadGateway, 1)
+	err = Check(context.Background(), clients{server}, options)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(exposition(), "lfswatchdog_canary_up 0\n"))
+}
+
+func exposition() string {
+	var b strings.Builder
+	metrics.Write(&b)
+	return b.String()
+}
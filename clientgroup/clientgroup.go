@@ -1,62 +1,257 @@
 package clientgroup
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 
+	"git.autodesk.com/github-solutions/lfswatchdog/audit"
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"git.autodesk.com/github-solutions/lfswatchdog/ratebudget"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
 	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/google/go-github/v35/github"
 )
 
-type GatekeeperGroup struct {
-	gitHubURL      string
-	appID          int64
-	privateKeyFile string
-	sync.RWMutex
-	clients map[int64]*watchdog.WatchDog
+// Options configures how clients for GitHub App installations are created
+type Options struct {
+	// GitHubURL is the GitHub Enterprise URL, "/api/v3/" is appended if
+	// missing. It is ignored if APIURL is set.
+	GitHubURL string
+	// APIURL is used verbatim, e.g. "https://api.github.example.com/" with
+	// subdomain isolation
+	APIURL string
+	// UploadURL defaults to the GitHubURL or APIURL. It is used verbatim if
+	// APIURL is set.
+	UploadURL string
+	// WebURL defaults to the API URL without "/api/v3" or "api." subdomain
+	WebURL string
+	// APIVersion is sent as the X-GitHub-Api-Version header if set.
+	// This allows validating the watchdog against new GHES API versions
+	// before an upgrade.
+	APIVersion     string
+	AppID          int64
+	PrivateKeyFile string
+	// AuditLog records all mutations if set
+	AuditLog *audit.Log
 }
 
-func New(githubInstance string, appID int64, privateKeyFile string) (*GatekeeperGroup, error) {
-	m := make(map[int64]*watchdog.WatchDog)
+// Maximum number of installations to keep clients for.
+// Evicted clients are recreated on demand.
+const maxClients = 1000
 
-	return &GatekeeperGroup{
-		gitHubURL:      githubInstance,
-		appID:          appID,
-		privateKeyFile: privateKeyFile,
-		clients:        m,
-		RWMutex:        sync.RWMutex{},
-	}, nil
+type GatekeeperGroup struct {
+	options Options
+	clients *cache.Cache
+	// mu guards options.AppID, which changes when credentials are rotated
+	mu sync.RWMutex
+	// Resolved endpoints
+	apiURL, uploadURL *url.URL
+	webURL            string
 }
 
-func (group *GatekeeperGroup) GetWatchdog(installationID int64) (*watchdog.WatchDog, error) {
-	group.RLock()
-	gatekeeper, retrieved := group.clients[installationID]
-	group.RUnlock()
+func New(options Options) (*GatekeeperGroup, error) {
+	group := &GatekeeperGroup{
+		options: options,
+		clients: cache.New("clients", cache.Options{MaxEntries: maxClients}),
+	}
 
-	if retrieved {
-		return gatekeeper, nil
+	if options.APIURL != "" {
+		if options.UploadURL == "" {
+			options.UploadURL = options.APIURL
+		}
+		var err error
+		if group.apiURL, err = parseEndpoint(options.APIURL); err != nil {
+			return nil, fmt.Errorf("invalid API URL: %w", err)
+		}
+		if group.uploadURL, err = parseEndpoint(options.UploadURL); err != nil {
+			return nil, fmt.Errorf("invalid upload URL: %w", err)
+		}
 	} else {
-		tr := http.DefaultTransport
-
-		// Wrap the shared transport for use with the app ID 1 authenticating with installation ID 99.
-		itr, err := ghinstallation.NewKeyFromFile(tr, group.appID, installationID, group.privateKeyFile)
+		if options.UploadURL == "" {
+			options.UploadURL = options.GitHubURL
+		}
+		// Let go-github append the "/api/v3/" and "/api/uploads/" paths
+		client, err := github.NewEnterpriseClient(options.GitHubURL, options.UploadURL, nil)
 		if err != nil {
-			return nil, fmt.Errorf("could not create a new installation object for appID '%d', installation ID '%d': %w", group.appID, installationID, err)
+			return nil, fmt.Errorf("invalid GitHub URL: %w", err)
 		}
-		itr.BaseURL = group.gitHubURL
+		group.apiURL, group.uploadURL = client.BaseURL, client.UploadURL
+	}
+
+	group.webURL = options.WebURL
+	if group.webURL == "" {
+		group.webURL = scm.WebURL(group.apiURL)
+	}
+	return group, nil
+}
+
+// Parse a URL that is used verbatim as a go-github endpoint
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u, nil
+}
+
+func (group *GatekeeperGroup) GetWatchdog(installationID int64) (*watchdog.WatchDog, error) {
+	key := strconv.FormatInt(installationID, 10)
+	if gatekeeper, retrieved := group.clients.Get(key); retrieved {
+		return gatekeeper.(*watchdog.WatchDog), nil
+	}
+
+	client, err := group.NewClient(installationID)
+	if err != nil {
+		return nil, err
+	}
+	gatekeeper := watchdog.New(client)
+	gatekeeper.SetInstallation(installationID)
+	group.clients.Add(key, gatekeeper)
+	return gatekeeper, nil
+}
+
+// NewClient creates an uncached client for an installation
+func (group *GatekeeperGroup) NewClient(installationID int64) (scm.Client, error) {
+	// Wrap the shared transport for use with the app ID 1 authenticating with installation ID 99.
+	appID := group.appID()
+	itr, err := ghinstallation.NewKeyFromFile(group.transport(), appID, installationID, group.options.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a new installation object for appID '%d', installation ID '%d': %w", appID, installationID, err)
+	}
+	itr.BaseURL = strings.TrimSuffix(group.apiURL.String(), "/")
+
+	// Use installation transport with github.com/google/go-github
+	client := github.NewClient(&http.Client{Transport: ratebudget.Transport(itr, installationID)})
+	client.BaseURL, client.UploadURL = group.apiURL, group.uploadURL
+
+	var scmClient scm.Client = scm.NewGitHub(client).WithWebURL(group.webURL)
+	if group.options.AuditLog != nil {
+		scmClient = audit.Client(scmClient, group.options.AuditLog, installationID)
+	}
+	return scmClient, nil
+}
 
-		// Use installation transport with github.com/google/go-github
-		client, err := github.NewEnterpriseClient(group.gitHubURL, group.gitHubURL, &http.Client{Transport: itr})
+// FindInstallation returns the ID of the App installation on a repository,
+// or scm.ErrNotFound if the App is not installed on it
+func (group *GatekeeperGroup) FindInstallation(ctx context.Context, owner, repo string) (int64, error) {
+	client, err := group.appClient()
+	if err != nil {
+		return 0, err
+	}
+	installation, resp, err := client.Apps.FindRepositoryInstallation(ctx, owner, repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("the App is not installed on '%s/%s': %w", owner, repo, scm.ErrNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return installation.GetID(), nil
+}
+
+// FindOrgInstallation returns the ID of the App installation on an
+// organization, or scm.ErrNotFound if the App is not installed on it
+func (group *GatekeeperGroup) FindOrgInstallation(ctx context.Context, org string) (int64, error) {
+	client, err := group.appClient()
+	if err != nil {
+		return 0, err
+	}
+	installation, resp, err := client.Apps.FindOrganizationInstallation(ctx, org)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("the App is not installed on '%s': %w", org, scm.ErrNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return installation.GetID(), nil
+}
+
+// App authenticates as the App, which verifies the App ID and private key
+func (group *GatekeeperGroup) App(ctx context.Context) (*github.App, error) {
+	client, err := group.appClient()
+	if err != nil {
+		return nil, err
+	}
+	app, _, err := client.Apps.Get(ctx, "")
+	return app, err
+}
+
+// Installations lists all installations of the App
+func (group *GatekeeperGroup) Installations(ctx context.Context) ([]*github.Installation, error) {
+	client, err := group.appClient()
+	if err != nil {
+		return nil, err
+	}
+	var installations []*github.Installation
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := client.Apps.ListInstallations(ctx, opts)
 		if err != nil {
-			return nil, fmt.Errorf("could not create a new client for installation ID '%d': %w", installationID, err)
+			return nil, err
+		}
+		installations = append(installations, page...)
+		if resp.NextPage == 0 {
+			return installations, nil
 		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// Create a client that authenticates as the App with a JWT
+func (group *GatekeeperGroup) appClient() (*github.Client, error) {
+	appID := group.appID()
+	atr, err := ghinstallation.NewAppsTransportKeyFromFile(group.transport(), appID, group.options.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not create an App transport for appID '%d': %w", appID, err)
+	}
+	atr.BaseURL = strings.TrimSuffix(group.apiURL.String(), "/")
+
+	client := github.NewClient(&http.Client{Transport: atr})
+	client.BaseURL, client.UploadURL = group.apiURL, group.uploadURL
+	return client, nil
+}
+
+// UpdateCredentials switches to a new App ID and rereads the private key
+// file. Clients created with the old credentials are discarded.
+func (group *GatekeeperGroup) UpdateCredentials(appID int64) {
+	group.mu.Lock()
+	group.options.AppID = appID
+	group.mu.Unlock()
+	group.clients.Clear()
+}
+
+func (group *GatekeeperGroup) appID() int64 {
+	group.mu.RLock()
+	defer group.mu.RUnlock()
+	return group.options.AppID
+}
 
-		gatekeeper := watchdog.New(client)
-		group.Lock()
-		group.clients[installationID] = gatekeeper
-		group.Unlock()
-		return gatekeeper, nil
+func (group *GatekeeperGroup) transport() http.RoundTripper {
+	var tr http.RoundTripper = http.DefaultTransport
+	if group.options.APIVersion != "" {
+		tr = &apiVersionTransport{version: group.options.APIVersion, next: tr}
 	}
+	return tr
+}
+
+// apiVersionTransport pins the GitHub REST API version of every request
+// c.f. https://docs.github.com/en/rest/overview/api-versions
+type apiVersionTransport struct {
+	version string
+	next    http.RoundTripper
+}
+
+func (t *apiVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the original request
+	r := req.Clone(req.Context())
+	r.Header.Set("X-GitHub-Api-Version", t.version)
+	return t.next.RoundTrip(r)
 }
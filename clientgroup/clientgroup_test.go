@@ -0,0 +1,89 @@
+package clientgroup
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpoints(t *testing.T) {
+	group, err := New(Options{GitHubURL: "https://github.example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3/", group.apiURL.String())
+	assert.Equal(t, "https://github.example.com/api/uploads/", group.uploadURL.String())
+	assert.Equal(t, "https://github.example.com/", group.webURL)
+
+	group, err = New(Options{
+		APIURL:    "https://api.github.example.com",
+		UploadURL: "https://uploads.github.example.com",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.github.example.com/", group.apiURL.String())
+	assert.Equal(t, "https://uploads.github.example.com/", group.uploadURL.String())
+	assert.Equal(t, "https://github.example.com/", group.webURL)
+
+	group, err = New(Options{APIURL: "https://api.github.example.com/", WebURL: "https://code.example.com/"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.github.example.com/", group.uploadURL.String())
+	assert.Equal(t, "https://code.example.com/", group.webURL)
+}
+
+// The fake server accepts any App JWT, but the key must be valid
+func writePrivateKey(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	f, err := ioutil.TempFile("", "lfswatchdog-clientgroup-*.pem")
+	assert.Nil(t, err)
+	defer f.Close()
+	assert.Nil(t, pem.Encode(f, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return f.Name()
+}
+
+func TestApp(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddInstallation("test-org/test-repo", 42)
+	keyFile := writePrivateKey(t)
+	defer os.Remove(keyFile)
+
+	group, err := New(Options{GitHubURL: server.URL, AppID: 1, PrivateKeyFile: keyFile})
+	assert.Nil(t, err)
+
+	app, err := group.App(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "lfswatchdog", app.GetSlug())
+
+	installations, err := group.Installations(context.Background())
+	assert.Nil(t, err)
+	if assert.Len(t, installations, 1) {
+		assert.Equal(t, int64(42), installations[0].GetID())
+		assert.Equal(t, "test-org", installations[0].GetAccount().GetLogin())
+	}
+
+	id, err := group.FindInstallation(context.Background(), "test-org", "test-repo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), id)
+	_, err = group.FindInstallation(context.Background(), "test-org", "other-repo")
+	assert.True(t, errors.Is(err, scm.ErrNotFound))
+
+	id, err = group.FindOrgInstallation(context.Background(), "test-org")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), id)
+	_, err = group.FindOrgInstallation(context.Background(), "other-org")
+	assert.True(t, errors.Is(err, scm.ErrNotFound))
+
+	group, err = New(Options{GitHubURL: server.URL, AppID: 1, PrivateKeyFile: os.DevNull})
+	assert.Nil(t, err)
+	_, err = group.App(context.Background())
+	assert.NotNil(t, err)
+}
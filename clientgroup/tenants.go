@@ -0,0 +1,117 @@
+package clientgroup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"gopkg.in/yaml.v2"
+)
+
+// Tenant is a GitHub App of a business unit that serves its organizations
+// from the same deployment
+type Tenant struct {
+	Orgs           []string `yaml:"orgs"`
+	AppID          int64    `yaml:"appID"`
+	PrivateKeyFile string   `yaml:"privateKeyFile"`
+	// Secret is the webhook secret of the App
+	Secret string `yaml:"secret"`
+}
+
+// ReadTenants reads a YAML list of tenants
+func ReadTenants(file string) ([]Tenant, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []Tenant
+	if err := yaml.UnmarshalStrict(content, &tenants); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for i, tenant := range tenants {
+		if len(tenant.Orgs) == 0 || tenant.AppID <= 0 || tenant.PrivateKeyFile == "" || tenant.Secret == "" {
+			return nil, fmt.Errorf("tenant %d needs orgs, an appID, a privateKeyFile and a secret", i+1)
+		}
+		for _, org := range tenant.Orgs {
+			if seen[strings.ToLower(org)] {
+				return nil, fmt.Errorf("organization '%s' belongs to more than one tenant", org)
+			}
+			seen[strings.ToLower(org)] = true
+		}
+	}
+	return tenants, nil
+}
+
+// Tenants selects the client group of the App that serves an organization.
+// Organizations without a tenant are served by the default App.
+type Tenants struct {
+	Default *GatekeeperGroup
+	// Lower case organization -> client group of its tenant
+	groups map[string]*GatekeeperGroup
+}
+
+// NewTenants creates a client group per tenant with the endpoints of the
+// default group
+func NewTenants(defaultGroup *GatekeeperGroup, tenants []Tenant) *Tenants {
+	t := &Tenants{Default: defaultGroup, groups: make(map[string]*GatekeeperGroup)}
+	for _, tenant := range tenants {
+		options := defaultGroup.options
+		options.AppID = tenant.AppID
+		options.PrivateKeyFile = tenant.PrivateKeyFile
+		group := &GatekeeperGroup{
+			options:   options,
+			clients:   cache.New(fmt.Sprintf("clients_%d", tenant.AppID), cache.Options{MaxEntries: maxClients}),
+			apiURL:    defaultGroup.apiURL,
+			uploadURL: defaultGroup.uploadURL,
+			webURL:    defaultGroup.webURL,
+		}
+		for _, org := range tenant.Orgs {
+			t.groups[strings.ToLower(org)] = group
+		}
+	}
+	return t
+}
+
+// Group returns the client group of the App that serves an organization
+func (t *Tenants) Group(owner string) *GatekeeperGroup {
+	if group, ok := t.groups[strings.ToLower(owner)]; ok {
+		return group
+	}
+	return t.Default
+}
+
+// Groups returns the client groups of the default App and all tenants
+func (t *Tenants) Groups() []*GatekeeperGroup {
+	groups := []*GatekeeperGroup{t.Default}
+	seen := map[*GatekeeperGroup]bool{t.Default: true}
+	for _, group := range t.groups {
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// FindInstallation returns the ID of the installation of the App that
+// serves the repository's organization
+func (t *Tenants) FindInstallation(ctx context.Context, owner, repo string) (int64, error) {
+	return t.Group(owner).FindInstallation(ctx, owner, repo)
+}
+
+// FindOrgInstallation returns the ID of the installation of the App that
+// serves the organization
+func (t *Tenants) FindOrgInstallation(ctx context.Context, org string) (int64, error) {
+	return t.Group(org).FindOrgInstallation(ctx, org)
+}
+
+// GetWatchdog returns the watchdog of an installation of the App that
+// serves the organization
+func (t *Tenants) GetWatchdog(owner string, installationID int64) (*watchdog.WatchDog, error) {
+	return t.Group(owner).GetWatchdog(installationID)
+}
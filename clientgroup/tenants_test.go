@@ -0,0 +1,70 @@
+package clientgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTenants(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "lfswatchdog-tenants-*.yml")
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = f.WriteString(content)
+	assert.Nil(t, err)
+	return f.Name()
+}
+
+func TestReadTenants(t *testing.T) {
+	file := writeTenants(t, `
+- orgs: [design, Render]
+  appID: 12
+  privateKeyFile: /keys/design.pem
+  secret: design-secret
+- orgs: [manufacturing]
+  appID: 13
+  privateKeyFile: /keys/manufacturing.pem
+  secret: manufacturing-secret
+`)
+	defer os.Remove(file)
+	tenants, err := ReadTenants(file)
+	assert.Nil(t, err)
+	if assert.Len(t, tenants, 2) {
+		assert.Equal(t, []string{"design", "Render"}, tenants[0].Orgs)
+		assert.Equal(t, int64(13), tenants[1].AppID)
+		assert.Equal(t, "manufacturing-secret", tenants[1].Secret)
+	}
+
+	for _, content := range []string{
+		"- orgs: [design]\n  appID: 12\n  privateKeyFile: /keys/design.pem\n",
+		"- orgs: [design]\n  appID: 12\n  privateKeyFile: /keys/design.pem\n  secret: s\n  region: eu\n",
+		"- orgs: [design]\n  appID: 12\n  privateKeyFile: a.pem\n  secret: a\n- orgs: [Design]\n  appID: 13\n  privateKeyFile: b.pem\n  secret: b\n",
+	} {
+		invalid := writeTenants(t, content)
+		_, err := ReadTenants(invalid)
+		assert.NotNil(t, err, content)
+		os.Remove(invalid)
+	}
+	_, err = ReadTenants("/nonexistent/tenants.yml")
+	assert.NotNil(t, err)
+}
+
+func TestTenantGroups(t *testing.T) {
+	defaultGroup, err := New(Options{GitHubURL: "https://github.example.com", AppID: 1, PrivateKeyFile: "/keys/default.pem"})
+	assert.Nil(t, err)
+	tenants := NewTenants(defaultGroup, []Tenant{
+		{Orgs: []string{"design", "Render"}, AppID: 12, PrivateKeyFile: "/keys/design.pem", Secret: "s"},
+	})
+
+	design := tenants.Group("Design")
+	assert.Equal(t, int64(12), design.options.AppID)
+	assert.Equal(t, "/keys/design.pem", design.options.PrivateKeyFile)
+	assert.Equal(t, defaultGroup.apiURL, design.apiURL)
+	assert.Same(t, design, tenants.Group("render"))
+	assert.Same(t, defaultGroup, tenants.Group("other-org"))
+	assert.Len(t, tenants.Groups(), 2)
+
+	assert.Len(t, NewTenants(defaultGroup, nil).Groups(), 1)
+}
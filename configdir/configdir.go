@@ -0,0 +1,85 @@
+// Package configdir reads settings from a directory with one file per
+// setting, named like the environment variable it replaces, e.g. a
+// Kubernetes Secret mounted as a volume.
+//
+// Kubernetes updates mounted Secrets by atomically swapping the "..data"
+// symlink, so a directory is always read in a consistent state.
+package configdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Settings maps setting names to values
+type Settings map[string]string
+
+// Read returns the settings in dir. Hidden files and directories, like the
+// "..data" symlink of Kubernetes volumes, are skipped. Trailing newlines
+// are trimmed from the values.
+func Read(dir string) (Settings, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(Settings)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		p := filepath.Join(dir, entry.Name())
+		// Follow the symlinks of Kubernetes volumes
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		value, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		settings[entry.Name()] = strings.TrimRight(string(value), "\r\n")
+	}
+	return settings, nil
+}
+
+// Getenv returns the setting name, or the environment variable name if
+// the setting is missing
+func (s Settings) Getenv(name string) string {
+	if value, ok := s[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// Overridden returns the names of the settings that are also set as
+// environment variables, sorted. The settings take precedence.
+func (s Settings) Overridden() []string {
+	var names []string
+	for name := range s {
+		if _, ok := os.LookupEnv(name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Equal reports whether s and other contain the same settings
+func (s Settings) Equal(other Settings) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for name, value := range s {
+		if v, ok := other[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
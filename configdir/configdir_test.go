@@ -0,0 +1,56 @@
+package configdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Lay out dir like a mounted Kubernetes Secret
+func writeSecretVolume(t *testing.T, dir, version string, files map[string]string) {
+	data := filepath.Join(dir, "..2021_06_01_"+version)
+	assert.Nil(t, os.Mkdir(data, 0755))
+	for name, value := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(data, name), []byte(value), 0600))
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	assert.Nil(t, os.Symlink(filepath.Base(data), tmp))
+	assert.Nil(t, os.Rename(tmp, filepath.Join(dir, "..data")))
+	for name := range files {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			assert.Nil(t, os.Symlink(filepath.Join("..data", name), link))
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lfswatchdog-configdir-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeSecretVolume(t, dir, "1", map[string]string{"LFSWATCHDOG_SECRET": "secret1\n", "GITHUB_APP_ID": "1"})
+	settings, err := Read(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, Settings{"LFSWATCHDOG_SECRET": "secret1", "GITHUB_APP_ID": "1"}, settings)
+
+	writeSecretVolume(t, dir, "2", map[string]string{"LFSWATCHDOG_SECRET": "secret2", "GITHUB_APP_ID": "1"})
+	updated, err := Read(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret2", updated.Getenv("LFSWATCHDOG_SECRET"))
+	assert.False(t, settings.Equal(updated))
+	assert.True(t, updated.Equal(Settings{"LFSWATCHDOG_SECRET": "secret2", "GITHUB_APP_ID": "1"}))
+
+	os.Setenv("LFSWATCHDOG_CONFIGDIR_TEST", "from-env")
+	defer os.Unsetenv("LFSWATCHDOG_CONFIGDIR_TEST")
+	assert.Equal(t, "from-env", updated.Getenv("LFSWATCHDOG_CONFIGDIR_TEST"))
+	assert.Empty(t, updated.Overridden())
+
+	// Files take precedence over the environment
+	updated["LFSWATCHDOG_CONFIGDIR_TEST"] = "from-file"
+	assert.Equal(t, "from-file", updated.Getenv("LFSWATCHDOG_CONFIGDIR_TEST"))
+	assert.Equal(t, []string{"LFSWATCHDOG_CONFIGDIR_TEST"}, updated.Overridden())
+}
@@ -0,0 +1,101 @@
+package githubtest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// DeploymentReview is the review of a deployment protection rule posted to
+// the server
+type DeploymentReview struct {
+	Repo        string
+	Run         string
+	Environment string `json:"environment_name"`
+	State       string `json:"state"`
+	Comment     string `json:"comment"`
+}
+
+// DeploymentReviews returns all deployment reviews posted so far
+func (s *Server) DeploymentReviews() []DeploymentReview {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DeploymentReview(nil), s.deploymentReviews...)
+}
+
+// DeploymentCallbackURL returns the callback URL of a deployment protection
+// rule event for a workflow run of the repository
+func (s *Server) DeploymentCallbackURL(repo, run string) string {
+	return s.URL + apiPrefix + "repos/" + repo + "/actions/runs/" + run + "/deployment_protection_rule"
+}
+
+// Serves the statuses and check runs of commits and the deployment reviews
+// of a repository. Returns false if the request is not one of them.
+func (s *Server) handleDeployments(w http.ResponseWriter, r *http.Request, repo, rest string) bool {
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "commits/") && strings.HasSuffix(rest, "/status"):
+		s.handleCombinedStatus(w, repo, strings.TrimSuffix(strings.TrimPrefix(rest, "commits/"), "/status"))
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "commits/") && strings.HasSuffix(rest, "/check-runs"):
+		s.handleListCheckRuns(w, repo, strings.TrimSuffix(strings.TrimPrefix(rest, "commits/"), "/check-runs"), r.URL.Query().Get("check_name"))
+	case r.Method == http.MethodPost && strings.HasPrefix(rest, "actions/runs/") && strings.HasSuffix(rest, "/deployment_protection_rule"):
+		var review DeploymentReview
+		if !decode(w, r, &review) {
+			return true
+		}
+		review.Repo = repo
+		review.Run = strings.TrimSuffix(strings.TrimPrefix(rest, "actions/runs/"), "/deployment_protection_rule")
+		s.mu.Lock()
+		s.deploymentReviews = append(s.deploymentReviews, review)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		return false
+	}
+	return true
+}
+
+// Serve the latest status of every context of a commit
+func (s *Server) handleCombinedStatus(w http.ResponseWriter, repo, sha string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	combined := &github.CombinedStatus{SHA: github.String(sha)}
+	seen := make(map[string]bool)
+	for i := len(s.statuses) - 1; i >= 0; i-- {
+		st := s.statuses[i]
+		if st.Repo != repo || st.SHA != sha || seen[st.Context] {
+			continue
+		}
+		seen[st.Context] = true
+		combined.Statuses = append(combined.Statuses, &github.RepoStatus{
+			Context:     github.String(st.Context),
+			State:       github.String(st.State),
+			Description: github.String(st.Description),
+			TargetURL:   github.String(st.TargetURL),
+		})
+	}
+	combined.TotalCount = github.Int(len(combined.Statuses))
+	writeJSON(w, http.StatusOK, combined)
+}
+
+// Serve the check runs of a commit, most recent first
+func (s *Server) handleListCheckRuns(w http.ResponseWriter, repo, sha, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := &github.ListCheckRunsResults{}
+	for i := len(s.checkRuns) - 1; i >= 0; i-- {
+		run := s.checkRuns[i]
+		if run.Repo != repo || run.HeadSHA != sha || (name != "" && run.Name != name) {
+			continue
+		}
+		result.CheckRuns = append(result.CheckRuns, &github.CheckRun{
+			Name:       github.String(run.Name),
+			HeadSHA:    github.String(run.HeadSHA),
+			Status:     run.Status,
+			Conclusion: run.Conclusion,
+			Output:     &github.CheckRunOutput{Title: run.GetOutput().Title, Summary: run.GetOutput().Summary},
+		})
+	}
+	result.Total = github.Int(len(result.CheckRuns))
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,312 @@
+package githubtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// PullRequest is a pull request opened on the server
+type PullRequest struct {
+	Repo string
+	github.NewPullRequest
+}
+
+// Issue is an issue opened on the server
+type Issue struct {
+	Repo  string
+	Title string
+	Body  string
+}
+
+// gitData holds the objects created with the Git data, pull request and
+// Git LFS APIs, and the issues opened. Created trees and commits are served like refs.
+type gitData struct {
+	// repo full name -> branch -> commit SHA
+	branches     map[string]map[string]string
+	pullRequests []PullRequest
+	issues       []Issue
+	// oid -> content
+	lfsObjects map[string][]byte
+	// repo full name -> locks
+	lfsLocks map[string][]*Lock
+	created  int
+}
+
+// Lock is a Git LFS file lock
+type Lock struct {
+	ID       string    `json:"id"`
+	Path     string    `json:"path"`
+	LockedAt time.Time `json:"locked_at"`
+	Owner    struct {
+		Name string `json:"name"`
+	} `json:"owner"`
+}
+
+// AddLFSLock locks a file of the repository for owner
+func (s *Server) AddLFSLock(repo, path, owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.git.lfsLocks == nil {
+		s.git.lfsLocks = make(map[string][]*Lock)
+	}
+	lock := &Lock{ID: strconv.Itoa(len(s.git.lfsLocks[repo]) + 1), Path: path, LockedAt: time.Now().UTC()}
+	lock.Owner.Name = owner
+	s.git.lfsLocks[repo] = append(s.git.lfsLocks[repo], lock)
+}
+
+// File returns an object of the repository at ref, e.g. of a commit
+// created through the API
+func (s *Server) File(repo, ref, file string) (*Object, bool) {
+	files, ok := s.files(repo, ref)
+	if !ok {
+		return nil, false
+	}
+	object, ok := files[file]
+	return object, ok
+}
+
+// Branch returns the commit SHA of a branch created through the API
+func (s *Server) Branch(repo, branch string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sha, ok := s.git.branches[repo][branch]
+	return sha, ok
+}
+
+// AddBranch adds a branch pointing at ref
+func (s *Server) AddBranch(repo, branch, ref string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.git.branches == nil {
+		s.git.branches = make(map[string]map[string]string)
+	}
+	if s.git.branches[repo] == nil {
+		s.git.branches[repo] = make(map[string]string)
+	}
+	s.git.branches[repo][branch] = ref
+}
+
+// PullRequests returns all pull requests opened so far
+func (s *Server) PullRequests() []PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PullRequest(nil), s.git.pullRequests...)
+}
+
+// Issues returns all issues opened so far
+func (s *Server) Issues() []Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Issue(nil), s.git.issues...)
+}
+
+// LFSObject returns the content of an object uploaded to Git LFS storage
+func (s *Server) LFSObject(oid string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.git.lfsObjects[oid]
+	return content, ok
+}
+
+// Serves the Git data and pull request APIs of a repository. Returns false
+// if the request is not one of them.
+func (s *Server) handleGit(w http.ResponseWriter, r *http.Request, repo, rest string) bool {
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "git/blobs/"):
+		s.handleBlob(w, r, repo, strings.TrimPrefix(rest, "git/blobs/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "git/commits/"):
+		sha := strings.TrimPrefix(rest, "git/commits/")
+		if _, ok := s.files(repo, sha); !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return true
+		}
+		writeJSON(w, http.StatusOK, &github.Commit{SHA: &sha, Tree: &github.Tree{SHA: &sha}})
+	case r.Method == http.MethodPost && rest == "git/trees":
+		var req struct {
+			BaseTree string              `json:"base_tree"`
+			Entries  []*github.TreeEntry `json:"tree"`
+		}
+		if !decode(w, r, &req) {
+			return true
+		}
+		base, ok := s.files(repo, req.BaseTree)
+		if !ok {
+			writeError(w, http.StatusUnprocessableEntity, "Invalid base tree")
+			return true
+		}
+		sha := s.createRef(repo, "tree", base, req.Entries)
+		writeJSON(w, http.StatusCreated, &github.Tree{SHA: &sha})
+	case r.Method == http.MethodPost && rest == "git/commits":
+		var c struct {
+			Message string   `json:"message"`
+			Tree    string   `json:"tree"`
+			Parents []string `json:"parents"`
+		}
+		if !decode(w, r, &c) {
+			return true
+		}
+		tree, ok := s.files(repo, c.Tree)
+		if !ok {
+			writeError(w, http.StatusUnprocessableEntity, "Invalid tree")
+			return true
+		}
+		sha := s.createRef(repo, "commit", tree, nil)
+		writeJSON(w, http.StatusCreated, &github.Commit{SHA: &sha, Message: &c.Message})
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "git/ref/heads/"):
+		branch := strings.TrimPrefix(rest, "git/ref/heads/")
+		sha, ok := s.Branch(repo, branch)
+		if !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return true
+		}
+		writeJSON(w, http.StatusOK, &github.Reference{
+			Ref:    github.String("refs/heads/" + branch),
+			Object: &github.GitObject{SHA: &sha},
+		})
+	case r.Method == http.MethodPost && rest == "git/refs":
+		var ref struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		if !decode(w, r, &ref) {
+			return true
+		}
+		branch := strings.TrimPrefix(ref.Ref, "refs/heads/")
+		if _, ok := s.Branch(repo, branch); ok {
+			writeError(w, http.StatusUnprocessableEntity, "Reference already exists")
+			return true
+		}
+		s.AddBranch(repo, branch, ref.SHA)
+		writeJSON(w, http.StatusCreated, &github.Reference{Ref: &ref.Ref, Object: &github.GitObject{SHA: &ref.SHA}})
+	case r.Method == http.MethodPost && rest == "pulls":
+		var pr github.NewPullRequest
+		if !decode(w, r, &pr) {
+			return true
+		}
+		s.mu.Lock()
+		s.git.pullRequests = append(s.git.pullRequests, PullRequest{Repo: repo, NewPullRequest: pr})
+		number := len(s.git.pullRequests)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, &github.PullRequest{
+			Number:  &number,
+			HTMLURL: github.String(fmt.Sprintf("%s/%s/pull/%d", s.URL, repo, number)),
+			Draft:   pr.Draft,
+		})
+	case r.Method == http.MethodPost && rest == "issues":
+		var issue github.IssueRequest
+		if !decode(w, r, &issue) {
+			return true
+		}
+		s.mu.Lock()
+		s.git.issues = append(s.git.issues, Issue{Repo: repo, Title: issue.GetTitle(), Body: issue.GetBody()})
+		number := len(s.git.issues)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, &github.Issue{
+			Number:  &number,
+			HTMLURL: github.String(fmt.Sprintf("%s/%s/issues/%d", s.URL, repo, number)),
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// Serve the raw content of a blob, honoring Range headers
+func (s *Server) handleBlob(w http.ResponseWriter, r *http.Request, repo, sha string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, files := range s.repos[repo] {
+		for _, object := range files {
+			if object.sha() == sha {
+				w.Header().Set("Content-Type", "application/vnd.github.v3.raw")
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(object.Content))
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// Create a ref with the objects of base, replaced by entries with content
+func (s *Server) createRef(repo, kind string, base map[string]*Object, entries []*github.TreeEntry) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make(map[string]*Object, len(base)+len(entries))
+	for p, object := range base {
+		files[p] = object
+	}
+	for _, e := range entries {
+		files[e.GetPath()] = &Object{Type: "file", Content: []byte(e.GetContent())}
+	}
+	s.git.created++
+	sha := fmt.Sprintf("%s%d", kind, s.git.created)
+	s.repos[repo][sha] = files
+	return sha
+}
+
+// Serves the Git LFS batch API of all repositories, with uploads to
+// "/lfs/objects/{oid}". Objects that were uploaded before are not
+// uploaded again. The locks API lists all locks on a single page.
+func (s *Server) handleLFS(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, ".git/info/lfs/locks"):
+		repo := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".git/info/lfs/locks")
+		s.mu.Lock()
+		locks := append([]*Lock{}, s.git.lfsLocks[repo]...)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"locks": locks})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, ".git/info/lfs/objects/batch"):
+		var batch struct {
+			Operation string `json:"operation"`
+			Objects   []struct {
+				OID     string                 `json:"oid"`
+				Size    int64                  `json:"size"`
+				Actions map[string]interface{} `json:"actions,omitempty"`
+			} `json:"objects"`
+		}
+		if !decode(w, r, &batch) {
+			return
+		}
+		s.mu.Lock()
+		for i, object := range batch.Objects {
+			if _, ok := s.git.lfsObjects[object.OID]; ok {
+				continue
+			}
+			batch.Objects[i].Actions = map[string]interface{}{
+				"upload": map[string]interface{}{
+					"href":   s.URL + "/lfs/objects/" + object.OID,
+					"header": map[string]string{"Authorization": "RemoteAuth githubtest"},
+				},
+			}
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, batch)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/lfs/objects/"):
+		if r.Header.Get("Authorization") != "RemoteAuth githubtest" {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.mu.Lock()
+		if s.git.lfsObjects == nil {
+			s.git.lfsObjects = make(map[string][]byte)
+		}
+		s.git.lfsObjects[strings.TrimPrefix(r.URL.Path, "/lfs/objects/")] = content
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
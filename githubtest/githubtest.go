@@ -0,0 +1,892 @@
+// Package githubtest provides a fake GitHub Enterprise API server for tests.
+//
+// The server keeps an in-memory model of repositories and serves the
+// contents and trees APIs from it. Comments, statuses, check runs, commits,
+// pull requests and Git LFS uploads posted to the server are recorded so
+// tests can assert on them. Errors and rate
+// limits can be injected for any endpoint.
+package githubtest
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+const apiPrefix = "/api/v3/"
+
+// The contents API lists at most this many entries of a directory
+const maxContentsEntries = 1000
+
+// Object is a file, symlink or submodule in a fake repository
+type Object struct {
+	// Type is one of "file", "symlink" or "submodule"
+	Type    string
+	Content []byte
+	// Size overrides len(Content) if set, to simulate large files cheaply
+	Size int
+	// Unlisted reports a size of 0 in listings, like GitHub does for very
+	// large blobs. HEAD requests for the raw content report the size.
+	Unlisted bool
+}
+
+func (o *Object) size() int {
+	if o.Size > 0 {
+		return o.Size
+	}
+	return len(o.Content)
+}
+
+func (o *Object) sha() string {
+	if o.size() == 0 {
+		// Like Git, so that empty files can be told from unlisted sizes
+		return "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+	}
+	return fmt.Sprintf("%x", sha1.Sum(o.Content))
+}
+
+// Comment is a commit comment posted to the server
+type Comment struct {
+	ID   int64
+	Repo string
+	SHA  string
+	Body string
+}
+
+// Status is a commit status posted to the server
+type Status struct {
+	Repo        string
+	SHA         string
+	Context     string
+	State       string
+	Description string
+	TargetURL   string
+}
+
+// CheckRun is a check run posted to the server
+type CheckRun struct {
+	Repo string
+	github.CreateCheckRunOptions
+}
+
+type injectedError struct {
+	method string
+	prefix string
+	status int
+	times  int
+}
+
+// Server is a fake GitHub Enterprise API server
+type Server struct {
+	*httptest.Server
+	// Mux allows tests to register handlers for endpoints that are not
+	// modelled by the server. Specific patterns take precedence over the
+	// built-in API handler.
+	Mux *http.ServeMux
+
+	mu sync.Mutex
+	// repo full name -> ref -> path -> object
+	repos map[string]map[string]map[string]*Object
+	// repo full name -> ref that objects were last added to
+	latest map[string]string
+	// email -> login
+	users map[string]string
+	// repo full name -> sha -> commit
+	commits map[string]map[string]*github.RepositoryCommit
+	// repo full name -> number -> pull request and its files
+	pulls map[string]map[int]*pullRequest
+	// repo full name -> installation ID
+	installations map[string]int64
+	// "org/team-slug" of existing teams
+	teams map[string]bool
+
+	comments  []Comment
+	statuses  []Status
+	checkRuns []CheckRun
+	calls     []string
+	errors    []*injectedError
+	rateReset time.Time
+
+	deploymentReviews []DeploymentReview
+
+	git gitData
+}
+
+// NewServer starts a new fake GitHub server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		Mux:           http.NewServeMux(),
+		repos:         make(map[string]map[string]map[string]*Object),
+		latest:        make(map[string]string),
+		users:         make(map[string]string),
+		commits:       make(map[string]map[string]*github.RepositoryCommit),
+		pulls:         make(map[string]map[int]*pullRequest),
+		installations: make(map[string]int64),
+		teams:         make(map[string]bool),
+	}
+	s.Mux.HandleFunc(apiPrefix, s.handleAPI)
+	s.Mux.HandleFunc("/", s.handleLFS)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns a go-github client talking to the server
+func (s *Server) Client() *github.Client {
+	client, _ := github.NewEnterpriseClient(s.URL, s.URL, http.DefaultClient)
+	return client
+}
+
+// AddFile adds a file to the repository at ref
+func (s *Server) AddFile(repo, ref, file string, content []byte) {
+	s.AddObject(repo, ref, file, &Object{Type: "file", Content: content})
+}
+
+// AddFileWithSize adds a file of the given size without allocating content
+func (s *Server) AddFileWithSize(repo, ref, file string, size int) {
+	s.AddObject(repo, ref, file, &Object{Type: "file", Size: size})
+}
+
+// AddObject adds an arbitrary object to the repository at ref
+func (s *Server) AddObject(repo, ref, file string, object *Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs, ok := s.repos[repo]
+	if !ok {
+		refs = make(map[string]map[string]*Object)
+		s.repos[repo] = refs
+	}
+	files, ok := refs[ref]
+	if !ok {
+		files = make(map[string]*Object)
+		refs[ref] = files
+	}
+	files[file] = object
+	s.latest[repo] = ref
+}
+
+// AddUser adds a user that can be found by email with the search API
+func (s *Server) AddUser(login, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[strings.ToLower(email)] = login
+}
+
+// AddCommit adds a commit that can be fetched with the commits API
+func (s *Server) AddCommit(repo string, commit *github.RepositoryCommit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.commits[repo] == nil {
+		s.commits[repo] = make(map[string]*github.RepositoryCommit)
+	}
+	s.commits[repo][commit.GetSHA()] = commit
+}
+
+type pullRequest struct {
+	*github.PullRequest
+	files []*github.CommitFile
+}
+
+// AddPullRequest adds a pull request and the files it changes
+func (s *Server) AddPullRequest(repo string, pr *github.PullRequest, files []*github.CommitFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pulls[repo] == nil {
+		s.pulls[repo] = make(map[int]*pullRequest)
+	}
+	s.pulls[repo][pr.GetNumber()] = &pullRequest{pr, files}
+}
+
+// AddInstallation installs the App on a repository
+func (s *Server) AddInstallation(repo string, installationID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.installations[repo] = installationID
+}
+
+// AddTeam creates a team in an organization
+func (s *Server) AddTeam(org, slug string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.teams[org+"/"+slug] = true
+}
+
+// InjectError makes the next `times` requests whose method matches and
+// whose API path (e.g. "repos/org/repo/contents/") starts with prefix fail
+// with the given HTTP status. An empty method matches all methods.
+func (s *Server) InjectError(method, prefix string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = append(s.errors, &injectedError{method, prefix, status, times})
+}
+
+// RateLimitUntil makes all requests fail with a rate limit error until reset
+func (s *Server) RateLimitUntil(reset time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateReset = reset
+}
+
+// Comments returns all comments posted so far
+func (s *Server) Comments() []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Comment(nil), s.comments...)
+}
+
+// Statuses returns all commit statuses posted so far
+func (s *Server) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Status(nil), s.statuses...)
+}
+
+// CheckRuns returns all check runs posted so far
+func (s *Server) CheckRuns() []CheckRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CheckRun(nil), s.checkRuns...)
+}
+
+// Calls returns the number of API requests whose "METHOD path" starts
+// with prefix, e.g. "GET repos/org/repo/contents/"
+func (s *Server) Calls(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.calls {
+		if strings.HasPrefix(c, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// ResetCalls forgets all recorded API requests
+func (s *Server) ResetCalls() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	apiPath := strings.TrimPrefix(r.URL.Path, apiPrefix)
+
+	s.mu.Lock()
+	s.calls = append(s.calls, r.Method+" "+apiPath)
+
+	if time.Now().Before(s.rateReset) {
+		s.mu.Unlock()
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(s.rateReset.Unix(), 10))
+		writeError(w, http.StatusForbidden, "API rate limit exceeded")
+		return
+	}
+
+	for _, e := range s.errors {
+		if e.times > 0 && (e.method == "" || e.method == r.Method) && strings.HasPrefix(apiPath, e.prefix) {
+			e.times--
+			s.mu.Unlock()
+			writeError(w, e.status, http.StatusText(e.status))
+			return
+		}
+	}
+	s.mu.Unlock()
+
+	s.Mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	apiPath := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	if r.Method == http.MethodPost && strings.HasPrefix(apiPath, "app/installations/") && strings.HasSuffix(apiPath, "/access_tokens") {
+		// Any App JWT is accepted
+		expiresAt := time.Now().Add(time.Hour)
+		writeJSON(w, http.StatusCreated, &github.InstallationToken{
+			Token:     github.String("ghs_githubtest"),
+			ExpiresAt: &expiresAt,
+		})
+		return
+	}
+
+	if r.Method == http.MethodGet && apiPath == "app" {
+		writeJSON(w, http.StatusOK, &github.App{ID: github.Int64(1), Slug: github.String("lfswatchdog")})
+		return
+	}
+
+	if r.Method == http.MethodGet && apiPath == "app/installations" {
+		s.handleInstallations(w)
+		return
+	}
+
+	if r.Method == http.MethodGet && apiPath == "installation/repositories" {
+		s.handleInstallationRepos(w)
+		return
+	}
+
+	if parts := strings.Split(apiPath, "/"); r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "orgs" && parts[2] == "installation" {
+		s.handleOrgInstallation(w, parts[1])
+		return
+	}
+
+	if r.Method == http.MethodGet && apiPath == "search/users" {
+		s.handleSearchUsers(w, r.URL.Query().Get("q"))
+		return
+	}
+
+	if parts := strings.Split(apiPath, "/"); r.Method == http.MethodGet && len(parts) == 4 && parts[0] == "orgs" && parts[2] == "teams" {
+		s.mu.Lock()
+		ok := s.teams[parts[1]+"/"+parts[3]]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, &github.Team{Slug: github.String(parts[3])})
+		return
+	}
+
+	parts := strings.SplitN(apiPath, "/", 4)
+	if len(parts) < 4 || parts[0] != "repos" {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	repo := parts[1] + "/" + parts[2]
+	rest := parts[3]
+
+	if s.handleDeployments(w, r, repo, rest) {
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "contents"):
+		s.handleContents(w, r, repo, r.URL.Query().Get("ref"), strings.Trim(strings.TrimPrefix(rest, "contents"), "/"))
+	case r.Method == http.MethodHead && strings.HasPrefix(rest, "contents/"):
+		s.handleRawSize(w, repo, r.URL.Query().Get("ref"), strings.TrimPrefix(rest, "contents/"))
+	case r.Method == http.MethodGet && rest == "installation":
+		s.mu.Lock()
+		id, ok := s.installations[repo]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, &github.Installation{ID: github.Int64(id)})
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "pulls/"):
+		parts := strings.Split(strings.TrimPrefix(rest, "pulls/"), "/")
+		number, _ := strconv.Atoi(parts[0])
+		s.mu.Lock()
+		pr, ok := s.pulls[repo][number]
+		s.mu.Unlock()
+		switch {
+		case !ok:
+			writeError(w, http.StatusNotFound, "Not Found")
+		case len(parts) == 1:
+			writeJSON(w, http.StatusOK, pr.PullRequest)
+		case len(parts) == 2 && parts[1] == "files":
+			writeJSON(w, http.StatusOK, pr.files)
+		default:
+			writeError(w, http.StatusNotFound, "Not Found")
+		}
+	case r.Method == http.MethodGet && rest == "commits":
+		s.handleListCommits(w, r, repo)
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "compare/"):
+		s.handleCompare(w, repo, strings.TrimPrefix(rest, "compare/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "commits/"):
+		s.mu.Lock()
+		commit, ok := s.commits[repo][strings.TrimPrefix(rest, "commits/")]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusUnprocessableEntity, "No commit found for SHA")
+			return
+		}
+		writeJSON(w, http.StatusOK, commit)
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "git/trees/"):
+		s.handleTree(w, repo, strings.TrimPrefix(rest, "git/trees/"), r.URL.Query().Get("recursive") != "")
+	case r.Method == http.MethodPost && strings.HasPrefix(rest, "commits/") && strings.HasSuffix(rest, "/comments"):
+		var c github.RepositoryComment
+		if !decode(w, r, &c) {
+			return
+		}
+		sha := strings.TrimSuffix(strings.TrimPrefix(rest, "commits/"), "/comments")
+		s.mu.Lock()
+		c.ID = github.Int64(int64(len(s.comments) + 1))
+		s.comments = append(s.comments, Comment{ID: c.GetID(), Repo: repo, SHA: sha, Body: c.GetBody()})
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, c)
+	case r.Method == http.MethodPatch && strings.HasPrefix(rest, "comments/"):
+		var c github.RepositoryComment
+		if !decode(w, r, &c) {
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(rest, "comments/"), 10, 64)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil || id < 1 || id > int64(len(s.comments)) || s.comments[id-1].Repo != repo {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		s.comments[id-1].Body = c.GetBody()
+		c.ID = github.Int64(id)
+		writeJSON(w, http.StatusOK, c)
+	case r.Method == http.MethodPost && strings.HasPrefix(rest, "statuses/"):
+		var st github.RepoStatus
+		if !decode(w, r, &st) {
+			return
+		}
+		s.mu.Lock()
+		s.statuses = append(s.statuses, Status{
+			Repo:        repo,
+			SHA:         strings.TrimPrefix(rest, "statuses/"),
+			Context:     st.GetContext(),
+			State:       st.GetState(),
+			Description: st.GetDescription(),
+			TargetURL:   st.GetTargetURL(),
+		})
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, st)
+	case r.Method == http.MethodPost && rest == "check-runs":
+		var opts github.CreateCheckRunOptions
+		if !decode(w, r, &opts) {
+			return
+		}
+		s.mu.Lock()
+		s.checkRuns = append(s.checkRuns, CheckRun{Repo: repo, CreateCheckRunOptions: opts})
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, &github.CheckRun{Name: &opts.Name, HeadSHA: &opts.HeadSHA})
+	default:
+		if !s.handleGit(w, r, repo, rest) {
+			writeError(w, http.StatusNotFound, "Not Found")
+		}
+	}
+}
+
+// Look up the objects of a repository at ref. Full branch refs like
+// "refs/heads/main" point at the ref given to AddBranch, or at the ref that
+// objects were last added to, like the head of a push.
+func (s *Server) files(repo, ref string) (map[string]*Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, ok := s.repos[repo]
+	if !ok {
+		return nil, false
+	}
+	if branch := strings.TrimPrefix(ref, "refs/heads/"); branch != ref {
+		ref = s.latest[repo]
+		if sha, ok := s.git.branches[repo][branch]; ok {
+			ref = sha
+		}
+	}
+	files, ok := refs[ref]
+	return files, ok
+}
+
+func (s *Server) handleContents(w http.ResponseWriter, r *http.Request, repo, ref, p string) {
+	files, ok := s.files(repo, ref)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No commit found for the ref "+ref)
+		return
+	}
+	if p == "." {
+		p = ""
+	}
+
+	if object, ok := files[p]; ok {
+		// Files are served with an ETag of their content and ref, which
+		// conditional requests send with If-None-Match
+		etag := fmt.Sprintf(`"%x"`, sha1.Sum([]byte(ref+"\x00"+object.sha())))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeJSON(w, http.StatusOK, content(p, object, true))
+		return
+	}
+
+	// Collect the immediate children of the directory
+	prefix := ""
+	if p != "" {
+		prefix = p + "/"
+	}
+	children := make(map[string]*github.RepositoryContent)
+	for name, object := range files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		child := strings.SplitN(strings.TrimPrefix(name, prefix), "/", 2)
+		childPath := prefix + child[0]
+		if len(child) == 2 {
+			children[childPath] = dirContent(childPath)
+		} else {
+			children[childPath] = content(childPath, object, false)
+		}
+	}
+	if len(children) == 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	listing := make([]*github.RepositoryContent, 0, len(children))
+	for _, c := range children {
+		listing = append(listing, c)
+	}
+	sort.Slice(listing, func(i, j int) bool { return listing[i].GetPath() < listing[j].GetPath() })
+	if len(listing) > maxContentsEntries {
+		listing = listing[:maxContentsEntries]
+	}
+	writeJSON(w, http.StatusOK, listing)
+}
+
+// Report the size of a file's raw content without sending it
+func (s *Server) handleRawSize(w http.ResponseWriter, repo, ref, p string) {
+	files, _ := s.files(repo, ref)
+	object, ok := files[p]
+	if !ok || object.Type != "file" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.github.v3.raw")
+	w.Header().Set("Content-Length", strconv.Itoa(object.size()))
+	w.WriteHeader(http.StatusOK)
+}
+
+// List one installation per account the App is installed on
+func (s *Server) handleInstallations(w http.ResponseWriter) {
+	s.mu.Lock()
+	accounts := make(map[int64]string)
+	for repo, id := range s.installations {
+		accounts[id] = strings.SplitN(repo, "/", 2)[0]
+	}
+	s.mu.Unlock()
+
+	installations := make([]*github.Installation, 0, len(accounts))
+	for id, login := range accounts {
+		installations = append(installations, &github.Installation{
+			ID:      github.Int64(id),
+			Account: &github.User{Login: github.String(login)},
+		})
+	}
+	sort.Slice(installations, func(i, j int) bool { return installations[i].GetID() < installations[j].GetID() })
+	writeJSON(w, http.StatusOK, installations)
+}
+
+// List the repositories the App is installed on. Installation tokens are
+// not told apart, so every installation sees all of them.
+func (s *Server) handleInstallationRepos(w http.ResponseWriter) {
+	s.mu.Lock()
+	repos := make([]*github.Repository, 0, len(s.installations))
+	for repo := range s.installations {
+		parts := strings.SplitN(repo, "/", 2)
+		repos = append(repos, &github.Repository{
+			Name:          github.String(parts[1]),
+			FullName:      github.String(repo),
+			Owner:         &github.User{Login: github.String(parts[0])},
+			DefaultBranch: github.String("main"),
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(repos, func(i, j int) bool { return repos[i].GetFullName() < repos[j].GetFullName() })
+	writeJSON(w, http.StatusOK, &github.ListRepositories{TotalCount: github.Int(len(repos)), Repositories: repos})
+}
+
+// Find the installation on any repository of an organization
+func (s *Server) handleOrgInstallation(w http.ResponseWriter, org string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for repo, id := range s.installations {
+		if strings.EqualFold(strings.SplitN(repo, "/", 2)[0], org) {
+			writeJSON(w, http.StatusOK, &github.Installation{ID: github.Int64(id)})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// Supports case insensitive queries of the form "email in:email" only
+func (s *Server) handleSearchUsers(w http.ResponseWriter, query string) {
+	email := strings.TrimSpace(strings.TrimSuffix(query, "in:email"))
+
+	s.mu.Lock()
+	login, ok := s.users[strings.ToLower(email)]
+	s.mu.Unlock()
+
+	result := &github.UsersSearchResult{Total: github.Int(0), IncompleteResults: github.Bool(false)}
+	if ok {
+		result.Total = github.Int(1)
+		result.Users = []*github.User{{Login: github.String(login), Email: github.String(email)}}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Compare the commits added with AddCommit of the form "base...head",
+// where base may be a branch added with AddBranch. The commits reachable
+// from head but not from base are listed oldest first, at most 250 like
+// GitHub does.
+func (s *Server) handleCompare(w http.ResponseWriter, repo, basehead string) {
+	parts := strings.SplitN(basehead, "...", 2)
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := parts[0]
+	if sha, ok := s.git.branches[repo][base]; ok {
+		base = sha
+	}
+	commits := s.commits[repo]
+	if _, ok := commits[base]; !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if _, ok := commits[parts[1]]; !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	// Walk the parents depth first, so that parents come before children
+	// once reversed
+	ancestors := func(sha string, visit func(*github.RepositoryCommit)) {
+		seen := make(map[string]bool)
+		stack := []string{sha}
+		for len(stack) > 0 {
+			sha, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			commit, ok := commits[sha]
+			if !ok || seen[sha] {
+				continue
+			}
+			seen[sha] = true
+			visit(commit)
+			for i := len(commit.Parents) - 1; i >= 0; i-- {
+				stack = append(stack, commit.Parents[i].GetSHA())
+			}
+		}
+	}
+	known := make(map[string]bool)
+	ancestors(base, func(c *github.RepositoryCommit) { known[c.GetSHA()] = true })
+	var listed []*github.RepositoryCommit
+	ancestors(parts[1], func(c *github.RepositoryCommit) {
+		if !known[c.GetSHA()] {
+			listed = append([]*github.RepositoryCommit{{SHA: c.SHA, Parents: c.Parents}}, listed...)
+		}
+	})
+	total := len(listed)
+	if len(listed) > 250 {
+		listed = listed[:250]
+	}
+	writeJSON(w, http.StatusOK, &github.CommitsComparison{
+		Status:       github.String("ahead"),
+		AheadBy:      github.Int(total),
+		TotalCommits: github.Int(total),
+		Commits:      listed,
+	})
+}
+
+// List the commits added with AddCommit from the sha parameter along
+// their first parents, newest first, in pages linked like GitHub does
+func (s *Server) handleListCommits(w http.ResponseWriter, r *http.Request, repo string) {
+	s.mu.Lock()
+	var commits []*github.RepositoryCommit
+	for commit, ok := s.commits[repo][r.URL.Query().Get("sha")]; ok; {
+		commits = append(commits, commit)
+		if len(commit.Parents) == 0 {
+			break
+		}
+		commit, ok = s.commits[repo][commit.Parents[0].GetSHA()]
+	}
+	s.mu.Unlock()
+	if len(commits) == 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage <= 0 {
+		perPage = 30
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	start, end := (page-1)*perPage, page*perPage
+	if start > len(commits) {
+		start = len(commits)
+	}
+	if end < len(commits) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"next\"", s.URL, next.String()))
+	} else {
+		end = len(commits)
+	}
+	writeJSON(w, http.StatusOK, commits[start:end])
+}
+
+func (s *Server) handleTree(w http.ResponseWriter, repo, sha string, recursive bool) {
+	files, dir, ok := s.tree(repo, sha)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	// Entries are named relative to the tree
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	dirs := make(map[string]bool)
+	var entries []*github.TreeEntry
+	for name, object := range files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		name = strings.TrimPrefix(name, prefix)
+		if !recursive && strings.Contains(name, "/") {
+			dirs[strings.SplitN(name, "/", 2)[0]] = true
+			continue
+		}
+		for dir := path.Dir(name); recursive && dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+		entries = append(entries, treeEntry(name, object))
+	}
+	for d := range dirs {
+		entries = append(entries, &github.TreeEntry{
+			Path: github.String(d),
+			Mode: github.String("040000"),
+			Type: github.String("tree"),
+			SHA:  github.String(treeSHA(files, prefix+d)),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].GetPath() < entries[j].GetPath() })
+
+	writeJSON(w, http.StatusOK, &github.Tree{
+		SHA:       github.String(sha),
+		Entries:   entries,
+		Truncated: github.Bool(false),
+	})
+}
+
+// Look up the objects of a repository by a ref, or by the SHA of the tree
+// of a directory and the directory
+func (s *Server) tree(repo, sha string) (map[string]*Object, string, bool) {
+	if files, ok := s.files(repo, sha); ok {
+		return files, "", true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, files := range s.repos[repo] {
+		checked := make(map[string]bool)
+		for name := range files {
+			for dir := path.Dir(name); dir != "." && !checked[dir]; dir = path.Dir(dir) {
+				checked[dir] = true
+				if treeSHA(files, dir) == sha {
+					return files, dir, true
+				}
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// Derive the SHA of the tree of a directory from its objects, so that
+// directories with the same objects have the same tree like in Git
+func treeSHA(files map[string]*Object, dir string) string {
+	var names []string
+	for name := range files {
+		if strings.HasPrefix(name, dir+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	h := sha1.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\x00%d\n", strings.TrimPrefix(name, dir+"/"), files[name].sha(), files[name].size())
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func content(p string, object *Object, withContent bool) *github.RepositoryContent {
+	c := &github.RepositoryContent{
+		Type: github.String(object.Type),
+		Name: github.String(path.Base(p)),
+		Path: github.String(p),
+		Size: github.Int(object.size()),
+		SHA:  github.String(object.sha()),
+	}
+	if object.Unlisted {
+		c.Size = github.Int(0)
+	}
+	if withContent && object.Type == "file" {
+		c.Encoding = github.String("base64")
+		c.Content = github.String(base64.StdEncoding.EncodeToString(object.Content))
+	}
+	return c
+}
+
+func dirContent(p string) *github.RepositoryContent {
+	return &github.RepositoryContent{
+		Type: github.String("dir"),
+		Name: github.String(path.Base(p)),
+		Path: github.String(p),
+		Size: github.Int(0),
+	}
+}
+
+func treeEntry(p string, object *Object) *github.TreeEntry {
+	e := &github.TreeEntry{
+		Path: github.String(p),
+		SHA:  github.String(object.sha()),
+	}
+	switch object.Type {
+	case "symlink":
+		e.Mode, e.Type = github.String("120000"), github.String("blob")
+		e.Size = github.Int(object.size())
+	case "submodule":
+		e.Mode, e.Type = github.String("160000"), github.String("commit")
+	default:
+		e.Mode, e.Type = github.String("100644"), github.String("blob")
+		e.Size = github.Int(object.size())
+		if object.Unlisted {
+			e.Size = github.Int(0)
+		}
+	}
+	return e
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,180 @@
+// Package jobs persists push checks until they finish, so that checks
+// interrupted by a restart can be resumed.
+//
+// Every job is a JSON file in the store directory, or an item of a
+// store.Store, that is rewritten atomically whenever a commit of the push
+// was checked and removed once the whole push was checked.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/store"
+	"github.com/google/go-github/v35/github"
+)
+
+const jobSuffix = ".json"
+
+// Delivery IDs are GUIDs, anything else is replaced to keep files in the
+// store directory
+var unsafeID = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// Store keeps the jobs in a directory or a bucket of a store.Store
+type Store struct {
+	dir    string
+	items  store.Store
+	bucket string
+}
+
+// Open creates the directory if it doesn't exist
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// New keeps the jobs in a bucket of a store. Replicas that share a store
+// need a bucket each, as every replica resumes all jobs of its bucket.
+func New(items store.Store, bucket string) *Store {
+	return &Store{items: items, bucket: bucket}
+}
+
+// Job is a push whose check has not finished
+type Job struct {
+	ID    string
+	Event *github.PushEvent
+	// Done lists the SHAs of the commits that were checked
+	Done []string
+
+	store *Store
+	mu    sync.Mutex
+}
+
+// Add persists a new job for a push delivery
+func (s *Store) Add(deliveryID string, event *github.PushEvent) (*Job, error) {
+	id := unsafeID.ReplaceAllString(deliveryID, "_")
+	if id == "" {
+		id = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	job := &Job{ID: id, Event: event, store: s}
+	return job, job.save()
+}
+
+// Pending returns the jobs that did not finish, oldest first
+func (s *Store) Pending() ([]*Job, error) {
+	if s.items != nil {
+		return s.pendingItems()
+	}
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	var pending []*Job
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), jobSuffix) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		job := &Job{store: s}
+		if err := json.Unmarshal(data, job); err != nil {
+			return nil, fmt.Errorf("invalid job '%s': %w", f.Name(), err)
+		}
+		pending = append(pending, job)
+	}
+	return pending, nil
+}
+
+func (s *Store) pendingItems() ([]*Job, error) {
+	items, err := s.items.List(context.Background(), s.bucket)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]*Job, 0, len(items))
+	for _, item := range items {
+		job := &Job{store: s}
+		if err := json.Unmarshal(item.Value, job); err != nil {
+			return nil, fmt.Errorf("invalid job '%s': %w", item.Key, err)
+		}
+		pending = append(pending, job)
+	}
+	return pending, nil
+}
+
+// Remaining returns the push without the commits that were checked
+func (j *Job) Remaining() *github.PushEvent {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	done := make(map[string]bool, len(j.Done))
+	for _, sha := range j.Done {
+		done[sha] = true
+	}
+	event := *j.Event
+	event.Commits = nil
+	for _, commit := range j.Event.Commits {
+		if !done[commit.GetID()] {
+			event.Commits = append(event.Commits, commit)
+		}
+	}
+	return &event
+}
+
+// MarkDone records that a commit was checked
+func (j *Job) MarkDone(sha string) error {
+	j.mu.Lock()
+	j.Done = append(j.Done, sha)
+	j.mu.Unlock()
+	return j.save()
+}
+
+// Finish removes the job once the push was checked
+func (j *Job) Finish() error {
+	if j.store.items != nil {
+		return j.store.items.Delete(context.Background(), j.store.bucket, j.ID)
+	}
+	err := os.Remove(j.path())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (j *Job) path() string {
+	return filepath.Join(j.store.dir, j.ID+jobSuffix)
+}
+
+// Put the job into the store, or write it to a temporary file and rename
+// it, so that a crash never leaves a partially written job
+func (j *Job) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if j.store.items != nil {
+		return j.store.items.Put(context.Background(), j.store.bucket, j.ID, data)
+	}
+	tmp := j.path() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path())
+}
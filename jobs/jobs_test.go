@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/store"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lfswatchdog-jobs-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := Open(dir)
+	assert.Nil(t, err)
+	event := &github.PushEvent{
+		Repo: &github.PushEventRepository{FullName: github.String("test-org/test-repo")},
+		Commits: []*github.HeadCommit{
+			{ID: github.String("sha1")},
+			{ID: github.String("sha2")},
+		},
+	}
+
+	job, err := store.Add("72d3162e-cc78-11e3-81ab-4c9367dc0958", event)
+	assert.Nil(t, err)
+	assert.Nil(t, job.MarkDone("sha1"))
+	_, err = store.Add("../escape", event)
+	assert.Nil(t, err)
+
+	// A restarted server finds both jobs
+	store, err = Open(dir)
+	assert.Nil(t, err)
+	pending, err := store.Pending()
+	assert.Nil(t, err)
+	if assert.Len(t, pending, 2) {
+		if pending[0].ID != "72d3162e-cc78-11e3-81ab-4c9367dc0958" {
+			pending[0], pending[1] = pending[1], pending[0]
+		}
+		assert.Equal(t, "72d3162e-cc78-11e3-81ab-4c9367dc0958", pending[0].ID)
+		remaining := pending[0].Remaining()
+		assert.Equal(t, "test-org/test-repo", remaining.GetRepo().GetFullName())
+		if assert.Len(t, remaining.Commits, 1) {
+			assert.Equal(t, "sha2", remaining.Commits[0].GetID())
+		}
+		assert.Equal(t, "___escape", pending[1].ID)
+
+		assert.Nil(t, pending[0].Finish())
+		assert.Nil(t, pending[1].Finish())
+	}
+
+	pending, err = store.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestJobsInStore(t *testing.T) {
+	items := store.NewMemory()
+	jobs := New(items, "jobs-0")
+	event := &github.PushEvent{
+		Repo:    &github.PushEventRepository{FullName: github.String("test-org/test-repo")},
+		Commits: []*github.HeadCommit{{ID: github.String("sha1")}, {ID: github.String("sha2")}},
+	}
+
+	first, err := jobs.Add("first", event)
+	assert.Nil(t, err)
+	_, err = jobs.Add("second", event)
+	assert.Nil(t, err)
+	assert.Nil(t, first.MarkDone("sha2"))
+
+	// Replicas don't resume the jobs of other replicas
+	pending, err := New(items, "jobs-1").Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+
+	pending, err = New(items, "jobs-0").Pending()
+	assert.Nil(t, err)
+	if assert.Len(t, pending, 2) {
+		assert.Equal(t, "first", pending[0].ID)
+		if remaining := pending[0].Remaining(); assert.Len(t, remaining.Commits, 1) {
+			assert.Equal(t, "sha1", remaining.Commits[0].GetID())
+		}
+		assert.Equal(t, "second", pending[1].ID)
+		assert.Nil(t, pending[0].Finish())
+	}
+
+	pending, err = jobs.Pending()
+	assert.Nil(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "second", pending[0].ID)
+	}
+}
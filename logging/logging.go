@@ -0,0 +1,31 @@
+// Package logging adds a debug level to the standard logger that can be
+// toggled at runtime.
+package logging
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+var debug int32
+
+// SetDebug turns debug logging on or off
+func SetDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&debug, v)
+}
+
+// Debug reports whether debug logging is on
+func Debug() bool {
+	return atomic.LoadInt32(&debug) != 0
+}
+
+// Debugf logs like log.Printf if debug logging is on
+func Debugf(format string, v ...interface{}) {
+	if Debug() {
+		log.Printf(format, v...)
+	}
+}
@@ -1,18 +1,250 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"git.autodesk.com/github-solutions/lfswatchdog/configdir"
+	"git.autodesk.com/github-solutions/lfswatchdog/selftest"
 	"git.autodesk.com/github-solutions/lfswatchdog/server"
+	"git.autodesk.com/github-solutions/lfswatchdog/store"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
 )
 
+// Version of the watchdog, set by the Makefile
+var version = "dev"
+
 func main() {
-	server.Run(
-		os.Getenv("GITHUB_ENTERPRISE_URL"),
-		os.Getenv("LFSWATCHDOG_SECRET"),
-		os.Getenv("GITHUB_APP_ID"),
-		os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE"),
-		os.Getenv("LFSWATCHDOG_PORT"),
-		os.Getenv("LFSWATCHDOG_PATH"),
-	)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "selftest":
+			if err := selftest.Run(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "selftest failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "explain":
+			explain(os.Args[2:])
+			return
+		case "preview":
+			preview(os.Args[2:])
+			return
+		case "migrate-store":
+			migrateStore(os.Args[2:])
+			return
+		}
+	}
+
+	var checkConfig, listInstallations bool
+	var configDir string
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--check-config":
+			checkConfig = true
+		case args[i] == "--list-installations":
+			listInstallations = true
+		case args[i] == "--config-dir" && i+1 < len(args):
+			i++
+			configDir = args[i]
+		case strings.HasPrefix(args[i], "--config-dir="):
+			configDir = strings.TrimPrefix(args[i], "--config-dir=")
+		default:
+			fmt.Fprintf(os.Stderr, "unknown argument '%s'\n", args[i])
+			os.Exit(2)
+		}
+	}
+
+	getenv := os.Getenv
+	if configDir != "" {
+		settings, err := configdir.Read(configDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read the configuration directory: %v\n", err)
+			os.Exit(1)
+		}
+		for _, name := range settings.Overridden() {
+			fmt.Fprintf(os.Stderr, "the environment variable '%s' is overridden by the file in the configuration directory\n", name)
+		}
+		getenv = settings.Getenv
+	}
+
+	config := serverConfig(getenv)
+	if configDir != "" && config.PrivateKeyFile == "" {
+		config.PrivateKeyFile = filepath.Join(configDir, privateKeyFile)
+	}
+	config.ConfigDir = configDir
+	config.CheckConfig = checkConfig
+	config.ListInstallations = listInstallations
+	server.Run(config)
+}
+
+// Name of the private key file in the configuration directory
+const privateKeyFile = "GITHUB_APP_PRIVATE_KEY"
+
+// Read the server configuration with getenv
+func serverConfig(getenv func(string) string) server.Config {
+	return server.Config{
+		GitHubURL:           getenv("GITHUB_ENTERPRISE_URL"),
+		GitHubAPIURL:        getenv("GITHUB_API_URL"),
+		GitHubUploadURL:     getenv("GITHUB_UPLOAD_URL"),
+		GitHubWebURL:        getenv("GITHUB_WEB_URL"),
+		GitHubAPIVersion:    getenv("GITHUB_API_VERSION"),
+		Secret:              getenv("LFSWATCHDOG_SECRET"),
+		AppID:               getenv("GITHUB_APP_ID"),
+		PrivateKeyFile:      getenv("GITHUB_APP_PRIVATE_KEY_FILE"),
+		Port:                getenv("LFSWATCHDOG_PORT"),
+		Path:                getenv("LFSWATCHDOG_PATH"),
+		LookupsPerCommit:    getenv("LFSWATCHDOG_LOOKUPS_PER_COMMIT"),
+		MaxLookups:          getenv("LFSWATCHDOG_MAX_LOOKUPS"),
+		AuditLogFile:        getenv("LFSWATCHDOG_AUDIT_LOG"),
+		RedactEmails:        getenv("LFSWATCHDOG_REDACT_EMAILS"),
+		LogPayloads:         getenv("LFSWATCHDOG_LOG_PAYLOADS"),
+		SyncDeliveries:      getenv("LFSWATCHDOG_SYNC_DELIVERIES"),
+		CanaryRepo:          getenv("LFSWATCHDOG_CANARY_REPO"),
+		CanaryInstallation:  getenv("LFSWATCHDOG_CANARY_INSTALLATION"),
+		CanaryRef:           getenv("LFSWATCHDOG_CANARY_REF"),
+		CanaryFile:          getenv("LFSWATCHDOG_CANARY_FILE"),
+		CanaryInterval:      getenv("LFSWATCHDOG_CANARY_INTERVAL"),
+		Replicas:            getenv("LFSWATCHDOG_REPLICAS"),
+		Replica:             getenv("LFSWATCHDOG_REPLICA"),
+		DrainDelay:          getenv("LFSWATCHDOG_DRAIN_DELAY"),
+		JobDir:              getenv("LFSWATCHDOG_JOB_DIR"),
+		Store:               getenv("LFSWATCHDOG_STORE"),
+		MaxPendingPushes:    getenv("LFSWATCHDOG_MAX_PENDING_PUSHES"),
+		MaxCommitsPerPush:   getenv("LFSWATCHDOG_MAX_COMMITS_PER_PUSH"),
+		LatencySLO:          getenv("LFSWATCHDOG_LATENCY_SLO"),
+		LatencyAlertURL:     getenv("LFSWATCHDOG_LATENCY_ALERT_URL"),
+		HelpContact:         getenv("LFSWATCHDOG_HELP_CONTACT"),
+		CommentSignature:    getenv("LFSWATCHDOG_COMMENT_SIGNATURE"),
+		AttributesTemplate:  getenv("LFSWATCHDOG_ATTRIBUTES_TEMPLATE"),
+		Tenants:             getenv("LFSWATCHDOG_TENANTS"),
+		PublicURL:           getenv("LFSWATCHDOG_PUBLIC_URL"),
+		GracePeriod:         getenv("LFSWATCHDOG_GRACE_PERIOD"),
+		CheckTimeout:        getenv("LFSWATCHDOG_CHECK_TIMEOUT"),
+		ConfigTTL:           getenv("LFSWATCHDOG_CONFIG_TTL"),
+		AdminToken:          getenv("LFSWATCHDOG_ADMIN_TOKEN"),
+		Debug:               getenv("LFSWATCHDOG_DEBUG"),
+		MetricsRepoLimit:    getenv("LFSWATCHDOG_METRICS_REPO_LIMIT"),
+		StatsDAddr:          getenv("LFSWATCHDOG_STATSD_ADDR"),
+		StatsDFormat:        getenv("LFSWATCHDOG_STATSD_FORMAT"),
+		TelemetryURL:        getenv("LFSWATCHDOG_TELEMETRY_URL"),
+		TelemetryInterval:   getenv("LFSWATCHDOG_TELEMETRY_INTERVAL"),
+		TelemetryDeployment: getenv("LFSWATCHDOG_TELEMETRY_DEPLOYMENT"),
+		Version:             version,
+	}
+}
+
+// Print all rules, or the explanation of the given rules
+func explain(rules []string) {
+	if len(rules) == 0 {
+		for _, rule := range watchdog.Rules() {
+			fmt.Printf("%s\t%s\n", rule, rule.Summary)
+		}
+		return
+	}
+
+	for _, id := range rules {
+		rule, ok := watchdog.LookupRule(id)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown rule '%s'\n", id)
+			os.Exit(1)
+		}
+		fmt.Println(rule.Explain())
+	}
+}
+
+// Print the comment a push of sample files would get with a repository
+// configuration
+func preview(args []string) {
+	flags := flag.NewFlagSet("preview", flag.ExitOnError)
+	configFile := flags.String("config", "", "`.github/watchdog.yml` file, the defaults are used if unset")
+	files := flags.String("files", "", "comma separated `paths` of the pushed files, each optionally followed by ':' and its size in bytes")
+	author := flags.String("author", "octocat", "`login` of the commit author")
+	flags.Parse(args)
+
+	config := watchdog.DefaultConfig()
+	if *configFile != "" {
+		content, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read the configuration: %v\n", err)
+			os.Exit(1)
+		}
+		config, err = watchdog.ParseConfig(content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+			os.Exit(1)
+		}
+		if len(config.Extends) > 0 {
+			fmt.Fprintf(os.Stderr, "the configurations in extends are not read by previews\n")
+		}
+	}
+
+	var samples []watchdog.PreviewFile
+	for _, file := range strings.Split(*files, ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		sample := watchdog.PreviewFile{Path: file}
+		if i := strings.LastIndex(file, ":"); i >= 0 {
+			if size, err := strconv.Atoi(file[i+1:]); err == nil {
+				sample = watchdog.PreviewFile{Path: file[:i], Size: size}
+			}
+		}
+		samples = append(samples, sample)
+	}
+	if len(samples) == 0 {
+		fmt.Fprintf(os.Stderr, "set the pushed files with --files\n")
+		os.Exit(2)
+	}
+
+	comment, err := watchdog.PreviewComment(config, samples, *author)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not render the comment: %v\n", err)
+		os.Exit(1)
+	}
+	if comment == "" {
+		fmt.Fprintf(os.Stderr, "none of the files would be commented on\n")
+		return
+	}
+	fmt.Println(comment)
+}
+
+// Copy the persisted state from one store to another, e.g. when a
+// deployment outgrows SQLite. The schema of both stores is migrated first.
+func migrateStore(args []string) {
+	flags := flag.NewFlagSet("migrate-store", flag.ExitOnError)
+	from := flags.String("from", "", "`URL` of the store to copy from")
+	to := flags.String("to", "", "`URL` of the store to copy to")
+	flags.Parse(args)
+	if *from == "" || *to == "" {
+		fmt.Fprintf(os.Stderr, "set both stores with --from and --to\n")
+		os.Exit(2)
+	}
+
+	src, err := store.Open(*from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open the store to copy from: %v\n", err)
+		os.Exit(1)
+	}
+	defer src.Close()
+	dst, err := store.Open(*to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open the store to copy to: %v\n", err)
+		os.Exit(1)
+	}
+	defer dst.Close()
+
+	copied, err := store.Copy(context.Background(), dst, src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "copied %d items before failing: %v\n", copied, err)
+		os.Exit(1)
+	}
+	fmt.Printf("copied %d items\n", copied)
 }
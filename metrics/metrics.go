@@ -0,0 +1,337 @@
+// Package metrics collects counters, gauges and histograms and exposes them
+// in the Prometheus text exposition format. Updates can additionally be
+// pushed to sinks like StatsD.
+//
+// Metrics are registered in a process wide registry when they are created,
+// typically as package level variables:
+//
+//	var requests = metrics.NewCounter("lfswatchdog_requests_total", "Webhook requests.", "event")
+//
+//	requests.Inc("push")
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets suitable for latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+type registry struct {
+	sync.Mutex
+	metrics map[string]*metric
+}
+
+var defaultRegistry = &registry{metrics: make(map[string]*metric)}
+
+// metric is a family of time series sharing a name and label names
+type metric struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// Histograms only
+	counts []uint64
+	count  uint64
+}
+
+func register(name, help string, k kind, buckets []float64, labels []string) *metric {
+	defaultRegistry.Lock()
+	defer defaultRegistry.Unlock()
+
+	if m, ok := defaultRegistry.metrics[name]; ok {
+		if m.kind != k {
+			panic(fmt.Sprintf("metric %s registered twice with different types", name))
+		}
+		return m
+	}
+	m := &metric{
+		name:    name,
+		help:    help,
+		kind:    k,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	defaultRegistry.metrics[name] = m
+	return m
+}
+
+// Look up or create the series for the label values. The caller must hold
+// the metric lock.
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if m.kind == histogramKind {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Remove the series whose label has value
+func (m *metric) deleteSeries(label, value string) {
+	i := 0
+	for ; i < len(m.labels) && m.labels[i] != label; i++ {
+	}
+	if i == len(m.labels) {
+		panic(fmt.Sprintf("metric %s has no label %s", m.name, label))
+	}
+	m.Lock()
+	defer m.Unlock()
+	for key, s := range m.series {
+		if s.labelValues[i] == value {
+			delete(m.series, key)
+		}
+	}
+}
+
+// Tag is a label name and value of a metric update
+type Tag struct {
+	Name  string
+	Value string
+}
+
+func (m *metric) tags(labelValues []string) []Tag {
+	tags := make([]Tag, len(m.labels))
+	for i, name := range m.labels {
+		tags[i] = Tag{name, labelValues[i]}
+	}
+	return tags
+}
+
+// Sink receives every metric update in addition to the Prometheus
+// registry, e.g. to push metrics to StatsD
+type Sink interface {
+	// Count is called with the increment of a counter
+	Count(name string, v float64, tags []Tag)
+	// Gauge is called with the new value of a gauge
+	Gauge(name string, v float64, tags []Tag)
+	// Histogram is called with an observation
+	Histogram(name string, v float64, tags []Tag)
+}
+
+var (
+	sinksMu sync.RWMutex
+	sinks   []Sink
+)
+
+// AddSink registers a sink for all subsequent updates
+func AddSink(s Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks = append(sinks, s)
+}
+
+// Unregister a sink, e.g. at the end of a test
+func removeSink(s Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for i, sink := range sinks {
+		if sink == s {
+			sinks = append(sinks[:i:i], sinks[i+1:]...)
+			return
+		}
+	}
+}
+
+func forEachSink(fn func(Sink)) {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	for _, s := range sinks {
+		fn(s)
+	}
+}
+
+// Counter is a monotonically increasing value per label combination
+type Counter struct{ m *metric }
+
+// NewCounter registers a counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{register(name, help, counterKind, nil, labels)}
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter by v
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.m.Lock()
+	c.m.get(labelValues).value += v
+	c.m.Unlock()
+	forEachSink(func(s Sink) { s.Count(c.m.name, v, c.m.tags(labelValues)) })
+}
+
+// Delete removes the series whose label has value from the registry, e.g.
+// once the value no longer gets its own label. Sinks keep their state.
+func (c *Counter) Delete(label, value string) {
+	c.m.deleteSeries(label, value)
+}
+
+// Gauge is a value that can go up and down per label combination
+type Gauge struct{ m *metric }
+
+// NewGauge registers a gauge with the given label names
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{register(name, help, gaugeKind, nil, labels)}
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.Lock()
+	g.m.get(labelValues).value = v
+	g.m.Unlock()
+	forEachSink(func(s Sink) { s.Gauge(g.m.name, v, g.m.tags(labelValues)) })
+}
+
+// Add changes the gauge by v
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.Lock()
+	s := g.m.get(labelValues)
+	s.value += v
+	value := s.value
+	g.m.Unlock()
+	forEachSink(func(s Sink) { s.Gauge(g.m.name, value, g.m.tags(labelValues)) })
+}
+
+// Histogram counts observations in buckets per label combination
+type Histogram struct{ m *metric }
+
+// NewHistogram registers a histogram with the given upper bounds and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{register(name, help, histogramKind, buckets, labels)}
+}
+
+// Observe records v
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.Lock()
+	s := h.m.get(labelValues)
+	for i, upper := range h.m.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+	h.m.Unlock()
+	forEachSink(func(s Sink) { s.Histogram(h.m.name, v, h.m.tags(labelValues)) })
+}
+
+// Delete removes the series whose label has value, like Counter.Delete
+func (h *Histogram) Delete(label, value string) {
+	h.m.deleteSeries(label, value)
+}
+
+// Write writes all metrics in the Prometheus text exposition format
+func Write(w io.Writer) error {
+	defaultRegistry.Lock()
+	names := make([]string, 0, len(defaultRegistry.metrics))
+	for name := range defaultRegistry.metrics {
+		names = append(names, name)
+	}
+	defaultRegistry.Unlock()
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		defaultRegistry.Lock()
+		m := defaultRegistry.metrics[name]
+		defaultRegistry.Unlock()
+		m.write(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (m *metric) write(b *strings.Builder) {
+	m.Lock()
+	defer m.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != histogramKind {
+			fmt.Fprintf(b, "%s%s %s\n", m.name, m.labelString(s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+		for i, upper := range m.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labelString(s.labelValues, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labelString(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", m.name, m.labelString(s.labelValues, "", ""), formatFloat(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", m.name, m.labelString(s.labelValues, "", ""), s.count)
+	}
+}
+
+func (m *metric) labelString(values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range m.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, values[i]))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// Handler serves all metrics for Prometheus to scrape
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// StatsD is a sink that sends every update to a StatsD server over UDP.
+//
+// With DogStatsD, labels are sent as tags. Plain StatsD has no tags, so the
+// label values are appended to the metric name instead, e.g.
+// "lfswatchdog_cache_hits_total.authors". Plain StatsD has no histograms
+// either, so observations are sent as timers in milliseconds, assuming
+// they are durations in seconds.
+type StatsD struct {
+	conn      net.Conn
+	prefix    string
+	dogStatsD bool
+}
+
+// NewStatsD creates a sink for the StatsD server at addr ("host:port").
+// prefix is prepended to all metric names.
+func NewStatsD(addr, prefix string, dogStatsD bool) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsD{conn: conn, prefix: prefix, dogStatsD: dogStatsD}, nil
+}
+
+func (s *StatsD) Count(name string, v float64, tags []Tag) {
+	s.send(name, formatFloat(v), "c", tags)
+}
+
+func (s *StatsD) Gauge(name string, v float64, tags []Tag) {
+	s.send(name, formatFloat(v), "g", tags)
+}
+
+func (s *StatsD) Histogram(name string, v float64, tags []Tag) {
+	if s.dogStatsD {
+		s.send(name, formatFloat(v), "h", tags)
+		return
+	}
+	s.send(name, formatFloat(v*1000), "ms", tags)
+}
+
+// Close closes the connection
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsD) send(name, value, statsdType string, tags []Tag) {
+	var b strings.Builder
+	b.WriteString(s.prefix)
+	b.WriteString(name)
+	if !s.dogStatsD {
+		for _, tag := range tags {
+			b.WriteString(".")
+			b.WriteString(sanitize(tag.Value))
+		}
+	}
+	fmt.Fprintf(&b, ":%s|%s", value, statsdType)
+	if s.dogStatsD && len(tags) > 0 {
+		pairs := make([]string, len(tags))
+		for i, tag := range tags {
+			pairs[i] = tag.Name + ":" + sanitize(tag.Value)
+		}
+		b.WriteString("|#")
+		b.WriteString(strings.Join(pairs, ","))
+	}
+
+	// Metrics are best effort, a lost packet must not affect the watchdog
+	s.conn.Write([]byte(b.String()))
+}
+
+// Replaces characters with special meaning in the StatsD line protocol
+var sanitizer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "@", "_", "\n", "_")
+
+func sanitize(value string) string {
+	return sanitizer.Replace(value)
+}
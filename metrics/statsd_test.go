@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	return string(buf[:n])
+}
+
+func TestStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	dog, err := NewStatsD(conn.LocalAddr().String(), "", true)
+	assert.Nil(t, err)
+	defer dog.Close()
+	plain, err := NewStatsD(conn.LocalAddr().String(), "ops.", false)
+	assert.Nil(t, err)
+	defer plain.Close()
+
+	tags := []Tag{{"cache", "authors"}, {"repo", "org/repo:x"}}
+
+	dog.Count("lfswatchdog_cache_hits_total", 1, tags)
+	assert.Equal(t, "lfswatchdog_cache_hits_total:1|c|#cache:authors,repo:org/repo_x", receive(t, conn))
+	dog.Histogram("lfswatchdog_check_seconds", 0.25, nil)
+	assert.Equal(t, "lfswatchdog_check_seconds:0.25|h", receive(t, conn))
+
+	plain.Gauge("lfswatchdog_cache_entries", 3, tags[:1])
+	assert.Equal(t, "ops.lfswatchdog_cache_entries.authors:3|g", receive(t, conn))
+	plain.Histogram("lfswatchdog_check_seconds", 0.25, nil)
+	assert.Equal(t, "ops.lfswatchdog_check_seconds:250|ms", receive(t, conn))
+}
+
+type recordingSink struct {
+	gauges []float64
+}
+
+func (r *recordingSink) Count(name string, v float64, tags []Tag)     {}
+func (r *recordingSink) Histogram(name string, v float64, tags []Tag) {}
+func (r *recordingSink) Gauge(name string, v float64, tags []Tag) {
+	if name == "lfswatchdog_test_sink_gauge" {
+		r.gauges = append(r.gauges, v)
+	}
+}
+
+func TestSink(t *testing.T) {
+	sink := &recordingSink{}
+	AddSink(sink)
+	t.Cleanup(func() { removeSink(sink) })
+
+	g := NewGauge("lfswatchdog_test_sink_gauge", "Test gauge.")
+	g.Set(2)
+	g.Add(3)
+
+	// Sinks receive the absolute value of gauges
+	assert.Equal(t, []float64{2, 5}, sink.gauges)
+}
@@ -0,0 +1,155 @@
+// Package ratebudget shares the GitHub API rate limit of each installation
+// between webhook traffic and background jobs such as organization audits.
+//
+// The remaining budget is recorded from the rate limit headers of every
+// response. Background jobs call Wait before issuing API calls, which holds
+// them back while the budget is down to the reserve kept for pushes, and
+// while pushes are being checked.
+package ratebudget
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+)
+
+const (
+	// Share of the rate limit that background jobs leave to webhook traffic
+	reserve = 0.2
+	// Background jobs yield to pushes in steps of liveYield, but for at
+	// most maxLiveDeferral per call so that they still progress under
+	// constant traffic
+	liveYield       = 100 * time.Millisecond
+	maxLiveDeferral = 2 * time.Second
+)
+
+var throttled = metrics.NewCounter("lfswatchdog_background_throttled_total", "API calls of background jobs that were held back.", "reason")
+
+// Budget is the last known rate limit of an installation
+type Budget struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+var budgets = struct {
+	sync.Mutex
+	byInstallation map[int64]Budget
+	live           func() int
+}{byInstallation: make(map[int64]Budget)}
+
+// SetLiveTraffic registers a function that returns the number of pushes
+// being checked, which background jobs defer to
+func SetLiveTraffic(live func() int) {
+	budgets.Lock()
+	defer budgets.Unlock()
+	budgets.live = live
+}
+
+// Get returns the last known budget of an installation
+func Get(installationID int64) (Budget, bool) {
+	budgets.Lock()
+	defer budgets.Unlock()
+	budget, ok := budgets.byInstallation[installationID]
+	return budget, ok
+}
+
+// Observe records the rate limit headers of a response to a request of an
+// installation. Responses without them are ignored.
+func Observe(installationID int64, header http.Header) {
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	budgets.Lock()
+	defer budgets.Unlock()
+	budgets.byInstallation[installationID] = Budget{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+}
+
+// Transport records the rate limit of every response of an installation
+func Transport(base http.RoundTripper, installationID int64) http.RoundTripper {
+	return &transport{base, installationID}
+}
+
+type transport struct {
+	base           http.RoundTripper
+	installationID int64
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		Observe(t.installationID, resp.Header)
+	}
+	return resp, err
+}
+
+// Wait blocks a background job of an installation until its budget is
+// above the reserve, or the rate limit was reset, and briefly while pushes
+// are being checked. It returns early with the error of ctx.
+func Wait(ctx context.Context, installationID int64) error {
+	if reset, ok := exhausted(installationID, time.Now()); ok {
+		throttled.Inc("rate_limit")
+		if err := sleep(ctx, time.Until(reset)); err != nil {
+			return err
+		}
+	}
+
+	deferred := time.Duration(0)
+	for deferred < maxLiveDeferral && liveTraffic() > 0 {
+		if deferred == 0 {
+			throttled.Inc("live_traffic")
+		}
+		if err := sleep(ctx, liveYield); err != nil {
+			return err
+		}
+		deferred += liveYield
+	}
+	return ctx.Err()
+}
+
+// Return when the rate limit of an installation resets, if its remaining
+// budget is down to the reserve
+func exhausted(installationID int64, now time.Time) (time.Time, bool) {
+	budgets.Lock()
+	defer budgets.Unlock()
+	budget, ok := budgets.byInstallation[installationID]
+	if !ok || !budget.Reset.After(now) {
+		return time.Time{}, false
+	}
+	return budget.Reset, float64(budget.Remaining) <= reserve*float64(budget.Limit)
+}
+
+func liveTraffic() int {
+	budgets.Lock()
+	live := budgets.live
+	budgets.Unlock()
+	if live == nil {
+		return 0
+	}
+	return live()
+}
+
+// Waits unless ctx is done, replaced in tests
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
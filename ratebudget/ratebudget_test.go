@@ -0,0 +1,98 @@
+package ratebudget
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Record the sleeps of Wait instead of sleeping
+func fakeSleep(t *testing.T) *[]time.Duration {
+	var slept []time.Duration
+	original := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { sleep = original })
+	return &slept
+}
+
+func rateLimitHeader(limit, remaining int, reset time.Time) http.Header {
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return header
+}
+
+func TestTransport(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range rateLimitHeader(5000, 4999, reset) {
+			w.Header()[name] = values
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport(http.DefaultTransport, 11)}
+	resp, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	budget, ok := Get(11)
+	assert.True(t, ok)
+	assert.Equal(t, Budget{Limit: 5000, Remaining: 4999, Reset: reset}, budget)
+
+	// Responses without rate limit headers keep the last budget
+	Observe(11, http.Header{})
+	budget, _ = Get(11)
+	assert.Equal(t, 4999, budget.Remaining)
+}
+
+func TestWaitForReset(t *testing.T) {
+	slept := fakeSleep(t)
+	reset := time.Now().Add(time.Hour)
+
+	// Unknown installations and budgets above the reserve don't wait
+	assert.Nil(t, Wait(context.Background(), 21))
+	Observe(21, rateLimitHeader(5000, 1001, reset))
+	assert.Nil(t, Wait(context.Background(), 21))
+	assert.Empty(t, *slept)
+
+	Observe(21, rateLimitHeader(5000, 1000, reset))
+	assert.Nil(t, Wait(context.Background(), 21))
+	if assert.Len(t, *slept, 1) {
+		assert.InDelta(t, time.Hour.Seconds(), (*slept)[0].Seconds(), 5)
+	}
+
+	// Budgets whose reset passed are replenished
+	Observe(21, rateLimitHeader(5000, 0, time.Now().Add(-time.Second)))
+	assert.Nil(t, Wait(context.Background(), 21))
+	assert.Len(t, *slept, 1)
+}
+
+func TestWaitForLiveTraffic(t *testing.T) {
+	slept := fakeSleep(t)
+	live := 1
+	SetLiveTraffic(func() int { return live })
+	defer SetLiveTraffic(nil)
+
+	// Background jobs still progress under constant traffic
+	assert.Nil(t, Wait(context.Background(), 31))
+	assert.Len(t, *slept, int(maxLiveDeferral/liveYield))
+
+	live = 0
+	*slept = nil
+	assert.Nil(t, Wait(context.Background(), 31))
+	assert.Empty(t, *slept)
+
+	live = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, Wait(ctx, 31))
+}
@@ -0,0 +1,80 @@
+// Package redact masks sensitive values before they are logged.
+//
+// Webhook secrets and private key paths are registered at startup with
+// AddValue. Installation tokens are short lived and therefore matched by
+// pattern. Email addresses are masked unless disabled with RedactEmails.
+package redact
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mask replaces redacted values
+const Mask = "[REDACTED]"
+
+var (
+	// GitHub tokens (ghs_... and the legacy v1.<hex> installation tokens)
+	tokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9_]{36,}|v1\.[0-9a-f]{40})\b`)
+	// Credentials in Authorization headers, e.g. JWTs
+	authPattern  = regexp.MustCompile(`(?i)\b(token|bearer) [A-Za-z0-9_.\-]{20,}`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+)
+
+var (
+	mu     sync.RWMutex
+	values []string
+	emails = true
+)
+
+// AddValue registers a value that must never be logged. Empty values are ignored.
+func AddValue(value string) {
+	if value == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	values = append(values, value)
+}
+
+// RedactEmails turns the masking of email addresses on or off
+func RedactEmails(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	emails = enabled
+}
+
+// String masks all sensitive values in s
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, value := range values {
+		s = strings.Replace(s, value, Mask, -1)
+	}
+	s = tokenPattern.ReplaceAllString(s, Mask)
+	s = authPattern.ReplaceAllString(s, "$1 "+Mask)
+	if emails {
+		s = emailPattern.ReplaceAllString(s, Mask)
+	}
+	return s
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// Writer returns a writer that masks sensitive values before writing to w.
+// It is meant for log.SetOutput, which writes one entry per call.
+func Writer(w io.Writer) io.Writer {
+	return &writer{w}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
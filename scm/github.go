@@ -0,0 +1,619 @@
+package scm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// notFoundError marks a 404 response as ErrNotFound and keeps the
+// original error for errors.As
+type notFoundError struct {
+	err error
+}
+
+func (e *notFoundError) Error() string { return e.err.Error() }
+
+func (e *notFoundError) Unwrap() error { return e.err }
+
+func (e *notFoundError) Is(target error) bool { return target == ErrNotFound }
+
+// rateLimitedError marks a rate limit error as ErrRateLimited and keeps
+// the original error for errors.As, e.g. by RateLimitReset
+type rateLimitedError struct {
+	err error
+}
+
+func (e *rateLimitedError) Error() string { return e.err.Error() }
+
+func (e *rateLimitedError) Unwrap() error { return e.err }
+
+func (e *rateLimitedError) Is(target error) bool { return target == ErrRateLimited }
+
+// Mark errors of the GitHub API with the error kinds of this package
+func wrapError(err error) error {
+	var errorResponse *github.ErrorResponse
+	if errors.As(err, &errorResponse) && errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusNotFound {
+		return &notFoundError{err}
+	}
+	if _, limited := RateLimitReset(err); limited {
+		return &rateLimitedError{err}
+	}
+	return err
+}
+
+// RateLimitReset returns the time at which a request that failed with err
+// can be retried, if err is a rate limit error
+func RateLimitReset(err error) (time.Time, bool) {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.Rate.Reset.Time, true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return time.Now().Add(*abuseErr.RetryAfter), true
+		}
+		return time.Now().Add(time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// GitHub implements Client with github.com/google/go-github
+type GitHub struct {
+	client *github.Client
+	webURL string
+}
+
+// NewGitHub wraps a go-github client. The web URL is derived from the
+// client's API URL, use WithWebURL if that's not possible.
+func NewGitHub(client *github.Client) *GitHub {
+	return &GitHub{client: client, webURL: WebURL(client.BaseURL)}
+}
+
+// WithWebURL sets the web URL, e.g. "https://github.example.com/"
+func (g *GitHub) WithWebURL(webURL string) *GitHub {
+	g.webURL = strings.TrimSuffix(webURL, "/") + "/"
+	return g
+}
+
+// WebURL derives the web URL from an API URL, i.e. "https://host/api/v3/"
+// or "https://api.host/" with subdomain isolation
+func WebURL(apiURL *url.URL) string {
+	web := *apiURL
+	web.Path = strings.TrimSuffix(strings.TrimSuffix(web.Path, "/"), "/api/v3") + "/"
+	web.Host = strings.TrimPrefix(web.Host, "api.")
+	return web.String()
+}
+
+func (g *GitHub) GetFileContent(ctx context.Context, owner, repo, ref, path string) (string, error) {
+	fileContent, _, _, err := g.client.Repositories.GetContents(
+		ctx,
+		owner,
+		repo,
+		path,
+		&github.RepositoryContentGetOptions{Ref: ref},
+	)
+
+	if err != nil {
+		return "", wrapError(err)
+	}
+
+	if fileContent == nil {
+		return "", fmt.Errorf("unexpected missing content for file %s at sha %s", path, ref)
+	}
+
+	return fileContent.GetContent()
+}
+
+// GetFileContentIfNoneMatch sends etag with If-None-Match, which GitHub
+// answers with 304 Not Modified if the content did not change
+func (g *GitHub) GetFileContentIfNoneMatch(ctx context.Context, owner, repo, ref, path, etag string) (string, string, error) {
+	escapedPath := (&url.URL{Path: strings.TrimSuffix(path, "/")}).String()
+	u := fmt.Sprintf("repos/%s/%s/contents/%s?ref=%s", owner, repo, escapedPath, url.QueryEscape(ref))
+	req, err := g.client.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	fileContent := new(github.RepositoryContent)
+	resp, err := g.client.Do(ctx, req, fileContent)
+	if resp != nil && resp.StatusCode == http.StatusNotModified {
+		return "", etag, ErrNotModified
+	}
+	if err != nil {
+		return "", "", wrapError(err)
+	}
+	if fileContent.GetType() != "file" {
+		return "", "", fmt.Errorf("unexpected missing content for file %s at sha %s", path, ref)
+	}
+	content, err := fileContent.GetContent()
+	return content, resp.Header.Get("ETag"), err
+}
+
+func (g *GitHub) GetDirContent(ctx context.Context, owner, repo, ref, path string) ([]*Entry, error) {
+	_, dirContent, _, err := g.client.Repositories.GetContents(
+		ctx,
+		owner,
+		repo,
+		path,
+		&github.RepositoryContentGetOptions{Ref: ref},
+	)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if dirContent == nil {
+		return nil, nil
+	}
+
+	entries := make([]*Entry, 0, len(dirContent))
+	for _, c := range dirContent {
+		entries = append(entries, &Entry{
+			Name: c.GetName(),
+			Path: c.GetPath(),
+			Type: c.GetType(),
+			SHA:  c.GetSHA(),
+			Size: c.GetSize(),
+		})
+	}
+	return entries, nil
+}
+
+// GetRawSize requests the raw media type of the contents API with HEAD, so
+// that GitHub reports the size of the blob but doesn't send it
+func (g *GitHub) GetRawSize(ctx context.Context, owner, repo, ref, path string) (int, error) {
+	escapedPath := (&url.URL{Path: strings.TrimSuffix(path, "/")}).String()
+	u := fmt.Sprintf("repos/%s/%s/contents/%s?ref=%s", owner, repo, escapedPath, url.QueryEscape(ref))
+	req, err := g.client.NewRequest(http.MethodHead, u, nil)
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3.raw")
+	resp, err := g.client.Do(ctx, req, nil)
+	if err != nil {
+		return -1, wrapError(err)
+	}
+	if resp.ContentLength < 0 {
+		return -1, fmt.Errorf("no content length for '%s' at '%s'", path, ref)
+	}
+	return int(resp.ContentLength), nil
+}
+
+func (g *GitHub) GetTree(ctx context.Context, owner, repo, sha string, recursive bool) (*Tree, error) {
+	tree, _, err := g.client.Git.GetTree(ctx, owner, repo, sha, recursive)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	result := &Tree{
+		SHA:       tree.GetSHA(),
+		Truncated: tree.GetTruncated(),
+	}
+	for _, e := range tree.Entries {
+		result.Entries = append(result.Entries, &Entry{
+			Name: e.GetPath(),
+			Path: e.GetPath(),
+			Type: treeEntryType(e),
+			SHA:  e.GetSHA(),
+			Size: e.GetSize(),
+		})
+	}
+	return result, nil
+}
+
+// Map Git tree entries to the types used by the contents API
+func treeEntryType(e *github.TreeEntry) string {
+	switch {
+	case e.GetMode() == "120000":
+		return "symlink"
+	case e.GetType() == "commit":
+		return "submodule"
+	case e.GetType() == "tree":
+		return "dir"
+	default:
+		return "file"
+	}
+}
+
+// GetCommit lists at most 300 changed files, like the push event payload.
+// GitHub answers requests for unknown SHAs with 422 "No commit found for
+// SHA", which yields errors matching ErrNotFound like missing repositories.
+// Other validation errors are GitHub's.
+// c.f. https://docs.github.com/en/rest/commits/commits#get-a-commit
+func (g *GitHub) GetCommit(ctx context.Context, owner, repo, sha string) (*Commit, error) {
+	c, _, err := g.client.Repositories.GetCommit(ctx, owner, repo, sha)
+	var errorResponse *github.ErrorResponse
+	if errors.As(err, &errorResponse) && errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusUnprocessableEntity &&
+		strings.HasPrefix(errorResponse.Message, "No commit found") {
+		return nil, &notFoundError{err}
+	}
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	commit := &Commit{
+		SHA:         c.GetSHA(),
+		Author:      c.GetAuthor().GetLogin(),
+		AuthorEmail: c.GetCommit().GetAuthor().GetEmail(),
+	}
+	for _, f := range c.Files {
+		commit.addFile(f)
+	}
+	return commit, nil
+}
+
+// Sort a changed file into the added, modified and removed files. Renamed
+// files are removed under their old name and added under the new one.
+func (commit *Commit) addFile(f *github.CommitFile) {
+	switch f.GetStatus() {
+	case "removed":
+		commit.Removed = append(commit.Removed, f.GetFilename())
+	case "renamed":
+		commit.Removed = append(commit.Removed, f.GetPreviousFilename())
+		commit.Added = append(commit.Added, f.GetFilename())
+	case "added", "copied":
+		commit.Added = append(commit.Added, f.GetFilename())
+	default:
+		commit.Modified = append(commit.Modified, f.GetFilename())
+	}
+}
+
+func (g *GitHub) CompareCommits(ctx context.Context, owner, repo, base, head string) ([]string, int, error) {
+	comparison, _, err := g.client.Repositories.CompareCommits(ctx, owner, repo, base, head)
+	if err != nil {
+		return nil, 0, wrapError(err)
+	}
+	shas := make([]string, 0, len(comparison.Commits))
+	for _, c := range comparison.Commits {
+		shas = append(shas, c.GetSHA())
+	}
+	return shas, comparison.GetTotalCommits(), nil
+}
+
+func (g *GitHub) ListPullRequestFiles(ctx context.Context, owner, repo string, number int) (*Commit, error) {
+	pr, _, err := g.client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	commit := &Commit{SHA: pr.GetHead().GetSHA(), Author: pr.GetUser().GetLogin()}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		files, resp, err := g.client.PullRequests.ListFiles(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for _, f := range files {
+			commit.addFile(f)
+		}
+		if resp.NextPage == 0 {
+			return commit, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GitHub reports whether a pull request is mergeable as null until it
+// created the merge commit
+// c.f. https://docs.github.com/en/rest/guides/using-the-rest-api-to-interact-with-your-git-database#checking-mergeability-of-pull-requests
+func (g *GitHub) GetPullRequestMergeCommit(ctx context.Context, owner, repo string, number int) (string, error) {
+	pr, _, err := g.client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	if !pr.GetMergeable() {
+		return "", nil
+	}
+	return pr.GetMergeCommitSHA(), nil
+}
+
+func (g *GitHub) CreateComment(ctx context.Context, owner, repo, sha, body string) (int64, error) {
+	comment, _, err := g.client.Repositories.CreateComment(
+		ctx,
+		owner,
+		repo,
+		sha,
+		&github.RepositoryComment{Body: &body},
+	)
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	return comment.GetID(), nil
+}
+
+func (g *GitHub) UpdateComment(ctx context.Context, owner, repo string, id int64, body string) error {
+	_, _, err := g.client.Repositories.UpdateComment(ctx, owner, repo, id, &github.RepositoryComment{Body: &body})
+	return wrapError(err)
+}
+
+func (g *GitHub) CreateStatus(ctx context.Context, owner, repo, sha string, status *Status) error {
+	repoStatus := &github.RepoStatus{
+		Context:     &status.Context,
+		State:       &status.State,
+		Description: &status.Description,
+	}
+	if status.TargetURL != "" {
+		repoStatus.TargetURL = &status.TargetURL
+	}
+	_, _, err := g.client.Repositories.CreateStatus(ctx, owner, repo, sha, repoStatus)
+	return wrapError(err)
+}
+
+func (g *GitHub) CreateCheckRun(ctx context.Context, owner, repo string, run *CheckRun) error {
+	completed := "completed"
+	now := github.Timestamp{Time: time.Now()}
+	opts := github.CreateCheckRunOptions{
+		Name:        run.Name,
+		HeadSHA:     run.HeadSHA,
+		Status:      &completed,
+		Conclusion:  &run.Conclusion,
+		CompletedAt: &now,
+		Output: &github.CheckRunOutput{
+			Title:   &run.Title,
+			Summary: &run.Summary,
+		},
+	}
+	if run.DetailsURL != "" {
+		opts.DetailsURL = &run.DetailsURL
+	}
+	if run.Text != "" {
+		opts.Output.Text = &run.Text
+	}
+	for _, a := range run.Annotations {
+		// Annotations require a line range; point at the top of the file
+		line := 1
+		path, level, title, message := a.Path, a.Level, a.Title, a.Message
+		opts.Output.Annotations = append(opts.Output.Annotations, &github.CheckRunAnnotation{
+			Path:            &path,
+			StartLine:       &line,
+			EndLine:         &line,
+			AnnotationLevel: &level,
+			Title:           &title,
+			Message:         &message,
+		})
+	}
+	for _, a := range run.Actions {
+		opts.Actions = append(opts.Actions, &github.CheckRunAction{Label: a.Label, Description: a.Description, Identifier: a.Identifier})
+	}
+	_, _, err := g.client.Checks.CreateCheckRun(ctx, owner, repo, opts)
+	return wrapError(err)
+}
+
+func (g *GitHub) GetStatuses(ctx context.Context, owner, repo, ref string) ([]*Status, error) {
+	var statuses []*Status
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		combined, resp, err := g.client.Repositories.GetCombinedStatus(ctx, owner, repo, ref, opts)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for _, s := range combined.Statuses {
+			statuses = append(statuses, &Status{
+				Context:     s.GetContext(),
+				State:       s.GetState(),
+				Description: s.GetDescription(),
+				TargetURL:   s.GetTargetURL(),
+			})
+		}
+		if resp.NextPage == 0 {
+			return statuses, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *GitHub) GetCheckRuns(ctx context.Context, owner, repo, ref, name string) ([]*CheckRun, error) {
+	result, _, err := g.client.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, &github.ListCheckRunsOptions{
+		CheckName:   &name,
+		ListOptions: github.ListOptions{PerPage: 100},
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	runs := make([]*CheckRun, 0, len(result.CheckRuns))
+	for _, r := range result.CheckRuns {
+		runs = append(runs, &CheckRun{
+			Name:       r.GetName(),
+			HeadSHA:    r.GetHeadSHA(),
+			Conclusion: r.GetConclusion(),
+			DetailsURL: r.GetDetailsURL(),
+			Title:      r.GetOutput().GetTitle(),
+			Summary:    r.GetOutput().GetSummary(),
+		})
+	}
+	return runs, nil
+}
+
+// ReviewDeployment posts the review to the callback URL, which must be on
+// the API host so that the installation token isn't sent elsewhere
+func (g *GitHub) ReviewDeployment(ctx context.Context, owner, repo string, review *DeploymentReview) error {
+	if !strings.HasPrefix(review.CallbackURL, g.client.BaseURL.String()) {
+		return fmt.Errorf("deployment callback URL '%s' is not on the API host", review.CallbackURL)
+	}
+	body := map[string]string{
+		"environment_name": review.Environment,
+		"state":            review.State,
+		"comment":          review.Comment,
+	}
+	req, err := g.client.NewRequest(http.MethodPost, review.CallbackURL, body)
+	if err != nil {
+		return err
+	}
+	_, err = g.client.Do(ctx, req, nil)
+	return wrapError(err)
+}
+
+func (g *GitHub) FileURL(owner, repo, ref, path string) string {
+	// Parentheses would end Markdown link destinations
+	escaper := strings.NewReplacer("(", "%28", ")", "%29")
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = escaper.Replace(url.PathEscape(segment))
+	}
+	return fmt.Sprintf("%s%s/%s/blob/%s/%s", g.webURL, owner, repo, ref, strings.Join(segments, "/"))
+}
+
+func (g *GitHub) FindUserByEmail(ctx context.Context, email string) (string, error) {
+	result, _, err := g.client.Search.Users(ctx, fmt.Sprintf("%s in:email", email), nil)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	if result.GetTotal() != 1 || len(result.Users) != 1 {
+		return "", nil
+	}
+	return result.Users[0].GetLogin(), nil
+}
+
+func (g *GitHub) TeamExists(ctx context.Context, org, slug string) (bool, error) {
+	_, _, err := g.client.Teams.GetTeamBySlug(ctx, org, slug)
+	if err == nil {
+		return true, nil
+	}
+	err = wrapError(err)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (g *GitHub) ListRepositories(ctx context.Context) ([]*Repository, error) {
+	var repos []*Repository
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := g.client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for _, r := range page.Repositories {
+			repos = append(repos, &Repository{
+				Owner:         r.GetOwner().GetLogin(),
+				Name:          r.GetName(),
+				DefaultBranch: r.GetDefaultBranch(),
+				Archived:      r.GetArchived(),
+			})
+		}
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *GitHub) GetBlob(ctx context.Context, owner, repo, sha string) ([]byte, error) {
+	content, _, err := g.client.Git.GetBlobRaw(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return content, nil
+}
+
+// GetBlobPrefix asks for a range of the raw blob and stops reading after n
+// bytes in case the range is ignored
+func (g *GitHub) GetBlobPrefix(ctx context.Context, owner, repo, sha string, n int) ([]byte, error) {
+	req, err := g.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/git/blobs/%s", owner, repo, sha), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3.raw")
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", n-1))
+	resp, err := g.client.BareDo(ctx, req)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(io.LimitReader(resp.Body, int64(n)))
+}
+
+func (g *GitHub) BranchExists(ctx context.Context, owner, repo, branch string) (bool, error) {
+	_, _, err := g.client.Git.GetRef(ctx, owner, repo, "heads/"+branch)
+	if err == nil {
+		return true, nil
+	}
+	err = wrapError(err)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return false, err
+}
+
+// CommitFiles creates the blobs with the tree, so that each file costs no
+// extra API request
+func (g *GitHub) CommitFiles(ctx context.Context, owner, repo string, change *Change) (string, error) {
+	parent, _, err := g.client.Git.GetCommit(ctx, owner, repo, change.Parent)
+	if err != nil {
+		return "", fmt.Errorf("could not get commit '%s': %w", change.Parent, wrapError(err))
+	}
+
+	paths := make([]string, 0, len(change.Files))
+	for p := range change.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	entries := make([]*github.TreeEntry, 0, len(paths))
+	for _, p := range paths {
+		entries = append(entries, &github.TreeEntry{
+			Path:    github.String(p),
+			Mode:    github.String("100644"),
+			Type:    github.String("blob"),
+			Content: github.String(change.Files[p]),
+		})
+	}
+	tree, _, err := g.client.Git.CreateTree(ctx, owner, repo, parent.GetTree().GetSHA(), entries)
+	if err != nil {
+		return "", fmt.Errorf("could not create tree: %w", wrapError(err))
+	}
+
+	commit, _, err := g.client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: &change.Message,
+		Tree:    &github.Tree{SHA: tree.SHA},
+		Parents: []*github.Commit{{SHA: &change.Parent}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create commit: %w", wrapError(err))
+	}
+
+	_, _, err = g.client.Git.CreateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + change.Branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create branch '%s': %w", change.Branch, wrapError(err))
+	}
+	return commit.GetSHA(), nil
+}
+
+func (g *GitHub) CreatePullRequest(ctx context.Context, owner, repo string, pr *PullRequest) (string, error) {
+	created, _, err := g.client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title: &pr.Title,
+		Body:  &pr.Body,
+		Head:  &pr.Head,
+		Base:  &pr.Base,
+		Draft: &pr.Draft,
+	})
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return created.GetHTMLURL(), nil
+}
+
+func (g *GitHub) CreateIssue(ctx context.Context, owner, repo, title, body string) (string, error) {
+	created, _, err := g.client.Issues.Create(ctx, owner, repo, &github.IssueRequest{
+		Title: &title,
+		Body:  &body,
+	})
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return created.GetHTMLURL(), nil
+}
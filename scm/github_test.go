@@ -0,0 +1,282 @@
+package scm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTree(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFileWithSize("test-org/test-repo", "abc123", "a/b/large.bin", 1234)
+	server.AddObject("test-org/test-repo", "abc123", "a/link", &githubtest.Object{Type: "symlink", Content: []byte("b")})
+	g := NewGitHub(server.Client())
+
+	tree, err := g.GetTree(context.Background(), "test-org", "test-repo", "abc123", true)
+	assert.Nil(t, err)
+	types := map[string]string{}
+	sizes := map[string]int{}
+	for _, e := range tree.Entries {
+		types[e.Path] = e.Type
+		sizes[e.Path] = e.Size
+	}
+	assert.Equal(t, map[string]string{"a": "dir", "a/b": "dir", "a/b/large.bin": "file", "a/link": "symlink"}, types)
+	assert.Equal(t, 1234, sizes["a/b/large.bin"])
+}
+
+func TestGetFileContentIfNoneMatch(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("test-org/test-repo", "main", ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\n"))
+	g := NewGitHub(server.Client())
+
+	content, etag, err := g.GetFileContentIfNoneMatch(context.Background(), "test-org", "test-repo", "main", ".github/watchdog.yml", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "lfsSizeThreshold: 1000\n", content)
+	assert.NotEmpty(t, etag)
+
+	_, same, err := g.GetFileContentIfNoneMatch(context.Background(), "test-org", "test-repo", "main", ".github/watchdog.yml", etag)
+	assert.True(t, errors.Is(err, ErrNotModified))
+	assert.Equal(t, etag, same)
+
+	server.AddFile("test-org/test-repo", "main", ".github/watchdog.yml", []byte("lfsSizeThreshold: 2000\n"))
+	content, changed, err := g.GetFileContentIfNoneMatch(context.Background(), "test-org", "test-repo", "main", ".github/watchdog.yml", etag)
+	assert.Nil(t, err)
+	assert.Equal(t, "lfsSizeThreshold: 2000\n", content)
+	assert.NotEqual(t, etag, changed)
+
+	_, _, err = g.GetFileContentIfNoneMatch(context.Background(), "test-org", "test-repo", "main", "missing.yml", etag)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestGetCommit(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddCommit("test-org/test-repo", &github.RepositoryCommit{
+		SHA:    github.String("abc123"),
+		Author: &github.User{Login: github.String("jdoe")},
+		Commit: &github.Commit{Author: &github.CommitAuthor{Email: github.String("jdoe@example.com")}},
+		Files: []*github.CommitFile{
+			{Filename: github.String("new.bin"), Status: github.String("added")},
+			{Filename: github.String("changed.bin"), Status: github.String("modified")},
+			{Filename: github.String("old.bin"), Status: github.String("removed")},
+			{Filename: github.String("moved.bin"), PreviousFilename: github.String("before.bin"), Status: github.String("renamed")},
+		},
+	})
+	g := NewGitHub(server.Client())
+
+	commit, err := g.GetCommit(context.Background(), "test-org", "test-repo", "abc123")
+	assert.Nil(t, err)
+	assert.Equal(t, &Commit{
+		SHA:         "abc123",
+		Author:      "jdoe",
+		AuthorEmail: "jdoe@example.com",
+		Added:       []string{"new.bin", "moved.bin"},
+		Modified:    []string{"changed.bin"},
+		Removed:     []string{"old.bin", "before.bin"},
+	}, commit)
+
+	// Unknown SHAs are answered with 422
+	_, err = g.GetCommit(context.Background(), "test-org", "test-repo", "def456")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// Other validation errors are not
+	server.InjectError("GET", "repos/test-org/test-repo/commits/", http.StatusUnprocessableEntity, 1)
+	_, err = g.GetCommit(context.Background(), "test-org", "test-repo", "abc123")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrNotFound))
+}
+
+func TestCompareCommits(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	repo := "test-org/test-repo"
+	commit := func(sha string, parents ...string) {
+		c := &github.RepositoryCommit{SHA: github.String(sha)}
+		for _, p := range parents {
+			c.Parents = append(c.Parents, &github.Commit{SHA: github.String(p)})
+		}
+		server.AddCommit(repo, c)
+	}
+	// main: base - old, feature: base - f1 - f2, merged into main by m1
+	commit("base")
+	commit("old", "base")
+	commit("f1", "base")
+	commit("f2", "f1")
+	commit("m1", "old", "f2")
+	server.AddBranch(repo, "main", "old")
+	g := NewGitHub(server.Client())
+
+	// Commits that were already on the branch are not listed
+	shas, total, err := g.CompareCommits(context.Background(), "test-org", "test-repo", "old", "m1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"f1", "f2", "m1"}, shas)
+	assert.Equal(t, 3, total)
+
+	shas, _, err = g.CompareCommits(context.Background(), "test-org", "test-repo", "main", "f2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"f1", "f2"}, shas)
+
+	_, _, err = g.CompareCommits(context.Background(), "test-org", "test-repo", "missing", "m1")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestGetPullRequestMergeCommit(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddPullRequest("test-org/test-repo", &github.PullRequest{Number: github.Int(1), Mergeable: github.Bool(true), MergeCommitSHA: github.String("merge1")}, nil)
+	// GitHub reports a merge commit SHA for pull requests with conflicts,
+	// but that commit is stale
+	server.AddPullRequest("test-org/test-repo", &github.PullRequest{Number: github.Int(2), Mergeable: github.Bool(false), MergeCommitSHA: github.String("stale")}, nil)
+	server.AddPullRequest("test-org/test-repo", &github.PullRequest{Number: github.Int(3), MergeCommitSHA: github.String("stale")}, nil)
+	g := NewGitHub(server.Client())
+
+	for number, want := range map[int]string{1: "merge1", 2: "", 3: ""} {
+		sha, err := g.GetPullRequestMergeCommit(context.Background(), "test-org", "test-repo", number)
+		assert.Nil(t, err)
+		assert.Equal(t, want, sha, "pull request #%d", number)
+	}
+	_, err := g.GetPullRequestMergeCommit(context.Background(), "test-org", "test-repo", 4)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestCreateStatusAndCheckRun(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	g := NewGitHub(server.Client())
+
+	err := g.CreateStatus(context.Background(), "test-org", "test-repo", "abc123", &Status{Context: "LFSWatchDog", State: "success", Description: "all clear!"})
+	assert.Nil(t, err)
+	err = g.CreateCheckRun(context.Background(), "test-org", "test-repo", &CheckRun{
+		Name:        "LFSWatchDog",
+		HeadSHA:     "abc123",
+		Conclusion:  "failure",
+		Title:       "1 file",
+		Summary:     "summary",
+		Annotations: []*Annotation{{Path: "large.bin", Level: "warning", Title: "too large", Message: "use LFS"}},
+		Actions:     []*CheckRunAction{{Label: "Re-run check", Description: "Check the commit again", Identifier: "recheck"}},
+	})
+	assert.Nil(t, err)
+
+	statuses := server.Statuses()
+	assert.Equal(t, 1, len(statuses))
+	assert.Equal(t, "success", statuses[0].State)
+	runs := server.CheckRuns()
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, "failure", runs[0].GetConclusion())
+	assert.Equal(t, "large.bin", runs[0].Output.Annotations[0].GetPath())
+	assert.Equal(t, "recheck", runs[0].Actions[0].Identifier)
+}
+
+func TestRateLimited(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	reset := time.Now().Add(time.Minute).Truncate(time.Second)
+	server.RateLimitUntil(reset)
+	g := NewGitHub(server.Client())
+
+	_, err := g.GetDirContent(context.Background(), "test-org", "test-repo", "abc123", "dir")
+	var rateLimitErr *github.RateLimitError
+	assert.True(t, errors.As(err, &rateLimitErr))
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.False(t, errors.Is(err, ErrNotFound))
+
+	at, ok := RateLimitReset(err)
+	assert.True(t, ok)
+	assert.True(t, at.Equal(reset))
+	_, ok = RateLimitReset(errors.New("other"))
+	assert.False(t, ok)
+
+	// Writes are rate limited, too
+	err = g.CreateStatus(context.Background(), "test-org", "test-repo", "abc123", &Status{State: "pending"})
+	assert.True(t, errors.Is(err, ErrRateLimited))
+}
+
+func TestNotFound(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	g := NewGitHub(server.Client())
+
+	_, err := g.GetFileContent(context.Background(), "test-org", "test-repo", "abc123", "missing.txt")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	var errorResponse *github.ErrorResponse
+	assert.True(t, errors.As(err, &errorResponse))
+}
+
+func TestFileURL(t *testing.T) {
+	g := NewGitHub(github.NewClient(nil)).WithWebURL("https://github.example.com/")
+	assert.Equal(t, "https://github.example.com/org/repo/blob/sha1/dir/file%20%281%29%23.png", g.FileURL("org", "repo", "sha1", "dir/file (1)#.png"))
+}
+
+func TestUploadLFSObject(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	g := NewGitHub(server.Client())
+
+	err := g.UploadLFSObject(context.Background(), "test-org", "test-repo", "abc123", []byte("content"))
+	assert.Nil(t, err)
+	content, ok := server.LFSObject("abc123")
+	assert.True(t, ok)
+	assert.Equal(t, "content", string(content))
+
+	// Stored objects are not uploaded again
+	server.ResetCalls()
+	err = g.UploadLFSObject(context.Background(), "test-org", "test-repo", "abc123", []byte("content"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, server.Calls("PUT /lfs/objects/"))
+}
+
+func TestCommitFiles(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("test-org/test-repo", "abc123", "keep.txt", []byte("keep"))
+	server.AddFile("test-org/test-repo", "abc123", "large.bin", []byte("large"))
+	g := NewGitHub(server.Client())
+
+	exists, err := g.BranchExists(context.Background(), "test-org", "test-repo", "fix")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	sha, err := g.CommitFiles(context.Background(), "test-org", "test-repo", &Change{
+		Branch:  "fix",
+		Parent:  "abc123",
+		Message: "Fix",
+		Files:   map[string]string{"large.bin": "pointer"},
+	})
+	assert.Nil(t, err)
+	branch, _ := server.Branch("test-org/test-repo", "fix")
+	assert.Equal(t, sha, branch)
+	large, _ := server.File("test-org/test-repo", sha, "large.bin")
+	assert.Equal(t, "pointer", string(large.Content))
+	keep, _ := server.File("test-org/test-repo", sha, "keep.txt")
+	assert.Equal(t, "keep", string(keep.Content))
+
+	exists, err = g.BranchExists(context.Background(), "test-org", "test-repo", "fix")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestTeamExists(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddTeam("test-org", "lfs-help")
+	g := NewGitHub(server.Client())
+
+	exists, err := g.TeamExists(context.Background(), "test-org", "lfs-help")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = g.TeamExists(context.Background(), "test-org", "no-team")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	server.InjectError("GET", "orgs/", http.StatusBadGateway, 1)
+	_, err = g.TeamExists(context.Background(), "test-org", "lfs-help")
+	assert.NotNil(t, err)
+}
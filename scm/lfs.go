@@ -0,0 +1,149 @@
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+// lfsAction is an upload or verify action of a batch response
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+type lfsObject struct {
+	OID     string               `json:"oid"`
+	Size    int64                `json:"size"`
+	Actions map[string]lfsAction `json:"actions,omitempty"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type lfsBatch struct {
+	Operation string      `json:"operation,omitempty"`
+	Transfers []string    `json:"transfers,omitempty"`
+	Objects   []lfsObject `json:"objects"`
+}
+
+// UploadLFSObject uses the Git LFS batch API of the repository, which
+// accepts the same credentials as the REST API
+// c.f. https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md
+func (g *GitHub) UploadLFSObject(ctx context.Context, owner, repo, oid string, content []byte) error {
+	batchURL := fmt.Sprintf("%s%s/%s.git/info/lfs/objects/batch", g.webURL, owner, repo)
+	req, err := g.client.NewRequest(http.MethodPost, batchURL, &lfsBatch{
+		Operation: "upload",
+		Transfers: []string{"basic"},
+		Objects:   []lfsObject{{OID: oid, Size: int64(len(content))}},
+	})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+
+	var batch lfsBatch
+	if _, err := g.client.Do(ctx, req, &batch); err != nil {
+		return fmt.Errorf("LFS batch request failed: %w", wrapError(err))
+	}
+	if len(batch.Objects) != 1 {
+		return fmt.Errorf("LFS batch response has %d objects, expected 1", len(batch.Objects))
+	}
+	object := batch.Objects[0]
+	if object.Error != nil {
+		return fmt.Errorf("LFS batch request failed for '%s': %d %s", oid, object.Error.Code, object.Error.Message)
+	}
+
+	upload, ok := object.Actions["upload"]
+	if !ok {
+		// The server has the object already
+		return nil
+	}
+	// The actions carry their own credentials, don't send the token
+	// to the storage hosts
+	if err := lfsRequest(ctx, http.MethodPut, upload, "application/octet-stream", bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("LFS upload failed for '%s': %w", oid, err)
+	}
+	if verify, ok := object.Actions["verify"]; ok {
+		body, _ := json.Marshal(&lfsObject{OID: oid, Size: int64(len(content))})
+		if err := lfsRequest(ctx, http.MethodPost, verify, lfsMediaType, bytes.NewReader(body)); err != nil {
+			return fmt.Errorf("LFS verify failed for '%s': %w", oid, err)
+		}
+	}
+	return nil
+}
+
+type lfsLocks struct {
+	Locks []struct {
+		ID       string    `json:"id"`
+		Path     string    `json:"path"`
+		LockedAt time.Time `json:"locked_at"`
+		Owner    struct {
+			Name string `json:"name"`
+		} `json:"owner"`
+	} `json:"locks"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// ListLFSLocks uses the Git LFS locks API of the repository
+// c.f. https://github.com/git-lfs/git-lfs/blob/main/docs/api/locking.md
+func (g *GitHub) ListLFSLocks(ctx context.Context, owner, repo string) ([]*Lock, error) {
+	locksURL := fmt.Sprintf("%s%s/%s.git/info/lfs/locks", g.webURL, owner, repo)
+	var locks []*Lock
+	cursor := ""
+	for {
+		query := url.Values{"limit": {"100"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		req, err := g.client.NewRequest(http.MethodGet, locksURL+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", lfsMediaType)
+
+		var page lfsLocks
+		if _, err := g.client.Do(ctx, req, &page); err != nil {
+			return nil, fmt.Errorf("LFS locks request failed: %w", wrapError(err))
+		}
+		for _, l := range page.Locks {
+			locks = append(locks, &Lock{ID: l.ID, Path: l.Path, Owner: l.Owner.Name, LockedAt: l.LockedAt})
+		}
+		if page.NextCursor == "" {
+			return locks, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func lfsRequest(ctx context.Context, method string, action lfsAction, contentType string, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, method, action.Href, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		// The href may be signed, keep it out of logs
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Package scm wraps the source control operations the watchdog needs.
+//
+// The watchdog only talks to the Client interface so that the underlying
+// GitHub library can be upgraded or swapped without touching check logic,
+// and so that tests can mock at this seam.
+package scm
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is matched by errors of requests for missing files and
+// directories, use errors.Is to test for it
+var ErrNotFound = errors.New("not found")
+
+// ErrRateLimited is matched by errors of requests that exceeded a primary
+// or secondary rate limit, use RateLimitReset for when to retry
+var ErrRateLimited = errors.New("rate limited")
+
+// ErrNotModified is returned by conditional requests for content that
+// did not change since the ETag was served
+var ErrNotModified = errors.New("not modified")
+
+// Client is the set of source control operations used by the watchdog
+type Client interface {
+	// GetFileContent returns the decoded content of a file at ref.
+	// Missing files and directories yield errors matching ErrNotFound.
+	GetFileContent(ctx context.Context, owner, repo, ref, path string) (string, error)
+	// GetFileContentIfNoneMatch returns the decoded content of a file at
+	// ref and its ETag, or ErrNotModified if its ETag is still etag.
+	// Conditional requests that aren't modified don't count against the
+	// rate limit.
+	GetFileContentIfNoneMatch(ctx context.Context, owner, repo, ref, path, etag string) (string, string, error)
+	// GetDirContent returns the entries of a directory at ref
+	GetDirContent(ctx context.Context, owner, repo, ref, path string) ([]*Entry, error)
+	// GetRawSize returns the size of a file at ref from the Content-Length
+	// of its raw content, without downloading it. Listings report a size of
+	// 0 for very large blobs.
+	GetRawSize(ctx context.Context, owner, repo, ref, path string) (int, error)
+	// GetTree returns the tree identified by sha (a tree or commit SHA)
+	GetTree(ctx context.Context, owner, repo, sha string, recursive bool) (*Tree, error)
+	// GetCommit returns a commit and the files it changed
+	GetCommit(ctx context.Context, owner, repo, sha string) (*Commit, error)
+	// CompareCommits returns the SHAs of the commits reachable from head
+	// but not from base, a commit SHA or branch, oldest first, and their
+	// total number. GitHub lists at most 250 of them.
+	CompareCommits(ctx context.Context, owner, repo, base, head string) ([]string, int, error)
+	// ListPullRequestFiles returns the files a pull request changes compared
+	// to its base branch as a Commit of its head. GitHub lists at most
+	// 3,000 files.
+	ListPullRequestFiles(ctx context.Context, owner, repo string, number int) (*Commit, error)
+	// GetPullRequestMergeCommit returns the SHA of the commit that GitHub
+	// creates to test merging a pull request into its base branch, which
+	// refs/pull/<number>/merge points to. The SHA is empty while GitHub
+	// computes the merge, and if the pull request has conflicts.
+	GetPullRequestMergeCommit(ctx context.Context, owner, repo string, number int) (string, error)
+	// CreateComment posts a comment to a commit and returns its ID
+	CreateComment(ctx context.Context, owner, repo, sha, body string) (int64, error)
+	// UpdateComment replaces the body of a commit comment
+	UpdateComment(ctx context.Context, owner, repo string, id int64, body string) error
+	// CreateStatus sets a commit status
+	CreateStatus(ctx context.Context, owner, repo, sha string, status *Status) error
+	// CreateCheckRun creates a check run for a commit
+	CreateCheckRun(ctx context.Context, owner, repo string, run *CheckRun) error
+	// GetStatuses returns the latest status of every context of a commit
+	GetStatuses(ctx context.Context, owner, repo, ref string) ([]*Status, error)
+	// GetCheckRuns returns the check runs with the given name of a commit,
+	// most recent first. Conclusion is empty for runs in progress.
+	GetCheckRuns(ctx context.Context, owner, repo, ref, name string) ([]*CheckRun, error)
+	// ReviewDeployment approves or rejects a deployment waiting for a
+	// deployment protection rule of the App
+	ReviewDeployment(ctx context.Context, owner, repo string, review *DeploymentReview) error
+	// FileURL returns the web URL of a file at ref, or an empty string if
+	// the web URL is unknown
+	FileURL(owner, repo, ref, path string) string
+	// FindUserByEmail returns the login of the user with the given email
+	// address, or an empty string if there is no unique match
+	FindUserByEmail(ctx context.Context, email string) (string, error)
+	// TeamExists reports whether an organization has a team with the slug
+	TeamExists(ctx context.Context, org, slug string) (bool, error)
+	// ListRepositories returns the repositories the installation can access
+	ListRepositories(ctx context.Context) ([]*Repository, error)
+	// GetBlob returns the raw content of a blob
+	GetBlob(ctx context.Context, owner, repo, sha string) ([]byte, error)
+	// GetBlobPrefix returns at most the first n bytes of a blob without
+	// downloading the rest
+	GetBlobPrefix(ctx context.Context, owner, repo, sha string, n int) ([]byte, error)
+	// UploadLFSObject stores content in the repository's Git LFS storage
+	// under its SHA-256 oid, unless it is stored already
+	UploadLFSObject(ctx context.Context, owner, repo, oid string, content []byte) error
+	// ListLFSLocks returns the Git LFS file locks of a repository
+	ListLFSLocks(ctx context.Context, owner, repo string) ([]*Lock, error)
+	// BranchExists reports whether a branch exists
+	BranchExists(ctx context.Context, owner, repo, branch string) (bool, error)
+	// CommitFiles creates a branch with a commit on top of parent that
+	// replaces the given files, and returns the commit SHA
+	CommitFiles(ctx context.Context, owner, repo string, change *Change) (string, error)
+	// CreatePullRequest opens a pull request and returns its web URL
+	CreatePullRequest(ctx context.Context, owner, repo string, pr *PullRequest) (string, error)
+	// CreateIssue opens an issue and returns its web URL
+	CreateIssue(ctx context.Context, owner, repo, title, body string) (string, error)
+}
+
+// Entry is a file, directory, symlink or submodule in a repository
+type Entry struct {
+	Name string
+	Path string
+	// Type is one of "file", "dir", "symlink" or "submodule"
+	Type string
+	SHA  string
+	Size int
+}
+
+// Tree is a (possibly recursive) listing of a Git tree
+type Tree struct {
+	SHA     string
+	Entries []*Entry
+	// Truncated is set if GitHub did not return all entries
+	Truncated bool
+}
+
+// Commit is a commit and the files it changed compared to its first parent
+type Commit struct {
+	SHA string
+	// Author is the login of the author, if GitHub could match the email
+	Author      string
+	AuthorEmail string
+	Added       []string
+	Modified    []string
+	Removed     []string
+}
+
+// Repository is a repository an installation can access
+type Repository struct {
+	Owner         string
+	Name          string
+	DefaultBranch string
+	Archived      bool
+}
+
+// Lock is a Git LFS file lock
+type Lock struct {
+	ID   string
+	Path string
+	// Owner is the login of the user holding the lock
+	Owner    string
+	LockedAt time.Time
+}
+
+// Change is a commit that replaces files with new content
+type Change struct {
+	Branch  string
+	Parent  string
+	Message string
+	// Files maps paths to their new content
+	Files map[string]string
+}
+
+// PullRequest is a pull request to open
+type PullRequest struct {
+	Title string
+	Body  string
+	// Head is the branch with the changes, Base the branch to merge into
+	Head  string
+	Base  string
+	Draft bool
+}
+
+// Status is a commit status
+type Status struct {
+	Context     string
+	State       string
+	Description string
+	TargetURL   string
+}
+
+// CheckRun is a completed check run for a commit
+type CheckRun struct {
+	Name        string
+	HeadSHA     string
+	Conclusion  string
+	DetailsURL  string
+	Title       string
+	Summary     string
+	Text        string
+	Annotations []*Annotation
+	// Actions are buttons that send a check_run event with the
+	// requested_action action to the App
+	Actions []*CheckRunAction
+}
+
+// DeploymentReview is the decision of a deployment protection rule
+type DeploymentReview struct {
+	// CallbackURL is the deployment_callback_url of the
+	// deployment_protection_rule event
+	CallbackURL string
+	Environment string
+	// State is "approved" or "rejected"
+	State   string
+	Comment string
+}
+
+// CheckRunAction is a button of a check run. GitHub limits the label to 20
+// characters, the description to 40 and the identifier to 20.
+type CheckRunAction struct {
+	Label       string
+	Description string
+	Identifier  string
+}
+
+// Annotation points a check run at a file
+type Annotation struct {
+	Path    string
+	Level   string
+	Title   string
+	Message string
+}
@@ -0,0 +1,311 @@
+// Package selftest replays recorded push payloads against the webhook
+// handler backed by a fake GitHub server and verifies the resulting
+// comments and commit statuses. This validates refactorings of the
+// watchdog as a whole, from webhook delivery to GitHub API calls.
+package selftest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/clientgroup"
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/server"
+	"github.com/google/go-github/v35/github"
+)
+
+//go:embed testdata/*.json
+var payloads embed.FS
+
+const (
+	secret = "selftest-secret"
+	appID  = 1
+
+	// Size of files that are not explicitly sized by a scenario
+	smallFileSize = 1024
+
+	config = "" +
+		"helpContact: \"@github-solutions\"\n" +
+		"lfsSizeThreshold: 512000\n" +
+		"lfsSizeExemptions: |\n" +
+		"  *.xml\n" +
+		"lfsSizeExemptionsThreshold: 20000000\n" +
+		"lfsSuggestionsEnabled: Yes\n" +
+		"lfsCommitStatusEnabled: Yes\n"
+)
+
+type scenario struct {
+	name    string
+	payload string
+	// Sizes of files in the repository, all other files are small
+	sizes map[string]int
+	// Number of commits the payload omits, which GitHub has before the
+	// commits of the payload
+	omitted int
+	// Files that must be listed in the comment of the commit with the
+	// given index in the push, omitted commits first. Commits without entry
+	// must not have a comment.
+	comments map[int][]string
+	// Final commit status state of the commit with the given index in the
+	// push. Commits without entry must not have a status.
+	statuses map[int]string
+}
+
+var scenarios = []scenario{
+	{
+		name:    "big push",
+		payload: "big_push.json",
+		sizes: map[string]int{
+			"assets/textures/hero.psd": 2 * 1024 * 1024,
+			"assets/models/hero.fbx":   30 * 1024 * 1024,
+			"test/fixtures/level.xml":  600 * 1024,
+		},
+		comments: map[int][]string{
+			0: {"assets/textures/hero.psd"},
+			2: {"assets/models/hero.fbx"},
+		},
+		statuses: map[int]string{0: "failure", 1: "success", 2: "failure"},
+	},
+	{
+		name:     "truncated commits",
+		payload:  "truncated_commits.json",
+		sizes:    map[string]int{"bin/tool.exe": 4 * 1024 * 1024},
+		omitted:  5,
+		comments: map[int][]string{24: {"bin/tool.exe"}},
+		// Every commit is checked, including those the payload omits
+		statuses: func() map[int]string {
+			m := make(map[int]string)
+			for i := 0; i < 24; i++ {
+				m[i] = "success"
+			}
+			m[24] = "failure"
+			return m
+		}(),
+	},
+	{
+		name:    "tag push",
+		payload: "tag_push.json",
+	},
+	{
+		name:    "new branch",
+		payload: "new_branch.json",
+		sizes:   map[string]int{"assets/rigs/hero.ma": 8 * 1024 * 1024},
+	},
+}
+
+// Run replays all scenarios and writes a report to out.
+// It returns an error if any scenario failed.
+func Run(out io.Writer) error {
+	keyFile, err := writePrivateKey()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(keyFile)
+
+	failed := 0
+	for _, s := range scenarios {
+		if err := s.run(keyFile); err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %v\n", s.name, err)
+			continue
+		}
+		fmt.Fprintf(out, "PASS %s\n", s.name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scenarios failed", failed, len(scenarios))
+	}
+	return nil
+}
+
+func (s *scenario) run(keyFile string) error {
+	payload, err := payloads.ReadFile("testdata/" + s.payload)
+	if err != nil {
+		return err
+	}
+	var event github.PushEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return fmt.Errorf("could not parse payload: %v", err)
+	}
+
+	gh := githubtest.NewServer()
+	defer gh.Close()
+	shas := s.seed(gh, &event)
+
+	clientGroup, err := clientgroup.New(clientgroup.Options{
+		GitHubURL:      gh.URL + "/api/v3",
+		AppID:          appID,
+		PrivateKeyFile: keyFile,
+	})
+	if err != nil {
+		return err
+	}
+	handler := server.NewHandler(clientgroup.NewTenants(clientGroup, nil), secret)
+	webhook := httptest.NewServer(handler)
+	defer webhook.Close()
+
+	if err := deliver(webhook.URL, "push", payload); err != nil {
+		return err
+	}
+	handler.Wait()
+
+	return s.verify(gh, shas)
+}
+
+// Add the commits of the push and all files they reference to the fake
+// repository. It returns the SHAs of all commits of the push in order.
+func (s *scenario) seed(gh *githubtest.Server, event *github.PushEvent) []string {
+	repo := event.GetRepo().GetFullName()
+	commits := make([]*github.HeadCommit, 0, s.omitted+len(event.Commits))
+	for i := 0; i < s.omitted; i++ {
+		commits = append(commits, &github.HeadCommit{
+			ID:       github.String(fmt.Sprintf("%040x", i+1)),
+			Modified: []string{fmt.Sprintf("src/omitted%d.c", i+1)},
+		})
+	}
+	commits = append(commits, event.Commits...)
+
+	parent := event.GetBefore()
+	gh.AddCommit(repo, &github.RepositoryCommit{SHA: github.String(parent)})
+	shas := make([]string, len(commits))
+	for i, commit := range commits {
+		shas[i] = commit.GetID()
+		files := make([]*github.CommitFile, 0, len(commit.Added)+len(commit.Modified))
+		gh.AddFile(repo, commit.GetID(), ".github/watchdog.yml", []byte(config))
+		for _, file := range append(commit.Added, commit.Modified...) {
+			size, ok := s.sizes[file]
+			if !ok {
+				size = smallFileSize
+			}
+			gh.AddFileWithSize(repo, commit.GetID(), file, size)
+		}
+		for _, file := range commit.Added {
+			files = append(files, &github.CommitFile{Filename: github.String(file), Status: github.String("added")})
+		}
+		for _, file := range commit.Modified {
+			files = append(files, &github.CommitFile{Filename: github.String(file), Status: github.String("modified")})
+		}
+		gh.AddCommit(repo, &github.RepositoryCommit{
+			SHA:     commit.ID,
+			Parents: []*github.Commit{{SHA: github.String(parent)}},
+			Files:   files,
+		})
+		parent = commit.GetID()
+	}
+	return shas
+}
+
+func (s *scenario) verify(gh *githubtest.Server, shas []string) error {
+	index := make(map[string]int)
+	for i, sha := range shas {
+		index[sha] = i
+	}
+
+	comments := make(map[int]string)
+	for _, c := range gh.Comments() {
+		i, ok := index[c.SHA]
+		if !ok {
+			return fmt.Errorf("unexpected comment on unknown commit %s", c.SHA)
+		}
+		if _, ok := comments[i]; ok {
+			return fmt.Errorf("more than one comment on commit %d", i)
+		}
+		comments[i] = c.Body
+	}
+	for i, files := range s.comments {
+		body, ok := comments[i]
+		if !ok {
+			return fmt.Errorf("missing comment on commit %d", i)
+		}
+		for _, file := range files {
+			if !strings.Contains(body, file) {
+				return fmt.Errorf("comment on commit %d does not mention %s", i, file)
+			}
+		}
+	}
+	for i := range comments {
+		if _, ok := s.comments[i]; !ok {
+			return fmt.Errorf("unexpected comment on commit %d: %q", i, comments[i])
+		}
+	}
+
+	// Statuses are posted in order, the last one wins
+	states := make(map[int]string)
+	for _, st := range gh.Statuses() {
+		i, ok := index[st.SHA]
+		if !ok {
+			return fmt.Errorf("unexpected status on unknown commit %s", st.SHA)
+		}
+		states[i] = st.State
+	}
+	if len(states) != len(s.statuses) {
+		return fmt.Errorf("expected statuses on %d commits, got %d", len(s.statuses), len(states))
+	}
+	for i, want := range s.statuses {
+		if got := states[i]; got != want {
+			return fmt.Errorf("expected status %q on commit %d, got %q", want, i, got)
+		}
+	}
+	return nil
+}
+
+// Deliver a payload to the webhook like GitHub does
+func deliver(url, event string, payload []byte) error {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", "selftest")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook responded with %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// The fake server accepts any App JWT, but the key must be valid
+func writePrivateKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile("", "lfswatchdog-selftest-*.pem")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = pem.Encode(f, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return filepath.Clean(f.Name()), nil
+}
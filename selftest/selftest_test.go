@@ -0,0 +1,15 @@
+package selftest
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	var out bytes.Buffer
+	err := Run(&out)
+	t.Log(out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
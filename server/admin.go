@@ -0,0 +1,74 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/logging"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+const adminSettingsPath = "/admin/settings"
+
+// Settings can be changed at runtime to reproduce problems without a
+// redeploy. Omitted fields are left unchanged.
+type Settings struct {
+	Debug  *bool `json:"debug,omitempty"`
+	DryRun *bool `json:"dryRun,omitempty"`
+}
+
+func currentSettings() Settings {
+	debug, dryRun := logging.Debug(), watchdog.DryRun()
+	return Settings{Debug: &debug, DryRun: &dryRun}
+}
+
+// adminHandler serves the admin endpoints to callers presenting the token
+type adminHandler struct {
+	token string
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var settings Settings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "invalid settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if settings.Debug != nil {
+			logging.SetDebug(*settings.Debug)
+			log.Printf("debug logging set to %t via %s\n", *settings.Debug, adminSettingsPath)
+		}
+		if settings.DryRun != nil {
+			watchdog.SetDryRun(*settings.DryRun)
+			log.Printf("dry-run set to %t via %s\n", *settings.DryRun, adminSettingsPath)
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentSettings())
+}
+
+// Check that the request presents the admin token as bearer token
+func authorized(r *http.Request, token string) bool {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) == 1
+}
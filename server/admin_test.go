@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/logging"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/stretchr/testify/assert"
+)
+
+func adminRequest(handler http.Handler, method, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, adminSettingsPath, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminSettings(t *testing.T) {
+	defer logging.SetDebug(false)
+	defer watchdog.SetDryRun(false)
+	handler := &adminHandler{token: "admin-token"}
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(handler, http.MethodGet, "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(handler, http.MethodGet, "wrong", "").Code)
+
+	w := adminRequest(handler, http.MethodPut, "admin-token", `{"dryRun": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"debug": false, "dryRun": true}`, w.Body.String())
+	assert.True(t, watchdog.DryRun())
+
+	w = adminRequest(handler, http.MethodPut, "admin-token", `{"debug": true}`)
+	assert.JSONEq(t, `{"debug": true, "dryRun": true}`, w.Body.String())
+	assert.True(t, logging.Debug())
+
+	assert.Equal(t, http.StatusBadRequest, adminRequest(handler, http.MethodPut, "admin-token", `{`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, adminRequest(handler, http.MethodPost, "admin-token", "").Code)
+}
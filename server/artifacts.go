@@ -0,0 +1,137 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// artifactsPath serves the stored check results, a file name follows
+	artifactsPath = "/artifacts/"
+
+	// Artifacts are kept in this subdirectory of the job directory
+	artifactsDir = "artifacts"
+
+	// Artifacts older than this are removed
+	artifactRetention = 30 * 24 * time.Hour
+)
+
+// Random ID and the name chosen by the watchdog, e.g.
+// "0123456789abcdef-my-org-my-repo-1a2b3c4.json"
+var artifactFile = regexp.MustCompile(`^[0-9a-f]{16}-[A-Za-z0-9._-]+\.(json|csv)$`)
+
+// artifactStore keeps check results in a directory and serves them to
+// anyone with a signed URL, so that they can be linked from check runs.
+// URLs are signed with the webhook secret and expire when it is rotated.
+type artifactStore struct {
+	dir       string
+	publicURL string
+	secret    func() []byte
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func openArtifactStore(jobDir, publicURL string, secret func() []byte) (*artifactStore, error) {
+	store := &artifactStore{
+		dir:       filepath.Join(jobDir, artifactsDir),
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		secret:    secret,
+	}
+	return store, os.MkdirAll(store.dir, 0700)
+}
+
+func (store *artifactStore) sign(file string) string {
+	mac := hmac.New(sha256.New, store.secret())
+	mac.Write([]byte(file))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Save writes an artifact and returns its signed URL
+func (store *artifactStore) Save(name string, content []byte) (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	file := hex.EncodeToString(id) + "-" + name
+	tmp := filepath.Join(store.dir, file+".tmp")
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, filepath.Join(store.dir, file)); err != nil {
+		return "", err
+	}
+	store.prune()
+	return store.publicURL + artifactsPath + file + "?signature=" + store.sign(file), nil
+}
+
+// Remove expired artifacts, at most once an hour
+func (store *artifactStore) prune() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if time.Since(store.lastPruned) < time.Hour {
+		return
+	}
+	store.lastPruned = time.Now()
+	pruneDir(store.dir, "artifact")
+}
+
+// Remove the files of a directory that are older than artifactRetention
+func pruneDir(dir, kind string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Printf("could not prune the %ss: %v\n", kind, err)
+		return
+	}
+	for _, f := range files {
+		if time.Since(f.ModTime()) > artifactRetention {
+			if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+				log.Printf("could not remove the %s '%s': %v\n", kind, f.Name(), err)
+			}
+		}
+	}
+}
+
+func (store *artifactStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file := strings.TrimPrefix(r.URL.Path, artifactsPath)
+	signature := r.URL.Query().Get("signature")
+	if !artifactFile.MatchString(file) || !hmac.Equal([]byte(signature), []byte(store.sign(file))) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(store.dir, file))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "could not read the artifact", http.StatusInternalServerError)
+		return
+	}
+	contentType := "application/json"
+	if strings.HasSuffix(file, ".csv") {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+file[17:]+`"`)
+	http.ServeContent(w, r, file, info.ModTime(), f)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lfswatchdog-artifacts")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	secret := "secret1"
+	store, err := openArtifactStore(dir, "https://watchdog.example.com/", func() []byte { return []byte(secret) })
+	assert.Nil(t, err)
+
+	url, err := store.Save("test-org-test-repo-sha1234.csv", []byte("path,rule\n"))
+	assert.Nil(t, err)
+	assert.Regexp(t, `^https://watchdog.example.com/artifacts/[0-9a-f]{16}-test-org-test-repo-sha1234.csv\?signature=[0-9a-f]{64}$`, url)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		store.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	target := strings.TrimPrefix(url, "https://watchdog.example.com")
+	w := get(target)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "path,rule\n", w.Body.String())
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="test-org-test-repo-sha1234.csv"`, w.Header().Get("Content-Disposition"))
+
+	// Unsigned, tampered and traversing URLs are not found
+	assert.Equal(t, http.StatusNotFound, get(strings.Split(target, "?")[0]).Code)
+	assert.Equal(t, http.StatusNotFound, get(strings.Replace(target, "sha1234.csv", "sha1235.csv", 1)).Code)
+	assert.Equal(t, http.StatusNotFound, get(artifactsPath+"..%2Finstallations%2F42.json?signature="+store.sign("../installations/42.json")).Code)
+
+	// Rotating the secret expires the URLs
+	secret = "secret2"
+	assert.Equal(t, http.StatusNotFound, get(target).Code)
+}
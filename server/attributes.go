@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/redact"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+// orgAPIPath is followed by "{org}/attributes" for the audit of the
+// .gitattributes files of an organization
+const orgAPIPath = "/api/orgs/"
+
+// attributesTemplatePath serves the org-standard .gitattributes
+const attributesTemplatePath = "/gitattributes"
+
+// orgHandler serves the organization API for the platform team
+type orgHandler struct {
+	token     string
+	watchdogs watchdogs
+}
+
+func (h *orgHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, orgAPIPath), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "attributes" {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		h.auditAttributes(w, r, parts[0], false)
+	case http.MethodPost:
+		h.auditAttributes(w, r, parts[0], true)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Report the common binary extensions that the .gitattributes files of
+// each repository of an organization leave out of Git LFS, and their drift
+// from the attributes template. With reconcile, pull requests add the
+// missing template patterns.
+func (h *orgHandler) auditAttributes(w http.ResponseWriter, r *http.Request, org string, reconcile bool) {
+	installationID, err := h.watchdogs.FindOrgInstallation(r.Context(), org)
+	if err != nil {
+		log.Printf("could not find the installation for '%s': %v\n", org, err)
+		http.Error(w, fmt.Sprintf("could not find the installation for '%s'", org), http.StatusNotFound)
+		return
+	}
+	gatekeeper, err := h.watchdogs.GetWatchdog(org, installationID)
+	if err != nil {
+		http.Error(w, redact.String(err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	audit, err := gatekeeper.AuditAttributes(r.Context(), org, reconcile)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(audit)
+}
+
+// Serve the org-standard .gitattributes, so that new repositories can
+// start from it
+func serveAttributesTemplate(w http.ResponseWriter, r *http.Request) {
+	template := watchdog.AttributesTemplate()
+	if template == "" {
+		http.Error(w, "no attributes template is configured", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(template))
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditAttributes(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddInstallation("test-org/game", 1)
+	server.AddInstallation("test-org/tools", 1)
+	server.AddInstallation("test-org/empty", 1)
+	server.AddInstallation("other-org/game", 2)
+	server.AddFile("test-org/game", "main", ".gitattributes", []byte("*.psd filter=lfs diff=lfs merge=lfs -text\n"))
+	server.AddFileWithSize("test-org/game", "main", "art/hero.psd", 5000)
+	server.AddFileWithSize("test-org/game", "main", "art/hero.png", 3000)
+	server.AddFileWithSize("test-org/game", "main", "README.md", 100)
+	server.AddFileWithSize("test-org/tools", "main", "bin/tool.exe", 2000)
+	server.AddFileWithSize("test-org/tools", "main", "docs/logo.PNG", 1000)
+	server.AddFileWithSize("other-org/game", "main", "hero.png", 3000)
+	handler := &orgHandler{token: "admin-token", watchdogs: &fakeWatchdogs{server}}
+	path := orgAPIPath + "test-org/attributes"
+
+	assert.Equal(t, http.StatusUnauthorized, recheckRequest(handler, http.MethodGet, "", path).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, recheckRequest(handler, http.MethodPut, "admin-token", path).Code)
+	assert.Equal(t, http.StatusNotFound, recheckRequest(handler, http.MethodGet, "admin-token", orgAPIPath+"test-org/other").Code)
+	assert.Equal(t, http.StatusNotFound, recheckRequest(handler, http.MethodGet, "admin-token", orgAPIPath+"missing-org/attributes").Code)
+
+	w := recheckRequest(handler, http.MethodGet, "admin-token", path)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var audit watchdog.AttributesAudit
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&audit))
+	assert.Equal(t, "test-org", audit.Org)
+	assert.Equal(t, 3, audit.Repositories)
+	assert.Equal(t, []watchdog.UncoveredExtension{
+		{Extension: ".png", Repositories: 2, Files: 2, TotalSize: 4000},
+		{Extension: ".exe", Repositories: 1, Files: 1, TotalSize: 2000},
+	}, audit.Extensions)
+	if assert.Len(t, audit.Repos, 3) {
+		assert.Equal(t, watchdog.RepoAttributesAudit{Repo: "empty", Ref: "main", Uncovered: []watchdog.UncoveredExtension{}}, audit.Repos[0])
+		assert.Equal(t, watchdog.RepoAttributesAudit{
+			Repo:      "game",
+			Ref:       "main",
+			Patterns:  []string{"*.psd"},
+			Uncovered: []watchdog.UncoveredExtension{{Extension: ".png", Files: 1, TotalSize: 3000}},
+		}, audit.Repos[1])
+		assert.Equal(t, watchdog.RepoAttributesAudit{
+			Repo: "tools",
+			Ref:  "main",
+			Uncovered: []watchdog.UncoveredExtension{
+				{Extension: ".exe", Files: 1, TotalSize: 2000},
+				{Extension: ".png", Files: 1, TotalSize: 1000},
+			},
+		}, audit.Repos[2])
+	}
+}
+
+func TestReconcileAttributes(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	watchdog.SetAttributesTemplate("# Org standard\n*.psd filter=lfs diff=lfs merge=lfs -text\n*.fbx filter=lfs diff=lfs merge=lfs -text\n*.md text\n")
+	defer watchdog.SetAttributesTemplate("")
+	server.AddInstallation("test-org/game", 1)
+	server.AddInstallation("test-org/standard", 1)
+	server.AddFile("test-org/game", "main", ".gitattributes", []byte("*.psd filter=lfs diff=lfs merge=lfs -text"))
+	server.AddCommit("test-org/game", &github.RepositoryCommit{SHA: github.String("main")})
+	server.AddFile("test-org/standard", "main", ".gitattributes", []byte("*.fbx filter=lfs -text\n*.psd filter=lfs -text\n"))
+	handler := &orgHandler{token: "admin-token", watchdogs: &fakeWatchdogs{server}}
+	path := orgAPIPath + "test-org/attributes"
+
+	// Audits only report the drift
+	var audit watchdog.AttributesAudit
+	assert.Nil(t, json.NewDecoder(recheckRequest(handler, http.MethodGet, "admin-token", path).Body).Decode(&audit))
+	assert.Equal(t, 1, audit.Drifted)
+	if assert.Len(t, audit.Repos, 2) {
+		assert.Equal(t, []string{"*.fbx"}, audit.Repos[0].MissingPatterns)
+		assert.Empty(t, audit.Repos[1].MissingPatterns)
+	}
+	assert.Empty(t, server.PullRequests())
+
+	w := recheckRequest(handler, http.MethodPost, "admin-token", path)
+	assert.Equal(t, http.StatusOK, w.Code)
+	audit = watchdog.AttributesAudit{}
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&audit))
+	prs := server.PullRequests()
+	if assert.Len(t, prs, 1) && assert.Len(t, audit.Repos, 2) {
+		assert.Equal(t, "test-org/game", prs[0].Repo)
+		assert.Equal(t, "main", prs[0].GetBase())
+		assert.Contains(t, prs[0].GetBody(), "- `*.fbx`\n")
+		assert.Equal(t, server.URL+"/test-org/game/pull/1", audit.Repos[0].PullRequest)
+		head, _ := server.Branch("test-org/game", prs[0].GetHead())
+		attributes, _ := server.File("test-org/game", head, ".gitattributes")
+		assert.Equal(t, "*.psd filter=lfs diff=lfs merge=lfs -text\n*.fbx filter=lfs diff=lfs merge=lfs -text\n", string(attributes.Content))
+	}
+
+	// The pull request is only opened once per template
+	recheckRequest(handler, http.MethodPost, "admin-token", path)
+	assert.Len(t, server.PullRequests(), 1)
+}
+
+func TestServeAttributesTemplate(t *testing.T) {
+	rec := httptest.NewRecorder()
+	serveAttributesTemplate(rec, httptest.NewRequest(http.MethodGet, attributesTemplatePath, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	watchdog.SetAttributesTemplate("*.psd filter=lfs diff=lfs merge=lfs -text\n")
+	defer watchdog.SetAttributesTemplate("")
+	rec = httptest.NewRecorder()
+	serveAttributesTemplate(rec, httptest.NewRequest(http.MethodGet, attributesTemplatePath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "*.psd filter=lfs diff=lfs merge=lfs -text\n", rec.Body.String())
+}
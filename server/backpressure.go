@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+)
+
+// Time after which GitHub, or whoever monitors the deliveries, should
+// retry a delivery that was rejected because the server was overloaded
+const overloadRetryAfter = time.Minute
+
+var (
+	pendingPushes = metrics.NewGauge("lfswatchdog_pending_pushes",
+		"Pushes that were accepted and are not completely checked yet.")
+	overloadedDeliveries = metrics.NewCounter("lfswatchdog_overloaded_deliveries_total",
+		"Push deliveries rejected with 503 because too many pushes were pending.")
+)
+
+// Reserve a slot for checking a push. Returns false if MaxPendingPushes
+// pushes are pending already.
+func (h *Handler) acquirePush() bool {
+	pending := atomic.AddInt32(&h.pending, 1)
+	if h.MaxPendingPushes > 0 && int(pending) > h.MaxPendingPushes {
+		atomic.AddInt32(&h.pending, -1)
+		return false
+	}
+	pendingPushes.Set(float64(pending))
+	return true
+}
+
+// Release the slot of a push once it was checked
+func (h *Handler) releasePush() {
+	pendingPushes.Set(float64(atomic.AddInt32(&h.pending, -1)))
+}
+
+// Respond that the server is overloaded. GitHub Enterprise marks the
+// delivery as failed, so it shows in the recent deliveries and can be
+// redelivered.
+func rejectOverloaded(w http.ResponseWriter, repo string) {
+	overloadedDeliveries.Inc()
+	message := fmt.Sprintf("too many pushes are pending, rejecting the push to '%s'\n", repo)
+	log.Print(message)
+	w.Header().Set("Retry-After", strconv.Itoa(int(overloadRetryAfter.Seconds())))
+	http.Error(w, message, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverloaded(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFileWithSize("test-org/payload-repo", "sha1", "large.bin", 1000)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+	handler.MaxPendingPushes = 1
+
+	// A push is still being checked
+	atomic.StoreInt32(&handler.pending, 1)
+	w := pushRequest(handler, []byte(validPush))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&handler.pending))
+	assert.Equal(t, 0, server.Calls("GET repos/test-org/payload-repo/contents/"))
+
+	atomic.StoreInt32(&handler.pending, 0)
+	assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(validPush)).Code)
+	handler.Wait()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&handler.pending))
+
+	// Without a limit pushes are never rejected
+	handler.MaxPendingPushes = 0
+	atomic.StoreInt32(&handler.pending, 1000)
+	assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(validPush)).Code)
+	handler.Wait()
+}
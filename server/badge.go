@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+const badgePath = "/badge/"
+
+// Badge colors of the shields.io flat style
+const (
+	badgeClean      = "#4c1"
+	badgeViolations = "#e05d44"
+	badgeUnknown    = "#9f9f9f"
+)
+
+const badgeTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[2]s: %[3]s">` +
+	`<title>%[2]s: %[3]s</title>` +
+	`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+	`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>` +
+	`<g clip-path="url(#r)"><rect width="%[4]d" height="20" fill="#555"/><rect x="%[4]d" width="%[5]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="%[7]d" y="14">%[2]s</text><text x="%[8]d" y="14">%[3]s</text></g></svg>`
+
+// Serve an SVG badge with the Git LFS hygiene of a repository on
+// /badge/{owner}/{repo}, so that teams can show it in READMEs and
+// dashboards. Badges only reveal the number of open findings.
+func serveBadge(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, badgePath), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "expected /badge/{owner}/{repo}", http.StatusNotFound)
+		return
+	}
+	repo := strings.TrimSuffix(parts[0]+"/"+parts[1], ".svg")
+
+	message, color := "unknown", badgeUnknown
+	if violations, audited := watchdog.OpenViolations(repo); audited {
+		message, color = "clean", badgeClean
+		if violations == 1 {
+			message, color = "1 violation", badgeViolations
+		} else if violations > 1 {
+			message, color = fmt.Sprintf("%d violations", violations), badgeViolations
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// Camo, which proxies images in GitHub READMEs, must not keep a stale badge
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(renderBadge("Git LFS", message, color)))
+}
+
+// Render a badge in the shields.io flat style
+func renderBadge(label, message, color string) string {
+	labelWidth, messageWidth := badgeTextWidth(label), badgeTextWidth(message)
+	return fmt.Sprintf(badgeTemplate, labelWidth+messageWidth, html.EscapeString(label), html.EscapeString(message),
+		labelWidth, messageWidth, color, labelWidth/2, labelWidth+messageWidth/2)
+}
+
+// Approximate the width of text in 11px Verdana with padding
+func badgeTextWidth(text string) int {
+	return 7*len([]rune(text)) + 10
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBadge(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	w := watchdog.New(scm.NewGitHub(server.Client()))
+
+	repo := "test-org/badge-repo"
+	owner, name := "test-org", "badge-repo"
+	push := func(sha string, added, removed []string) {
+		server.AddFile(repo, sha, ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\n"))
+		server.AddFileWithSize(repo, sha, "large.bin", 2000)
+		server.AddFileWithSize(repo, sha, "huge.bin", 3000)
+		w.Check(&github.PushEvent{
+			Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{
+				ID:       github.String(sha),
+				Distinct: github.Bool(true),
+				Added:    added,
+				Removed:  removed,
+			}},
+		})
+	}
+	badge := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		serveBadge(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := badge("/badge/test-org/badge-repo")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `aria-label="Git LFS: unknown"`)
+
+	push("sha1", []string{"large.bin", "huge.bin"}, nil)
+	rec = badge("/badge/Test-Org/badge-repo.svg")
+	assert.Contains(t, rec.Body.String(), `aria-label="Git LFS: 2 violations"`)
+	assert.Contains(t, rec.Body.String(), badgeViolations)
+
+	push("sha2", nil, []string{"large.bin", "huge.bin"})
+	rec = badge("/badge/test-org/badge-repo")
+	assert.Contains(t, rec.Body.String(), `aria-label="Git LFS: clean"`)
+	assert.Contains(t, rec.Body.String(), badgeClean)
+
+	assert.Equal(t, http.StatusNotFound, badge("/badge/test-org").Code)
+}
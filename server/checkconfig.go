@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// Time to authenticate as the App and list its installations
+const checkConfigTimeout = 30 * time.Second
+
+// app authenticates as the GitHub App
+type app interface {
+	App(ctx context.Context) (*github.App, error)
+	Installations(ctx context.Context) ([]*github.Installation, error)
+}
+
+// Mint an App JWT and have GitHub verify it, which fails if the App ID,
+// private key or GitHub URL are wrong
+func checkApp(a app, listInstallations bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), checkConfigTimeout)
+	defer cancel()
+
+	gitHubApp, err := a.App(ctx)
+	if err != nil {
+		return fmt.Errorf("could not authenticate as the GitHub App: %w", err)
+	}
+	log.Printf("authenticated as the GitHub App '%s' (ID %d)\n", gitHubApp.GetSlug(), gitHubApp.GetID())
+
+	if !listInstallations {
+		return nil
+	}
+	installations, err := a.Installations(ctx)
+	if err != nil {
+		return fmt.Errorf("could not list the installations: %w", err)
+	}
+	for _, installation := range installations {
+		log.Printf("installation %d on '%s'\n", installation.GetID(), installation.GetAccount().GetLogin())
+		verifyInstallation(installation)
+	}
+	if len(installations) == 0 {
+		log.Printf("the GitHub App is not installed on any organization or user\n")
+	}
+	return nil
+}
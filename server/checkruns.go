@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/redact"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/google/go-github/v35/github"
+)
+
+// Check a commit or pull request again in the background when a user
+// re-runs a check run or clicks its "Re-run check" button. GitHub only sends
+// these actions to the App that created the check run.
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#check_run
+func (h *Handler) rerunCheck(w http.ResponseWriter, e *github.CheckRunEvent, tenant *tenantSecret) {
+	rerequested := e.GetAction() == "rerequested" ||
+		e.GetAction() == "requested_action" && e.GetRequestedAction().Identifier == watchdog.RecheckAction
+	if !rerequested {
+		io.WriteString(w, fmt.Sprintf("ignoring '%s' check run\n", e.GetAction()))
+		return
+	}
+	owner, repo, sha := e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName(), e.GetCheckRun().GetHeadSHA()
+	if owner == "" || repo == "" || sha == "" {
+		message := "malformed check run payload\n"
+		log.Print(message)
+		http.Error(w, message, http.StatusUnprocessableEntity)
+		return
+	}
+	if !tenant.allows(owner) {
+		http.Error(w, "check run is signed with the secret of another tenant\n", http.StatusForbidden)
+		return
+	}
+
+	guard, err := h.clientGroup.GetWatchdog(owner, e.GetInstallation().GetID())
+	if err != nil {
+		log.Printf("could not obtain Watchdog client: %v\n", err)
+		http.Error(w, redact.String(err.Error()), 500)
+		return
+	}
+
+	pulls := e.GetCheckRun().PullRequests
+	if e.GetCheckRun().GetName() == watchdog.PullRequestCheckRunName && len(pulls) > 0 {
+		request := watchdog.PullRequestRequest{Owner: owner, Repo: repo, Number: pulls[0].GetNumber()}
+		h.checks.Add(1)
+		go func() {
+			defer h.checks.Done()
+			if _, err := guard.CheckPullRequest(context.Background(), request); err != nil {
+				log.Printf("could not check pull request #%d in '%s': %v\n", request.Number, e.GetRepo().GetFullName(), err)
+			}
+		}()
+		io.WriteString(w, fmt.Sprintf("checking pull request #%d again\n", request.Number))
+		return
+	}
+
+	h.checks.Add(1)
+	go func() {
+		defer h.checks.Done()
+		if _, err := guard.Recheck(context.Background(), owner, repo, sha); err != nil {
+			log.Printf("could not recheck '%s' in '%s': %v\n", sha, e.GetRepo().GetFullName(), err)
+		}
+	}()
+	io.WriteString(w, fmt.Sprintf("checking '%s' again\n", sha))
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRerunCheck(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	repo := "test-org/rerun-repo"
+	server.AddInstallation(repo, 1)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+
+	server.AddFile(repo, "sha1", ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\nlfsChecksEnabled: Yes\npullRequestChecksEnabled: Yes\n"))
+	server.AddFileWithSize(repo, "sha1", "large.bin", 2000)
+	server.AddCommit(repo, &github.RepositoryCommit{
+		SHA:   github.String("sha1"),
+		Files: []*github.CommitFile{{Filename: github.String("large.bin"), Status: github.String("added")}},
+	})
+	server.AddPullRequest(repo, &github.PullRequest{
+		Number: github.Int(9),
+		Head:   &github.PullRequestBranch{SHA: github.String("sha1")},
+	}, []*github.CommitFile{{Filename: github.String("large.bin"), Status: github.String("added")}})
+	event := func(action, name, extra string) int {
+		payload := fmt.Sprintf(`{
+			"action": "%s",
+			"check_run": {"name": "%s", "head_sha": "sha1", "pull_requests": [{"number": 9}]},
+			"installation": {"id": 1},
+			"repository": {"name": "rerun-repo", "full_name": "test-org/rerun-repo", "owner": {"login": "test-org"}}
+			%s
+		}`, action, name, extra)
+		w := eventRequest(handler, "check_run", []byte(payload))
+		handler.Wait()
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, event("requested_action", "LFSWatchDog", `, "requested_action": {"identifier": "recheck"}`))
+	runs := server.CheckRuns()
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, "LFSWatchDog", runs[0].Name)
+		assert.Equal(t, "failure", runs[0].GetConclusion())
+	}
+
+	assert.Equal(t, http.StatusOK, event("rerequested", "LFSWatchDog pull request", ""))
+	runs = server.CheckRuns()
+	if assert.Len(t, runs, 2) {
+		assert.Equal(t, "LFSWatchDog pull request", runs[1].Name)
+	}
+
+	// Other actions, including check runs the watchdog completed, are ignored
+	assert.Equal(t, http.StatusOK, event("completed", "LFSWatchDog", ""))
+	assert.Equal(t, http.StatusOK, event("requested_action", "LFSWatchDog", `, "requested_action": {"identifier": "other"}`))
+	assert.Len(t, server.CheckRuns(), 2)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/configdir"
+	"git.autodesk.com/github-solutions/lfswatchdog/redact"
+)
+
+const (
+	// Kubernetes takes up to a minute to update mounted Secrets, polling is
+	// cheap in comparison and works with the symlink swaps of Secret volumes
+	configDirPollInterval = 10 * time.Second
+	// The webhook settings of GitHub and the Secret are updated one after
+	// the other, deliveries signed with the previous secret are accepted
+	// for this long
+	secretGracePeriod = time.Hour
+)
+
+// credentials are the App credentials of a client group
+type credentials interface {
+	UpdateCredentials(appID int64)
+}
+
+// Poll the configuration directory and apply rotated credentials: the
+// webhook secret, the App ID and the private key, if it is in the directory.
+// Other settings require a restart.
+func watchConfigDir(dir string, config Config, handler *Handler, group credentials) {
+	settings, err := configdir.Read(dir)
+	if err != nil {
+		log.Printf("could not read the configuration directory '%s': %v\n", dir, err)
+	}
+
+	for range time.Tick(configDirPollInterval) {
+		current, err := configdir.Read(dir)
+		if err != nil {
+			log.Printf("could not read the configuration directory '%s': %v\n", dir, err)
+			continue
+		}
+		if settings != nil && !current.Equal(settings) {
+			applySettings(dir, config, settings, current, handler, group)
+		}
+		settings = current
+	}
+}
+
+func applySettings(dir string, config Config, previous, current configdir.Settings, handler *Handler, group credentials) {
+	var keyFile string
+	if filepath.Dir(filepath.Clean(config.PrivateKeyFile)) == filepath.Clean(dir) {
+		keyFile = filepath.Base(config.PrivateKeyFile)
+	}
+
+	var changed []string
+	for name := range union(previous, current) {
+		if previous.Getenv(name) != current.Getenv(name) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+
+	var rotateApp bool
+	for _, name := range changed {
+		switch name {
+		case "LFSWATCHDOG_SECRET":
+			secret := current.Getenv(name)
+			if secret == "" {
+				log.Printf("ignoring the empty webhook secret in '%s'\n", dir)
+				continue
+			}
+			redact.AddValue(secret)
+			handler.SetSecret(secret)
+			log.Printf("rotated the webhook secret, the previous one is accepted for %s\n", secretGracePeriod)
+		case "GITHUB_APP_ID", keyFile:
+			rotateApp = true
+		default:
+			log.Printf("setting '%s' changed, restart to apply it\n", name)
+		}
+	}
+
+	if rotateApp {
+		appID, err := strconv.ParseInt(current.Getenv("GITHUB_APP_ID"), 10, 64)
+		if err != nil {
+			log.Printf("ignoring the invalid GITHUB_APP_ID in '%s'\n", dir)
+			return
+		}
+		group.UpdateCredentials(appID)
+		log.Printf("rotated the GitHub App credentials\n")
+	}
+}
+
+func union(a, b configdir.Settings) map[string]bool {
+	names := make(map[string]bool, len(a)+len(b))
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+	return names
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/configdir"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingCredentials struct {
+	appIDs []int64
+}
+
+func (c *recordingCredentials) UpdateCredentials(appID int64) {
+	c.appIDs = append(c.appIDs, appID)
+}
+
+func TestApplySettings(t *testing.T) {
+	config := Config{PrivateKeyFile: "/etc/lfswatchdog/GITHUB_APP_PRIVATE_KEY"}
+	handler := NewHandler(nil, "secret1")
+	group := &recordingCredentials{}
+	previous := configdir.Settings{"LFSWATCHDOG_SECRET": "secret1", "GITHUB_APP_ID": "1", "GITHUB_APP_PRIVATE_KEY": "key1"}
+
+	// Other settings require a restart
+	applySettings("/etc/lfswatchdog", config, previous, configdir.Settings{"LFSWATCHDOG_SECRET": "secret1", "GITHUB_APP_ID": "1", "GITHUB_APP_PRIVATE_KEY": "key1", "LFSWATCHDOG_PORT": "9000"}, handler, group)
+	assert.Equal(t, "secret1", string(handler.webhookSecret()))
+	assert.Empty(t, group.appIDs)
+
+	applySettings("/etc/lfswatchdog", config, previous, configdir.Settings{"LFSWATCHDOG_SECRET": "secret2", "GITHUB_APP_ID": "1", "GITHUB_APP_PRIVATE_KEY": "key1"}, handler, group)
+	assert.Equal(t, "secret2", string(handler.webhookSecret()))
+	assert.Empty(t, group.appIDs)
+
+	applySettings("/etc/lfswatchdog", config, previous, configdir.Settings{"LFSWATCHDOG_SECRET": "secret1", "GITHUB_APP_ID": "1", "GITHUB_APP_PRIVATE_KEY": "key2"}, handler, group)
+	assert.Equal(t, []int64{1}, group.appIDs)
+
+	applySettings("/etc/lfswatchdog", config, previous, configdir.Settings{"LFSWATCHDOG_SECRET": "secret1", "GITHUB_APP_ID": "2", "GITHUB_APP_PRIVATE_KEY": "key1"}, handler, group)
+	assert.Equal(t, []int64{1, 2}, group.appIDs)
+
+	// Invalid and empty values are ignored
+	applySettings("/etc/lfswatchdog", config, previous, configdir.Settings{"LFSWATCHDOG_SECRET": "", "GITHUB_APP_ID": "x", "GITHUB_APP_PRIVATE_KEY": "key1"}, handler, group)
+	assert.Equal(t, []int64{1, 2}, group.appIDs)
+	assert.Equal(t, "secret2", string(handler.webhookSecret()))
+}
+
+func TestPreviousSecretGracePeriod(t *testing.T) {
+	handler := NewHandler(&fakeWatchdogs{}, "secret")
+	defer handler.Wait()
+	ping := []byte(`{"zen": "Keep it logically awesome.", "hook_id": 1}`)
+
+	// Deliveries signed with the previous secret are accepted for a while
+	handler.SetSecret("rotated")
+	assert.Equal(t, http.StatusOK, eventRequest(handler, "ping", ping).Code)
+
+	handler.previousSecretUntil = time.Now().Add(-time.Second)
+	assert.Equal(t, http.StatusBadRequest, eventRequest(handler, "ping", ping).Code)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/redact"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/google/go-github/v35/github"
+)
+
+// Sent to Apps that are enabled as a deployment protection rule of an
+// environment, which go-github doesn't know yet
+const deploymentProtectionRuleEvent = "deployment_protection_rule"
+
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#deployment_protection_rule
+type deploymentProtectionRule struct {
+	Action                string               `json:"action"`
+	Environment           string               `json:"environment"`
+	DeploymentCallbackURL string               `json:"deployment_callback_url"`
+	Deployment            *github.Deployment   `json:"deployment"`
+	Repo                  *github.Repository   `json:"repository"`
+	Installation          *github.Installation `json:"installation"`
+}
+
+// Review a deployment waiting for the App in the background. GitHub keeps
+// the deployment waiting until the review is posted to the callback URL.
+func (h *Handler) reviewDeployment(w http.ResponseWriter, payload []byte, tenant *tenantSecret) {
+	var e deploymentProtectionRule
+	if err := json.Unmarshal(payload, &e); err != nil {
+		message := fmt.Sprintf("could not parse webhook: err=%v\n", err)
+		log.Print(message)
+		http.Error(w, message, 400)
+		return
+	}
+	if e.Action != "requested" {
+		io.WriteString(w, fmt.Sprintf("ignoring '%s' deployment protection rule\n", e.Action))
+		return
+	}
+	if e.Deployment.GetSHA() == "" || e.DeploymentCallbackURL == "" || e.Repo.GetOwner().GetLogin() == "" || e.Repo.GetName() == "" {
+		message := "malformed deployment protection rule payload\n"
+		log.Print(message)
+		http.Error(w, message, http.StatusUnprocessableEntity)
+		return
+	}
+	owner := e.Repo.GetOwner().GetLogin()
+	if !tenant.allows(owner) {
+		http.Error(w, "deployment protection rule is signed with the secret of another tenant\n", http.StatusForbidden)
+		return
+	}
+
+	guard, err := h.clientGroup.GetWatchdog(owner, e.Installation.GetID())
+	if err != nil {
+		log.Printf("could not obtain Watchdog client: %v\n", err)
+		http.Error(w, redact.String(err.Error()), 500)
+		return
+	}
+
+	request := watchdog.DeploymentRequest{
+		Owner:       owner,
+		Repo:        e.Repo.GetName(),
+		Environment: e.Environment,
+		Ref:         e.Deployment.GetRef(),
+		SHA:         e.Deployment.GetSHA(),
+		CallbackURL: e.DeploymentCallbackURL,
+	}
+	h.checks.Add(1)
+	go func() {
+		defer h.checks.Done()
+		if _, err := guard.ReviewDeployment(context.Background(), request); err != nil {
+			log.Printf("could not review the deployment of '%s' in '%s': %v\n", request.SHA, e.Repo.GetFullName(), err)
+		}
+	}()
+	io.WriteString(w, fmt.Sprintf("reviewing the deployment of '%s' to '%s'\n", request.SHA, request.Environment))
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeploymentProtectionRule(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	repo := "test-org/deploy-repo"
+	server.AddInstallation(repo, 1)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+
+	push := func(sha, file string, size int) {
+		server.AddFile(repo, sha, ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+		server.AddFileWithSize(repo, sha, file, size)
+		payload := fmt.Sprintf(`{
+			"ref": "refs/heads/main",
+			"installation": {"id": 1},
+			"repository": {"name": "deploy-repo", "full_name": "test-org/deploy-repo", "owner": {"login": "test-org"}},
+			"commits": [{"id": "%s", "distinct": true, "modified": ["%s"]}]
+		}`, sha, file)
+		assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(payload)).Code)
+		handler.Wait()
+	}
+	deploy := func(sha string) githubtest.DeploymentReview {
+		payload := fmt.Sprintf(`{
+			"action": "requested",
+			"environment": "production",
+			"deployment_callback_url": "%s",
+			"deployment": {"sha": "%s", "ref": "main"},
+			"installation": {"id": 1},
+			"repository": {"name": "deploy-repo", "full_name": "test-org/deploy-repo", "owner": {"login": "test-org"}}
+		}`, server.DeploymentCallbackURL(repo, "42"), sha)
+		w := eventRequest(handler, "deployment_protection_rule", []byte(payload))
+		assert.Equal(t, http.StatusOK, w.Code)
+		handler.Wait()
+		reviews := server.DeploymentReviews()
+		if !assert.NotEmpty(t, reviews) {
+			return githubtest.DeploymentReview{}
+		}
+		return reviews[len(reviews)-1]
+	}
+
+	// Commits the watchdog didn't check can't be deployed
+	review := deploy("sha0")
+	assert.Equal(t, githubtest.DeploymentReview{Repo: repo, Run: "42", Environment: "production", State: "rejected",
+		Comment: "`sha0` was not checked for Git LFS problems. Only commits with a watchdog status or check run can be deployed, " +
+			"see `lfsCommitStatusEnabled` and `lfsChecksEnabled`."}, review)
+
+	push("sha1", "large.bin", 2000)
+	review = deploy("sha1")
+	assert.Equal(t, "rejected", review.State)
+	assert.Equal(t, "`sha1` failed the Git LFS checks (`LFSWatchDog`: 1 file >1000B).", review.Comment)
+
+	// Later commits pass, but the file is still on the branch
+	push("sha2", "small.txt", 10)
+	review = deploy("sha2")
+	assert.Equal(t, "rejected", review.State)
+	assert.Equal(t, "1 file on `main` still has Git LFS findings reported on earlier commits: `large.bin`.", review.Comment)
+
+	push("sha3", "large.bin", 100)
+	review = deploy("sha3")
+	assert.Equal(t, "approved", review.State)
+	assert.Equal(t, "`sha3` passed the Git LFS checks.", review.Comment)
+
+	// Other actions are acknowledged
+	w := eventRequest(handler, "deployment_protection_rule", []byte(`{"action": "completed"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, server.DeploymentReviews(), 4)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"github.com/google/go-github/v35/github"
+)
+
+// Installations by repository full name for pushes of organization and
+// enterprise webhooks. Unlike App webhooks, their payloads don't name the
+// installation, and looking it up authenticates as the App.
+var installationCache = cache.New("installations", cache.Options{MaxEntries: 10000, TTL: time.Hour})
+
+// Fill in the installation of a push delivered by an organization or
+// enterprise webhook, so that it can be checked like a push of the App
+// webhook. Returns scm.ErrNotFound if the App is not installed on the
+// repository.
+func (h *Handler) resolveInstallation(ctx context.Context, e *github.PushEvent) error {
+	if e.GetInstallation().GetID() != 0 {
+		return nil
+	}
+	fullName := e.GetRepo().GetFullName()
+	if id, ok := installationCache.Get(fullName); ok {
+		e.Installation = &github.Installation{ID: github.Int64(id.(int64))}
+		return nil
+	}
+	id, err := h.clientGroup.FindInstallation(ctx, e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName())
+	if err != nil {
+		return err
+	}
+	installationCache.Add(fullName, id)
+	e.Installation = &github.Installation{ID: github.Int64(id)}
+	return nil
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// A push of an organization webhook, which names no installation
+const orgHookPush = `{
+	"ref": "refs/heads/main",
+	"repository": {"name": "hook-repo", "full_name": "test-org/hook-repo", "owner": {"login": "test-org"}},
+	"organization": {"login": "test-org"},
+	"commits": [
+		{"id": "sha1", "distinct": true, "added": ["large.bin"], "modified": [], "removed": [], "author": {"username": "jdoe"}}
+	]
+}`
+
+func TestOrganizationWebhook(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddInstallation("test-org/hook-repo", 7)
+	server.AddFile("test-org/hook-repo", "sha1", ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/hook-repo", "sha1", "large.bin", 2000)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+
+	assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(orgHookPush)).Code)
+	handler.Wait()
+	statuses := server.Statuses()
+	if assert.NotEmpty(t, statuses) {
+		assert.Equal(t, "failure", statuses[len(statuses)-1].State)
+	}
+
+	// The installation is looked up once
+	assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(orgHookPush)).Code)
+	handler.Wait()
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/hook-repo/installation"))
+
+	// Pushes to repositories without the App are ignored
+	w := pushRequest(handler, []byte(strings.Replace(orgHookPush, "hook-repo", "other-repo", -1)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "not installed")
+	handler.Wait()
+	assert.Equal(t, 0, server.Calls("GET repos/test-org/other-repo/contents/"))
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+const (
+	// adminInstallationsPath lists the installation settings, an
+	// installation ID may follow
+	adminInstallationsPath = "/admin/installations/"
+
+	// Installation settings are kept in this subdirectory of the job
+	// directory, one JSON file per installation
+	installationSettingsDir = "installations"
+)
+
+// installationStore persists installation settings in a directory
+type installationStore struct {
+	dir string
+}
+
+// Open the settings directory and apply the stored settings
+func openInstallationStore(jobDir string) (*installationStore, error) {
+	store := &installationStore{dir: filepath.Join(jobDir, installationSettingsDir)}
+	if err := os.MkdirAll(store.dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		id, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), ".json"), 10, 64)
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") || err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(store.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var settings watchdog.InstallationSettings
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("invalid settings '%s': %w", f.Name(), err)
+		}
+		if _, err := watchdog.SetInstallationSettings(id, settings); err != nil {
+			return nil, fmt.Errorf("invalid settings '%s': %w", f.Name(), err)
+		}
+	}
+	return store, nil
+}
+
+func (store *installationStore) path(installationID int64) string {
+	return filepath.Join(store.dir, fmt.Sprintf("%d.json", installationID))
+}
+
+// Write to a temporary file and rename it, so that a crash never leaves
+// partially written settings
+func (store *installationStore) save(installationID int64, settings watchdog.InstallationSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	tmp := store.path(installationID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, store.path(installationID))
+}
+
+func (store *installationStore) remove(installationID int64) error {
+	err := os.Remove(store.path(installationID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// installationsHandler serves the installation settings to callers
+// presenting the admin token. Settings are only kept in memory without a
+// store.
+type installationsHandler struct {
+	token string
+	store *installationStore
+}
+
+func (h *installationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, adminInstallationsPath)
+	if path == "" {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(watchdog.AllInstallationSettings())
+		return
+	}
+	installationID, err := strconv.ParseInt(path, 10, 64)
+	if err != nil || installationID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var settings watchdog.InstallationSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "invalid settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		settings, err = watchdog.SetInstallationSettings(installationID, settings)
+		if err != nil {
+			http.Error(w, "invalid settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if h.store != nil {
+			if err := h.store.save(installationID, settings); err != nil {
+				log.Printf("could not store the settings of installation %d: %v\n", installationID, err)
+				http.Error(w, "could not store the settings", http.StatusInternalServerError)
+				return
+			}
+		}
+		log.Printf("settings of installation %d set to %+v via %s\n", installationID, settings, adminInstallationsPath)
+	case http.MethodDelete:
+		watchdog.SetInstallationSettings(installationID, watchdog.InstallationSettings{})
+		if h.store != nil {
+			if err := h.store.remove(installationID); err != nil {
+				log.Printf("could not remove the settings of installation %d: %v\n", installationID, err)
+				http.Error(w, "could not remove the settings", http.StatusInternalServerError)
+				return
+			}
+		}
+		log.Printf("settings of installation %d removed via %s\n", installationID, adminInstallationsPath)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, _ := watchdog.GetInstallationSettings(installationID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
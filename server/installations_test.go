@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/stretchr/testify/assert"
+)
+
+func installationsRequest(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, adminInstallationsPath+path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestInstallationSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lfswatchdog-installations")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer watchdog.SetInstallationSettings(42, watchdog.InstallationSettings{})
+
+	store, err := openInstallationStore(dir)
+	assert.Nil(t, err)
+	handler := &installationsHandler{token: "admin-token", store: store}
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(handler, http.MethodGet, "", "").Code)
+
+	w := installationsRequest(handler, http.MethodPut, "42", `{"dryRun": true, "disabledRules": ["oversize-file"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"dryRun": true, "disabledRules": ["LFS001"]}`, w.Body.String())
+
+	w = installationsRequest(handler, http.MethodGet, "", "")
+	assert.JSONEq(t, `{"42": {"dryRun": true, "disabledRules": ["LFS001"]}}`, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, installationsRequest(handler, http.MethodPut, "42", `{"disabledRules": ["LFS999"]}`).Code)
+	assert.Equal(t, http.StatusNotFound, installationsRequest(handler, http.MethodGet, "acme", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, installationsRequest(handler, http.MethodPost, "42", "").Code)
+
+	// The settings survive a restart
+	watchdog.SetInstallationSettings(42, watchdog.InstallationSettings{})
+	_, err = openInstallationStore(dir)
+	assert.Nil(t, err)
+	settings, ok := watchdog.GetInstallationSettings(42)
+	assert.True(t, ok)
+	assert.True(t, settings.DryRun)
+
+	w = installationsRequest(handler, http.MethodDelete, "42", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{}`, w.Body.String())
+	_, ok = watchdog.GetInstallationSettings(42)
+	assert.False(t, ok)
+	_, err = openInstallationStore(dir)
+	assert.Nil(t, err)
+	_, ok = watchdog.GetInstallationSettings(42)
+	assert.False(t, ok)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"github.com/google/go-github/v35/github"
+)
+
+const (
+	// Number of recent pushes the p95 latency is computed from
+	latencyWindow = 200
+	// The alert hook is not called before this many pushes were observed
+	minLatencySamples = 20
+
+	alertTimeout = 10 * time.Second
+)
+
+var (
+	pushLatency = metrics.NewHistogram("lfswatchdog_push_latency_seconds",
+		"Time from a push to the completion of its report.",
+		[]float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600})
+	pushLatencyP95 = metrics.NewGauge("lfswatchdog_push_latency_p95_seconds",
+		"95th percentile of the push latency of recent pushes.")
+)
+
+// Latency alert hook states
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// LatencyAlert is posted as JSON to the alert hook when the p95 push
+// latency crosses the SLO, and again when it recovers
+type LatencyAlert struct {
+	Status     string  `json:"status"`
+	P95Seconds float64 `json:"p95Seconds"`
+	SLOSeconds float64 `json:"sloSeconds"`
+	Pushes     int     `json:"pushes"`
+}
+
+// latencyTracker observes the time between pushes and the completion of
+// their reports, so that we know when the watchdog falls behind GitHub
+type latencyTracker struct {
+	slo      time.Duration
+	alertURL string
+	// post sends an alert, replaced in tests
+	post func(alert *LatencyAlert) error
+
+	mu      sync.Mutex
+	samples []float64
+	next    int
+	firing  bool
+}
+
+func newLatencyTracker(slo time.Duration, alertURL string) *latencyTracker {
+	t := &latencyTracker{slo: slo, alertURL: alertURL, samples: make([]float64, 0, latencyWindow)}
+	t.post = t.postAlert
+	return t
+}
+
+// observe records the latency of a push that was reported at done.
+// Pushes without a timestamp are ignored.
+func (t *latencyTracker) observe(event *github.PushEvent, done time.Time) {
+	pushedAt := event.GetRepo().GetPushedAt().Time
+	if pushedAt.IsZero() {
+		return
+	}
+	// The clocks of GitHub and the watchdog may differ
+	latency := math.Max(done.Sub(pushedAt).Seconds(), 0)
+	pushLatency.Observe(latency)
+
+	t.mu.Lock()
+	if len(t.samples) < latencyWindow {
+		t.samples = append(t.samples, latency)
+	} else {
+		t.samples[t.next] = latency
+		t.next = (t.next + 1) % latencyWindow
+	}
+	p95 := percentile(t.samples, 0.95)
+	pushes := len(t.samples)
+	pushLatencyP95.Set(p95)
+
+	var alert *LatencyAlert
+	if t.slo > 0 && pushes >= minLatencySamples {
+		breached := p95 > t.slo.Seconds()
+		if breached != t.firing {
+			t.firing = breached
+			alert = &LatencyAlert{Status: alertResolved, P95Seconds: p95, SLOSeconds: t.slo.Seconds(), Pushes: pushes}
+			if breached {
+				alert.Status = alertFiring
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	if alert == nil {
+		return
+	}
+	log.Printf("push latency alert is %s: p95 of %.1fs with an SLO of %s\n", alert.Status, alert.P95Seconds, t.slo)
+	if t.alertURL != "" {
+		if err := t.post(alert); err != nil {
+			log.Printf("could not call the latency alert hook: %v\n", err)
+		}
+	}
+}
+
+func (t *latencyTracker) postAlert(alert *LatencyAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: alertTimeout}
+	resp, err := client.Post(t.alertURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Return the p-th percentile of values with the nearest-rank method
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
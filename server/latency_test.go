@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	var alerts []LatencyAlert
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert LatencyAlert
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&alert))
+		alerts = append(alerts, alert)
+	}))
+	defer hook.Close()
+
+	tracker := newLatencyTracker(time.Minute, hook.URL)
+	now := time.Now()
+	push := func(latency time.Duration) {
+		tracker.observe(&github.PushEvent{
+			Repo: &github.PushEventRepository{PushedAt: &github.Timestamp{Time: now.Add(-latency)}},
+		}, now)
+	}
+
+	// Pushes without a timestamp are ignored
+	tracker.observe(&github.PushEvent{}, now)
+	assert.Empty(t, tracker.samples)
+
+	// The hook isn't called before enough pushes were observed
+	for i := 0; i < minLatencySamples-1; i++ {
+		push(2 * time.Minute)
+	}
+	assert.Empty(t, alerts)
+	push(2 * time.Minute)
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, LatencyAlert{Status: alertFiring, P95Seconds: 120, SLOSeconds: 60, Pushes: minLatencySamples}, alerts[0])
+	}
+
+	// Still firing, the hook is called once per change
+	push(2 * time.Minute)
+	assert.Len(t, alerts, 1)
+
+	for i := 0; i < latencyWindow; i++ {
+		push(10 * time.Second)
+	}
+	if assert.Len(t, alerts, 2) {
+		assert.Equal(t, alertResolved, alerts[1].Status)
+		assert.Equal(t, latencyWindow, alerts[1].Pushes)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	assert.Equal(t, 0.0, percentile(nil, 0.95))
+	assert.Equal(t, 3.0, percentile([]float64{3}, 0.95))
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = float64(100 - i)
+	}
+	assert.Equal(t, 95.0, percentile(values, 0.95))
+}
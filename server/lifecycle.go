@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+const (
+	healthPath = "/healthz"
+	// adminDrainPath drains the server before it is stopped, e.g. from a
+	// Kubernetes preStop hook
+	adminDrainPath = "/admin/drain"
+
+	// Time for load balancers to notice a failing health check before the
+	// listener closes
+	defaultDrainDelay = 10 * time.Second
+	// Time for in-flight requests and background checks to finish
+	shutdownTimeout = 60 * time.Second
+
+	// First file descriptor passed by systemd socket activation
+	listenFdsStart = 3
+)
+
+// draining is set once the server received SIGTERM or was drained via
+// adminDrainPath
+var draining int32
+
+// rejecting is set once the server was drained via adminDrainPath, which
+// rejects new deliveries, so that GitHub shows them as failed and they can
+// be redelivered to another replica
+var rejecting int32
+
+// Report readiness to load balancers
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&draining) != 0 {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+// Reject a delivery to a drained server
+func rejectDrained(w http.ResponseWriter, r *http.Request) bool {
+	if atomic.LoadInt32(&rejecting) == 0 {
+		return false
+	}
+	log.Printf("rejecting delivery '%s': the server is draining\n", github.DeliveryID(r))
+	w.Header().Set("Retry-After", strconv.Itoa(int(overloadRetryAfter.Seconds())))
+	http.Error(w, "the server is draining\n", http.StatusServiceUnavailable)
+	return true
+}
+
+// drainHandler stops accepting deliveries and waits for the pending checks
+// for callers presenting the admin token. It responds once all checks are
+// finished or after the "timeout" query parameter, which defaults to
+// shutdownTimeout, so that it fits into the termination grace period.
+type drainHandler struct {
+	token   string
+	handler *Handler
+}
+
+func (h *drainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	timeout := shutdownTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		var err error
+		timeout, err = time.ParseDuration(t)
+		if err != nil || timeout <= 0 {
+			http.Error(w, "invalid timeout: "+t, http.StatusBadRequest)
+			return
+		}
+	}
+
+	atomic.StoreInt32(&draining, 1)
+	atomic.StoreInt32(&rejecting, 1)
+	log.Printf("draining via %s for up to %s\n", adminDrainPath, timeout)
+
+	done := make(chan struct{})
+	go func() {
+		h.handler.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Printf("drained via %s\n", adminDrainPath)
+		io.WriteString(w, "drained\n")
+	case <-time.After(timeout):
+		message := fmt.Sprintf("%d pushes still pending after %s\n", atomic.LoadInt32(&h.handler.pending), timeout)
+		log.Print(message)
+		http.Error(w, message, http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+// Listen on the socket passed by systemd socket activation, if any,
+// otherwise on port.
+// c.f. https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+func listen(port string) (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return net.Listen("tcp", ":"+port)
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, fmt.Errorf("socket activation without sockets: LISTEN_FDS='%s'", os.Getenv("LISTEN_FDS"))
+	}
+	// The variables must not be inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	return net.FileListener(os.NewFile(listenFdsStart, "LISTEN_FD_3"))
+}
+
+// Serve until SIGTERM or SIGINT, then drain: fail the health check, wait
+// for load balancers to stop sending deliveries, stop accepting
+// connections and wait for in-flight deliveries and checks.
+func serve(server *http.Server, listener net.Listener, handler *Handler, drainDelay time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Printf("received %s, draining for %s\n", sig, drainDelay)
+	}
+
+	// Load balancers noticed already if the server was drained via
+	// adminDrainPath
+	if atomic.SwapInt32(&draining, 1) == 0 {
+		time.Sleep(drainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		handler.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Printf("drained, exiting\n")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("checks still running after %s", shutdownTimeout)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrain(t *testing.T) {
+	defer atomic.StoreInt32(&draining, 0)
+	defer atomic.StoreInt32(&rejecting, 0)
+	handler := NewHandler(nil, "secret")
+	drain := &drainHandler{token: "admin-token", handler: handler}
+	request := func(method, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, adminDrainPath+query, nil)
+		r.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		drain.ServeHTTP(w, r)
+		return w
+	}
+	health := func() int {
+		w := httptest.NewRecorder()
+		serveHealth(w, httptest.NewRequest(http.MethodGet, healthPath, nil))
+		return w.Code
+	}
+	ping := []byte(`{"zen": "Keep it logically awesome.", "hook_id": 1}`)
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(drain, http.MethodPost, "", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "?timeout=soon").Code)
+	assert.Equal(t, http.StatusOK, health())
+	assert.Equal(t, http.StatusOK, eventRequest(handler, "ping", ping).Code)
+
+	// Pending checks are waited for until the timeout
+	handler.checks.Add(1)
+	assert.Equal(t, http.StatusServiceUnavailable, request(http.MethodPost, "?timeout=10ms").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, health())
+	w := eventRequest(handler, "ping", ping)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	handler.checks.Done()
+	w = request(http.MethodPost, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "drained\n", w.Body.String())
+}
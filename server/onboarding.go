@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/google/go-github/v35/github"
+)
+
+// The onboarding times are kept in this subdirectory of the job directory
+const onboardingDir = "onboarding"
+
+// onboardingStore persists when the App was installed on each repository
+type onboardingStore struct {
+	file string
+}
+
+// Open the onboarding directory and restore the stored onboarding times
+func openOnboardingStore(jobDir string) (*onboardingStore, error) {
+	dir := filepath.Join(jobDir, onboardingDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	store := &onboardingStore{file: filepath.Join(dir, "repos.json")}
+	data, err := ioutil.ReadFile(store.file)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var since map[string]time.Time
+	if err := json.Unmarshal(data, &since); err != nil {
+		return nil, err
+	}
+	for repo, at := range since {
+		watchdog.SetOnboarded(repo, at)
+	}
+	return store, nil
+}
+
+// Write to a temporary file and rename it, so that a crash never leaves a
+// partially written file
+func (store *onboardingStore) save() error {
+	data, err := json.Marshal(watchdog.AllOnboarded())
+	if err != nil {
+		return err
+	}
+	tmp := store.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, store.file)
+}
+
+// Record that the App was installed on repositories. Repositories that
+// were onboarded before keep their time, so that reinstalling the App
+// doesn't restart their grace period.
+func (h *Handler) onboard(repos []*github.Repository) int {
+	h.onboardingMu.Lock()
+	defer h.onboardingMu.Unlock()
+
+	now := time.Now()
+	var added int
+	for _, repo := range repos {
+		if _, ok := watchdog.Onboarded(repo.GetFullName()); ok || repo.GetFullName() == "" {
+			continue
+		}
+		watchdog.SetOnboarded(repo.GetFullName(), now)
+		log.Printf("'%s' was onboarded\n", repo.GetFullName())
+		added++
+	}
+	if added > 0 && h.onboarding != nil {
+		if err := h.onboarding.save(); err != nil {
+			log.Printf("could not store the onboarded repositories: %v\n", err)
+		}
+	}
+	return added
+}
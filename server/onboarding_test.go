@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/clientgroup"
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/stretchr/testify/assert"
+)
+
+const repositoriesAdded = `{
+	"action": "added",
+	"installation": {"id": 7, "account": {"login": "test-org"}},
+	"repositories_added": [{"full_name": "test-org/onboarded-repo"}]
+}`
+
+func TestGracePeriod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lfswatchdog-onboarding")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	watchdog.SetGracePeriod(24 * time.Hour)
+	defer watchdog.SetGracePeriod(0)
+
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddInstallation("test-org/onboarded-repo", 7)
+	server.AddFile("test-org/onboarded-repo", "sha1", ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/onboarded-repo", "sha1", "large.bin", 2000)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+	handler.onboarding, err = openOnboardingStore(dir)
+	assert.Nil(t, err)
+
+	w := eventRequest(handler, "installation_repositories", []byte(repositoriesAdded))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "onboarded 1 repositories\n", w.Body.String())
+	onboarded, ok := watchdog.Onboarded("test-org/onboarded-repo")
+	assert.True(t, ok)
+
+	// Adding the repository again keeps its grace period
+	w = eventRequest(handler, "installation_repositories", []byte(repositoriesAdded))
+	assert.Equal(t, "onboarded 0 repositories\n", w.Body.String())
+
+	// Errors are reported as warnings during the grace period
+	push := strings.Replace(orgHookPush, "hook-repo", "onboarded-repo", -1)
+	assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(push)).Code)
+	handler.Wait()
+	statuses := server.Statuses()
+	if assert.NotEmpty(t, statuses) {
+		assert.Equal(t, "success", statuses[len(statuses)-1].State)
+	}
+
+	watchdog.SetGracePeriod(time.Nanosecond)
+	assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(push)).Code)
+	handler.Wait()
+	statuses = server.Statuses()
+	assert.Equal(t, "failure", statuses[len(statuses)-1].State)
+
+	// The onboarding times survive a restart
+	watchdog.SetOnboarded("test-org/onboarded-repo", time.Time{})
+	_, err = openOnboardingStore(dir)
+	assert.Nil(t, err)
+	restored, _ := watchdog.Onboarded("test-org/onboarded-repo")
+	assert.True(t, onboarded.Equal(restored))
+
+	// Tenants can't onboard the repositories of other organizations
+	other := NewHandler(&fakeWatchdogs{server}, "default-secret")
+	other.SetTenants([]clientgroup.Tenant{{Orgs: []string{"another-org"}, Secret: "secret"}})
+	assert.Equal(t, http.StatusForbidden, eventRequest(other, "installation_repositories", []byte(repositoriesAdded)).Code)
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// Check that a push payload has the fields the watchdog relies on.
+// Payloads are validated by their signature, but may still be incomplete,
+// e.g. when replayed by hand or sent by a proxy. Pushes of organization
+// and enterprise webhooks have no installation, it is looked up instead.
+func validatePushEvent(e *github.PushEvent) error {
+	repo := e.GetRepo()
+	if repo.GetFullName() == "" || repo.GetName() == "" || repo.GetOwner().GetLogin() == "" {
+		return errors.New("push has no repository full name, name or owner login")
+	}
+	for i, commit := range e.Commits {
+		if commit.GetID() == "" {
+			return fmt.Errorf("commit %d of the push has no ID", i)
+		}
+	}
+	return nil
+}
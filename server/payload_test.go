@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const validPush = `{
+	"ref": "refs/heads/main",
+	"installation": {"id": 1},
+	"repository": {"name": "payload-repo", "full_name": "test-org/payload-repo", "owner": {"login": "test-org"}, "pushed_at": 1600000000},
+	"pusher": {"name": "jdoe"},
+	"commits": [
+		{"id": "sha1", "distinct": true, "added": ["large.bin"], "modified": [], "removed": [], "author": {"username": "jdoe", "email": "jdoe@example.com"}}
+	]
+}`
+
+func pushRequest(handler http.Handler, payload []byte) *httptest.ResponseRecorder {
+	return eventRequest(handler, "push", payload)
+}
+
+func eventRequest(handler http.Handler, event string, payload []byte) *httptest.ResponseRecorder {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+	r := httptest.NewRequest(http.MethodPost, defaultPath, bytes.NewReader(payload))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-GitHub-Event", event)
+	r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestMalformedPushPayloads(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFileWithSize("test-org/payload-repo", "sha1", "large.bin", 1000)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+	defer handler.Wait()
+
+	assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(validPush)).Code)
+
+	for name, payload := range map[string]string{
+		"no repository": `{"installation": {"id": 1}}`,
+		"no owner":      `{"installation": {"id": 1}, "repository": {"name": "r", "full_name": "o/r"}}`,
+		"null commit":   `{"installation": {"id": 1}, "repository": {"name": "r", "full_name": "o/r", "owner": {"login": "o"}}, "commits": [null]}`,
+		"no commit ID":  `{"installation": {"id": 1}, "repository": {"name": "r", "full_name": "o/r", "owner": {"login": "o"}}, "commits": [{"distinct": true}]}`,
+	} {
+		w := pushRequest(handler, []byte(payload))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, name)
+		assert.Contains(t, w.Body.String(), "malformed push payload", name)
+	}
+	// Payloads that don't decode are bad requests
+	assert.Equal(t, http.StatusBadRequest, pushRequest(handler, []byte(`{"commits": "sha1"}`)).Code)
+}
+
+// Mutate a decoded JSON value by deleting keys or replacing values with
+// values of other types, e.g. null
+func mutate(rnd *rand.Rand, v interface{}) interface{} {
+	replacements := []interface{}{nil, "", "x", 0.0, -1.0, true, []interface{}{}, []interface{}{nil}, map[string]interface{}{}}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			switch rnd.Intn(8) {
+			case 0:
+				delete(v, k)
+			case 1:
+				v[k] = replacements[rnd.Intn(len(replacements))]
+			default:
+				v[k] = mutate(rnd, child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if rnd.Intn(8) == 0 {
+				v[i] = replacements[rnd.Intn(len(replacements))]
+			} else {
+				v[i] = mutate(rnd, child)
+			}
+		}
+	}
+	return v
+}
+
+func TestFuzzPushPayloads(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	// Mutated file names would be looked up again until they time out,
+	// fail fast instead. Lookups of the installation of pushes without one
+	// fail, too.
+	server.InjectError("GET", "repos/", http.StatusBadGateway, 1<<20)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		var event interface{}
+		assert.Nil(t, json.Unmarshal([]byte(validPush), &event))
+		payload, err := json.Marshal(mutate(rnd, event))
+		assert.Nil(t, err)
+
+		code := pushRequest(handler, payload).Code
+		assert.Contains(t, []int{http.StatusOK, http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusInternalServerError}, code, string(payload))
+	}
+	// Background checks of accepted payloads must not panic either
+	handler.Wait()
+}
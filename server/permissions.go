@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"github.com/google/go-github/v35/github"
+)
+
+// adminPermissionsPath lists the permissions that installations lack
+const adminPermissionsPath = "/admin/permissions"
+
+// requiredPermission is a permission the watchdog needs on every
+// installation, and what fails without it
+type requiredPermission struct {
+	name, level string
+	granted     func(*github.InstallationPermissions) string
+	usedFor     string
+}
+
+var requiredPermissions = []requiredPermission{
+	{"contents", "read", (*github.InstallationPermissions).GetContents, "reading files and configurations"},
+	{"statuses", "write", (*github.InstallationPermissions).GetStatuses, "commit statuses"},
+	{"checks", "write", (*github.InstallationPermissions).GetChecks, "check runs"},
+}
+
+var missingPermissionsGauge = metrics.NewGauge("lfswatchdog_installation_missing_permissions",
+	"Set to 1 for every permission the watchdog requires that an installation was not granted.", "installation", "permission")
+
+// installationPermissions are the results of verifying an installation
+type installationPermissions struct {
+	Installation int64     `json:"installation"`
+	Account      string    `json:"account"`
+	Missing      []string  `json:"missing"`
+	Verified     time.Time `json:"verified"`
+}
+
+// Results of the last verification by installation ID
+var verifiedPermissions = struct {
+	sync.Mutex
+	installations map[int64]installationPermissions
+}{installations: make(map[int64]installationPermissions)}
+
+// Return the required permissions that were not granted as "name:level".
+// Write access includes read access and admin access includes both.
+func missingPermissions(granted *github.InstallationPermissions) []string {
+	levels := map[string]int{"read": 1, "write": 2, "admin": 3}
+	var missing []string
+	for _, p := range requiredPermissions {
+		if levels[p.granted(granted)] < levels[p.level] {
+			missing = append(missing, p.name+":"+p.level)
+		}
+	}
+	return missing
+}
+
+// Verify the permissions granted to an installation, log the missing ones
+// and expose them with metrics and the admin API
+func verifyInstallation(installation *github.Installation) []string {
+	missing := missingPermissions(installation.GetPermissions())
+	id := strconv.FormatInt(installation.GetID(), 10)
+	for _, p := range requiredPermissions {
+		value := 0.0
+		for _, m := range missing {
+			if m == p.name+":"+p.level {
+				value = 1
+				log.Printf("installation %d on '%s' lacks the permission %s:%s, %s will fail\n",
+					installation.GetID(), installation.GetAccount().GetLogin(), p.name, p.level, p.usedFor)
+			}
+		}
+		missingPermissionsGauge.Set(value, id, p.name)
+	}
+
+	verifiedPermissions.Lock()
+	defer verifiedPermissions.Unlock()
+	verifiedPermissions.installations[installation.GetID()] = installationPermissions{
+		Installation: installation.GetID(),
+		Account:      installation.GetAccount().GetLogin(),
+		Missing:      missing,
+		Verified:     time.Now(),
+	}
+	return missing
+}
+
+// Forget an installation that was deleted
+func forgetInstallation(installationID int64) {
+	id := strconv.FormatInt(installationID, 10)
+	for _, p := range requiredPermissions {
+		missingPermissionsGauge.Set(0, id, p.name)
+	}
+	verifiedPermissions.Lock()
+	defer verifiedPermissions.Unlock()
+	delete(verifiedPermissions.installations, installationID)
+}
+
+// Verify the permissions of all installations of the Apps. Failures to list
+// installations are logged, as the watchdog works without the results.
+func verifyPermissions(apps []app) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkConfigTimeout)
+	defer cancel()
+	for _, a := range apps {
+		installations, err := a.Installations(ctx)
+		if err != nil {
+			log.Printf("could not list the installations to verify their permissions: %v\n", err)
+			continue
+		}
+		for _, installation := range installations {
+			verifyInstallation(installation)
+		}
+	}
+}
+
+// permissionsHandler serves the verified permissions of all installations
+// to callers presenting the admin token
+type permissionsHandler struct {
+	token string
+}
+
+func (h *permissionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Only list the installations that lack permissions unless all are
+	// requested
+	all := r.URL.Query().Get("all") == "true"
+	verifiedPermissions.Lock()
+	list := make([]installationPermissions, 0, len(verifiedPermissions.installations))
+	for _, p := range verifiedPermissions.installations {
+		if all || len(p.Missing) > 0 {
+			list = append(list, p)
+		}
+	}
+	verifiedPermissions.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Installation < list[j].Installation })
+	for i := range list {
+		if list[i].Missing == nil {
+			list[i].Missing = []string{}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeApp lists fixed installations
+type fakeApp []*github.Installation
+
+func (a fakeApp) App(ctx context.Context) (*github.App, error) {
+	return &github.App{ID: github.Int64(1), Slug: github.String("lfswatchdog")}, nil
+}
+
+func (a fakeApp) Installations(ctx context.Context) ([]*github.Installation, error) {
+	return a, nil
+}
+
+func TestMissingPermissions(t *testing.T) {
+	assert.Equal(t, []string{"contents:read", "statuses:write", "checks:write"}, missingPermissions(nil))
+	assert.Equal(t, []string{"checks:write"}, missingPermissions(&github.InstallationPermissions{
+		Contents: github.String("write"),
+		Statuses: github.String("write"),
+		Checks:   github.String("read"),
+	}))
+	assert.Empty(t, missingPermissions(&github.InstallationPermissions{
+		Contents: github.String("read"),
+		Statuses: github.String("write"),
+		Checks:   github.String("admin"),
+	}))
+}
+
+func TestVerifyPermissions(t *testing.T) {
+	defer forgetInstallation(71)
+	defer forgetInstallation(72)
+	verifyPermissions([]app{fakeApp{
+		{
+			ID:      github.Int64(71),
+			Account: &github.User{Login: github.String("granted-org")},
+			Permissions: &github.InstallationPermissions{
+				Contents: github.String("read"),
+				Statuses: github.String("write"),
+				Checks:   github.String("write"),
+			},
+		},
+		{
+			ID:      github.Int64(72),
+			Account: &github.User{Login: github.String("restricted-org")},
+			Permissions: &github.InstallationPermissions{
+				Contents: github.String("read"),
+			},
+		},
+	}})
+
+	handler := &permissionsHandler{token: "admin-token"}
+	request := func(method, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, adminPermissionsPath+query, nil)
+		r.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(handler, http.MethodGet, "", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, "").Code)
+
+	w := request(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"account":"restricted-org","missing":["statuses:write","checks:write"]`)
+	assert.NotContains(t, w.Body.String(), "granted-org")
+
+	w = request(http.MethodGet, "?all=true")
+	assert.Contains(t, w.Body.String(), `"account":"granted-org","missing":[]`)
+
+	// Accepting new permissions verifies the installation again
+	webhooks := NewHandler(nil, "secret")
+	w = eventRequest(webhooks, "installation", []byte(`{
+		"action": "new_permissions_accepted",
+		"installation": {"id": 72, "account": {"login": "restricted-org"},
+			"permissions": {"contents": "read", "statuses": "write", "checks": "write"}}
+	}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, request(http.MethodGet, "").Body.String(), "restricted-org")
+}
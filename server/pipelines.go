@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/google/go-github/v35/github"
+)
+
+// Time a pipeline may take to check a push
+const pipelineTimeout = 10 * time.Minute
+
+var pipelineChecks = metrics.NewCounter("lfswatchdog_pipeline_checks_total",
+	"Pushes checked by additional pipelines by the state of their status.", "pipeline", "state")
+
+// Pipeline checks pushes independently of the Git LFS checks, e.g. a
+// plugin that validates .gitattributes files. Every pipeline reports the
+// head commit of a push with its own commit status.
+type Pipeline interface {
+	// Name identifies the pipeline in the "watchdog/<name>" status
+	// context, logs and metrics
+	Name() string
+	// Check checks a push with the client of the repository's installation
+	// and returns the state ("success" or "failure") and description of the
+	// status. Errors are reported with the "error" state.
+	Check(ctx context.Context, client scm.Client, event *github.PushEvent) (state, description string, err error)
+}
+
+// PipelineConfig registers a pipeline with Run
+type PipelineConfig struct {
+	Pipeline Pipeline
+	// Concurrency is the number of pushes the pipeline checks at the same
+	// time, it defaults to 1
+	Concurrency int
+}
+
+// pipeline is a registered pipeline and its concurrency budget
+type pipeline struct {
+	Pipeline
+	budget chan struct{}
+}
+
+// pipelines are the registered pipelines, guarded by mu
+type pipelines struct {
+	mu   sync.RWMutex
+	list []*pipeline
+}
+
+// AddPipeline routes all pushes to a pipeline in addition to the Git LFS
+// checks. At most concurrency pushes are checked by the pipeline at the
+// same time, others wait for their turn.
+func (h *Handler) AddPipeline(p Pipeline, concurrency int) error {
+	for _, rule := range watchdog.Rules() {
+		if p.Name() == rule.Family {
+			return fmt.Errorf("pipeline '%s' would share the status context of the '%s' rules", p.Name(), rule.Family)
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	h.pipelines.mu.Lock()
+	defer h.pipelines.mu.Unlock()
+	for _, registered := range h.pipelines.list {
+		if registered.Name() == p.Name() {
+			return fmt.Errorf("pipeline '%s' is already registered", p.Name())
+		}
+	}
+	h.pipelines.list = append(h.pipelines.list, &pipeline{Pipeline: p, budget: make(chan struct{}, concurrency)})
+	return nil
+}
+
+// Route a push to all pipelines in the background
+func (h *Handler) dispatch(guard *watchdog.WatchDog, event *github.PushEvent) {
+	if len(event.Commits) == 0 || event.GetAfter() == "" {
+		// Nothing to report on, e.g. a deleted branch
+		return
+	}
+	h.pipelines.mu.RLock()
+	defer h.pipelines.mu.RUnlock()
+	for _, p := range h.pipelines.list {
+		// Show that the push is waiting for the pipeline's budget
+		h.reportPipeline(guard.SCM(), event, p.Name(), "pending", "waiting to be checked")
+		h.checks.Add(1)
+		go func(p *pipeline) {
+			defer h.checks.Done()
+			defer recoverPipeline(p.Name(), event)
+			p.budget <- struct{}{}
+			defer func() { <-p.budget }()
+			h.runPipeline(guard.SCM(), event, p)
+		}(p)
+	}
+}
+
+func (h *Handler) runPipeline(client scm.Client, event *github.PushEvent, p *pipeline) {
+	ctx, cancel := context.WithTimeout(context.Background(), pipelineTimeout)
+	defer cancel()
+	state, description, err := p.Check(ctx, client, event)
+	if err != nil {
+		log.Printf("pipeline '%s' could not check '%s' in '%s': %v\n", p.Name(), event.GetAfter(), event.GetRepo().GetFullName(), err)
+		state, description = "error", "check could not complete"
+	}
+	h.reportPipeline(client, event, p.Name(), state, description)
+	pipelineChecks.Inc(p.Name(), state)
+}
+
+// Set the status of a pipeline on the head commit of a push
+func (h *Handler) reportPipeline(client scm.Client, event *github.PushEvent, name, state, description string) {
+	status := &scm.Status{Context: "watchdog/" + name, State: state, Description: description}
+	if watchdog.DryRun() {
+		log.Printf("dry-run: status '%s' of '%s' in '%s' is '%s': %s\n", status.Context, event.GetAfter(), event.GetRepo().GetFullName(), state, description)
+		return
+	}
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	if err := client.CreateStatus(context.Background(), owner, repo, event.GetAfter(), status); err != nil {
+		log.Printf("could not set status '%s' of '%s' in '%s': %v\n", status.Context, event.GetAfter(), event.GetRepo().GetFullName(), err)
+	}
+}
+
+// Log a panic of a pipeline like one of the Git LFS checks
+func recoverPipeline(name string, event *github.PushEvent) {
+	if r := recover(); r != nil {
+		log.Printf("pipeline '%s' panicked on a push to '%s': %v\n%s", name, event.GetRepo().GetFullName(), r, debug.Stack())
+	}
+}
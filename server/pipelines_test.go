@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePipeline fails pushes to repositories named "broken" and records
+// how many pushes it checked at the same time
+type fakePipeline struct {
+	name    string
+	running int32
+	maxSeen int32
+	mu      sync.Mutex
+}
+
+func (p *fakePipeline) Name() string {
+	return p.name
+}
+
+func (p *fakePipeline) Check(ctx context.Context, client scm.Client, event *github.PushEvent) (string, string, error) {
+	running := atomic.AddInt32(&p.running, 1)
+	defer atomic.AddInt32(&p.running, -1)
+	p.mu.Lock()
+	if running > p.maxSeen {
+		p.maxSeen = running
+	}
+	p.mu.Unlock()
+
+	if event.GetRepo().GetName() == "broken" {
+		return "", "", errors.New("broken")
+	}
+	return "success", "attributes are fine", nil
+}
+
+func TestPipelines(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+
+	attributes := &fakePipeline{name: "attributes"}
+	assert.Nil(t, handler.AddPipeline(attributes, 1))
+	assert.NotNil(t, handler.AddPipeline(&fakePipeline{name: "attributes"}, 1))
+	assert.NotNil(t, handler.AddPipeline(&fakePipeline{name: "lfs"}, 1))
+
+	for _, repo := range []string{"repo1", "repo2", "broken"} {
+		// The Git LFS checks skip commits without added or modified files
+		push := strings.Replace(validPush, `"ref"`, `"after": "sha1", "ref"`, 1)
+		push = strings.Replace(push, `"added": ["large.bin"]`, `"added": []`, 1)
+		push = strings.Replace(push, "payload-repo", repo, -1)
+		assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(push)).Code)
+	}
+	handler.Wait()
+
+	assert.Equal(t, int32(1), attributes.maxSeen)
+	final := make(map[string]string)
+	for _, status := range server.Statuses() {
+		if status.Context == "watchdog/attributes" {
+			final[status.Repo] = status.State
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"test-org/repo1":  "success",
+		"test-org/repo2":  "success",
+		"test-org/broken": "error",
+	}, final)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/redact"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/google/go-github/v35/github"
+)
+
+// Actions of pull_request events that change the files of a pull request
+var pullRequestActions = map[string]bool{"opened": true, "reopened": true, "synchronize": true}
+
+// Check the files of a pull request in the background and summarize them
+// with a check run
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#pull_request
+func (h *Handler) checkPullRequest(w http.ResponseWriter, e *github.PullRequestEvent, tenant *tenantSecret) {
+	if !pullRequestActions[e.GetAction()] {
+		io.WriteString(w, fmt.Sprintf("ignoring '%s' pull request\n", e.GetAction()))
+		return
+	}
+	owner := e.GetRepo().GetOwner().GetLogin()
+	if owner == "" || e.GetRepo().GetName() == "" || e.GetNumber() == 0 {
+		message := "malformed pull request payload\n"
+		log.Print(message)
+		http.Error(w, message, http.StatusUnprocessableEntity)
+		return
+	}
+	if !tenant.allows(owner) {
+		http.Error(w, "pull request is signed with the secret of another tenant\n", http.StatusForbidden)
+		return
+	}
+
+	guard, err := h.clientGroup.GetWatchdog(owner, e.GetInstallation().GetID())
+	if err != nil {
+		log.Printf("could not obtain Watchdog client: %v\n", err)
+		http.Error(w, redact.String(err.Error()), 500)
+		return
+	}
+
+	request := watchdog.PullRequestRequest{
+		Owner:  owner,
+		Repo:   e.GetRepo().GetName(),
+		Number: e.GetNumber(),
+	}
+	h.checks.Add(1)
+	go func() {
+		defer h.checks.Done()
+		if _, err := guard.CheckPullRequest(context.Background(), request); err != nil {
+			log.Printf("could not check pull request #%d in '%s': %v\n", request.Number, e.GetRepo().GetFullName(), err)
+		}
+	}()
+	io.WriteString(w, fmt.Sprintf("checking pull request #%d\n", request.Number))
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullRequestEvent(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	repo := "test-org/pr-repo"
+	server.AddInstallation(repo, 1)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+
+	server.AddFile(repo, "head1", ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\npullRequestChecksEnabled: Yes\n"))
+	server.AddFileWithSize(repo, "head1", "art/hero.psd", 2000)
+	server.AddFileWithSize(repo, "head1", "docs/notes.txt", 10)
+	server.AddPullRequest(repo, &github.PullRequest{
+		Number: github.Int(7),
+		Head:   &github.PullRequestBranch{SHA: github.String("head1")},
+		User:   &github.User{Login: github.String("jdoe")},
+	}, []*github.CommitFile{
+		{Filename: github.String("art/hero.psd"), Status: github.String("added")},
+		{Filename: github.String("docs/notes.txt"), Status: github.String("modified")},
+		{Filename: github.String("old.bin"), Status: github.String("removed")},
+	})
+	event := func(action string) int {
+		payload := fmt.Sprintf(`{
+			"action": "%s",
+			"number": 7,
+			"installation": {"id": 1},
+			"repository": {"name": "pr-repo", "full_name": "test-org/pr-repo", "owner": {"login": "test-org"}}
+		}`, action)
+		w := eventRequest(handler, "pull_request", []byte(payload))
+		handler.Wait()
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, event("opened"))
+	runs := server.CheckRuns()
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, "LFSWatchDog pull request", runs[0].Name)
+		assert.Equal(t, "head1", runs[0].HeadSHA)
+		assert.Equal(t, "failure", runs[0].GetConclusion())
+		assert.Contains(t, runs[0].Output.GetSummary(), "**Pull request #7** adds or modifies 2 files compared to its base branch")
+		assert.Contains(t, runs[0].Output.GetSummary(), "art/hero.psd")
+		assert.NotContains(t, runs[0].Output.GetSummary(), "docs/notes.txt")
+	}
+	// Per-commit reporting is left to pushes
+	assert.Empty(t, server.Comments())
+	assert.Empty(t, server.Statuses())
+
+	assert.Equal(t, http.StatusOK, event("synchronize"))
+	assert.Len(t, server.CheckRuns(), 2)
+	assert.Equal(t, http.StatusOK, event("closed"))
+	assert.Len(t, server.CheckRuns(), 2)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/redact"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+// repoAPIPath is followed by "{org}/{repo}/checks/{sha}" to recheck a
+// commit, "{org}/{repo}/lfs" for the Git LFS usage, or
+// "{org}/{repo}/thresholds" for threshold advice
+const repoAPIPath = "/api/repos/"
+
+// watchdogs finds the watchdog responsible for a repository or
+// organization, installation IDs are those of the App that serves the owner
+type watchdogs interface {
+	FindInstallation(ctx context.Context, owner, repo string) (int64, error)
+	FindOrgInstallation(ctx context.Context, org string) (int64, error)
+	GetWatchdog(owner string, installationID int64) (*watchdog.WatchDog, error)
+}
+
+// repoHandler serves the repository API for support engineers. It re-runs
+// the check of a commit, e.g. if the watchdog was down when the commit was
+// pushed, and reports the Git LFS usage of a repository.
+type repoHandler struct {
+	token     string
+	watchdogs watchdogs
+}
+
+// RecheckResult is the response of a recheck
+type RecheckResult struct {
+	SHA        string
+	Skipped    bool   `json:",omitempty"`
+	SkipReason string `json:",omitempty"`
+	Findings   []watchdog.Finding
+	Resolved   []watchdog.Finding `json:",omitempty"`
+	// Actions lists the comments and statuses that were posted
+	Actions []string `json:",omitempty"`
+	Errors  []string `json:",omitempty"`
+}
+
+func (h *repoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, repoAPIPath), "/")
+	if len(parts) < 3 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case len(parts) == 4 && parts[2] == "checks" && parts[3] != "":
+		if allowMethod(w, r, http.MethodPost) {
+			h.recheck(w, r, parts[0], parts[1], parts[3])
+		}
+	case len(parts) == 3 && parts[2] == "lfs":
+		if allowMethod(w, r, http.MethodGet) {
+			h.lfsUsage(w, r, parts[0], parts[1])
+		}
+	case len(parts) == 3 && parts[2] == "thresholds":
+		if allowMethod(w, r, http.MethodGet) {
+			h.adviseThresholds(w, r, parts[0], parts[1])
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// Find the watchdog responsible for a repository, or respond with an error
+func (h *repoHandler) findWatchdog(w http.ResponseWriter, r *http.Request, owner, repo string) (*watchdog.WatchDog, bool) {
+	installationID, err := h.watchdogs.FindInstallation(r.Context(), owner, repo)
+	if err != nil {
+		log.Printf("could not find the installation for '%s/%s': %v\n", owner, repo, err)
+		http.Error(w, fmt.Sprintf("could not find the installation for '%s/%s'", owner, repo), http.StatusNotFound)
+		return nil, false
+	}
+	gatekeeper, err := h.watchdogs.GetWatchdog(owner, installationID)
+	if err != nil {
+		http.Error(w, redact.String(err.Error()), http.StatusInternalServerError)
+		return nil, false
+	}
+	return gatekeeper, true
+}
+
+func (h *repoHandler) recheck(w http.ResponseWriter, r *http.Request, owner, repo, sha string) {
+	gatekeeper, ok := h.findWatchdog(w, r, owner, repo)
+	if !ok {
+		return
+	}
+
+	result, err := gatekeeper.Recheck(r.Context(), owner, repo, sha)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	log.Printf("rechecked '%s' in '%s/%s' via %s\n", sha, owner, repo, repoAPIPath)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recheckResult(result))
+}
+
+func recheckResult(result *watchdog.CommitResult) *RecheckResult {
+	response := &RecheckResult{
+		SHA:        result.SHA,
+		Skipped:    result.Skipped,
+		SkipReason: result.SkipReason,
+		Findings:   result.Findings,
+		Resolved:   result.Resolved,
+	}
+	for _, action := range result.Actions {
+		if action.Err != nil {
+			response.Errors = append(response.Errors, fmt.Sprintf("could not post %s: %v", action.Type, action.Err))
+			continue
+		}
+		response.Actions = append(response.Actions, action.Type)
+	}
+	for _, err := range result.Errors {
+		response.Errors = append(response.Errors, err.Error())
+	}
+	return response
+}
+
+// Missing commits and refs are the caller's fault, anything else is GitHub's
+func errorStatus(err error) int {
+	if errors.Is(err, scm.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadGateway
+}
+
+// Report the Git LFS objects referenced at the "ref" query parameter,
+// which defaults to the default branch
+func (h *repoHandler) lfsUsage(w http.ResponseWriter, r *http.Request, owner, repo string) {
+	gatekeeper, ok := h.findWatchdog(w, r, owner, repo)
+	if !ok {
+		return
+	}
+
+	ref := r.URL.Query().Get("ref")
+	if ref == "" {
+		ref = "HEAD"
+	}
+	usage, err := gatekeeper.LFSUsage(r.Context(), owner, repo, ref)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// Recommend thresholds from the files at the "ref" query parameter, which
+// defaults to the default branch
+func (h *repoHandler) adviseThresholds(w http.ResponseWriter, r *http.Request, owner, repo string) {
+	gatekeeper, ok := h.findWatchdog(w, r, owner, repo)
+	if !ok {
+		return
+	}
+
+	ref := r.URL.Query().Get("ref")
+	if ref == "" {
+		ref = "HEAD"
+	}
+	advice, err := gatekeeper.AdviseThresholds(r.Context(), owner, repo, ref)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(advice)
+}
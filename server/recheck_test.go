@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWatchdogs struct {
+	server *githubtest.Server
+}
+
+func (f *fakeWatchdogs) FindInstallation(ctx context.Context, owner, repo string) (int64, error) {
+	installation, resp, err := f.server.Client().Apps.FindRepositoryInstallation(ctx, owner, repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return 0, scm.ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return installation.GetID(), nil
+}
+
+func (f *fakeWatchdogs) FindOrgInstallation(ctx context.Context, org string) (int64, error) {
+	installation, resp, err := f.server.Client().Apps.FindOrganizationInstallation(ctx, org)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return 0, scm.ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return installation.GetID(), nil
+}
+
+func (f *fakeWatchdogs) GetWatchdog(owner string, installationID int64) (*watchdog.WatchDog, error) {
+	return watchdog.New(scm.NewGitHub(f.server.Client())), nil
+}
+
+func recheckRequest(handler http.Handler, method, token, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRecheck(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddInstallation("test-org/recheck-repo", 1)
+	server.AddFile("test-org/recheck-repo", "sha1", ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/recheck-repo", "sha1", "large.bin", 2000)
+	server.AddCommit("test-org/recheck-repo", &github.RepositoryCommit{
+		SHA:   github.String("sha1"),
+		Files: []*github.CommitFile{{Filename: github.String("large.bin"), Status: github.String("added")}},
+	})
+	handler := &repoHandler{token: "admin-token", watchdogs: &fakeWatchdogs{server}}
+	path := repoAPIPath + "test-org/recheck-repo/checks/sha1"
+
+	assert.Equal(t, http.StatusUnauthorized, recheckRequest(handler, http.MethodPost, "", path).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, recheckRequest(handler, http.MethodGet, "admin-token", path).Code)
+	assert.Equal(t, http.StatusNotFound, recheckRequest(handler, http.MethodPost, "admin-token", repoAPIPath+"test-org/recheck-repo/sha1").Code)
+	assert.Equal(t, http.StatusNotFound, recheckRequest(handler, http.MethodPost, "admin-token", repoAPIPath+"test-org/other-repo/checks/sha1").Code)
+	// GitHub answers unknown SHAs with 422
+	assert.Equal(t, http.StatusNotFound, recheckRequest(handler, http.MethodPost, "admin-token", repoAPIPath+"test-org/recheck-repo/checks/unknown").Code)
+
+	w := recheckRequest(handler, http.MethodPost, "admin-token", path)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result RecheckResult
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, "sha1", result.SHA)
+	if assert.Len(t, result.Findings, 1) {
+		assert.Equal(t, "large.bin", result.Findings[0].Path)
+	}
+	assert.Empty(t, result.Errors)
+	assert.Len(t, server.Comments(), 1)
+	statuses := server.Statuses()
+	if assert.NotEmpty(t, statuses) {
+		assert.Equal(t, "failure", statuses[len(statuses)-1].State)
+	}
+}
+
+func TestLFSUsage(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddInstallation("test-org/recheck-repo", 1)
+	server.AddFile("test-org/recheck-repo", "HEAD", "a.psd", []byte("version https://git-lfs.github.com/spec/v1\noid sha256:"+strings.Repeat("a", 64)+"\nsize 3000000\n"))
+	handler := &repoHandler{token: "admin-token", watchdogs: &fakeWatchdogs{server}}
+	path := repoAPIPath + "test-org/recheck-repo/lfs"
+
+	assert.Equal(t, http.StatusMethodNotAllowed, recheckRequest(handler, http.MethodPost, "admin-token", path).Code)
+	assert.Equal(t, http.StatusNotFound, recheckRequest(handler, http.MethodGet, "admin-token", path+"?ref=missing").Code)
+
+	w := recheckRequest(handler, http.MethodGet, "admin-token", path)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var usage watchdog.LFSUsage
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	assert.Equal(t, watchdog.LFSUsage{Ref: "HEAD", Objects: 1, Size: 3000000}, usage)
+}
+
+func TestAdviseThresholds(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddInstallation("test-org/recheck-repo", 1)
+	for i := 0; i < 5; i++ {
+		server.AddFileWithSize("test-org/recheck-repo", "HEAD", fmt.Sprintf("t%d.png", i), 3000)
+	}
+	handler := &repoHandler{token: "admin-token", watchdogs: &fakeWatchdogs{server}}
+	path := repoAPIPath + "test-org/recheck-repo/thresholds"
+
+	assert.Equal(t, http.StatusMethodNotAllowed, recheckRequest(handler, http.MethodPost, "admin-token", path).Code)
+	assert.Equal(t, http.StatusNotFound, recheckRequest(handler, http.MethodGet, "admin-token", path+"?ref=missing").Code)
+
+	w := recheckRequest(handler, http.MethodGet, "admin-token", path)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var advice watchdog.ThresholdAdvice
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &advice))
+	assert.Equal(t, 5, advice.Files)
+	if assert.Equal(t, 1, len(advice.Extensions)) {
+		assert.Equal(t, 4096, advice.Extensions[0].Threshold)
+	}
+}
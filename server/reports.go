@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// reportsPath serves the push reports as "/reports/<owner>/<repo>/<sha>"
+	reportsPath = "/reports/"
+
+	// Push reports are kept in this subdirectory of the job directory
+	reportsDir = "reports"
+)
+
+var reportRequest = regexp.MustCompile(`^([A-Za-z0-9._-]+/[A-Za-z0-9._-]+)/([0-9a-f]{7,64})$`)
+
+// reportStore keeps the report of every checked push and serves it to
+// anyone with its signed URL. Unlike artifact URLs, report URLs only
+// depend on the push, so that statuses can link them before the push is
+// completely checked.
+type reportStore struct {
+	dir       string
+	publicURL string
+	secret    func() []byte
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func openReportStore(jobDir, publicURL string, secret func() []byte) (*reportStore, error) {
+	store := &reportStore{
+		dir:       filepath.Join(jobDir, reportsDir),
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		secret:    secret,
+	}
+	return store, os.MkdirAll(store.dir, 0700)
+}
+
+// Key a report by the lower case repository name and the pushed SHA
+func reportKey(repo, sha string) string {
+	return strings.ToLower(repo) + "@" + sha
+}
+
+func (store *reportStore) sign(repo, sha string) string {
+	mac := hmac.New(sha256.New, store.secret())
+	mac.Write([]byte(reportKey(repo, sha)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Name the file of a report without trusting the repository name
+func (store *reportStore) file(repo, sha string) string {
+	sum := sha256.Sum256([]byte(reportKey(repo, sha)))
+	return filepath.Join(store.dir, hex.EncodeToString(sum[:])+".md")
+}
+
+// URL returns the signed URL of the report of a push
+func (store *reportStore) URL(repo, sha string) string {
+	return store.publicURL + reportsPath + repo + "/" + sha + "?signature=" + store.sign(repo, sha)
+}
+
+// Save writes the report of a push, replacing an earlier one
+func (store *reportStore) Save(repo, sha string, report []byte) error {
+	file := store.file(repo, sha)
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, report, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	store.prune()
+	return nil
+}
+
+// Remove expired reports, at most once an hour
+func (store *reportStore) prune() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if time.Since(store.lastPruned) < time.Hour {
+		return
+	}
+	store.lastPruned = time.Now()
+	pruneDir(store.dir, "report")
+}
+
+func (store *reportStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	match := reportRequest.FindStringSubmatch(strings.TrimPrefix(r.URL.Path, reportsPath))
+	if match == nil {
+		http.NotFound(w, r)
+		return
+	}
+	repo, sha := match[1], match[2]
+	if !hmac.Equal([]byte(r.URL.Query().Get("signature")), []byte(store.sign(repo, sha))) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(store.file(repo, sha))
+	if os.IsNotExist(err) {
+		http.Error(w, "The report is saved once all commits of the push are checked, try again in a moment.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not read the report", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "could not read the report", http.StatusInternalServerError)
+		return
+	}
+	// Browsers show plain text, but download Markdown
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
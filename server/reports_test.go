@@ -0,0 +1,51 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lfswatchdog-reports")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	store, err := openReportStore(dir, "https://watchdog.example.com/", func() []byte { return []byte("secret") })
+	assert.Nil(t, err)
+
+	// The URL is known before the report is saved and doesn't change
+	url := store.URL("Test-Org/test-repo", "abc1234")
+	assert.Regexp(t, `^https://watchdog.example.com/reports/Test-Org/test-repo/abc1234\?signature=[0-9a-f]{64}$`, url)
+	assert.Equal(t, url, store.URL("Test-Org/test-repo", "abc1234"))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		store.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	target := strings.TrimPrefix(url, "https://watchdog.example.com")
+	w := get(target)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "once all commits of the push are checked")
+
+	assert.Nil(t, store.Save("Test-Org/test-repo", "abc1234", []byte("# first\n")))
+	assert.Nil(t, store.Save("test-org/test-repo", "abc1234", []byte("# report\n")))
+	w = get(target)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "# report\n", w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+	// Unsigned, tampered and traversing URLs are not found
+	assert.Equal(t, http.StatusNotFound, get(strings.Split(target, "?")[0]).Code)
+	assert.Equal(t, http.StatusNotFound, get(strings.Replace(target, "abc1234", "abc1235", 1)).Code)
+	assert.Equal(t, http.StatusNotFound, get(reportsPath+"../jobs/abc1234?signature="+store.sign("../jobs", "abc1234")).Code)
+
+	w = httptest.NewRecorder()
+	store.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
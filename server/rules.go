@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+const rulesPath = "/rules/"
+
+// Serve all rules as JSON on /rules/ and a single rule explanation as
+// Markdown on /rules/{id or name}
+func serveRules(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, rulesPath), "/")
+	if id == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(watchdog.Rules())
+		return
+	}
+
+	rule, ok := watchdog.LookupRule(id)
+	if !ok {
+		http.Error(w, "unknown rule '"+id+"'", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Write([]byte(rule.Explain()))
+}
@@ -1,101 +1,904 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"git.autodesk.com/github-solutions/lfswatchdog/audit"
+	"git.autodesk.com/github-solutions/lfswatchdog/canary"
 	"git.autodesk.com/github-solutions/lfswatchdog/clientgroup"
+	"git.autodesk.com/github-solutions/lfswatchdog/jobs"
+	"git.autodesk.com/github-solutions/lfswatchdog/logging"
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/ratebudget"
+	"git.autodesk.com/github-solutions/lfswatchdog/redact"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"git.autodesk.com/github-solutions/lfswatchdog/shard"
+	"git.autodesk.com/github-solutions/lfswatchdog/store"
+	"git.autodesk.com/github-solutions/lfswatchdog/telemetry"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
 	"github.com/google/go-github/v35/github"
 )
 
 const (
 	defaultPath = "/lfs/v2"
 	defaultPort = "8080"
+	metricsPath = "/metrics"
+
+	defaultCanaryInterval = 5 * time.Minute
+
+	defaultTelemetryInterval = 24 * time.Hour
 )
 
-func Run(github, secret, appID, privateKeyFile, port, path string) {
-	if github == "" {
-		log.Fatalf("Set your GITHUB_HOST environment variable to and instance of GitHub Enterprise")
+// Config holds the settings the server is started with
+type Config struct {
+	GitHubURL string
+	// GitHubAPIURL replaces GitHubURL with subdomain isolation
+	GitHubAPIURL string
+	// GitHubUploadURL defaults to GitHubURL if empty
+	GitHubUploadURL string
+	// GitHubWebURL is derived from the API URL if empty
+	GitHubWebURL string
+	// GitHubAPIVersion is sent as X-GitHub-Api-Version if set
+	GitHubAPIVersion string
+	Secret           string
+	AppID            string
+	PrivateKeyFile   string
+	Port             string
+	Path             string
+	// LookupsPerCommit bounds the concurrent file size lookups of a commit
+	LookupsPerCommit string
+	// MaxLookups bounds the concurrent file size lookups of all commits
+	MaxLookups string
+	// AuditLogFile is appended with every mutation if set
+	AuditLogFile string
+	// RedactEmails masks email addresses in logs unless "false"
+	RedactEmails string
+	// LogPayloads logs the (redacted) webhook payloads if "true"
+	LogPayloads string
+	// SyncDeliveries checks pushes before responding to their
+	// delivery and responds with the result if "true"
+	SyncDeliveries string
+	// CanaryRepo ("owner/repo") enables the periodic canary evaluation
+	CanaryRepo         string
+	CanaryInstallation string
+	// CanaryRef defaults to "main"
+	CanaryRef string
+	// CanaryFile defaults to "README.md"
+	CanaryFile string
+	// CanaryInterval defaults to 5m
+	CanaryInterval string
+	// Replicas is the number of replicas background jobs are sharded across
+	Replicas string
+	// Replica is the index of this replica, it defaults to the ordinal of
+	// a StatefulSet pod hostname
+	Replica string
+	// AdminToken enables the admin endpoints for callers presenting it as
+	// a bearer token
+	AdminToken string
+	// Debug turns on debug logging at startup if "true"
+	Debug string
+	// MetricsRepoLimit is the number of repositories with their own metrics label
+	MetricsRepoLimit string
+	// StatsDAddr ("host:port") pushes all metrics to StatsD if set
+	StatsDAddr string
+	// StatsDFormat is "dogstatsd" (default) or "statsd"
+	StatsDFormat string
+	// DrainDelay is the time between failing the health check and closing
+	// the listener on shutdown, it defaults to 10s
+	DrainDelay string
+	// MaxCommitsPerPush is the number of commits above which a push is
+	// checked at its head commit only
+	MaxCommitsPerPush string
+	// MaxPendingPushes is the number of pushes being checked above which
+	// deliveries are rejected with 503 Service Unavailable
+	MaxPendingPushes string
+	// JobDir persists push checks so that they are resumed after a restart
+	JobDir string
+	// Store is the URL of the store.Store that persists open findings and,
+	// instead of JobDir, push checks, e.g. "sqlite:/data/lfswatchdog.db"
+	Store string
+	// LatencySLO is the p95 push latency above which the alert hook is called
+	LatencySLO string
+	// HelpContact is mentioned by repositories that don't configure a help
+	// contact or whose team does not exist
+	HelpContact string
+	// CommentSignature is a line of Markdown that every comment ends with
+	CommentSignature string
+	// AttributesTemplate is the file with the org-standard .gitattributes
+	// that repositories are audited against
+	AttributesTemplate string
+	// LatencyAlertURL receives a JSON LatencyAlert when the SLO is breached
+	// and when it recovers
+	LatencyAlertURL string
+
+	// TelemetryURL opts in to posting anonymous usage statistics to it,
+	// see package telemetry
+	TelemetryURL string
+	// TelemetryInterval defaults to 24h
+	TelemetryInterval string
+	// TelemetryDeployment names this deployment in telemetry reports, e.g.
+	// after the business unit running it
+	TelemetryDeployment string
+	// Version of the watchdog, reported with telemetry
+	Version string
+
+	// GracePeriod is the time after the App was installed on a repository
+	// during which errors are only reported as warnings
+	GracePeriod string
+
+	// CheckTimeout is the deadline of checking a push, after which the
+	// findings so far are reported, e.g. "10m". "0" disables the deadline.
+	CheckTimeout string
+
+	// ConfigTTL is the time during which configuration files are reused
+	// without requesting them, e.g. "5m"
+	ConfigTTL string
+
+	// PublicURL is the URL of the watchdog for users, e.g.
+	// "https://watchdog.example.com", that links to stored results and push
+	// reports start with. They are only stored if it and JobDir are set.
+	PublicURL string
+
+	// Pipelines check pushes in addition to the Git LFS checks, for builds
+	// of the watchdog with plugins
+	Pipelines []PipelineConfig
+
+	// Tenants is a YAML file of the GitHub Apps that serve some organizations
+	// instead of the default App, see clientgroup.ReadTenants
+	Tenants string
+
+	// ConfigDir is watched for rotated credentials if set, see watchConfigDir
+	ConfigDir string
+
+	// CheckConfig validates the configuration and authenticates as the App,
+	// then returns instead of serving
+	CheckConfig bool
+	// ListInstallations logs all App installations with CheckConfig
+	ListInstallations bool
+}
+
+func Run(config Config) {
+	// Never log credentials, not even in error messages
+	redact.AddValue(config.Secret)
+	redact.AddValue(config.PrivateKeyFile)
+	redact.AddValue(config.AdminToken)
+	// The store URL may contain a database password
+	redact.AddValue(config.Store)
+	log.SetOutput(redact.Writer(os.Stderr))
+
+	if config.RedactEmails != "" {
+		redactEmails, err := strconv.ParseBool(config.RedactEmails)
+		if err != nil {
+			log.Fatalf("Set your LFSWATCHDOG_REDACT_EMAILS environment variable to true or false\n")
+		}
+		redact.RedactEmails(redactEmails)
+	}
+
+	if config.Debug != "" {
+		debug, err := strconv.ParseBool(config.Debug)
+		if err != nil {
+			log.Fatalf("Set your LFSWATCHDOG_DEBUG environment variable to true or false\n")
+		}
+		logging.SetDebug(debug)
+	}
+
+	var logPayloads bool
+	if config.LogPayloads != "" {
+		var err error
+		logPayloads, err = strconv.ParseBool(config.LogPayloads)
+		if err != nil {
+			log.Fatalf("Set your LFSWATCHDOG_LOG_PAYLOADS environment variable to true or false\n")
+		}
+	}
+
+	var synchronous bool
+	if config.SyncDeliveries != "" {
+		var err error
+		synchronous, err = strconv.ParseBool(config.SyncDeliveries)
+		if err != nil {
+			log.Fatalf("Set your LFSWATCHDOG_SYNC_DELIVERIES environment variable to true or false\n")
+		}
+		if synchronous {
+			log.Printf("checking pushes synchronously, deliveries of large pushes may time out\n")
+		}
 	}
 
-	if appID == "" {
+	if config.GitHubURL == "" && config.GitHubAPIURL == "" {
+		log.Fatalf("Set your GITHUB_ENTERPRISE_URL environment variable to an instance of GitHub Enterprise, or GITHUB_API_URL with subdomain isolation")
+	}
+
+	if config.AppID == "" {
 		log.Fatalf("Set your GITHUB_APP_ID environment variable to a GitHub App ID\n")
 	}
 
-	appID64, err := strconv.ParseInt(appID, 10, 64)
+	appID64, err := strconv.ParseInt(config.AppID, 10, 64)
 	if err != nil {
 		log.Fatalf("Set your GITHUB_APP_ID environment variable to something that can convert to int64\n")
 	}
 
-	if privateKeyFile == "" {
+	if config.PrivateKeyFile == "" {
 		log.Fatalf("Set your GITHUB_APP_PRIVATE_KEY_FILE environment variable to a GitHub App private key pem file\n")
 	}
 
-	if port == "" {
-		port = defaultPort
+	if config.Port == "" {
+		config.Port = defaultPort
 	}
 
-	if path == "" {
-		path = defaultPath
+	if config.Path == "" {
+		config.Path = defaultPath
 	}
 
-	log.Printf("server started at path '%s' on port %s...", path, port)
-	http.HandleFunc(path, HandlePushEvent(github, secret, appID64, privateKeyFile))
-	err = http.ListenAndServe(":"+port, nil)
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	if config.StatsDAddr != "" {
+		var dogStatsD bool
+		switch config.StatsDFormat {
+		case "", "dogstatsd":
+			dogStatsD = true
+		case "statsd":
+		default:
+			log.Fatalf("Set your LFSWATCHDOG_STATSD_FORMAT environment variable to 'dogstatsd' or 'statsd'\n")
+		}
+		statsd, err := metrics.NewStatsD(config.StatsDAddr, "", dogStatsD)
+		if err != nil {
+			log.Fatalf("could not connect to StatsD: %v", err)
+		}
+		metrics.AddSink(statsd)
+	}
+
+	if config.MetricsRepoLimit != "" {
+		limit, err := strconv.Atoi(config.MetricsRepoLimit)
+		if err != nil || limit < 0 {
+			log.Fatalf("Set your LFSWATCHDOG_METRICS_REPO_LIMIT environment variable to a number\n")
+		}
+		watchdog.SetMetricsRepoLimit(limit)
+	}
+
+	var concurrency watchdog.Concurrency
+	if config.LookupsPerCommit != "" {
+		concurrency.LookupsPerCommit, err = strconv.Atoi(config.LookupsPerCommit)
+		if err != nil || concurrency.LookupsPerCommit < 1 {
+			log.Fatalf("Set your LFSWATCHDOG_LOOKUPS_PER_COMMIT environment variable to a positive number\n")
+		}
+	}
+	if config.MaxLookups != "" {
+		concurrency.MaxLookups, err = strconv.Atoi(config.MaxLookups)
+		if err != nil || concurrency.MaxLookups < 1 {
+			log.Fatalf("Set your LFSWATCHDOG_MAX_LOOKUPS environment variable to a positive number\n")
+		}
+	}
+	watchdog.SetConcurrency(concurrency)
+
+	if config.MaxCommitsPerPush != "" {
+		max, err := strconv.Atoi(config.MaxCommitsPerPush)
+		if err != nil || max < 1 {
+			log.Fatalf("Set your LFSWATCHDOG_MAX_COMMITS_PER_PUSH environment variable to a positive number\n")
+		}
+		watchdog.SetMaxCommitsPerPush(max)
+	}
+	watchdog.SetDefaultHelpContact(config.HelpContact)
+	watchdog.SetVersion(config.Version)
+	watchdog.SetCommentSignature(config.CommentSignature)
+	if config.AttributesTemplate != "" {
+		template, err := os.ReadFile(config.AttributesTemplate)
+		if err != nil {
+			log.Fatalf("Set your LFSWATCHDOG_ATTRIBUTES_TEMPLATE environment variable to a readable .gitattributes file: %v\n", err)
+		}
+		watchdog.SetAttributesTemplate(string(template))
+	}
+
+	if config.GracePeriod != "" {
+		gracePeriod, err := time.ParseDuration(config.GracePeriod)
+		if err != nil || gracePeriod < 0 {
+			log.Fatalf("Set your LFSWATCHDOG_GRACE_PERIOD environment variable to a duration like '336h'\n")
+		}
+		watchdog.SetGracePeriod(gracePeriod)
+	}
+	if config.CheckTimeout != "" {
+		checkTimeout, err := time.ParseDuration(config.CheckTimeout)
+		if err != nil || checkTimeout < 0 {
+			log.Fatalf("Set your LFSWATCHDOG_CHECK_TIMEOUT environment variable to a duration like '10m'\n")
+		}
+		watchdog.SetCheckTimeout(checkTimeout)
+	}
+	if config.ConfigTTL != "" {
+		configTTL, err := time.ParseDuration(config.ConfigTTL)
+		if err != nil || configTTL < 0 {
+			log.Fatalf("Set your LFSWATCHDOG_CONFIG_TTL environment variable to a duration like '5m'\n")
+		}
+		watchdog.SetConfigTTL(configTTL)
 	}
-}
 
-func HandlePushEvent(githubEnterprise, secret string, appID int64, privateKeyFile string) func(http.ResponseWriter, *http.Request) {
+	var auditLog *audit.Log
+	if config.AuditLogFile != "" {
+		auditLog, err = audit.Open(config.AuditLogFile)
+		if err != nil {
+			log.Fatalf("could not open the audit log: %v", err)
+		}
+	}
 
-	clientGroup, err := clientgroup.New(githubEnterprise, appID, privateKeyFile)
+	clientGroup, err := clientgroup.New(clientgroup.Options{
+		GitHubURL:      config.GitHubURL,
+		APIURL:         config.GitHubAPIURL,
+		UploadURL:      config.GitHubUploadURL,
+		WebURL:         config.GitHubWebURL,
+		APIVersion:     config.GitHubAPIVersion,
+		AppID:          appID64,
+		PrivateKeyFile: config.PrivateKeyFile,
+		AuditLog:       auditLog,
+	})
 	if err != nil {
 		log.Fatalf("could not create HTTP client: %v", err)
 	}
 
-	result := func(w http.ResponseWriter, r *http.Request) {
-		payload, err := github.ValidatePayload(r, []byte(secret))
+	var tenantList []clientgroup.Tenant
+	if config.Tenants != "" {
+		tenantList, err = clientgroup.ReadTenants(config.Tenants)
 		if err != nil {
-			message := fmt.Sprintf("error validating request body: err=%s\n", err)
+			log.Fatalf("Set your LFSWATCHDOG_TENANTS environment variable to a valid tenants file: %v\n", err)
+		}
+		for _, tenant := range tenantList {
+			redact.AddValue(tenant.Secret)
+			redact.AddValue(tenant.PrivateKeyFile)
+		}
+	}
+	tenants := clientgroup.NewTenants(clientGroup, tenantList)
+
+	replica := replicaShard(config)
+	var canaryOpts canary.Options
+	if config.CanaryRepo != "" {
+		canaryOpts = canaryOptions(config)
+	}
+
+	drainDelay := defaultDrainDelay
+	if config.DrainDelay != "" {
+		drainDelay, err = time.ParseDuration(config.DrainDelay)
+		if err != nil || drainDelay < 0 {
+			log.Fatalf("Set your LFSWATCHDOG_DRAIN_DELAY environment variable to a duration like '10s'\n")
+		}
+	}
+
+	var latencySLO time.Duration
+	if config.LatencySLO != "" {
+		latencySLO, err = time.ParseDuration(config.LatencySLO)
+		if err != nil || latencySLO <= 0 {
+			log.Fatalf("Set your LFSWATCHDOG_LATENCY_SLO environment variable to a duration like '2m'\n")
+		}
+	}
+	if config.LatencyAlertURL != "" && latencySLO == 0 {
+		log.Fatalf("Set your LFSWATCHDOG_LATENCY_SLO environment variable to use LFSWATCHDOG_LATENCY_ALERT_URL\n")
+	}
+
+	var telemetryOpts telemetry.Options
+	if config.TelemetryURL != "" {
+		telemetryOpts = telemetryOptions(config)
+	}
+
+	if config.CheckConfig {
+		for _, group := range tenants.Groups() {
+			if err := checkApp(group, config.ListInstallations); err != nil {
+				log.Fatalf("configuration check failed: %v\n", err)
+			}
+		}
+		log.Printf("configuration is valid\n")
+		return
+	}
+
+	if config.CanaryRepo != "" {
+		if replica.Leader() {
+			go canary.Run(context.Background(), clientGroup, canaryOpts)
+		} else {
+			log.Printf("replica %d of %d leaves the canary to the leader\n", replica.Index, replica.Count)
+		}
+	}
+
+	if config.TelemetryURL != "" {
+		go telemetry.Run(context.Background(), telemetryOpts)
+	}
+
+	var apps []app
+	for _, group := range tenants.Groups() {
+		apps = append(apps, group)
+	}
+	go verifyPermissions(apps)
+
+	listener, err := listen(config.Port)
+	if err != nil {
+		log.Fatalf("could not listen: %v", err)
+	}
+
+	log.Printf("server started at path '%s' on '%s'...", config.Path, listener.Addr())
+	handler := NewHandler(tenants, config.Secret)
+	handler.SetTenants(tenantList)
+	handler.LogPayloads = logPayloads
+	handler.Synchronous = synchronous
+	ratebudget.SetLiveTraffic(func() int { return int(atomic.LoadInt32(&handler.pending)) })
+	if config.MaxPendingPushes != "" {
+		handler.MaxPendingPushes, err = strconv.Atoi(config.MaxPendingPushes)
+		if err != nil || handler.MaxPendingPushes < 1 {
+			log.Fatalf("Set your LFSWATCHDOG_MAX_PENDING_PUSHES environment variable to a positive number\n")
+		}
+	}
+	handler.latency = newLatencyTracker(latencySLO, config.LatencyAlertURL)
+	for _, p := range config.Pipelines {
+		if err := handler.AddPipeline(p.Pipeline, p.Concurrency); err != nil {
+			log.Fatalf("could not add a pipeline: %v\n", err)
+		}
+	}
+	if config.Store != "" {
+		items, err := store.Open(config.Store)
+		if err != nil {
+			log.Fatalf("could not open the store: %v\n", err)
+		}
+		if err := watchdog.SetStore(items); err != nil {
+			log.Fatalf("could not load the open findings: %v\n", err)
+		}
+		// Replicas may share the store, but resume their own checks
+		handler.Jobs = jobs.New(items, fmt.Sprintf("jobs-%d", replica.Index))
+	} else if config.JobDir != "" {
+		handler.Jobs, err = jobs.Open(config.JobDir)
+		if err != nil {
+			log.Fatalf("could not open the job directory: %v\n", err)
+		}
+	}
+	if handler.Jobs != nil {
+		if err := handler.Resume(); err != nil {
+			log.Printf("could not resume interrupted checks: %v\n", err)
+		}
+	}
+	if config.PublicURL != "" {
+		if config.JobDir == "" {
+			log.Fatalf("Set your LFSWATCHDOG_JOB_DIR environment variable to use LFSWATCHDOG_PUBLIC_URL\n")
+		}
+		artifacts, err := openArtifactStore(config.JobDir, config.PublicURL, handler.webhookSecret)
+		if err != nil {
+			log.Fatalf("could not open the artifact directory: %v\n", err)
+		}
+		watchdog.SetArtifactStore(artifacts)
+		http.Handle(artifactsPath, artifacts)
+		reports, err := openReportStore(config.JobDir, config.PublicURL, handler.webhookSecret)
+		if err != nil {
+			log.Fatalf("could not open the report directory: %v\n", err)
+		}
+		watchdog.SetReportStore(reports)
+		http.Handle(reportsPath, reports)
+	}
+	if config.JobDir != "" {
+		handler.onboarding, err = openOnboardingStore(config.JobDir)
+		if err != nil {
+			log.Fatalf("could not read the onboarded repositories: %v\n", err)
+		}
+	}
+	installations := &installationsHandler{token: config.AdminToken}
+	if config.JobDir != "" {
+		installations.store, err = openInstallationStore(config.JobDir)
+		if err != nil {
+			log.Fatalf("could not read the installation settings: %v\n", err)
+		}
+	}
+	http.Handle(config.Path, handler)
+	http.Handle(metricsPath, metrics.Handler())
+	http.HandleFunc(rulesPath, serveRules)
+	http.HandleFunc(badgePath, serveBadge)
+	http.HandleFunc(attributesTemplatePath, serveAttributesTemplate)
+	http.HandleFunc(healthPath, serveHealth)
+	if config.AdminToken != "" {
+		http.Handle(adminSettingsPath, &adminHandler{token: config.AdminToken})
+		http.Handle(repoAPIPath, &repoHandler{token: config.AdminToken, watchdogs: tenants})
+		http.Handle(orgAPIPath, &orgHandler{token: config.AdminToken, watchdogs: tenants})
+		http.Handle(adminDeliveriesPath, &deliveriesHandler{token: config.AdminToken, timelines: handler.timelines})
+		http.Handle(adminInstallationsPath, installations)
+		http.Handle(adminPermissionsPath, &permissionsHandler{token: config.AdminToken})
+		http.Handle(adminDrainPath, &drainHandler{token: config.AdminToken, handler: handler})
+	}
+	if config.ConfigDir != "" {
+		go watchConfigDir(config.ConfigDir, config, handler, clientGroup)
+	}
+	err = serve(&http.Server{}, listener, handler, drainDelay)
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal("Serve: ", err)
+	}
+}
+
+// Handler processes GitHub webhook deliveries
+type Handler struct {
+	clientGroup watchdogs
+	// mu guards secret, which changes when credentials are rotated, the
+	// previous secret and the secrets of the tenants
+	mu      sync.RWMutex
+	secret  string
+	tenants []tenantSecret
+	// previousSecret is still accepted until previousSecretUntil, so that
+	// deliveries signed before a rotation reached GitHub don't fail
+	previousSecret      string
+	previousSecretUntil time.Time
+	// LogPayloads logs every validated payload, with sensitive values masked
+	LogPayloads bool
+	// Synchronous checks pushes before responding and responds with a JSON
+	// DeliveryResult, so that redelivering a push in the webhook settings
+	// shows its result. GitHub gives up on responses after 10 seconds.
+	Synchronous bool
+	// MaxPendingPushes rejects pushes with 503 while this many pushes are
+	// being checked, if set
+	MaxPendingPushes int
+	// pending is the number of pushes being checked
+	pending int32
+	// Jobs persists push checks until they finish if set
+	Jobs *jobs.Store
+	// onboarding persists when the App was installed on repositories if
+	// set, onboardingMu serializes its updates
+	onboarding   *onboardingStore
+	onboardingMu sync.Mutex
+	// checks tracks the push checks running in the background
+	checks sync.WaitGroup
+	// timelines records the processing stages of recent deliveries
+	timelines *timelines
+	// latency tracks the time from pushes to their reports
+	latency *latencyTracker
+	// pipelines check pushes in addition to the Git LFS checks
+	pipelines pipelines
+}
+
+// NewHandler creates a webhook handler that checks pushes with watchdogs from clientGroup
+func NewHandler(clientGroup watchdogs, secret string) *Handler {
+	return &Handler{
+		clientGroup: clientGroup,
+		secret:      secret,
+		timelines:   newTimelines(maxTimelines),
+		latency:     newLatencyTracker(0, ""),
+	}
+}
+
+// SetSecret changes the webhook secret deliveries are validated with. The
+// previous secret is still accepted for secretGracePeriod.
+func (h *Handler) SetSecret(secret string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if secret == h.secret {
+		return
+	}
+	h.previousSecret, h.previousSecretUntil = h.secret, time.Now().Add(secretGracePeriod)
+	h.secret = secret
+}
+
+func (h *Handler) webhookSecret() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return []byte(h.secret)
+}
+
+// Return the previous webhook secret while it is still accepted, or nil
+func (h *Handler) previousWebhookSecret() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.previousSecret == "" || time.Now().After(h.previousSecretUntil) {
+		return nil
+	}
+	return []byte(h.previousSecret)
+}
+
+// Wait blocks until all checks started by the handler have finished
+func (h *Handler) Wait() {
+	h.checks.Wait()
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
+	if rejectDrained(w, r) {
+		return
+	}
+
+	payload, tenant, err := h.validatePayload(r)
+	if err != nil {
+		message := fmt.Sprintf("error validating request body: err=%s\n", err)
+		log.Print(message)
+		http.Error(w, message, 400)
+		return
+	}
+	defer r.Body.Close()
+
+	// Unsigned requests would push the deliveries of GitHub out of the
+	// timelines
+	timeline := &Timeline{
+		DeliveryID: github.DeliveryID(r),
+		Event:      github.WebHookType(r),
+		Received:   received,
+	}
+	h.timelines.add(timeline)
+	defer h.timelines.update(timeline, func(t *Timeline) { t.Responded = time.Now() })
+
+	if h.LogPayloads || logging.Debug() {
+		log.Printf("received '%s' delivery '%s': %s\n", github.WebHookType(r), github.DeliveryID(r), payload)
+	}
+
+	if github.WebHookType(r) == deploymentProtectionRuleEvent {
+		h.reviewDeployment(w, payload, tenant)
+		return
+	}
+
+	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if err != nil {
+		message := fmt.Sprintf("could not parse webhook: err=%v\n", err)
+		log.Print(message)
+		http.Error(w, message, 400)
+		return
+	}
+
+	switch e := event.(type) {
+	case *github.PushEvent:
+		// https://docs.github.com/en/developers/webhooks-and-events/webhook-events-and-payloads#push
+
+		if err := validatePushEvent(e); err != nil {
+			message := fmt.Sprintf("malformed push payload: %v\n", err)
 			log.Print(message)
-			http.Error(w, message, 400)
+			http.Error(w, message, http.StatusUnprocessableEntity)
 			return
 		}
-		defer r.Body.Close()
 
-		event, err := github.ParseWebHook(github.WebHookType(r), payload)
-		if err != nil {
-			message := fmt.Sprintf("could not parse webhook: err=%v\n", err)
+		if !tenant.allows(e.GetRepo().GetOwner().GetLogin()) {
+			message := fmt.Sprintf("push to '%s' is signed with the secret of another tenant\n", e.GetRepo().GetFullName())
 			log.Print(message)
-			http.Error(w, message, 400)
+			http.Error(w, message, http.StatusForbidden)
+			return
+		}
+
+		if err := h.resolveInstallation(r.Context(), e); err != nil {
+			if errors.Is(err, scm.ErrNotFound) {
+				// Organization and enterprise webhooks deliver pushes to all
+				// repositories, the App may be installed on some only
+				logging.Debugf("the App is not installed on '%s', ignoring the push\n", e.GetRepo().GetFullName())
+				io.WriteString(w, fmt.Sprintf("the App is not installed on '%s', ignoring the push\n", e.GetRepo().GetFullName()))
+				return
+			}
+			log.Printf("could not find the installation for '%s': %v\n", e.GetRepo().GetFullName(), err)
+			http.Error(w, redact.String(err.Error()), 500)
+			return
+		}
+
+		guard, err := h.clientGroup.GetWatchdog(e.GetRepo().GetOwner().GetLogin(), e.GetInstallation().GetID())
+		if err != nil {
+			log.Printf("could not obtain Watchdog client: %v\n", err)
+			// The error may contain the private key path
+			http.Error(w, redact.String(err.Error()), 500)
 			return
 		}
 
-		switch e := event.(type) {
-		case *github.PushEvent:
-			// https://docs.github.com/en/developers/webhooks-and-events/webhook-events-and-payloads#pull_request_review
+		h.timelines.update(timeline, func(t *Timeline) { t.Repo = e.GetRepo().GetFullName() })
 
-			guard, err := clientGroup.GetWatchdog(e.Installation.GetID())
+		if !h.acquirePush() {
+			rejectOverloaded(w, e.GetRepo().GetFullName())
+			return
+		}
+
+		var job *jobs.Job
+		if h.Jobs != nil {
+			job, err = h.Jobs.Add(github.DeliveryID(r), e)
 			if err != nil {
-				log.Printf("could not obtain Watchdog client: %v\n", err)
-				http.Error(w, err.Error(), 500)
-				return
+				// Still check the push, it's only lost if the server restarts
+				log.Printf("could not persist delivery '%s': %v\n", github.DeliveryID(r), err)
+				job = nil
 			}
+		}
 
-			guard.Check(e)
+		h.checks.Add(1)
+		if h.Synchronous {
+			result := h.runCheck(guard, e, job, timeline)
+			h.dispatch(guard, e)
+			writeDeliveryResult(w, result)
+			return
+		}
+		// GitHub expects a response within 10 seconds,
+		// check the push in the background.
+		go h.runCheck(guard, e, job, timeline)
+		h.dispatch(guard, e)
 
-		case *github.PingEvent:
-			io.WriteString(w, fmt.Sprintf("pong!\nhook_id: %d\nzen: %s\n", e.GetHookID(), e.GetZen()))
-		default:
-			message := fmt.Sprintf("unhandled event type: '%s'\n", github.WebHookType(r))
-			log.Print(message)
-			http.Error(w, message, 400)
+	case *github.InstallationEvent:
+		if !tenant.allows(e.GetInstallation().GetAccount().GetLogin()) {
+			http.Error(w, "installation is signed with the secret of another tenant\n", http.StatusForbidden)
+			return
+		}
+		var added int
+		if e.GetAction() == "created" {
+			added = h.onboard(e.Repositories)
+		}
+		switch e.GetAction() {
+		case "created", "new_permissions_accepted":
+			verifyInstallation(e.GetInstallation())
+		case "deleted":
+			forgetInstallation(e.GetInstallation().GetID())
 		}
+		io.WriteString(w, fmt.Sprintf("onboarded %d repositories\n", added))
+	case *github.InstallationRepositoriesEvent:
+		if !tenant.allows(e.GetInstallation().GetAccount().GetLogin()) {
+			http.Error(w, "installation is signed with the secret of another tenant\n", http.StatusForbidden)
+			return
+		}
+		var added int
+		if e.GetAction() == "added" {
+			added = h.onboard(e.RepositoriesAdded)
+		}
+		io.WriteString(w, fmt.Sprintf("onboarded %d repositories\n", added))
+	case *github.PullRequestEvent:
+		h.checkPullRequest(w, e, tenant)
+	case *github.CheckRunEvent:
+		h.rerunCheck(w, e, tenant)
+	case *github.PingEvent:
+		io.WriteString(w, fmt.Sprintf("pong!\nhook_id: %d\nzen: %s\n", e.GetHookID(), e.GetZen()))
+	default:
+		message := fmt.Sprintf("unhandled event type: '%s'\n", github.WebHookType(r))
+		log.Print(message)
+		http.Error(w, message, 400)
 	}
+}
+
+// Check an accepted push and release its slot. Returns nil if the check
+// panicked.
+func (h *Handler) runCheck(guard *watchdog.WatchDog, event *github.PushEvent, job *jobs.Job, timeline *Timeline) (result *watchdog.PushResult) {
+	defer h.checks.Done()
+	defer h.releasePush()
+	defer recoverCheck(event)
+	h.timelines.update(timeline, func(t *Timeline) { t.Dequeued = time.Now() })
+	result = h.check(guard, event, job)
+	h.timelines.finish(timeline, result)
+	h.latency.observe(event, time.Now())
+	return result
+}
 
+// Check a push and record the progress in job, if not nil. Rate limited
+// commits are checked again in the background, the handler waits for them
+// and the job stays open until then.
+func (h *Handler) check(guard *watchdog.WatchDog, event *github.PushEvent, job *jobs.Job) *watchdog.PushResult {
+	var checked func(*watchdog.CommitResult)
+	if job != nil {
+		checked = func(commit *watchdog.CommitResult) {
+			if err := job.MarkDone(commit.SHA); err != nil {
+				log.Printf("could not record the progress of job '%s': %v\n", job.ID, err)
+			}
+		}
+	}
+	result := guard.CheckWithProgress(event, checked)
+	h.checks.Add(1)
+	go func() {
+		defer h.checks.Done()
+		result.WaitRetries()
+		if job == nil {
+			return
+		}
+		if err := job.Finish(); err != nil {
+			log.Printf("could not remove job '%s': %v\n", job.ID, err)
+		}
+	}()
 	return result
 }
+
+// Log a panic of a background check instead of crashing the server, which
+// would abort the checks of all other pushes
+func recoverCheck(event *github.PushEvent) {
+	if r := recover(); r != nil {
+		log.Printf("checking a push to '%s' panicked: %v\n%s", event.GetRepo().GetFullName(), r, debug.Stack())
+	}
+}
+
+// Resume checks the commits of pushes that were interrupted by a restart
+func (h *Handler) Resume() error {
+	pending, err := h.Jobs.Pending()
+	if err != nil {
+		return err
+	}
+	for _, job := range pending {
+		event := job.Remaining()
+		guard, err := h.clientGroup.GetWatchdog(event.GetRepo().GetOwner().GetLogin(), event.GetInstallation().GetID())
+		if err != nil {
+			log.Printf("could not resume job '%s': %v\n", job.ID, err)
+			continue
+		}
+		log.Printf("resuming job '%s': %d of %d commits in '%s' are unchecked\n", job.ID, len(event.Commits), len(job.Event.Commits), event.GetRepo().GetFullName())
+		// Resumed pushes were accepted before, they are never rejected
+		pendingPushes.Set(float64(atomic.AddInt32(&h.pending, 1)))
+		h.checks.Add(1)
+		go func(job *jobs.Job) {
+			defer h.checks.Done()
+			defer h.releasePush()
+			defer recoverCheck(event)
+			h.check(guard, event, job)
+			h.latency.observe(event, time.Now())
+		}(job)
+	}
+	return nil
+}
+
+func replicaShard(config Config) shard.Shard {
+	if config.Replicas == "" {
+		return shard.Single
+	}
+
+	count, err := strconv.Atoi(config.Replicas)
+	if err != nil {
+		log.Fatalf("Set your LFSWATCHDOG_REPLICAS environment variable to the number of replicas\n")
+	}
+
+	var index int
+	if config.Replica != "" {
+		index, err = strconv.Atoi(config.Replica)
+		if err != nil {
+			log.Fatalf("Set your LFSWATCHDOG_REPLICA environment variable to the index of this replica\n")
+		}
+	} else {
+		hostname, _ := os.Hostname()
+		var ok bool
+		if index, ok = shard.Ordinal(hostname); !ok {
+			log.Fatalf("Set your LFSWATCHDOG_REPLICA environment variable, the hostname '%s' has no ordinal\n", hostname)
+		}
+	}
+
+	s, err := shard.New(index, count)
+	if err != nil {
+		log.Fatalf("invalid replica configuration: %v\n", err)
+	}
+	return s
+}
+
+func canaryOptions(config Config) canary.Options {
+	options := canary.Options{
+		Ref:      "main",
+		File:     "README.md",
+		Interval: defaultCanaryInterval,
+	}
+
+	parts := strings.Split(config.CanaryRepo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		log.Fatalf("Set your LFSWATCHDOG_CANARY_REPO environment variable to a repository like 'org/repo'\n")
+	}
+	options.Owner, options.Repo = parts[0], parts[1]
+
+	installation, err := strconv.ParseInt(config.CanaryInstallation, 10, 64)
+	if err != nil {
+		log.Fatalf("Set your LFSWATCHDOG_CANARY_INSTALLATION environment variable to the installation ID of the canary repository\n")
+	}
+	options.Installation = installation
+
+	if config.CanaryRef != "" {
+		options.Ref = config.CanaryRef
+	}
+	if config.CanaryFile != "" {
+		options.File = config.CanaryFile
+	}
+	if config.CanaryInterval != "" {
+		options.Interval, err = time.ParseDuration(config.CanaryInterval)
+		if err != nil || options.Interval <= 0 {
+			log.Fatalf("Set your LFSWATCHDOG_CANARY_INTERVAL environment variable to a duration like '5m'\n")
+		}
+	}
+	return options
+}
+
+func telemetryOptions(config Config) telemetry.Options {
+	options := telemetry.Options{
+		URL:        config.TelemetryURL,
+		Interval:   defaultTelemetryInterval,
+		Deployment: config.TelemetryDeployment,
+		Version:    config.Version,
+	}
+	if u, err := url.Parse(config.TelemetryURL); err != nil || u.Host == "" {
+		log.Fatalf("Set your LFSWATCHDOG_TELEMETRY_URL environment variable to a URL like 'https://telemetry.example.com/lfswatchdog'\n")
+	}
+	if config.TelemetryInterval != "" {
+		var err error
+		options.Interval, err = time.ParseDuration(config.TelemetryInterval)
+		if err != nil || options.Interval <= 0 {
+			log.Fatalf("Set your LFSWATCHDOG_TELEMETRY_INTERVAL environment variable to a duration like '24h'\n")
+		}
+	}
+	return options
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+// DeliveryResult is the response to a push delivery in synchronous mode
+type DeliveryResult struct {
+	Repo    string
+	Ref     string
+	Commits []*RecheckResult
+}
+
+// Respond to a push delivery with the result of its check
+func writeDeliveryResult(w http.ResponseWriter, result *watchdog.PushResult) {
+	if result == nil {
+		http.Error(w, "checking the push panicked, see the log\n", http.StatusInternalServerError)
+		return
+	}
+	response := &DeliveryResult{Repo: result.Repo, Ref: result.Ref, Commits: []*RecheckResult{}}
+	for _, commit := range result.Commits {
+		response.Commits = append(response.Commits, recheckResult(commit))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
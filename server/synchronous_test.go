@@ -0,0 +1,36 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSynchronousDeliveries(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddFile("test-org/payload-repo", "sha1", ".github/watchdog.yml", []byte("lfsSizeThreshold: 100\n"))
+	server.AddFileWithSize("test-org/payload-repo", "sha1", "large.bin", 1000)
+	handler := NewHandler(&fakeWatchdogs{server}, "secret")
+	handler.Synchronous = true
+
+	w := pushRequest(handler, []byte(validPush))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var result DeliveryResult
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.Equal(t, "test-org/payload-repo", result.Repo)
+	assert.Equal(t, "refs/heads/main", result.Ref)
+	if assert.Len(t, result.Commits, 1) {
+		commit := result.Commits[0]
+		assert.Equal(t, "sha1", commit.SHA)
+		assert.Equal(t, []watchdog.Finding{{Path: "large.bin", Size: 1000, Threshold: 100, Rule: watchdog.RuleOversizeFile, Severity: watchdog.SeverityError}}, commit.Findings)
+		assert.Contains(t, commit.Actions, "comment")
+	}
+	// The check finished before the response
+	assert.Len(t, server.Comments(), 1)
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/clientgroup"
+	"github.com/google/go-github/v35/github"
+)
+
+// tenantSecret is the webhook secret of a tenant App, which only signs
+// deliveries for the tenant's organizations
+type tenantSecret struct {
+	secret string
+	// Lower case organizations
+	orgs map[string]bool
+}
+
+// Report whether the secret signs deliveries for an owner. Deliveries
+// signed with the webhook secret, whose tenant is nil, are always allowed.
+func (t *tenantSecret) allows(owner string) bool {
+	return t == nil || t.orgs[strings.ToLower(owner)]
+}
+
+// SetTenants accepts deliveries signed with the webhook secrets of the
+// tenant Apps, for their organizations only
+func (h *Handler) SetTenants(tenants []clientgroup.Tenant) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tenants = nil
+	for _, tenant := range tenants {
+		t := tenantSecret{secret: tenant.Secret, orgs: make(map[string]bool)}
+		for _, org := range tenant.Orgs {
+			t.orgs[strings.ToLower(org)] = true
+		}
+		h.tenants = append(h.tenants, t)
+	}
+}
+
+// Validate the signature of a delivery with the webhook secret, the
+// previous webhook secret during its grace period and then the secrets of
+// the tenants. Returns the tenant whose secret signed the delivery, or nil
+// for the webhook secrets.
+func (h *Handler) validatePayload(r *http.Request) ([]byte, *tenantSecret, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.mu.RLock()
+	tenants := h.tenants
+	h.mu.RUnlock()
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	payload, err := github.ValidatePayload(r, h.webhookSecret())
+	if previous := h.previousWebhookSecret(); err != nil && previous != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if previousPayload, previousErr := github.ValidatePayload(r, previous); previousErr == nil {
+			return previousPayload, nil, nil
+		}
+	}
+	for i := 0; err != nil && i < len(tenants); i++ {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if tenantPayload, tenantErr := github.ValidatePayload(r, []byte(tenants[i].secret)); tenantErr == nil {
+			return tenantPayload, &tenants[i], nil
+		}
+	}
+	return payload, nil, err
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/clientgroup"
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantSecrets(t *testing.T) {
+	server := githubtest.NewServer()
+	defer server.Close()
+	server.AddInstallation("test-org/hook-repo", 7)
+	server.AddFile("test-org/hook-repo", "sha1", ".github/watchdog.yml", []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/hook-repo", "sha1", "large.bin", 2000)
+
+	// pushRequest signs with "secret", which is only the tenant's secret
+	handler := NewHandler(&fakeWatchdogs{server}, "default-secret")
+	assert.Equal(t, http.StatusBadRequest, pushRequest(handler, []byte(orgHookPush)).Code)
+
+	handler.SetTenants([]clientgroup.Tenant{{Orgs: []string{"Test-Org"}, Secret: "secret"}})
+	assert.Equal(t, http.StatusOK, pushRequest(handler, []byte(orgHookPush)).Code)
+	handler.Wait()
+	assert.NotEmpty(t, server.Statuses())
+
+	// A tenant can't push on behalf of the organizations of others
+	handler.SetTenants([]clientgroup.Tenant{{Orgs: []string{"another-org"}, Secret: "secret"}})
+	assert.Equal(t, http.StatusForbidden, pushRequest(handler, []byte(orgHookPush)).Code)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+)
+
+const (
+	// adminDeliveriesPath lists recent deliveries, a delivery ID may follow
+	adminDeliveriesPath = "/admin/deliveries/"
+
+	// Number of recent delivery timelines to keep
+	maxTimelines = 500
+)
+
+// Timeline records when a delivery went through the stages of processing,
+// to see where the 10 second webhook response budget is spent
+type Timeline struct {
+	DeliveryID string
+	Event      string
+	Repo       string `json:",omitempty"`
+	Received   time.Time
+	// Responded is when the response was sent to GitHub
+	Responded time.Time
+	// Dequeued is when the background check of a push started
+	Dequeued time.Time
+	// Finished is when all commits were checked
+	Finished time.Time
+	Commits  []CommitTimeline `json:",omitempty"`
+}
+
+// CommitTimeline records the stages of checking a commit of a push
+type CommitTimeline struct {
+	SHA string
+	watchdog.Timings
+	// Trace records how each file was evaluated while debug logging was on
+	Trace []watchdog.FileTrace `json:",omitempty"`
+}
+
+// timelines keeps the timelines of the most recent deliveries
+type timelines struct {
+	mu      sync.Mutex
+	entries []*Timeline
+	next    int
+}
+
+func newTimelines(size int) *timelines {
+	return &timelines{entries: make([]*Timeline, size)}
+}
+
+// add records a new delivery, replacing the oldest one if full
+func (t *timelines) add(timeline *Timeline) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[t.next] = timeline
+	t.next = (t.next + 1) % len(t.entries)
+}
+
+// update modifies a recorded timeline
+func (t *timelines) update(timeline *Timeline, fn func(*Timeline)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(timeline)
+}
+
+// recent returns copies of the recorded timelines, newest first
+func (t *timelines) recent() []Timeline {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var recent []Timeline
+	for i := 1; i <= len(t.entries); i++ {
+		e := t.entries[(t.next-i+len(t.entries))%len(t.entries)]
+		if e == nil {
+			break
+		}
+		c := *e
+		c.Commits = append([]CommitTimeline(nil), e.Commits...)
+		recent = append(recent, c)
+	}
+	return recent
+}
+
+// finish records the end of a push check
+func (t *timelines) finish(timeline *Timeline, result *watchdog.PushResult) {
+	t.update(timeline, func(timeline *Timeline) {
+		timeline.Finished = time.Now()
+		for _, commit := range result.Commits {
+			timeline.Commits = append(timeline.Commits, CommitTimeline{SHA: commit.SHA, Timings: commit.Timings, Trace: commit.Trace})
+		}
+	})
+}
+
+// deliveriesHandler serves the recent delivery timelines to callers
+// presenting the admin token
+type deliveriesHandler struct {
+	token     string
+	timelines *timelines
+}
+
+func (h *deliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	recent := h.timelines.recent()
+	if id := strings.TrimPrefix(r.URL.Path, adminDeliveriesPath); id != "" {
+		var found []Timeline
+		for _, timeline := range recent {
+			if timeline.DeliveryID == id {
+				found = append(found, timeline)
+			}
+		}
+		if len(found) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		// GitHub redeliveries reuse the delivery ID
+		recent = found
+	} else {
+		// Traces are only served per delivery, they would bloat the list
+		for i := range recent {
+			commits := make([]CommitTimeline, len(recent[i].Commits))
+			for j, commit := range recent[i].Commits {
+				commit.Trace = nil
+				commits[j] = commit
+			}
+			recent[i].Commits = commits
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recent)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/watchdog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimelines(t *testing.T) {
+	timelines := newTimelines(2)
+	assert.Empty(t, timelines.recent())
+
+	first := &Timeline{DeliveryID: "1", Received: time.Now()}
+	timelines.add(first)
+	timelines.finish(first, &watchdog.PushResult{Commits: []*watchdog.CommitResult{{SHA: "sha1"}}})
+	timelines.add(&Timeline{DeliveryID: "2"})
+	timelines.add(&Timeline{DeliveryID: "3"})
+
+	recent := timelines.recent()
+	if assert.Len(t, recent, 2) {
+		assert.Equal(t, "3", recent[0].DeliveryID)
+		assert.Equal(t, "2", recent[1].DeliveryID)
+	}
+	assert.False(t, first.Finished.IsZero())
+	assert.Equal(t, "sha1", first.Commits[0].SHA)
+}
+
+func TestDeliveriesHandler(t *testing.T) {
+	timelines := newTimelines(10)
+	push := &Timeline{DeliveryID: "abc", Event: "push"}
+	timelines.add(push)
+	timelines.finish(push, &watchdog.PushResult{Commits: []*watchdog.CommitResult{{
+		SHA:   "sha1",
+		Trace: []watchdog.FileTrace{{Path: "large.bin", Size: 2000, Threshold: 1000, Decision: "finding", Rule: "LFS001"}},
+	}}})
+	timelines.add(&Timeline{DeliveryID: "def", Event: "ping"})
+	handler := &deliveriesHandler{token: "admin-token", timelines: timelines}
+
+	request := func(path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request(adminDeliveriesPath, "wrong").Code)
+	assert.Equal(t, http.StatusNotFound, request(adminDeliveriesPath+"missing", "admin-token").Code)
+
+	var all []Timeline
+	assert.Nil(t, json.Unmarshal(request(adminDeliveriesPath, "admin-token").Body.Bytes(), &all))
+	if assert.Len(t, all, 2) {
+		assert.Empty(t, all[1].Commits[0].Trace)
+	}
+
+	var one []Timeline
+	assert.Nil(t, json.Unmarshal(request(adminDeliveriesPath+"abc", "admin-token").Body.Bytes(), &one))
+	if assert.Len(t, one, 1) {
+		assert.Equal(t, "push", one[0].Event)
+		assert.Equal(t, "finding", one[0].Commits[0].Trace[0].Decision)
+	}
+}
+
+func TestTimelinesOnlySignedDeliveries(t *testing.T) {
+	handler := NewHandler(&fakeWatchdogs{}, "secret")
+	defer handler.Wait()
+
+	ping := []byte(`{"zen": "Keep it logically awesome.", "hook_id": 1}`)
+	r := httptest.NewRequest(http.MethodPost, defaultPath, bytes.NewReader(ping))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-GitHub-Event", "ping")
+	r.Header.Set("X-Hub-Signature-256", "sha256=0000")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, handler.timelines.recent())
+
+	assert.Equal(t, http.StatusOK, eventRequest(handler, "ping", ping).Code)
+	assert.Len(t, handler.timelines.recent(), 1)
+}
@@ -0,0 +1,62 @@
+// Package shard assigns background jobs to replicas, so that jobs don't run
+// once per replica in multi-replica deployments.
+//
+// Every replica knows its index and the number of replicas, e.g. from the
+// ordinal of a Kubernetes StatefulSet pod. Jobs that must run exactly once
+// run on the leader, jobs per installation run on the replica that owns
+// the installation.
+package shard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Shard is the position of a replica in the deployment
+type Shard struct {
+	Index int
+	Count int
+}
+
+// Single is the shard of a deployment with one replica
+var Single = Shard{Index: 0, Count: 1}
+
+// New validates a replica index and count
+func New(index, count int) (Shard, error) {
+	if count < 1 || index < 0 || index >= count {
+		return Shard{}, fmt.Errorf("replica index %d is not within %d replicas", index, count)
+	}
+	return Shard{Index: index, Count: count}, nil
+}
+
+// Leader reports whether the replica runs jobs that must run exactly once
+func (s Shard) Leader() bool {
+	return s.Index == 0
+}
+
+// Owns reports whether the replica runs the jobs of an installation
+func (s Shard) Owns(installationID int64) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	owner := installationID % int64(s.Count)
+	if owner < 0 {
+		owner += int64(s.Count)
+	}
+	return owner == int64(s.Index)
+}
+
+// Ordinal returns the trailing number of a StatefulSet pod hostname like
+// "lfswatchdog-2"
+func Ordinal(hostname string) (int, bool) {
+	i := strings.LastIndex(hostname, "-")
+	if i < 0 {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(hostname[i+1:])
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+	return ordinal, true
+}
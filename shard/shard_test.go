@@ -0,0 +1,43 @@
+package shard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(0, 1)
+	assert.Nil(t, err)
+	_, err = New(3, 3)
+	assert.NotNil(t, err)
+	_, err = New(0, 0)
+	assert.NotNil(t, err)
+}
+
+func TestOwns(t *testing.T) {
+	shards := []Shard{{0, 3}, {1, 3}, {2, 3}}
+	for _, installation := range []int64{1, 2, 3, 42, 1000} {
+		owners := 0
+		for _, s := range shards {
+			if s.Owns(installation) {
+				owners++
+			}
+		}
+		assert.Equal(t, 1, owners, "installation %d", installation)
+	}
+	assert.True(t, Single.Owns(42))
+	assert.True(t, Single.Leader())
+	assert.False(t, shards[1].Leader())
+}
+
+func TestOrdinal(t *testing.T) {
+	ordinal, ok := Ordinal("lfswatchdog-2")
+	assert.True(t, ok)
+	assert.Equal(t, 2, ordinal)
+
+	_, ok = Ordinal("lfswatchdog-7d9f8c6b5-x2k4q")
+	assert.False(t, ok)
+	_, ok = Ordinal("localhost")
+	assert.False(t, ok)
+}
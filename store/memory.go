@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Memory is a Store that keeps the items in memory
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	keys   []string
+	values map[string][]byte
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*memoryBucket)}
+}
+
+// Get implements Store
+func (m *Memory) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b, ok := m.buckets[bucket]; ok {
+		if value, ok := b.values[key]; ok {
+			return append([]byte(nil), value...), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Put implements Store
+func (m *Memory) Put(ctx context.Context, bucket, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[bucket]
+	if !ok {
+		b = &memoryBucket{values: make(map[string][]byte)}
+		m.buckets[bucket] = b
+	}
+	if _, ok := b.values[key]; !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete implements Store
+func (m *Memory) Delete(ctx context.Context, bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil
+	}
+	if _, ok := b.values[key]; !ok {
+		return nil
+	}
+	delete(b.values, key)
+	for i, k := range b.keys {
+		if k == key {
+			b.keys = append(b.keys[:i], b.keys[i+1:]...)
+			break
+		}
+	}
+	if len(b.keys) == 0 {
+		delete(m.buckets, bucket)
+	}
+	return nil
+}
+
+// List implements Store
+func (m *Memory) List(ctx context.Context, bucket string) ([]Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, nil
+	}
+	items := make([]Item, len(b.keys))
+	for i, key := range b.keys {
+		items[i] = Item{Key: key, Value: append([]byte(nil), b.values[key]...)}
+	}
+	return items, nil
+}
+
+// Buckets implements Store
+func (m *Memory) Buckets(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buckets := make([]string, 0, len(m.buckets))
+	for bucket := range m.buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+// Close implements Store
+func (m *Memory) Close() error { return nil }
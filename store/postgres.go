@@ -0,0 +1,7 @@
+//go:build postgres
+// +build postgres
+
+package store
+
+// Link the Postgres driver
+import _ "github.com/lib/pq"
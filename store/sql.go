@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect adapts the SQL store to a database
+type Dialect struct {
+	// Driver is the name the database/sql driver registers
+	Driver string
+	// Tag is the build tag that links the driver
+	Tag string
+	// Migrations create and change the schema, in order. Applied
+	// migrations are recorded in lfswatchdog_schema, so they must never
+	// change once released; append new ones instead.
+	Migrations []string
+	// Numbered placeholders, e.g. $1, instead of ?
+	numbered bool
+	// Maximum number of open connections, 0 is unlimited
+	maxOpenConns int
+}
+
+// SQLite stores the items in a database file
+var SQLite = &Dialect{
+	Driver: "sqlite3",
+	Tag:    "sqlite",
+	Migrations: []string{
+		`CREATE TABLE lfswatchdog_items (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			bucket TEXT NOT NULL,
+			name TEXT NOT NULL,
+			value BLOB NOT NULL,
+			UNIQUE (bucket, name)
+		)`,
+	},
+	// SQLite locks the whole database for writes
+	maxOpenConns: 1,
+}
+
+// Postgres stores the items in a database that replicas share
+var Postgres = &Dialect{
+	Driver: "postgres",
+	Tag:    "postgres",
+	Migrations: []string{
+		`CREATE TABLE lfswatchdog_items (
+			seq BIGSERIAL PRIMARY KEY,
+			bucket TEXT NOT NULL,
+			name TEXT NOT NULL,
+			value BYTEA NOT NULL,
+			UNIQUE (bucket, name)
+		)`,
+	},
+	numbered: true,
+}
+
+// SQL is a Store in a SQL database
+type SQL struct {
+	db      *sql.DB
+	dialect *Dialect
+}
+
+// OpenSQL connects to a database with the driver of a dialect and migrates
+// its schema to the current version
+func OpenSQL(dialect *Dialect, dsn string) (*SQL, error) {
+	if !driverLinked(dialect.Driver) {
+		return nil, fmt.Errorf("the %s driver is not linked, build the watchdog with '-tags %s'", dialect.Driver, dialect.Tag)
+	}
+	db, err := sql.Open(dialect.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(dialect.maxOpenConns)
+
+	s := &SQL{db: db, dialect: dialect}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not migrate the schema: %w", err)
+	}
+	return s, nil
+}
+
+func driverLinked(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply the migrations that the database lacks, each in a transaction.
+// Replicas that start at the same time may race to apply a migration, the
+// losers fail to start and succeed once restarted.
+func (s *SQL) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS lfswatchdog_schema (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	var version int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM lfswatchdog_schema`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(s.dialect.Migrations) {
+		return fmt.Errorf("schema version %d is newer than this watchdog, which knows %d", version, len(s.dialect.Migrations))
+	}
+	for i := version; i < len(s.dialect.Migrations); i++ {
+		if err := s.apply(ctx, i+1, s.dialect.Migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQL) apply(ctx context.Context, version int, migration string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO lfswatchdog_schema (version) VALUES (?)`), version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replace the ? placeholders of a query for dialects with numbered ones.
+// Queries of the store have no literals that contain a ?.
+func (s *SQL) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Get implements Store
+func (s *SQL) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT value FROM lfswatchdog_items WHERE bucket = ? AND name = ?`), bucket, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+// Put implements Store
+func (s *SQL) Put(ctx context.Context, bucket, key string, value []byte) error {
+	// Both dialects support upserts, which keep the sequence number of the
+	// first put
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO lfswatchdog_items (bucket, name, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, name) DO UPDATE SET value = excluded.value`), bucket, key, value)
+	return err
+}
+
+// Delete implements Store
+func (s *SQL) Delete(ctx context.Context, bucket, key string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM lfswatchdog_items WHERE bucket = ? AND name = ?`), bucket, key)
+	return err
+}
+
+// List implements Store
+func (s *SQL) List(ctx context.Context, bucket string) ([]Item, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT name, value FROM lfswatchdog_items WHERE bucket = ? ORDER BY seq`), bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.Key, &item.Value); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Buckets implements Store
+func (s *SQL) Buckets(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT bucket FROM lfswatchdog_items ORDER BY bucket`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []string
+	for rows.Next() {
+		var bucket string
+		if err := rows.Scan(&bucket); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+// Close implements Store
+func (s *SQL) Close() error { return s.db.Close() }
@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package store
+
+// Link the SQLite driver, which requires cgo
+import _ "github.com/mattn/go-sqlite3"
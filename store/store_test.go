@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+
+	_, err := s.Get(ctx, "jobs", "a")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	assert.Nil(t, s.Put(ctx, "jobs", "b", []byte("1")))
+	assert.Nil(t, s.Put(ctx, "jobs", "a", []byte("2")))
+	assert.Nil(t, s.Put(ctx, "jobs", "b", []byte("3")))
+	assert.Nil(t, s.Put(ctx, "violations", "c", []byte("4")))
+
+	value, err := s.Get(ctx, "jobs", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("3"), value)
+
+	// Replacing a value keeps its position
+	items, err := s.List(ctx, "jobs")
+	assert.Nil(t, err)
+	assert.Equal(t, []Item{{"b", []byte("3")}, {"a", []byte("2")}}, items)
+
+	assert.Nil(t, s.Delete(ctx, "jobs", "b"))
+	assert.Nil(t, s.Delete(ctx, "jobs", "missing"))
+	assert.Nil(t, s.Delete(ctx, "violations", "c"))
+	buckets, err := s.Buckets(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"jobs"}, buckets)
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	src, dst := NewMemory(), NewMemory()
+	assert.Nil(t, src.Put(ctx, "jobs", "b", []byte("1")))
+	assert.Nil(t, src.Put(ctx, "jobs", "a", []byte("2")))
+	assert.Nil(t, src.Put(ctx, "violations", "c", []byte("3")))
+	assert.Nil(t, dst.Put(ctx, "violations", "d", []byte("4")))
+
+	copied, err := Copy(ctx, dst, src)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, copied)
+
+	items, err := dst.List(ctx, "jobs")
+	assert.Nil(t, err)
+	assert.Equal(t, []Item{{"b", []byte("1")}, {"a", []byte("2")}}, items)
+	items, err = dst.List(ctx, "violations")
+	assert.Nil(t, err)
+	assert.Equal(t, []Item{{"d", []byte("4")}, {"c", []byte("3")}}, items)
+}
+
+func TestOpen(t *testing.T) {
+	s, err := Open("memory:")
+	assert.Nil(t, err)
+	assert.IsType(t, &Memory{}, s)
+
+	// The drivers are only linked with build tags
+	if !driverLinked(SQLite.Driver) {
+		_, err = Open("sqlite:/tmp/state.db")
+		assert.EqualError(t, err, "the sqlite3 driver is not linked, build the watchdog with '-tags sqlite'")
+	}
+
+	_, err = Open("mysql://watchdog:secret@db/watchdog")
+	assert.EqualError(t, err, "unsupported store 'mysql:'")
+	_, err = Open("state.db")
+	assert.NotNil(t, err)
+}
+
+func TestRebind(t *testing.T) {
+	query := `DELETE FROM lfswatchdog_items WHERE bucket = ? AND name = ?`
+	assert.Equal(t, query, (&SQL{dialect: SQLite}).rebind(query))
+	assert.Equal(t, `DELETE FROM lfswatchdog_items WHERE bucket = $1 AND name = $2`, (&SQL{dialect: Postgres}).rebind(query))
+}
@@ -0,0 +1,163 @@
+// Package telemetry periodically reports anonymous aggregate usage
+// statistics to an internal endpoint, so that the adoption and impact of
+// the watchdog can be measured across the deployments of business units.
+//
+// Only counts leave the process: repositories are counted by a hash of
+// their name, and no file names, users or findings are sent. Telemetry is
+// disabled unless Run is called.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+)
+
+const postTimeout = 10 * time.Second
+
+var failures = metrics.NewCounter("lfswatchdog_telemetry_failures_total", "Telemetry reports that could not be sent.")
+
+// Options describe where and how often usage is reported
+type Options struct {
+	URL      string
+	Interval time.Duration
+	// Deployment names the deployment, e.g. the business unit, if set
+	Deployment string
+	// Version of the watchdog
+	Version string
+}
+
+// Report is posted as JSON to the telemetry endpoint every interval. The
+// counts cover the time since the previous report.
+type Report struct {
+	// Instance is random and changes with every start of the process
+	Instance   string    `json:"instance"`
+	Deployment string    `json:"deployment,omitempty"`
+	Version    string    `json:"version"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	// Repositories is the number of distinct repositories checked
+	Repositories int `json:"repositories"`
+	Commits      int `json:"commits"`
+	// Findings counts reported findings by rule ID
+	Findings map[string]int `json:"findings"`
+}
+
+var enabled int32
+
+// Usage since the last report
+var usage = struct {
+	sync.Mutex
+	start    time.Time
+	repos    map[[sha256.Size]byte]bool
+	commits  int
+	findings map[string]int
+}{repos: make(map[[sha256.Size]byte]bool), findings: make(map[string]int)}
+
+// RecordCommit counts a checked commit of a repository and its findings by
+// rule ID. It does nothing unless telemetry is enabled.
+func RecordCommit(repo string, rules []string) {
+	if atomic.LoadInt32(&enabled) == 0 {
+		return
+	}
+	usage.Lock()
+	defer usage.Unlock()
+	usage.repos[sha256.Sum256([]byte(strings.ToLower(repo)))] = true
+	usage.commits++
+	for _, rule := range rules {
+		usage.findings[rule]++
+	}
+}
+
+// Take the usage since the last report and start counting anew
+func take(end time.Time) Report {
+	usage.Lock()
+	defer usage.Unlock()
+	report := Report{
+		Start:        usage.start,
+		End:          end,
+		Repositories: len(usage.repos),
+		Commits:      usage.commits,
+		Findings:     usage.findings,
+	}
+	usage.start = end
+	usage.repos = make(map[[sha256.Size]byte]bool)
+	usage.commits = 0
+	usage.findings = make(map[string]int)
+	return report
+}
+
+// Run reports the usage every interval until ctx is done
+func Run(ctx context.Context, options Options) {
+	instance, err := newInstanceID()
+	if err != nil {
+		log.Printf("could not create the telemetry instance ID, telemetry is disabled: %v\n", err)
+		return
+	}
+	take(time.Now())
+	atomic.StoreInt32(&enabled, 1)
+	defer atomic.StoreInt32(&enabled, 0)
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report := take(now)
+			report.Instance, report.Deployment, report.Version = instance, options.Deployment, options.Version
+			if err := post(ctx, options.URL, &report); err != nil {
+				// The counts are lost rather than reported twice
+				log.Printf("could not send the telemetry report: %v\n", err)
+				failures.Inc()
+			}
+		}
+	}
+}
+
+// Post a report to the telemetry endpoint
+func post(ctx context.Context, url string, report *Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, postTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Return a random ID that tells the reports of concurrent replicas apart
+// without identifying the host
+func newInstanceID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,56 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordCommitWhileDisabled(t *testing.T) {
+	take(time.Now())
+	RecordCommit("test-org/test-repo", []string{"LFS001"})
+	report := take(time.Now())
+	assert.Equal(t, 0, report.Commits)
+	assert.Empty(t, report.Findings)
+}
+
+func TestRun(t *testing.T) {
+	reports := make(chan Report, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report Report
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&report))
+		reports <- report
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Run(ctx, Options{URL: server.URL, Interval: 200 * time.Millisecond, Deployment: "games", Version: "2.0.0"})
+	for atomic.LoadInt32(&enabled) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	RecordCommit("test-org/test-repo", []string{"LFS001", "LFS001"})
+	RecordCommit("Test-Org/Test-Repo", []string{"LFS003"})
+	RecordCommit("test-org/other-repo", nil)
+
+	report := <-reports
+	assert.Len(t, report.Instance, 16)
+	assert.Equal(t, "games", report.Deployment)
+	assert.Equal(t, "2.0.0", report.Version)
+	assert.Equal(t, 2, report.Repositories)
+	assert.Equal(t, 3, report.Commits)
+	assert.Equal(t, map[string]int{"LFS001": 2, "LFS003": 1}, report.Findings)
+	assert.True(t, report.End.After(report.Start))
+
+	// Every report counts the usage since the previous one
+	report = <-reports
+	assert.Equal(t, 0, report.Commits)
+	assert.Empty(t, report.Findings)
+}
@@ -0,0 +1,130 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// Extensions with fewer files get no threshold advice
+	minAdviceFiles = 5
+	// Bounds the extensions of a threshold advice
+	maxAdviceExtensions = 50
+	// Percentile of the existing file sizes that new files of an extension
+	// are compared to
+	advicePercentile = 0.95
+)
+
+// ThresholdAdvice recommends size thresholds from the files of a tree
+type ThresholdAdvice struct {
+	Ref string
+	// Files is the number of files the advice is based on
+	Files int
+	// Threshold is the configured lfsSizeThreshold at Ref
+	Threshold int
+	// Extensions are ordered by their total size, largest first
+	Extensions []ExtensionAdvice
+	// Truncated is set if GitHub did not return all files
+	Truncated bool `json:",omitempty"`
+}
+
+// ExtensionAdvice describes the sizes of the files with an extension
+type ExtensionAdvice struct {
+	// Extension is lower case with a leading dot, or empty for files
+	// without one
+	Extension  string
+	Files      int
+	TotalSize  int64
+	MedianSize int
+	P95Size    int
+	MaxSize    int
+	// Threshold is a size that flags files larger than almost all
+	// existing files of the extension
+	Threshold int `json:",omitempty"`
+	// TrackWithLFS is set if most files are larger than the configured
+	// threshold, so the whole extension should be tracked with Git LFS
+	TrackWithLFS bool `json:",omitempty"`
+}
+
+// AdviseThresholds inspects the size distribution of the files at ref and
+// recommends a threshold per extension, so that admins don't have to guess
+// a number for each asset type. Git LFS pointers are measured as they are
+// stored in the repository.
+func (watchdog *WatchDog) AdviseThresholds(ctx context.Context, owner, repo, ref string) (*ThresholdAdvice, error) {
+	tree, err := watchdog.scm.GetTree(ctx, owner, repo, ref, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the tree of '%s': %w", ref, err)
+	}
+	config, err := watchdog.getWatchDogConfig(ctx, owner, repo, ref)
+	if err != nil {
+		log.Printf("using the default configuration to advise thresholds for '%s/%s': %v\n", owner, repo, err)
+	}
+
+	advice := &ThresholdAdvice{Ref: ref, Threshold: config.LFSSizeThreshold, Truncated: tree.Truncated}
+	sizes := make(map[string][]int)
+	for _, entry := range tree.Entries {
+		if entry.Type != "file" {
+			continue
+		}
+		advice.Files++
+		ext := strings.ToLower(path.Ext(entry.Path))
+		sizes[ext] = append(sizes[ext], entry.Size)
+	}
+
+	for ext, s := range sizes {
+		sort.Ints(s)
+		e := ExtensionAdvice{
+			Extension:  ext,
+			Files:      len(s),
+			MedianSize: nearestRank(s, 0.5),
+			P95Size:    nearestRank(s, advicePercentile),
+			MaxSize:    s[len(s)-1],
+		}
+		for _, size := range s {
+			e.TotalSize += int64(size)
+		}
+		if len(s) >= minAdviceFiles {
+			e.TrackWithLFS = e.MedianSize > config.LFSSizeThreshold
+			if !e.TrackWithLFS {
+				e.Threshold = roundUpSize(e.P95Size)
+			}
+		}
+		advice.Extensions = append(advice.Extensions, e)
+	}
+	sort.Slice(advice.Extensions, func(i, j int) bool {
+		a, b := advice.Extensions[i], advice.Extensions[j]
+		if a.TotalSize != b.TotalSize {
+			return a.TotalSize > b.TotalSize
+		}
+		return a.Extension < b.Extension
+	})
+	if len(advice.Extensions) > maxAdviceExtensions {
+		advice.Extensions = advice.Extensions[:maxAdviceExtensions]
+	}
+	log.Printf("advised thresholds for %d extensions of '%s/%s' at '%s'\n", len(advice.Extensions), owner, repo, ref)
+	return advice, nil
+}
+
+// Return the p-th percentile of sorted sizes with the nearest-rank method
+func nearestRank(sorted []int, p float64) int {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// Round a size up to the next power of two of at least 1KB, which reads
+// well as a threshold
+func roundUpSize(size int) int {
+	threshold := 1024
+	for threshold < size {
+		threshold *= 2
+	}
+	return threshold
+}
@@ -0,0 +1,85 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// EvalRequest describes the files of a commit to evaluate
+type EvalRequest struct {
+	Owner string
+	Repo  string
+	// SHA is the commit (or any ref) the files are measured at
+	SHA   string
+	Files []string
+	// Config is used instead of the repository's .github/watchdog.yml if
+	// set. Repositories without one are evaluated with the defaults.
+	Config *Config
+}
+
+// Findings lists the files that violate the policy
+type Findings []Finding
+
+// EvaluationError lists the problems that prevented a complete evaluation.
+// Findings returned alongside it are still valid.
+type EvaluationError struct {
+	Errors []error
+}
+
+func (e *EvaluationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("evaluation incomplete: %s", strings.Join(messages, "; "))
+}
+
+// Unwrap returns the first error to support errors.Is and errors.As
+func (e *EvaluationError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[0]
+}
+
+// Evaluate applies the LFS policy to the files of a commit without posting
+// anything to GitHub. This allows other services to reuse the policy logic
+// of the watchdog without running the webhook server.
+//
+// Findings suppressed by the configuration are not returned.
+// If some files could not be evaluated, Evaluate returns the findings for
+// the remaining files together with an *EvaluationError.
+func Evaluate(ctx context.Context, client scm.Client, request EvalRequest) (Findings, error) {
+	watchdog := New(client)
+	var errs []error
+
+	config := request.Config
+	if config == nil {
+		var err error
+		config, err = watchdog.getWatchDogConfig(ctx, request.Owner, request.Repo, request.SHA)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not obtain configuration: %w", err))
+		}
+	}
+
+	commit := &Commit{
+		Owner:    request.Owner,
+		Repo:     request.Repo,
+		SHA:      request.SHA,
+		Modified: request.Files,
+	}
+	result := watchdog.evaluate(ctx, commit, config)
+	// Whether the files of a request are new is unknown
+	for i := range result.Findings {
+		result.Findings[i].Modified = false
+	}
+
+	errs = append(errs, result.Errors...)
+	if len(errs) > 0 {
+		return result.Findings, &EvaluationError{Errors: errs}
+	}
+	return result.Findings, nil
+}
@@ -0,0 +1,99 @@
+package watchdog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+)
+
+// ArtifactStore keeps the complete results of check runs whose summaries
+// are too long to read, or are truncated
+type ArtifactStore interface {
+	// Save stores content under a file name and returns its URL
+	Save(name string, content []byte) (string, error)
+}
+
+var artifactStore = struct {
+	sync.RWMutex
+	store ArtifactStore
+}{}
+
+// SetArtifactStore links the complete results of large check runs from
+// their summaries. A nil store disables the export.
+func SetArtifactStore(store ArtifactStore) {
+	artifactStore.Lock()
+	defer artifactStore.Unlock()
+	artifactStore.store = store
+}
+
+func currentArtifactStore() ArtifactStore {
+	artifactStore.RLock()
+	defer artifactStore.RUnlock()
+	return artifactStore.store
+}
+
+// Results is the exported result of a check run
+type Results struct {
+	Repo     string
+	SHA      string
+	Findings []Finding
+}
+
+// Render findings as CSV with a header row
+func findingsCSV(findings []Finding) ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"path", "rule", "severity", "size", "threshold", "lockedBy", "target", "commit", "changes"})
+	for _, finding := range findings {
+		w.Write([]string{
+			finding.Path,
+			finding.Rule,
+			finding.Severity,
+			strconv.Itoa(finding.Size),
+			strconv.Itoa(finding.Threshold),
+			finding.LockedBy,
+			finding.Target,
+			finding.Commit,
+			strconv.Itoa(finding.Changes),
+		})
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+// Export the findings of a large check run as JSON and CSV and return a
+// Markdown line that links them. Returns "" if there is no store, the
+// findings fit the summary or the export failed.
+func exportResults(org, repo, ref string, findings []Finding) string {
+	store := currentArtifactStore()
+	if store == nil || len(findings) <= collapseThreshold {
+		return ""
+	}
+
+	name := fmt.Sprintf("%s-%s-%s", org, repo, shortSHA(ref))
+	jsonContent, err := json.MarshalIndent(Results{Repo: org + "/" + repo, SHA: ref, Findings: findings}, "", "  ")
+	if err != nil {
+		log.Printf("could not export the results of '%s' in '%s/%s': %v\n", ref, org, repo, err)
+		return ""
+	}
+	csvContent, err := findingsCSV(findings)
+	if err != nil {
+		log.Printf("could not export the results of '%s' in '%s/%s': %v\n", ref, org, repo, err)
+		return ""
+	}
+	jsonURL, err := store.Save(name+".json", jsonContent)
+	if err != nil {
+		log.Printf("could not store the results of '%s' in '%s/%s': %v\n", ref, org, repo, err)
+		return ""
+	}
+	csvURL, err := store.Save(name+".csv", csvContent)
+	if err != nil {
+		log.Printf("could not store the results of '%s' in '%s/%s': %v\n", ref, org, repo, err)
+		return ""
+	}
+	return fmt.Sprintf("Download the complete results of all %d findings as [JSON](%s) or [CSV](%s).\n\n", len(findings), jsonURL, csvURL)
+}
@@ -0,0 +1,325 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/ratebudget"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"github.com/git-lfs/git-lfs/filepathfilter"
+)
+
+// Extensions of binary formats that belong in Git LFS in almost every
+// repository, which an org-wide attributes template should cover
+var auditExtensions = []string{
+	// Images and textures
+	".bmp", ".exr", ".gif", ".hdr", ".jpeg", ".jpg", ".png", ".psd", ".tga", ".tif", ".tiff",
+	// 3D scenes and models
+	".blend", ".fbx", ".ma", ".max", ".mb", ".obj", ".uasset", ".umap",
+	// Audio and video
+	".avi", ".mov", ".mp3", ".mp4", ".ogg", ".wav",
+	// Archives
+	".7z", ".gz", ".rar", ".tar", ".zip",
+	// Build outputs
+	".a", ".bin", ".dll", ".dylib", ".exe", ".jar", ".lib", ".pdb", ".so",
+	// Documents and fonts
+	".otf", ".pdf", ".ttf",
+}
+
+// AttributesAudit compares the Git LFS coverage of the .gitattributes files
+// of the repositories of an organization
+type AttributesAudit struct {
+	Org string
+	// Repositories is the number of audited repositories, archived ones
+	// are skipped
+	Repositories int
+	// Drifted is the number of repositories whose root .gitattributes
+	// lacks patterns of the attributes template
+	Drifted int `json:",omitempty"`
+	// Extensions summarizes the uncovered extensions of all repositories,
+	// ordered by the number of repositories they are uncovered in
+	Extensions []UncoveredExtension
+	// Repos lists every audited repository by name
+	Repos []RepoAttributesAudit
+}
+
+// RepoAttributesAudit lists the common binary extensions of a repository
+// that no filter=lfs pattern covers
+type RepoAttributesAudit struct {
+	Repo string
+	// Ref is the default branch
+	Ref string
+	// Patterns are the filter=lfs patterns of the root .gitattributes
+	Patterns  []string `json:",omitempty"`
+	Uncovered []UncoveredExtension
+	// MissingPatterns are the filter=lfs patterns of the attributes
+	// template that the root .gitattributes lacks
+	MissingPatterns []string `json:",omitempty"`
+	// PullRequest is the web URL of the pull request that adds the
+	// missing patterns, if one was opened
+	PullRequest string `json:",omitempty"`
+	// Truncated is set if GitHub did not return all files
+	Truncated bool   `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
+
+// UncoveredExtension counts the files of an extension that would be
+// committed to Git instead of Git LFS
+type UncoveredExtension struct {
+	Extension string
+	// Repositories is only set in the organization summary
+	Repositories int `json:",omitempty"`
+	Files        int
+	TotalSize    int64
+}
+
+// A line of a .gitattributes file that sets or unsets the filter attribute
+type filterRule struct {
+	line    string
+	pattern string
+	filter  *filepathfilter.Filter
+	lfs     bool
+}
+
+// The filter rules of a .gitattributes file in dir, which apply to the
+// files below dir
+type attributesFile struct {
+	dir   string
+	rules []filterRule
+}
+
+func (a attributesFile) depth() int {
+	if a.dir == "" {
+		return 0
+	}
+	return strings.Count(a.dir, "/") + 1
+}
+
+// AuditAttributes reports, for every repository of an organization the
+// installation can access, the common binary extensions at the default
+// branch that are not covered by a filter=lfs pattern, so that the
+// platform team can drive a standard attributes template across the
+// organization. Attributes are read from all .gitattributes files of the
+// tree, but not from macros or $GIT_DIR/info/attributes.
+//
+// If an attributes template is set, repositories are compared to it, and
+// with reconcile a pull request adds the missing template lines to the
+// root .gitattributes of every repository that drifted.
+//
+// The audit is a background job: it leaves the rate limit reserve of the
+// installation to webhook traffic, see package ratebudget.
+func (watchdog *WatchDog) AuditAttributes(ctx context.Context, org string, reconcile bool) (*AttributesAudit, error) {
+	repos, err := watchdog.scm.ListRepositories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the repositories of '%s': %w", org, err)
+	}
+	var audited []*scm.Repository
+	for _, repo := range repos {
+		if strings.EqualFold(repo.Owner, org) && !repo.Archived {
+			audited = append(audited, repo)
+		}
+	}
+	sort.Slice(audited, func(i, j int) bool { return audited[i].Name < audited[j].Name })
+
+	template := parseFilterRules(AttributesTemplate())
+	audit := &AttributesAudit{Org: org, Repositories: len(audited), Repos: make([]RepoAttributesAudit, len(audited))}
+	attributes := make([]string, len(audited))
+	forEachBackgroundLookup(len(audited), func(i int) {
+		if err := ratebudget.Wait(ctx, watchdog.installationID); err != nil {
+			audit.Repos[i] = RepoAttributesAudit{Repo: audited[i].Name, Ref: audited[i].DefaultBranch, Error: err.Error()}
+			return
+		}
+		audit.Repos[i], attributes[i] = watchdog.auditRepoAttributes(ctx, org, audited[i], template)
+	})
+	for i := range audit.Repos {
+		repo := &audit.Repos[i]
+		if len(repo.MissingPatterns) == 0 {
+			continue
+		}
+		audit.Drifted++
+		if reconcile && repo.Error == "" {
+			// One repository at a time, pull requests are subject to the
+			// secondary rate limits of content creation
+			if err := ratebudget.Wait(ctx, watchdog.installationID); err != nil {
+				repo.Error = err.Error()
+				continue
+			}
+			repo.PullRequest, err = watchdog.reconcileAttributes(ctx, org, repo, attributes[i], template)
+			if err != nil {
+				log.Printf("could not reconcile the .gitattributes of '%s/%s': %v\n", org, repo.Repo, err)
+				repo.Error = fmt.Sprintf("could not reconcile: %v", err)
+			}
+		}
+	}
+
+	summary := make(map[string]*UncoveredExtension)
+	for _, repo := range audit.Repos {
+		for _, e := range repo.Uncovered {
+			s, ok := summary[e.Extension]
+			if !ok {
+				s = &UncoveredExtension{Extension: e.Extension}
+				summary[e.Extension] = s
+			}
+			s.Repositories++
+			s.Files += e.Files
+			s.TotalSize += e.TotalSize
+		}
+	}
+	for _, s := range summary {
+		audit.Extensions = append(audit.Extensions, *s)
+	}
+	sort.Slice(audit.Extensions, func(i, j int) bool {
+		a, b := audit.Extensions[i], audit.Extensions[j]
+		if a.Repositories != b.Repositories {
+			return a.Repositories > b.Repositories
+		}
+		return a.Extension < b.Extension
+	})
+	log.Printf("audited the .gitattributes of %d repositories of '%s'\n", len(audited), org)
+	return audit, nil
+}
+
+// Audit the default branch of a repository and return the content of its
+// root .gitattributes. Errors are reported in the result so that one
+// broken repository does not fail the whole audit.
+func (watchdog *WatchDog) auditRepoAttributes(ctx context.Context, owner string, repo *scm.Repository, template []filterRule) (RepoAttributesAudit, string) {
+	audit := RepoAttributesAudit{Repo: repo.Name, Ref: repo.DefaultBranch, Uncovered: []UncoveredExtension{}}
+	if audit.Ref == "" {
+		audit.Ref = "HEAD"
+	}
+	tree, err := watchdog.scm.GetTree(ctx, owner, repo.Name, audit.Ref, true)
+	if errors.Is(err, scm.ErrNotFound) {
+		// Empty repositories have no default branch yet
+		return audit, ""
+	}
+	if err != nil {
+		audit.Error = fmt.Sprintf("could not get the tree: %v", err)
+		return audit, ""
+	}
+	audit.Truncated = tree.Truncated
+
+	var root string
+
+	var attributes []attributesFile
+	var files []*scm.Entry
+	for _, entry := range tree.Entries {
+		if entry.Type != "file" {
+			continue
+		}
+		if path.Base(entry.Path) != gitattributesFile {
+			files = append(files, entry)
+			continue
+		}
+		if err := ratebudget.Wait(ctx, watchdog.installationID); err != nil {
+			audit.Error = err.Error()
+			return audit, ""
+		}
+		content, err := watchdog.scm.GetBlob(ctx, owner, repo.Name, entry.SHA)
+		if err != nil {
+			audit.Error = fmt.Sprintf("could not get '%s': %v", entry.Path, err)
+			return audit, ""
+		}
+		dir := path.Dir(entry.Path)
+		if dir == "." {
+			dir = ""
+		}
+		file := attributesFile{dir: dir, rules: parseFilterRules(string(content))}
+		if dir == "" {
+			root = string(content)
+			for _, rule := range file.rules {
+				if rule.lfs {
+					audit.Patterns = append(audit.Patterns, rule.pattern)
+				}
+			}
+		}
+		attributes = append(attributes, file)
+	}
+	// Attributes of deeper directories take precedence
+	sort.SliceStable(attributes, func(i, j int) bool {
+		return attributes[i].depth() < attributes[j].depth()
+	})
+
+	extensions := make(map[string]bool, len(auditExtensions))
+	for _, ext := range auditExtensions {
+		extensions[ext] = true
+	}
+	uncovered := make(map[string]*UncoveredExtension)
+	for _, entry := range files {
+		ext := strings.ToLower(path.Ext(entry.Path))
+		if !extensions[ext] || trackedWithLFS(attributes, normalizePath(entry.Path)) {
+			continue
+		}
+		u, ok := uncovered[ext]
+		if !ok {
+			u = &UncoveredExtension{Extension: ext}
+			uncovered[ext] = u
+		}
+		u.Files++
+		u.TotalSize += int64(entry.Size)
+	}
+	for _, u := range uncovered {
+		audit.Uncovered = append(audit.Uncovered, *u)
+	}
+	sort.Slice(audit.Uncovered, func(i, j int) bool {
+		a, b := audit.Uncovered[i], audit.Uncovered[j]
+		if a.TotalSize != b.TotalSize {
+			return a.TotalSize > b.TotalSize
+		}
+		return a.Extension < b.Extension
+	})
+	for _, pattern := range missingPatterns(template, audit.Patterns) {
+		audit.MissingPatterns = append(audit.MissingPatterns, pattern.pattern)
+	}
+	return audit, root
+}
+
+// Parse the lines of a .gitattributes file that set filter=lfs, or unset
+// or change the filter attribute. The path filter anchors patterns with a
+// slash at the directory of the file, like Git.
+func parseFilterRules(content string) []filterRule {
+	var rules []filterRule
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+		for _, attribute := range fields[1:] {
+			if attribute != "-filter" && attribute != "!filter" && !strings.HasPrefix(attribute, "filter=") {
+				continue
+			}
+			rules = append(rules, filterRule{
+				line:    strings.TrimSpace(line),
+				pattern: fields[0],
+				filter:  newPathFilter([]string{fields[0]}),
+				lfs:     attribute == "filter=lfs",
+			})
+		}
+	}
+	return rules
+}
+
+// Report whether the last filter rule that matches a file sets filter=lfs,
+// which is how Git resolves conflicting attributes
+func trackedWithLFS(attributes []attributesFile, file string) bool {
+	tracked := false
+	for _, a := range attributes {
+		relative := file
+		if a.dir != "" {
+			if !strings.HasPrefix(file, a.dir+"/") {
+				continue
+			}
+			relative = strings.TrimPrefix(file, a.dir+"/")
+		}
+		for _, rule := range a.rules {
+			if rule.filter.Allows(relative) {
+				tracked = rule.lfs
+			}
+		}
+	}
+	return tracked
+}
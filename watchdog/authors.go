@@ -0,0 +1,59 @@
+package watchdog
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+)
+
+// Email to login mappings, including emails without a unique user.
+// The search API has a low rate limit, so lookups are cached generously.
+var authorCache = cache.New("authors", cache.Options{MaxEntries: 10000, TTL: 24 * time.Hour})
+
+// Resolve the GitHub login of a commit author. Commits created by some
+// clients and integrations lack the username in the push payload; those
+// are resolved via the author email. Returns an empty string if the author
+// can't be resolved.
+func (watchdog *WatchDog) resolveAuthor(ctx context.Context, commit *Commit) string {
+	if commit.Author != "" {
+		return commit.Author
+	}
+	if commit.AuthorEmail == "" {
+		return ""
+	}
+	if login, ok := noreplyLogin(commit.AuthorEmail); ok {
+		return login
+	}
+
+	key := strings.ToLower(commit.AuthorEmail)
+	if login, ok := authorCache.Get(key); ok {
+		return login.(string)
+	}
+
+	login, err := watchdog.scm.FindUserByEmail(ctx, commit.AuthorEmail)
+	if err != nil {
+		// Don't cache errors, the next commit might succeed
+		log.Printf("could not resolve the author of '%s' in '%s': %v\n", commit.SHA, commit.FullName(), err)
+		return ""
+	}
+	authorCache.Add(key, login)
+	return login
+}
+
+// Commits created in the web UI by users who keep their email private are
+// authored by "ID+login@users.noreply.<host>" or "login@users.noreply.<host>",
+// which doesn't need a search
+func noreplyLogin(email string) (string, bool) {
+	at := strings.LastIndex(email, "@")
+	if at < 1 || !strings.HasPrefix(strings.ToLower(email[at+1:]), "users.noreply.") {
+		return "", false
+	}
+	local := email[:at]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[plus+1:]
+	}
+	return local, local != ""
+}
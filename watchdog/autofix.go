@@ -0,0 +1,125 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// Attributes branches are named after the commit they fix, so that a
+// redelivered push doesn't open a second pull request
+const trackBranchPrefix = "lfswatchdog/track-"
+
+// Derive the filter=lfs patterns that would have tracked the files of
+// findings: a pattern for their extension, or their path if they have none
+func suggestedPatterns(findings []Finding) []string {
+	var patterns []string
+	seen := make(map[string]bool)
+	for _, finding := range findings {
+		if finding.Rule != RuleOversizeFile && finding.Rule != RuleBinaryChurn {
+			continue
+		}
+		pattern := attributesPattern(finding.Path)
+		if ext := path.Ext(finding.Path); ext != "" && ext != path.Base(finding.Path) {
+			pattern = "*" + attributesEscaper.Replace(ext)
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Propose tracking the file types of a commit's suggestions with Git LFS in
+// a pull request against the pushed branch that appends patterns to the
+// root .gitattributes. Unlike proposeFix, the files stay in Git until they
+// are migrated. Returns the web URL of the pull request, or an empty string
+// if no pull request was opened.
+func (watchdog *WatchDog) proposeAttributes(ctx context.Context, commit *Commit, findings []Finding) (string, error) {
+	base := strings.TrimPrefix(commit.Ref, "refs/heads/")
+	if base == commit.Ref || strings.HasPrefix(base, fixBranchPrefix) || strings.HasPrefix(base, trackBranchPrefix) {
+		return "", nil
+	}
+
+	attributes, err := watchdog.scm.GetFileContent(ctx, commit.Owner, commit.Repo, commit.SHA, gitattributesFile)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("could not get %s: %w", gitattributesFile, err)
+	}
+	present := make(map[string]bool)
+	for _, rule := range parseFilterRules(attributes) {
+		present[rule.pattern] = rule.lfs
+	}
+	var patterns []string
+	for _, pattern := range suggestedPatterns(findings) {
+		if !present[pattern] {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return "", nil
+	}
+
+	branch := trackBranchPrefix + shortSHA(commit.SHA)
+	exists, err := watchdog.scm.BranchExists(ctx, commit.Owner, commit.Repo, branch)
+	if err != nil {
+		return "", fmt.Errorf("could not look up branch '%s': %w", branch, err)
+	}
+	if exists {
+		log.Printf("not proposing Git LFS patterns for '%s' in '%s': branch '%s' exists\n", commit.SHA, commit.FullName(), branch)
+		return "", nil
+	}
+
+	_, err = watchdog.scm.CommitFiles(ctx, commit.Owner, commit.Repo, &scm.Change{
+		Branch:  branch,
+		Parent:  commit.SHA,
+		Message: fmt.Sprintf("Track large file types with Git LFS\n\nAdds the file types of the large files added in %s to %s.", shortSHA(commit.SHA), gitattributesFile),
+		Files:   map[string]string{gitattributesFile: appendLFSPatterns(attributes, patterns)},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return watchdog.scm.CreatePullRequest(ctx, commit.Owner, commit.Repo, &scm.PullRequest{
+		Title: fmt.Sprintf("Track the large file types of %s with Git LFS", shortSHA(commit.SHA)),
+		Body:  attributesPullRequestBody(commit, patterns, findings),
+		Head:  branch,
+		Base:  base,
+	})
+}
+
+func attributesPullRequestBody(commit *Commit, patterns []string, findings []Finding) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s added large files that should be stored in [Git LFS](https://git-lfs.github.com/). "+
+		"This pull request adds the following patterns to `.gitattributes`, so that files of these types are stored in Git LFS from now on:\n\n", commit.SHA)
+	for _, pattern := range patterns {
+		fmt.Fprintf(&b, "- %s\n", codeSpan(pattern))
+	}
+	b.WriteString("\nMerging it doesn't move the files that are already committed, which Git LFS then warns " +
+		"should have been pointers. Migrate them on this branch before merging:\n\n```\n")
+	var includes []string
+	for _, finding := range findings {
+		if finding.Rule == RuleOversizeFile || finding.Rule == RuleBinaryChurn {
+			includes = append(includes, finding.Path)
+		}
+	}
+	fmt.Fprintf(&b, "git lfs migrate import --no-rewrite %s\n```\n\n", strings.Join(quoteArgs(includes), " "))
+	b.WriteString("`--no-rewrite` adds a commit that replaces the files by pointers. Without it, " +
+		"`git lfs migrate import --include=\"<pattern>\"` rewrites the history of the branch, which " +
+		"removes the files from it but requires a force push.\n")
+	return b.String()
+}
+
+// Quote paths for a shell
+func quoteArgs(paths []string) []string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = "'" + strings.ReplaceAll(p, "'", `'\''`) + "'"
+	}
+	return quoted
+}
@@ -0,0 +1,107 @@
+package watchdog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"github.com/google/go-github/v35/github"
+)
+
+const (
+	// Shape of the simulated large push
+	largePushFiles    = 600
+	largePushDirs     = 60
+	largePushDepth    = 8
+	largePushLargeOne = 7 // every 7th file exceeds the threshold
+
+	// Maximum number of GitHub API calls to check the large push.
+	// Lower this budget whenever an optimization reduces API usage.
+	largePushAPICallBudget = largePushFiles + 2 // one directory listing per file, config, comment
+)
+
+// Build a push with files spread across a deep directory hierarchy
+func largePush(server *githubtest.Server, commits int) *github.PushEvent {
+	fullName := "test-org/test-repo"
+	event := pushEvent(fullName, nil)
+	event.Ref = github.String("refs/heads/main")
+
+	perCommit := largePushFiles / commits
+	for c := 0; c < commits; c++ {
+		sha := fmt.Sprintf("%040d", c)
+		server.AddFile(fullName, sha, configFile, []byte("lfsSuggestionsEnabled: Yes\nlfsSizeThreshold: 512000\nlfsSizeExemptions: \"*.xml\"\nlfsSizeExemptionsThreshold: 20000000\n"))
+
+		commit := &github.HeadCommit{ID: github.String(sha), Distinct: github.Bool(true)}
+		for f := c * perCommit; f < (c+1)*perCommit; f++ {
+			dir := make([]string, largePushDepth)
+			for d := range dir {
+				dir[d] = fmt.Sprintf("level%d-%d", d, (f%largePushDirs)>>uint(d))
+			}
+			file := fmt.Sprintf("%s/file%d.bin", strings.Join(dir, "/"), f)
+
+			size := 1024
+			if f%largePushLargeOne == 0 {
+				size = 1024 * 1024
+			}
+			server.AddFileWithSize(fullName, sha, file, size)
+
+			if f%2 == 0 {
+				commit.Added = append(commit.Added, file)
+			} else {
+				commit.Modified = append(commit.Modified, file)
+			}
+		}
+		event.Commits = append(event.Commits, commit)
+	}
+	return event
+}
+
+func benchmarkCheck(b *testing.B, commits int) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	server := githubtest.NewServer()
+	defer server.Close()
+	w := newWatchDog(server.URL)
+	event := largePush(server, commits)
+
+	server.ResetCalls()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Check(event)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(server.Calls(""))/float64(b.N), "api-calls/op")
+}
+
+func BenchmarkCheckLargePush(b *testing.B) {
+	benchmarkCheck(b, 1)
+}
+
+func BenchmarkCheckLargePushManyCommits(b *testing.B) {
+	benchmarkCheck(b, 20)
+}
+
+func TestLargePushAPIBudget(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	server := githubtest.NewServer()
+	defer server.Close()
+	w := newWatchDog(server.URL)
+	event := largePush(server, 1)
+
+	server.ResetCalls()
+	w.Check(event)
+
+	if calls := server.Calls(""); calls > largePushAPICallBudget {
+		t.Errorf("checking a push with %d files took %d API calls, the budget is %d", largePushFiles, calls, largePushAPICallBudget)
+	}
+	if comments := len(server.Comments()); comments != 1 {
+		t.Errorf("expected 1 comment, got %d", comments)
+	}
+}
@@ -0,0 +1,86 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+)
+
+// Filter rules of .gitattributes files by repository and blob SHA, which
+// rarely change between the commits of a push
+var attributesCache = cache.New("attributes", cache.Options{MaxEntries: 10000, TTL: 24 * time.Hour})
+
+// Read the .gitattributes files of a commit that apply to its files, in
+// order of precedence. They are looked up in the tree of the commit, which
+// lookups of files beyond the listing limit share.
+func (watchdog *WatchDog) commitAttributes(ctx context.Context, commit *Commit) ([]attributesFile, error) {
+	tree, err := watchdog.getTree(ctx, commit.Owner, commit.Repo, commit.SHA, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the tree: %w", err)
+	}
+
+	dirs := map[string]bool{"": true}
+	for _, file := range commit.Files() {
+		for dir := path.Dir(normalizePath(file)); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	var attributes []attributesFile
+	for dir := range dirs {
+		name := path.Join(dir, gitattributesFile)
+		entry, ok := tree.entries[name]
+		if !ok && tree.truncated {
+			if entry, err = watchdog.descendTree(ctx, commit.Owner, commit.Repo, commit.SHA, name); err != nil {
+				return nil, err
+			}
+		}
+		if entry == nil || entry.Type != "file" {
+			continue
+		}
+		rules, err := watchdog.attributesRules(ctx, commit, name, entry.SHA)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attributesFile{dir: dir, rules: rules})
+	}
+	// Attributes of deeper directories take precedence
+	sort.Slice(attributes, func(i, j int) bool {
+		if attributes[i].depth() != attributes[j].depth() {
+			return attributes[i].depth() < attributes[j].depth()
+		}
+		return attributes[i].dir < attributes[j].dir
+	})
+	return attributes, nil
+}
+
+func (watchdog *WatchDog) attributesRules(ctx context.Context, commit *Commit, file, sha string) ([]filterRule, error) {
+	key := commit.FullName() + "\x00" + sha
+	if rules, ok := attributesCache.Get(key); ok {
+		return rules.([]filterRule), nil
+	}
+	content, err := watchdog.scm.GetBlob(ctx, commit.Owner, commit.Repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("could not get '%s': %w", file, err)
+	}
+	rules := parseFilterRules(string(content))
+	attributesCache.Add(key, rules)
+	return rules, nil
+}
+
+// Evaluate a file that .gitattributes tracks with Git LFS but that is no
+// pointer, e.g. because it was committed on a machine without Git LFS
+func evaluateBypassedLFS(config *Config, file string, size int) (Finding, bool) {
+	if !config.ruleEnabled(RuleBypassedLFS) {
+		return Finding{}, false
+	}
+	return Finding{
+		Path:     file,
+		Size:     size,
+		Rule:     RuleBypassedLFS,
+		Severity: config.ruleSeverity(RuleBypassedLFS),
+	}, true
+}
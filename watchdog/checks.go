@@ -0,0 +1,309 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+const (
+	checkRunName = "LFSWatchDog"
+
+	// Lists longer than this are collapsed in the check run summary
+	collapseThreshold = 10
+
+	// GitHub rejects check run summaries longer than this
+	maxCheckSummary = 65535
+
+	// GitHub accepts at most this many annotations per request
+	maxCheckAnnotations = 50
+
+	// RecheckAction identifies the button of a check run that checks its
+	// commit again
+	RecheckAction = "recheck"
+
+	remediationAppendix = "" +
+		"### How to fix\n\n" +
+		"Track new large files with Git LFS before they are merged:\n\n" +
+		"```\ngit lfs track \"*.psd\"\ngit add .gitattributes path/to/file.psd\ngit commit --amend\n```\n\n" +
+		"Files that are already part of the history need to be migrated, which rewrites history:\n\n" +
+		"```\ngit lfs migrate import --include=\"path/to/file.psd\"\n```\n\n" +
+		"Watch the [Git LFS tutorial](https://www.youtube.com/watch?v=YQzNfb4IwEY) for an introduction.\n"
+
+	bypassAppendix = "" +
+		"### Files that bypassed Git LFS\n\n" +
+		"These files match a `filter=lfs` pattern of `.gitattributes` but were committed without Git LFS, " +
+		"usually on a machine where it isn't installed. Install it and replace the files by pointers:\n\n" +
+		"```\ngit lfs install\ngit add --renormalize path/to/file.psd\ngit commit\n```\n"
+
+	lockAppendix = "" +
+		"### Locked files\n\n" +
+		"Changes to binary files can't be merged. Ask the owner of the lock whether your change conflicts " +
+		"with theirs, and wait until they release it with `git lfs unlock`.\n"
+)
+
+// Render the Markdown summary of a check run. Files are linked if fileURL
+// returns their web URL.
+func checkRunSummary(findings []Finding, helpContact string, fileURL func(path string) string) string {
+	if len(findings) == 0 {
+		return "No files need to be tracked with Git LFS."
+	}
+
+	rule, _ := LookupRule(RuleOversizeFile)
+	groups := make(map[int][]Finding)
+	var thresholds []int
+	var locked, symlinks, churn, lfsObjects, vendored, buildOutputs, bypassed []Finding
+	submodules := make(map[string][]Finding)
+	for _, finding := range findings {
+		if ruleFamily(finding.Rule) == "submodule" {
+			submodules[finding.Rule] = append(submodules[finding.Rule], finding)
+			continue
+		}
+		if finding.Rule == RuleLockedFile {
+			locked = append(locked, finding)
+			continue
+		}
+		if finding.Rule == RuleSymlink {
+			symlinks = append(symlinks, finding)
+			continue
+		}
+		if finding.Rule == RuleBinaryChurn {
+			churn = append(churn, finding)
+			continue
+		}
+		if finding.Rule == RuleOversizeLFSObject {
+			lfsObjects = append(lfsObjects, finding)
+			continue
+		}
+		if finding.Rule == RuleVendoredPointer {
+			vendored = append(vendored, finding)
+			continue
+		}
+		if finding.Rule == RuleBuildOutput {
+			buildOutputs = append(buildOutputs, finding)
+			continue
+		}
+		if finding.Rule == RuleBypassedLFS {
+			bypassed = append(bypassed, finding)
+			continue
+		}
+		if _, ok := groups[finding.Threshold]; !ok {
+			thresholds = append(thresholds, finding.Threshold)
+		}
+		groups[finding.Threshold] = append(groups[finding.Threshold], finding)
+	}
+	sort.Ints(thresholds)
+
+	var b strings.Builder
+	for _, threshold := range thresholds {
+		group := groups[threshold]
+		fmt.Fprintf(&b, "### %s: %d %s larger than %s\n\n", rule, len(group), pluralize(len(group), "file", "files"), formatSize(threshold))
+		writeFileTable(&b, group, "| File | Size |\n|---|---:|\n", fileURL, func(finding Finding) string {
+			return formatSize(finding.Size)
+		})
+	}
+	if len(locked) > 0 {
+		rule, _ := LookupRule(RuleLockedFile)
+		fmt.Fprintf(&b, "### %s: %d %s locked by other users\n\n", rule, len(locked), pluralize(len(locked), "file", "files"))
+		writeFileTable(&b, locked, "| File | Locked by |\n|---|---|\n", fileURL, func(finding Finding) string {
+			return tableCell(finding.LockedBy)
+		})
+	}
+	if len(churn) > 0 {
+		rule, _ := LookupRule(RuleBinaryChurn)
+		fmt.Fprintf(&b, "### %s: %d binary %s changed often\n\n", rule, len(churn), pluralize(len(churn), "file", "files"))
+		writeFileTable(&b, churn, "| File | Changes |\n|---|---:|\n", fileURL, func(finding Finding) string {
+			return fmt.Sprintf("%d", finding.Changes)
+		})
+	}
+	if len(lfsObjects) > 0 {
+		rule, _ := LookupRule(RuleOversizeLFSObject)
+		fmt.Fprintf(&b, "### %s: %d Git LFS %s larger than %s\n\n", rule, len(lfsObjects), pluralize(len(lfsObjects), "object", "objects"), formatSize(lfsObjects[0].Threshold))
+		writeFileTable(&b, lfsObjects, "| File | Size |\n|---|---:|\n", fileURL, func(finding Finding) string {
+			return formatSize(finding.Size)
+		})
+	}
+	if len(vendored) > 0 {
+		rule, _ := LookupRule(RuleVendoredPointer)
+		fmt.Fprintf(&b, "### %s: %d Git LFS %s in vendored directories\n\n", rule, len(vendored), pluralize(len(vendored), "pointer", "pointers"))
+		writeFileTable(&b, vendored, "| File | Object size |\n|---|---:|\n", fileURL, func(finding Finding) string {
+			return formatSize(finding.Size)
+		})
+	}
+	if len(buildOutputs) > 0 {
+		rule, _ := LookupRule(RuleBuildOutput)
+		fmt.Fprintf(&b, "### %s: %d compiled %s\n\n", rule, len(buildOutputs), pluralize(len(buildOutputs), "binary", "binaries"))
+		writeFileTable(&b, buildOutputs, "| File | Format |\n|---|---|\n", fileURL, func(finding Finding) string {
+			return tableCell(finding.Format)
+		})
+	}
+	if len(bypassed) > 0 {
+		rule, _ := LookupRule(RuleBypassedLFS)
+		fmt.Fprintf(&b, "### %s: %d %s committed without Git LFS\n\n", rule, len(bypassed), pluralize(len(bypassed), "file", "files"))
+		writeFileTable(&b, bypassed, "| File | Size |\n|---|---:|\n", fileURL, func(finding Finding) string {
+			return formatSize(finding.Size)
+		})
+	}
+	if len(symlinks) > 0 {
+		rule, _ := LookupRule(RuleSymlink)
+		fmt.Fprintf(&b, "### %s: %d %s\n\n", rule, len(symlinks), pluralize(len(symlinks), "symlink", "symlinks"))
+		writeFileTable(&b, symlinks, "| File | Target |\n|---|---|\n", fileURL, func(finding Finding) string {
+			return tableCell(codeSpan(finding.Target))
+		})
+	}
+	for _, id := range []string{RuleNewSubmodule, RuleSubmoduleURL, RuleSubmoduleCommit} {
+		group := submodules[id]
+		if len(group) == 0 {
+			continue
+		}
+		rule, _ := LookupRule(id)
+		fmt.Fprintf(&b, "### %s: %d %s\n\n%s.\n\n", rule, len(group), pluralize(len(group), "submodule", "submodules"), rule.Summary)
+		writeFileTable(&b, group, "| Submodule | URL |\n|---|---|\n", fileURL, func(finding Finding) string {
+			if finding.Commit != "" {
+				return tableCell(fmt.Sprintf("%s at %s", codeSpan(finding.Target), codeSpan(finding.Commit)))
+			}
+			return tableCell(codeSpan(finding.Target))
+		})
+	}
+
+	if len(thresholds) > 0 || len(churn) > 0 {
+		b.WriteString(remediationAppendix)
+	}
+	if len(bypassed) > 0 {
+		if len(thresholds) > 0 || len(churn) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(bypassAppendix)
+	}
+	if len(locked) > 0 {
+		if len(thresholds) > 0 || len(churn) > 0 || len(bypassed) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(lockAppendix)
+	}
+	fmt.Fprintf(&b, "\nContact %s for help.\n", helpContact)
+
+	return truncate(b.String(), maxCheckSummary)
+}
+
+// Write a table of findings with a column rendered by detail. Long
+// tables are collapsed.
+func writeFileTable(b *strings.Builder, findings []Finding, header string, fileURL func(path string) string, detail func(Finding) string) {
+	collapse := len(findings) > collapseThreshold
+	if collapse {
+		fmt.Fprintf(b, "<details><summary>Show %d files</summary>\n\n", len(findings))
+	}
+	b.WriteString(header)
+	for _, finding := range findings {
+		file := codeSpan(finding.Path)
+		if url := fileURL(finding.Path); url != "" {
+			file = fmt.Sprintf("[%s](%s)", file, url)
+		}
+		if finding.PreExisting {
+			file += " (reported before)"
+		}
+		fmt.Fprintf(b, "| %s | %s |\n", tableCell(file), detail(finding))
+	}
+	if collapse {
+		b.WriteString("\n</details>\n")
+	}
+	b.WriteString("\n")
+}
+
+// Annotate the files of the first findings, so that they are highlighted
+// in the "Files changed" tab of pull requests
+func checkRunAnnotations(findings []Finding) []*scm.Annotation {
+	var annotations []*scm.Annotation
+	for _, finding := range findings {
+		if len(annotations) == maxCheckAnnotations {
+			break
+		}
+		rule, _ := LookupRule(finding.Rule)
+		message := rule.Summary + "."
+		if finding.Size > 0 && finding.Threshold > 0 {
+			message = fmt.Sprintf("%s: %s, larger than %s.", rule.Summary, formatSize(finding.Size), formatSize(finding.Threshold))
+		}
+		level := "warning"
+		switch finding.Severity {
+		case SeverityError:
+			level = "failure"
+		case SeverityNotice:
+			level = "notice"
+		}
+		annotations = append(annotations, &scm.Annotation{Path: finding.Path, Level: level, Title: rule.String(), Message: message})
+	}
+	return annotations
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// Render the errors that prevented a complete evaluation
+func checkRunErrors(errs []error) string {
+	var b strings.Builder
+	b.WriteString("### The watchdog could not evaluate this commit completely\n\n")
+	for _, err := range errs {
+		fmt.Fprintf(&b, "- %s\n", err)
+	}
+	b.WriteString("\nThis is not a problem with your change. Re-run the check or contact the watchdog administrators if it persists.\n\n")
+	return b.String()
+}
+
+// Create a completed check run for a commit. Policy violations fail the
+// check. Incomplete evaluations cancel it, as the Checks API has no error
+// conclusion, so that they block merging just as well but can be told apart.
+func (watchdog *WatchDog) createCheckRun(org, repo, ref, note string, findings []Finding, errs []error, helpContact string) error {
+	run := watchdog.newCheckRun(org, repo, ref, note, findings, errs, helpContact)
+	if run.Conclusion != "success" {
+		run.Actions = []*scm.CheckRunAction{{Label: "Re-run check", Description: "Check the commit again", Identifier: RecheckAction}}
+	}
+	err := watchdog.scm.CreateCheckRun(context.Background(), org, repo, run)
+	if err != nil {
+		log.Printf("could not create a check run for '%s' in '%s/%s': %v\n", ref, org, repo, err)
+	}
+	return err
+}
+
+// Render the check run of a commit with findings and errors
+func (watchdog *WatchDog) newCheckRun(org, repo, ref, note string, findings []Finding, errs []error, helpContact string) *scm.CheckRun {
+	run := &scm.CheckRun{
+		Name:       checkRunName,
+		HeadSHA:    ref,
+		Conclusion: "success",
+		Title:      "No LFS problems",
+		Summary: checkRunSummary(findings, helpContact, func(path string) string {
+			return watchdog.scm.FileURL(org, repo, ref, path)
+		}),
+	}
+	if note != "" {
+		run.Summary = truncate(note+run.Summary, maxCheckSummary)
+	}
+	run.Annotations = checkRunAnnotations(findings)
+	if links := exportResults(org, repo, ref, findings); links != "" {
+		// Keep the links when the summary is truncated
+		run.Summary = truncate(links+run.Summary, maxCheckSummary)
+	}
+	if len(findings) > 0 {
+		run.Conclusion = "neutral"
+		run.Title = statusDescription(findings)
+	}
+	if len(errs) > 0 {
+		run.Summary = truncate(checkRunErrors(errs)+run.Summary, maxCheckSummary)
+		if !hasErrors(findings) {
+			run.Conclusion = "cancelled"
+			run.Title = errorDescription(errs)
+		}
+	}
+	if hasErrors(findings) {
+		run.Conclusion = "failure"
+	}
+	return run
+}
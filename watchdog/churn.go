@@ -0,0 +1,154 @@
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+const (
+	churnTTL              = 90 * 24 * time.Hour
+	defaultChurnThreshold = 5
+	defaultChurnWindow    = 30 * 24 * time.Hour
+	// Git considers files with a NUL byte in this prefix binary
+	binaryPrefixSize = 8000
+)
+
+// Modifications of files below the size threshold by repository and path,
+// so that binary files that change often can be moved to Git LFS. Every
+// version of a binary file is kept forever, so churn bloats a repository
+// as much as size.
+var churnCache = cache.New("churn", cache.Options{MaxEntries: 100000, TTL: churnTTL})
+
+// Guards read-modify-write of churn entries, commits of a push are
+// evaluated concurrently
+var churnMu sync.Mutex
+
+// change is a commit that modified a file
+type change struct {
+	sha string
+	at  time.Time
+}
+
+// persistedChange is a change in the store
+type persistedChange struct {
+	SHA string
+	At  time.Time
+}
+
+// Check that the churn settings are usable
+func (config *Config) validateChurn() error {
+	if config.BinaryChurnThreshold < 1 {
+		return fmt.Errorf("binaryChurnThreshold must be at least 1, got %d", config.BinaryChurnThreshold)
+	}
+	if config.BinaryChurnWindow <= 0 {
+		return fmt.Errorf("binaryChurnWindow must be positive, got %s", config.BinaryChurnWindow)
+	}
+	return nil
+}
+
+// Return the recent modifications of a file, and whether commit is one of
+// them
+func recentChanges(commit *Commit, key string, window time.Duration) ([]change, bool) {
+	var changes []change
+	if c, ok := churnCache.Get(key); ok {
+		changes = c.([]change)
+	}
+	now := clock()
+	recent := make([]change, 0, len(changes)+1)
+	seen := false
+	for _, c := range changes {
+		if now.Sub(c.at) < window {
+			recent = append(recent, c)
+			seen = seen || c.sha == commit.SHA
+		}
+	}
+	return recent, seen
+}
+
+func churnKey(commit *Commit, file string) string {
+	return commit.FullName() + "\x00" + normalizePath(file)
+}
+
+// Return how often a file was modified within the churn window, counting
+// the modification of commit. Rechecked commits are counted once.
+func countChanges(commit *Commit, file string, window time.Duration) int {
+	churnMu.Lock()
+	defer churnMu.Unlock()
+
+	recent, seen := recentChanges(commit, churnKey(commit, file), window)
+	if seen {
+		return len(recent)
+	}
+	return len(recent) + 1
+}
+
+// Record that a commit modified files that were evaluated for churn.
+// Commits of a push are checked concurrently, so they may not count the
+// modifications of each other.
+func recordChanges(commit *Commit, files []string, window time.Duration) {
+	churnMu.Lock()
+	defer churnMu.Unlock()
+
+	for _, file := range files {
+		key := churnKey(commit, file)
+		recent, seen := recentChanges(commit, key, window)
+		if seen {
+			continue
+		}
+		recent = append(recent, change{sha: commit.SHA, at: clock()})
+		persisted := make([]persistedChange, len(recent))
+		for i, c := range recent {
+			persisted[i] = persistedChange{SHA: c.sha, At: c.at}
+		}
+		churnCache.Add(key, recent)
+		persistEntry(churnBucket, key, persisted)
+	}
+}
+
+// Evaluate a modified file below the size threshold for churn. The
+// content is only read once the file changed often enough. It returns
+// whether the modification counts towards the churn of the file, which
+// files with text content don't.
+func (watchdog *WatchDog) evaluateChurn(ctx context.Context, commit *Commit, config *Config, file string, entry *scm.Entry) (Finding, bool, bool, error) {
+	changes := countChanges(commit, file, config.BinaryChurnWindow)
+	if changes < config.BinaryChurnThreshold {
+		return Finding{}, false, true, nil
+	}
+	content, err := watchdog.scm.GetBlob(ctx, commit.Owner, commit.Repo, entry.SHA)
+	if err != nil {
+		return Finding{}, false, false, fmt.Errorf("could not get the content of '%s': %w", file, err)
+	}
+	if !isBinary(content) {
+		return Finding{}, false, false, nil
+	}
+	return Finding{
+		Path:     file,
+		Size:     entry.Size,
+		Rule:     RuleBinaryChurn,
+		Severity: config.ruleSeverity(RuleBinaryChurn),
+		Changes:  changes,
+	}, true, true, nil
+}
+
+// Detect binary content like Git does. Git LFS pointers are text.
+func isBinary(content []byte) bool {
+	if len(content) > binaryPrefixSize {
+		content = content[:binaryPrefixSize]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// Format a churn window like "30 days"
+func formatWindow(window time.Duration) string {
+	if window%(24*time.Hour) == 0 {
+		days := int(window / (24 * time.Hour))
+		return fmt.Sprintf("%d %s", days, pluralize(days, "day", "days"))
+	}
+	return window.String()
+}
@@ -0,0 +1,46 @@
+package watchdog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Lower case login or email -> commits of the author with findings,
+// forgotten when the server restarts
+var offenses = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+// Count a commit with findings and report whether its author is coached,
+// i.e. their first commits with findings are only reported in the check
+// run instead of a commit comment that anyone can read
+func coached(commit *Commit, config *Config) bool {
+	if config.coachingViolations <= 0 {
+		return false
+	}
+	author := commit.Author
+	if author == "" {
+		author = commit.AuthorEmail
+	}
+	if author == "" {
+		return false
+	}
+	key := strings.ToLower(author)
+
+	offenses.Lock()
+	defer offenses.Unlock()
+	offenses.counts[key]++
+	return offenses.counts[key] <= config.coachingViolations
+}
+
+// Render the note of a check run that coaches the author
+func coachingNote(config *Config) string {
+	first := "your first commit"
+	if config.coachingViolations > 1 {
+		first = fmt.Sprintf("one of your first %d commits", config.coachingViolations)
+	}
+	return fmt.Sprintf("**Note:** as %s with Git LFS findings, this commit is only reported here. "+
+		"Later findings are also posted as commit comments.\n\n", first)
+}
@@ -0,0 +1,67 @@
+package watchdog
+
+import "sync"
+
+const (
+	defaultLookupsPerCommit = 8
+	defaultMaxLookups       = 64
+)
+
+// Concurrency bounds the file size lookups of all watchdogs in the process
+type Concurrency struct {
+	// LookupsPerCommit is the number of concurrent lookups within one commit
+	LookupsPerCommit int
+	// MaxLookups is the number of concurrent lookups across all commits
+	MaxLookups int
+}
+
+var (
+	lookupsPerCommit = defaultLookupsPerCommit
+	// Global pool of lookup slots, shared by all commits
+	lookupPool = make(chan struct{}, defaultMaxLookups)
+	// Pool of lookup slots of background jobs. They wait for the rate
+	// budget while holding a slot, which must not starve pushes.
+	backgroundPool = make(chan struct{}, defaultLookupsPerCommit)
+)
+
+// SetConcurrency configures the lookup concurrency. Zero values keep the
+// defaults. It must be called before any commit is checked.
+func SetConcurrency(c Concurrency) {
+	if c.LookupsPerCommit > 0 {
+		lookupsPerCommit = c.LookupsPerCommit
+	}
+	if c.MaxLookups > 0 {
+		lookupPool = make(chan struct{}, c.MaxLookups)
+	}
+}
+
+// Run fn for every index up to n with at most lookupsPerCommit concurrent
+// calls, each holding a slot of the global pool
+func forEachLookup(n int, fn func(i int)) {
+	forEachInPool(lookupPool, n, fn)
+}
+
+// Run fn like forEachLookup for background jobs, which hold slots of their
+// own pool
+func forEachBackgroundLookup(n int, fn func(i int)) {
+	forEachInPool(backgroundPool, n, fn)
+}
+
+func forEachInPool(pool chan struct{}, n int, fn func(i int)) {
+	slots := make(chan struct{}, lookupsPerCommit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+		pool <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-pool
+				<-slots
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,101 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"github.com/google/go-github/v35/github"
+)
+
+// Time during which configuration files are reused without requesting
+// them, zero requests them on every lookup
+var configTTL int64
+
+var configRequests = metrics.NewCounter("lfswatchdog_config_requests_total",
+	"Configuration file lookups by whether they were cached, not modified or downloaded.", "result")
+
+// Configuration files by repository and branch, or commit SHA, with the
+// ETag they were served with. Entries are kept after their TTL to request
+// them conditionally.
+var configContentCache = cache.New("config-contents", cache.Options{MaxEntries: 10000})
+
+// cachedConfigContent is a configuration file, or the error of a missing
+// one, and when it was last requested
+type cachedConfigContent struct {
+	content string
+	etag    string
+	err     error
+	fetched time.Time
+}
+
+func (c *cachedConfigContent) Size() int { return len(c.content) + len(c.etag) }
+
+// SetConfigTTL sets how long configuration files are reused before they are
+// requested again. Files are requested with the ETag they were served with,
+// so unchanged files are neither downloaded nor count against the rate
+// limit. Zero requests them on every lookup.
+func SetConfigTTL(ttl time.Duration) {
+	atomic.StoreInt64(&configTTL, int64(ttl))
+}
+
+// Return the ref to read the configuration of a pushed commit at. Commits
+// pushed to a branch share the configuration of the branch, which is cached
+// across pushes, unless the push changes the configuration or isn't
+// completely known. Other commits are read at their SHA.
+func configRef(event *github.PushEvent, sha string) string {
+	if !strings.HasPrefix(event.GetRef(), "refs/heads/") || event.GetDeleted() || event.GetSize() > len(event.Commits) {
+		return sha
+	}
+	for _, commit := range event.Commits {
+		for _, paths := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, path := range paths {
+				if path == configFile {
+					return sha
+				}
+			}
+		}
+	}
+	return event.GetRef()
+}
+
+// Get the configuration file of a repository at ref from the cache, or
+// request it if it is older than the TTL
+func (watchdog *WatchDog) getConfigContent(ctx context.Context, org, repo, ref string) (string, error) {
+	key := org + "/" + repo + "\x00" + ref
+	var cached *cachedConfigContent
+	if c, ok := configContentCache.Get(key); ok {
+		cached = c.(*cachedConfigContent)
+		if time.Since(cached.fetched) < time.Duration(atomic.LoadInt64(&configTTL)) {
+			configRequests.Inc("cached")
+			return cached.content, cached.err
+		}
+	}
+
+	etag := ""
+	if cached != nil {
+		etag = cached.etag
+	}
+	content, etag, err := watchdog.scm.GetFileContentIfNoneMatch(ctx, org, repo, ref, configFile, etag)
+	switch {
+	case errors.Is(err, scm.ErrNotModified):
+		configRequests.Inc("not modified")
+		content = cached.content
+	case errors.Is(err, ErrNotFound):
+		// Most repositories don't have a configuration
+		configRequests.Inc("not found")
+		configContentCache.Add(key, &cachedConfigContent{err: err, fetched: time.Now()})
+		return "", err
+	case err != nil:
+		return "", err
+	default:
+		configRequests.Inc("downloaded")
+	}
+	configContentCache.Add(key, &cachedConfigContent{content: content, etag: etag, fetched: time.Now()})
+	return content, nil
+}
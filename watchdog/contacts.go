@@ -0,0 +1,102 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+)
+
+// Existence of "org/team-slug" help contacts. Mentions of teams that don't
+// exist silently notify nobody, so they are looked up before they are used.
+var teamCache = cache.New("teams", cache.Options{MaxEntries: 10000, TTL: time.Hour})
+
+// The contact of repositories that don't configure one, or whose team
+// does not exist
+var defaultHelpContact = struct {
+	sync.RWMutex
+	contact string
+}{contact: lfsHelpContact}
+
+// SetDefaultHelpContact replaces the help contact of repositories without
+// a valid helpContact setting, e.g. "@org/lfs-help". Empty contacts are
+// ignored.
+func SetDefaultHelpContact(contact string) {
+	if contact == "" {
+		return
+	}
+	defaultHelpContact.Lock()
+	defer defaultHelpContact.Unlock()
+	defaultHelpContact.contact = contact
+}
+
+// DefaultHelpContact returns the help contact of repositories without a
+// valid helpContact setting
+func DefaultHelpContact() string {
+	defaultHelpContact.RLock()
+	defer defaultHelpContact.RUnlock()
+	return defaultHelpContact.contact
+}
+
+// Report whether a help contact is a single mention with a slash, which
+// GitHub only resolves for teams. Contacts with text are not checked.
+func looksLikeTeam(contact string) bool {
+	return strings.HasPrefix(contact, "@") && strings.Contains(contact, "/") && !strings.ContainsAny(contact, " \t\n")
+}
+
+// Split a team mention like "@org/team-name" into the organization and
+// team slug
+func teamMention(contact string) (string, string, bool) {
+	if !looksLikeTeam(contact) {
+		return "", "", false
+	}
+	parts := strings.Split(contact[1:], "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Check that a help contact that looks like a team mention is one
+func (config *Config) validateHelpContact() error {
+	return checkHelpContact(config.HelpContact)
+}
+
+func checkHelpContact(contact string) error {
+	if _, _, ok := teamMention(contact); looksLikeTeam(contact) && !ok {
+		return fmt.Errorf("helpContact '%s' is not a team mention like '@org/team-name'", contact)
+	}
+	return nil
+}
+
+// Return the help contact to mention for a commit. Teams that don't exist
+// are replaced with the default help contact. If the team can't be looked
+// up, e.g. because the App lacks the "Members" permission, it is used as is.
+func (watchdog *WatchDog) resolveHelpContact(ctx context.Context, commit *Commit, contact string) string {
+	org, slug, ok := teamMention(contact)
+	if !ok {
+		return contact
+	}
+
+	key := strings.ToLower(org + "/" + slug)
+	exists, cached := teamCache.Get(key)
+	if !cached {
+		found, err := watchdog.scm.TeamExists(ctx, org, slug)
+		if err != nil {
+			// Don't cache errors, the next commit might succeed
+			log.Printf("could not look up help contact '%s' of '%s': %v\n", contact, commit.FullName(), err)
+			return contact
+		}
+		teamCache.Add(key, found)
+		exists = found
+	}
+	if exists.(bool) {
+		return contact
+	}
+	log.Printf("help contact '%s' of '%s' does not exist, mentioning '%s' instead\n", contact, commit.FullName(), DefaultHelpContact())
+	return DefaultHelpContact()
+}
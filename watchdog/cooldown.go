@@ -0,0 +1,106 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+)
+
+// Cooldowns are at most a day
+const cooldownTTL = 24 * time.Hour
+
+// The last comment posted on each branch, so that findings pushed within the
+// repository's comment cooldown are added to it instead of a new comment
+var cooldownCache = cache.New("comment_cooldowns", cache.Options{MaxEntries: 10000, TTL: cooldownTTL})
+
+// Guards get-or-create of cooldown entries
+var cooldownMu sync.Mutex
+
+// Returns the current time, replaced in tests
+var clock = time.Now
+
+// cooldown is the last comment posted on a branch. Commits of a push are
+// reported concurrently, so the entry is locked while it is updated.
+type cooldown struct {
+	mu     sync.Mutex
+	id     int64
+	body   string
+	posted time.Time
+}
+
+// persistedCooldown is a cooldown in the store
+type persistedCooldown struct {
+	ID     int64
+	Body   string
+	Posted time.Time
+}
+
+// Persist the last comment of a branch, the entry must be locked
+func (c *cooldown) persist(key string) {
+	persistEntry(cooldownsBucket, key, persistedCooldown{ID: c.id, Body: c.body, Posted: c.posted})
+}
+
+func cooldownKey(commit *Commit) string {
+	return commit.FullName() + "\x00" + commit.Ref
+}
+
+func branchCooldown(commit *Commit) *cooldown {
+	cooldownMu.Lock()
+	defer cooldownMu.Unlock()
+
+	key := cooldownKey(commit)
+	if c, ok := cooldownCache.Get(key); ok {
+		return c.(*cooldown)
+	}
+	c := &cooldown{}
+	cooldownCache.Add(key, c)
+	return c
+}
+
+// Post a comment with its footer on a commit, or add it to the last comment
+// on the branch if that was posted within the cooldown. Returns the posted
+// comment body.
+func (watchdog *WatchDog) postCommentWithCooldown(commit *Commit, config *Config, comment string, footer CommentFooter) (string, error) {
+	if config.CommentCooldown <= 0 || commit.Ref == "" {
+		body := withFooter(comment, footer)
+		return body, watchdog.postComment(commit.Owner, commit.Repo, commit.SHA, &body)
+	}
+
+	c := branchCooldown(commit)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.id != 0 && clock().Sub(c.posted) < config.CommentCooldown {
+		combined := footer
+		if last, ok := ParseCommentFooter(c.body); ok {
+			combined.Rules = sortedRules(append(last.Rules, footer.Rules...))
+		}
+		body := fmt.Sprintf("%s\n---\n\n**Also pushed to this branch in %s:**\n\n%s", stripFooter(c.body), shortSHA(commit.SHA), comment)
+		// Start a new comment rather than truncating the combined one
+		if utf8.RuneCountInString(body)+utf8.RuneCountInString(footerSuffix(combined)) <= maxCommentBody {
+			body = withFooter(body, combined)
+			err := watchdog.scm.UpdateComment(context.Background(), commit.Owner, commit.Repo, c.id, body)
+			if err == nil {
+				log.Printf("added '%s' to the last comment on '%s' in '%s'\n", commit.SHA, commit.Ref, commit.FullName())
+				c.body = body
+				c.persist(cooldownKey(commit))
+				return body, nil
+			}
+			// The comment may have been deleted, post a new one
+		}
+	}
+
+	body := withFooter(comment, footer)
+	id, err := watchdog.scm.CreateComment(context.Background(), commit.Owner, commit.Repo, commit.SHA, body)
+	if err != nil {
+		return body, err
+	}
+	c.id, c.body, c.posted = id, body, clock()
+	c.persist(cooldownKey(commit))
+	return body, nil
+}
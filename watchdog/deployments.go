@@ -0,0 +1,133 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// Open findings listed in the comment of a rejected deployment
+const maxDeploymentFindings = 5
+
+var deploymentReviews = metrics.NewCounter("lfswatchdog_deployment_reviews_total", "Deployments reviewed as a deployment protection rule.", "state")
+
+// DeploymentRequest is a deployment to an environment that waits for the
+// deployment protection rule of the App
+type DeploymentRequest struct {
+	Owner       string
+	Repo        string
+	Environment string
+	// Ref is the deployed branch, tag or SHA, SHA the deployed commit
+	Ref         string
+	SHA         string
+	CallbackURL string
+}
+
+// ReviewDeployment approves a deployment if its commit passed the watchdog
+// checks and its branch has no open findings with error severity, and
+// rejects it otherwise. Deployments that can't be verified are rejected.
+func (watchdog *WatchDog) ReviewDeployment(ctx context.Context, request DeploymentRequest) (bool, error) {
+	approved, comment, err := watchdog.gateDeployment(ctx, request)
+	if err != nil {
+		log.Printf("could not verify the deployment of '%s' in '%s/%s' to '%s': %v\n", request.SHA, request.Owner, request.Repo, request.Environment, err)
+		approved, comment = false, fmt.Sprintf("The Git LFS checks of %s could not be verified, try again later.", codeSpan(shortSHA(request.SHA)))
+	}
+
+	state := "rejected"
+	if approved {
+		state = "approved"
+	}
+	deploymentReviews.Inc(state)
+	log.Printf("%s the deployment of '%s' in '%s/%s' to '%s'\n", state, request.SHA, request.Owner, request.Repo, request.Environment)
+	review := &scm.DeploymentReview{
+		CallbackURL: request.CallbackURL,
+		Environment: request.Environment,
+		State:       state,
+		Comment:     comment,
+	}
+	if err := watchdog.scm.ReviewDeployment(ctx, request.Owner, request.Repo, review); err != nil {
+		return approved, fmt.Errorf("could not review the deployment: %w", err)
+	}
+	return approved, nil
+}
+
+// Decide on a deployment and explain the decision
+func (watchdog *WatchDog) gateDeployment(ctx context.Context, request DeploymentRequest) (bool, string, error) {
+	sha := codeSpan(shortSHA(request.SHA))
+	statuses, err := watchdog.scm.GetStatuses(ctx, request.Owner, request.Repo, request.SHA)
+	if err != nil {
+		return false, "", fmt.Errorf("could not get the statuses: %w", err)
+	}
+	runs, err := watchdog.scm.GetCheckRuns(ctx, request.Owner, request.Repo, request.SHA, checkRunName)
+	if err != nil {
+		return false, "", fmt.Errorf("could not get the check runs: %w", err)
+	}
+
+	checked := false
+	for _, status := range statuses {
+		if status.Context != defaultStatusContext && !strings.HasPrefix(status.Context, "watchdog/") {
+			continue
+		}
+		checked = true
+		switch status.State {
+		case "pending":
+			return false, fmt.Sprintf("%s is still being checked for Git LFS problems, deploy again once its %s status is set.", sha, codeSpan(status.Context)), nil
+		case "failure", "error":
+			return false, fmt.Sprintf("%s failed the Git LFS checks (%s: %s).", sha, codeSpan(status.Context), status.Description), nil
+		}
+	}
+	if len(runs) > 0 {
+		// The latest run supersedes earlier ones
+		checked = true
+		switch runs[0].Conclusion {
+		case "":
+			return false, fmt.Sprintf("%s is still being checked for Git LFS problems, deploy again once its check run completed.", sha), nil
+		case "failure", "action_required":
+			return false, fmt.Sprintf("%s failed the Git LFS checks (%s).", sha, runs[0].Title), nil
+		}
+	}
+	if !checked {
+		return false, fmt.Sprintf("%s was not checked for Git LFS problems. Only commits with a watchdog status or check run can be deployed, "+
+			"see `lfsCommitStatusEnabled` and `lfsChecksEnabled`.", sha), nil
+	}
+
+	if paths := openBranchErrors(request.Owner+"/"+request.Repo, "refs/heads/"+request.Ref); len(paths) > 0 {
+		listed := paths
+		if len(listed) > maxDeploymentFindings {
+			listed = listed[:maxDeploymentFindings]
+		}
+		for i, path := range listed {
+			listed[i] = codeSpan(path)
+		}
+		more := ""
+		if n := len(paths) - len(listed); n > 0 {
+			more = fmt.Sprintf(" and %d more", n)
+		}
+		return false, fmt.Sprintf("%d %s on %s still %s Git LFS findings reported on earlier commits: %s%s.", len(paths),
+			pluralize(len(paths), "file", "files"), codeSpan(request.Ref), pluralize(len(paths), "has", "have"), strings.Join(listed, ", "), more), nil
+	}
+	return true, fmt.Sprintf("%s passed the Git LFS checks.", sha), nil
+}
+
+// Return the paths of a branch with open findings of error severity, which
+// earlier commits of the branch introduced
+func openBranchErrors(repo, ref string) []string {
+	var paths []string
+	branchViolationCache.Range(func(key string, value interface{}) bool {
+		parts := strings.SplitN(key, "\x00", 3)
+		if len(parts) != 3 || !strings.EqualFold(parts[0], repo) || parts[1] != ref {
+			return true
+		}
+		if v, ok := violationCache.Get(key); ok && v.(violation).Severity == SeverityError {
+			paths = append(paths, parts[2])
+		}
+		return true
+	})
+	sort.Strings(paths)
+	return paths
+}
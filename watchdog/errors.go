@@ -0,0 +1,35 @@
+package watchdog
+
+import (
+	"errors"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// Kinds of errors of a check, match them with errors.Is
+var (
+	// ErrNotFound is matched by errors of files, directories or commits that
+	// GitHub does not know (yet)
+	ErrNotFound = scm.ErrNotFound
+	// ErrTooLarge is matched by errors of lookups that exceeded a limit of
+	// the GitHub API, e.g. directories with more than 1,000 files
+	ErrTooLarge = errors.New("too large")
+	// ErrRateLimited is matched by errors of requests that exceeded a rate
+	// limit of the GitHub API
+	ErrRateLimited = scm.ErrRateLimited
+)
+
+var errGetContentsUpperLimit error = &kindError{
+	kind: ErrTooLarge,
+	msg:  "reached Git contents API upper limit of 1,000 files for a directory",
+}
+
+// kindError is an error with its own message that matches an error kind
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string { return e.msg }
+
+func (e *kindError) Is(target error) bool { return target == e.kind }
@@ -0,0 +1,281 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/logging"
+)
+
+// Commit identifies a commit and the files it changed
+type Commit struct {
+	Owner string
+	Repo  string
+	SHA   string
+	// Ref is the pushed ref, e.g. "refs/heads/main", if known
+	Ref      string
+	Added    []string
+	Modified []string
+	Removed  []string
+	// Author is the GitHub login of the commit author, if known
+	Author      string
+	AuthorEmail string
+	// Pusher is the GitHub login of the user who pushed the commit, if known
+	Pusher string
+	// StatusOnly reports the commit without commenting on it
+	StatusOnly bool
+	// Collapsed is the number of commits of a push that this commit stands
+	// for, if the push had too many commits to check them one by one
+	Collapsed int
+	// Import is set if the commit stands for the import of an existing
+	// repository, which is reported with an issue instead of comments
+	Import bool
+	// Reevaluated is set if the commit is the head of the default branch,
+	// evaluated again with all its files because a push changed the
+	// configuration. It is reported with statuses and check runs only.
+	Reevaluated bool
+	// ReportURL is the URL of the report of the push, if reports are stored
+	ReportURL string
+}
+
+// FullName returns the "owner/repo" name of the commit's repository
+func (commit *Commit) FullName() string {
+	return commit.Owner + "/" + commit.Repo
+}
+
+// Files returns all added and modified files
+func (commit *Commit) Files() []string {
+	files := make([]string, 0, len(commit.Added)+len(commit.Modified))
+	files = append(files, commit.Added...)
+	return append(files, commit.Modified...)
+}
+
+// Measure the files of a commit and apply the policy.
+// The result contains findings and errors, but no actions.
+func (watchdog *WatchDog) evaluate(ctx context.Context, commit *Commit, config *Config) *CommitResult {
+	result := &CommitResult{SHA: commit.SHA}
+
+	// Look up sizes concurrently, but evaluate them in order
+	files := commit.Files()
+	entries, errs := watchdog.lookupEntries(ctx, commit, files, watchdog.fileEntryLookup(ctx, commit, config))
+
+	var attributes []attributesFile
+	if config.ruleEnabled(RuleBypassedLFS) && len(files) > 0 && ctx.Err() == nil {
+		var err error
+		attributes, err = watchdog.commitAttributes(ctx, commit)
+		if err != nil {
+			log.Printf("could not read the .gitattributes of '%s' at '%s': %v\n", commit.FullName(), commit.SHA, err)
+			result.Errors = append(result.Errors, fmt.Errorf("could not read .gitattributes: %w", err))
+		}
+	}
+
+	// Trace the evaluation of every file, whichever way it ends
+	traces := make([]FileTrace, 0, len(files))
+	for i, file := range files {
+		entry, err := entries[i], errs[i]
+		if err != nil && err == ctx.Err() {
+			result.Errors = append(result.Errors, err)
+			break
+		}
+		traces = append(traces, FileTrace{Path: file, Decision: "error"})
+		trace := &traces[len(traces)-1]
+		if err != nil {
+			log.Printf("could not obtain file size for '%s' at '%s' in '%s': %v\n", file, commit.SHA, commit.FullName(), err)
+			result.Errors = append(result.Errors, fmt.Errorf("could not obtain file size for '%s': %w", file, err))
+			trace.Error = fmt.Sprint(err)
+			continue
+		}
+		trace.Type, trace.Size = entry.Type, entry.Size
+
+		finding, violates := Finding{}, false
+		modified := i >= len(commit.Added)
+		switch entry.Type {
+		case "submodule":
+			// Evaluated by the submodule rules
+		case "symlink":
+			finding, violates, err = watchdog.evaluateSymlink(ctx, commit, config, file, entry.SHA)
+			if err != nil {
+				log.Printf("could not resolve symlink '%s' at '%s' in '%s': %v\n", file, commit.SHA, commit.FullName(), err)
+				result.Errors = append(result.Errors, fmt.Errorf("could not resolve symlink '%s': %w", file, err))
+				trace.Error = fmt.Sprint(err)
+				continue
+			}
+		default:
+			logging.Debugf("'%s' has '%s' of size %d \n", commit.FullName(), file, entry.Size)
+			finding, violates = evaluateFile(config, file, entry.Size)
+			trace.traceThreshold(config, file)
+			// Files tracked with Git LFS are never oversize files, but
+			// their objects may be
+			isPointer := false
+			vendored := config.ruleEnabled(RuleVendoredPointer) && config.vendored(file)
+			// Git LFS doesn't convert empty files
+			tracked := entry.Size > 0 && trackedWithLFS(attributes, normalizePath(file))
+			trace.Vendored, trace.TrackedWithLFS = vendored, tracked
+			if maybePointer(entry.Size) && (violates || vendored || tracked || config.ruleEnabled(RuleOversizeLFSObject)) {
+				p, err := watchdog.readPointer(ctx, commit, file, entry.SHA)
+				if err != nil {
+					log.Printf("could not read Git LFS pointer '%s' at '%s' in '%s': %v\n", file, commit.SHA, commit.FullName(), err)
+					result.Errors = append(result.Errors, fmt.Errorf("could not read Git LFS pointer '%s': %w", file, err))
+					trace.Error = fmt.Sprint(err)
+					continue
+				}
+				if p != nil {
+					isPointer = true
+					trace.Pointer = true
+					finding, violates = evaluateVendoredPointer(config, file, p)
+					if !violates {
+						finding, violates = evaluateLFSObject(config, file, p)
+					}
+				}
+			}
+			bypassed := tracked && !isPointer
+			if bypassed {
+				finding, violates = evaluateBypassedLFS(config, file, entry.Size)
+			}
+			if !isPointer && !bypassed && config.sniffable(file, entry.Size) {
+				format, err := watchdog.sniffFile(ctx, commit, file, entry.SHA)
+				if err != nil {
+					log.Printf("could not detect the format of '%s' at '%s' in '%s': %v\n", file, commit.SHA, commit.FullName(), err)
+					result.Errors = append(result.Errors, fmt.Errorf("could not detect the format of '%s': %w", file, err))
+					trace.Error = fmt.Sprint(err)
+					continue
+				}
+				finding, violates = evaluateSniffed(config, file, entry.Size, format, finding, violates)
+				if format.name != "" {
+					// Binary files don't get the threshold of exempt text files
+					trace.Format, trace.Threshold = format.name, config.LFSSizeThreshold
+				}
+			}
+			// Commits pushed before were counted already
+			if !violates && !isPointer && modified && !commit.StatusOnly && config.ruleEnabled(RuleBinaryChurn) {
+				var counted bool
+				finding, violates, counted, err = watchdog.evaluateChurn(ctx, commit, config, file, entry)
+				if counted {
+					result.changed = append(result.changed, file)
+				}
+				if err != nil {
+					log.Printf("could not evaluate the churn of '%s' at '%s' in '%s': %v\n", file, commit.SHA, commit.FullName(), err)
+					result.Errors = append(result.Errors, fmt.Errorf("could not evaluate the churn of '%s': %w", file, err))
+					trace.Error = fmt.Sprint(err)
+					continue
+				}
+			}
+		}
+
+		if violates {
+			finding.Modified = modified
+			trace.Rule = finding.Rule
+			if suppression, ok := config.suppression(finding); ok {
+				log.Printf("suppressed %s for '%s' at '%s' in '%s': %s\n", finding.Rule, file, commit.SHA, commit.FullName(), suppression.Reason)
+				finding.SuppressionReason = suppression.Reason
+				result.Suppressed = append(result.Suppressed, finding)
+				result.cleared = append(result.cleared, file)
+				trace.Decision = "suppressed"
+				continue
+			}
+			result.Findings = append(result.Findings, finding)
+			trace.Decision = "finding"
+			continue
+		}
+		result.cleared = append(result.cleared, file)
+		trace.Decision = "cleared"
+	}
+	// Traces are only kept while debug logging is on
+	if logging.Debug() {
+		result.Trace = traces
+	}
+
+	if config.ruleEnabled(RuleLockedFile) && ctx.Err() == nil {
+		locked, err := watchdog.lockedFiles(ctx, commit, config)
+		if err != nil {
+			log.Printf("could not obtain Git LFS locks of '%s': %v\n", commit.FullName(), err)
+			result.Errors = append(result.Errors, fmt.Errorf("could not obtain Git LFS locks: %w", err))
+		}
+		result.addFindings(commit, config, locked)
+	}
+
+	if config.submoduleRulesEnabled() && ctx.Err() == nil {
+		submodules, err := watchdog.submoduleFindings(ctx, commit, config, entries)
+		if err != nil {
+			log.Printf("could not evaluate the submodules of '%s' at '%s': %v\n", commit.FullName(), commit.SHA, err)
+			result.Errors = append(result.Errors, fmt.Errorf("could not evaluate submodules: %w", err))
+		}
+		result.addFindings(commit, config, submodules)
+	}
+
+	return result
+}
+
+// Add findings that are not about the size of a file, unless suppressed
+func (result *CommitResult) addFindings(commit *Commit, config *Config, findings []Finding) {
+	for _, finding := range findings {
+		if suppression, ok := config.suppression(finding); ok {
+			log.Printf("suppressed %s for '%s' at '%s' in '%s': %s\n", finding.Rule, finding.Path, commit.SHA, commit.FullName(), suppression.Reason)
+			finding.SuppressionReason = suppression.Reason
+			result.Suppressed = append(result.Suppressed, finding)
+			continue
+		}
+		result.Findings = append(result.Findings, finding)
+	}
+}
+
+// FileTrace records how a file of a commit was evaluated, so that support
+// engineers can see why it was or wasn't reported
+type FileTrace struct {
+	Path string
+	// Type is the type of the file's entry, e.g. "file" or "symlink"
+	Type string `json:",omitempty"`
+	Size int
+	// Threshold is the size the file had to exceed, zero if it is unlimited
+	Threshold int `json:",omitempty"`
+	// Exemption is the lfsSizeExemptions pattern that matched the file
+	Exemption string `json:",omitempty"`
+	// TrackedWithLFS is set if .gitattributes sets filter=lfs for the file,
+	// which is only read if the bypassed-lfs rule is enabled
+	TrackedWithLFS bool `json:",omitempty"`
+	Pointer        bool `json:",omitempty"`
+	// Vendored is set if the file matches vendorPaths
+	Vendored bool `json:",omitempty"`
+	// Format is the binary format of an extensionless file, detected by its
+	// magic number
+	Format string `json:",omitempty"`
+	// Decision is "cleared", "finding", "suppressed" or "error"
+	Decision string
+	Rule     string `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
+
+// Record the size threshold that applies to a file
+func (trace *FileTrace) traceThreshold(config *Config, file string) {
+	trace.Threshold = config.LFSSizeThreshold
+	if exempt, ok := config.exemptionThreshold(file); ok {
+		trace.Threshold, trace.Exemption = exempt, config.exemptionPattern(file)
+	}
+	if trace.Threshold == unlimitedSize {
+		trace.Threshold = 0
+	}
+}
+
+// Decide whether a file of the given size should be tracked with Git LFS
+func evaluateFile(config *Config, file string, size int) (Finding, bool) {
+	if !config.ruleEnabled(RuleOversizeFile) {
+		return Finding{}, false
+	}
+
+	threshold := config.LFSSizeThreshold // Large binary file
+	if exempt, ok := config.exemptionThreshold(file); ok {
+		threshold = exempt // Super large text file
+	}
+
+	if size > threshold {
+		return Finding{
+			Path:      file,
+			Size:      size,
+			Threshold: threshold,
+			Rule:      RuleOversizeFile,
+			Severity:  config.ruleSeverity(RuleOversizeFile),
+		}, true
+	}
+	return Finding{}, false
+}
@@ -0,0 +1,123 @@
+package watchdog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/filepathfilter"
+)
+
+// Ceiling of exemptions with the "unlimited" keyword
+const unlimitedSize = int(^uint(0) >> 1)
+
+// sizeExemption is an entry of lfsSizeExemptions with its own ceiling,
+// e.g. "Regression/*.txt 50MB"
+type sizeExemption struct {
+	threshold int
+	filter    *filepathfilter.Filter
+}
+
+// Parse lfsSizeExemptions. Patterns are separated by whitespace, and a
+// size or "unlimited" at the end of a line replaces
+// lfsSizeExemptionsThreshold for the patterns on that line.
+func (config *Config) validateExemptions() error {
+	config.sizeExemptions = nil
+	var patterns []string
+	for _, line := range strings.Split(config.LFSSizeExemptions, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 {
+			last := fields[len(fields)-1]
+			if threshold, ok, err := parseCeiling(last); err != nil {
+				return fmt.Errorf("lfsSizeExemptions entry '%s': %w", strings.TrimSpace(line), err)
+			} else if ok {
+				fields = fields[:len(fields)-1]
+				config.sizeExemptions = append(config.sizeExemptions, sizeExemption{
+					threshold: threshold,
+					filter:    newPathFilter(fields),
+				})
+			}
+		}
+		patterns = append(patterns, fields...)
+	}
+
+	// A filter without patterns would match every file
+	config.LFSExemptionsFilter = nil
+	if len(patterns) > 0 {
+		config.LFSExemptionsFilter = newPathFilter(patterns)
+	}
+	return nil
+}
+
+// Parse the ceiling of an exemption, e.g. "50MB", "512KB", "20000000" or
+// "unlimited". Units are binary like in comments. It reports false if s
+// is not a ceiling but a pattern.
+func parseCeiling(s string) (int, bool, error) {
+	if strings.EqualFold(s, "unlimited") {
+		return unlimitedSize, true, nil
+	}
+	upper := strings.ToUpper(s)
+	multiplier := 1
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int
+	}{{"GB", 1024 * 1024 * 1024}, {"MB", 1024 * 1024}, {"KB", 1024}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper, multiplier = strings.TrimSuffix(upper, unit.suffix), unit.multiplier
+			break
+		}
+	}
+	if upper == "" || strings.Trim(upper, "0123456789") != "" {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(upper)
+	if err != nil || n > unlimitedSize/multiplier {
+		return 0, false, fmt.Errorf("ceiling '%s' is too large", s)
+	}
+	if n == 0 {
+		return 0, false, fmt.Errorf("ceiling '%s' must be positive", s)
+	}
+	return n * multiplier, true, nil
+}
+
+// exemptionThreshold returns the size threshold of a file matching
+// lfsSizeExemptions. The first entry with its own ceiling wins, other
+// exempt files get lfsSizeExemptionsThreshold.
+func (config *Config) exemptionThreshold(file string) (int, bool) {
+	if config.LFSExemptionsFilter == nil {
+		return 0, false
+	}
+	path := normalizePath(file)
+	if !config.LFSExemptionsFilter.Allows(path) {
+		return 0, false
+	}
+	for _, exemption := range config.sizeExemptions {
+		if exemption.filter.Allows(path) {
+			return exemption.threshold, true
+		}
+	}
+	return config.LFSSizeExemptionsThreshold, true
+}
+
+// exemptionPattern returns the lfsSizeExemptions pattern that matches a
+// file, or an empty string if the file is not exempt
+func (config *Config) exemptionPattern(file string) string {
+	if _, ok := config.exemptionThreshold(file); !ok {
+		return ""
+	}
+	path := normalizePath(file)
+	for _, line := range strings.Split(config.LFSSizeExemptions, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 {
+			if _, ok, _ := parseCeiling(fields[len(fields)-1]); ok {
+				fields = fields[:len(fields)-1]
+			}
+		}
+		for _, pattern := range fields {
+			if newPathFilter([]string{pattern}).Allows(path) {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
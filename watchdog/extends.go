@@ -0,0 +1,148 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Configurations may extend configurations that extend others up to
+	// this depth
+	maxExtendsDepth = 5
+	// Configurations extended from other repositories are read from their
+	// default branch, which may change
+	extendsTTL = 5 * time.Minute
+)
+
+// Content of extended configurations by repository, ref and path
+var extendsCache = cache.New("config extends", cache.Options{MaxEntries: 1000, TTL: extendsTTL})
+
+// configSource identifies a configuration file
+type configSource struct {
+	owner, repo string
+	// ref is empty for the default branch
+	ref, path string
+}
+
+func (s configSource) String() string {
+	if s.ref == "" {
+		return fmt.Sprintf("%s/%s:%s", s.owner, s.repo, s.path)
+	}
+	return fmt.Sprintf("%s/%s:%s@%s", s.owner, s.repo, s.path, s.ref)
+}
+
+// ExtendsError is returned for configurations whose extended
+// configurations can't be resolved, e.g. because they are missing, invalid,
+// nested too deeply or form a cycle
+type ExtendsError struct {
+	// Chain lists the configurations from the repository's own
+	// configuration to the one that failed
+	Chain []string
+	Err   error
+
+	// Set if reading an extended configuration failed
+	fetching bool
+}
+
+func (e *ExtendsError) Error() string {
+	return fmt.Sprintf("could not resolve the configurations extended by %s: %v", strings.Join(e.Chain, " -> "), e.Err)
+}
+
+func (e *ExtendsError) Unwrap() error { return e.Err }
+
+// Report whether resolving failed because of a transient error reading an
+// extended configuration, rather than because of the configurations
+func transientExtendsError(err error) bool {
+	var extends *ExtendsError
+	return errors.As(err, &extends) && extends.fetching && !errors.Is(err, ErrNotFound)
+}
+
+// Parse an entry of extends. Paths are read from the same commit, paths
+// prefixed with "owner/repo:" from the default branch of that repository.
+func parseExtends(from configSource, entry string) (configSource, error) {
+	entry = strings.TrimSpace(entry)
+	if i := strings.Index(entry, ":"); i >= 0 {
+		names := strings.Split(entry[:i], "/")
+		if len(names) != 2 || names[0] == "" || names[1] == "" || entry[i+1:] == "" {
+			return configSource{}, fmt.Errorf("extends entry '%s' is not a path or 'owner/repo:path'", entry)
+		}
+		return configSource{owner: names[0], repo: names[1], path: strings.TrimPrefix(entry[i+1:], "/")}, nil
+	}
+	if entry == "" {
+		return configSource{}, fmt.Errorf("extends entry is empty")
+	}
+	return configSource{owner: from.owner, repo: from.repo, ref: from.ref, path: strings.TrimPrefix(entry, "/")}, nil
+}
+
+// Resolve the configurations extended by content, read from source, and
+// return all documents in the order they apply: extended configurations
+// first, so that the extending configuration overrides them.
+func (watchdog *WatchDog) resolveExtends(ctx context.Context, source configSource, content []byte) ([][]byte, error) {
+	return watchdog.resolveChain(ctx, []configSource{source}, content)
+}
+
+func (watchdog *WatchDog) resolveChain(ctx context.Context, chain []configSource, content []byte) ([][]byte, error) {
+	chainError := func(err error) *ExtendsError {
+		names := make([]string, len(chain))
+		for i, s := range chain {
+			names[i] = s.String()
+		}
+		return &ExtendsError{Chain: names, Err: err}
+	}
+
+	var header struct {
+		Extends []string `yaml:"extends"`
+	}
+	if err := yaml.Unmarshal(content, &header); err != nil {
+		return nil, chainError(err)
+	}
+	if len(header.Extends) > 0 && len(chain) > maxExtendsDepth {
+		return nil, chainError(fmt.Errorf("configurations are extended more than %d levels deep", maxExtendsDepth))
+	}
+
+	var documents [][]byte
+	for _, entry := range header.Extends {
+		source, err := parseExtends(chain[len(chain)-1], entry)
+		if err != nil {
+			return nil, chainError(err)
+		}
+		for _, s := range chain {
+			if s == source {
+				return nil, chainError(fmt.Errorf("%s is extended again, the configurations form a cycle", source))
+			}
+		}
+		extended, err := watchdog.getExtendedContent(ctx, source)
+		if err != nil {
+			e := chainError(fmt.Errorf("could not read %s: %w", source, err))
+			e.fetching = true
+			return nil, e
+		}
+		// Don't share the backing array with other entries
+		resolved, err := watchdog.resolveChain(ctx, append(chain[:len(chain):len(chain)], source), extended)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, resolved...)
+	}
+	return append(documents, content), nil
+}
+
+// Get the content of an extended configuration from the cache or GitHub
+func (watchdog *WatchDog) getExtendedContent(ctx context.Context, source configSource) ([]byte, error) {
+	key := source.String()
+	if content, ok := extendsCache.Get(key); ok {
+		return content.([]byte), nil
+	}
+	content, err := watchdog.getFileContent(ctx, source.owner, source.repo, source.ref, source.path)
+	if err != nil {
+		return nil, err
+	}
+	extendsCache.Add(key, []byte(content))
+	return []byte(content), nil
+}
@@ -0,0 +1,225 @@
+package watchdog
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"github.com/google/go-github/v35/github"
+)
+
+const (
+	// Fix branches are named after the head commit of the push they fix,
+	// so that a redelivered push doesn't open a second pull request
+	fixBranchPrefix = "lfswatchdog/fix-"
+	// Bound the files uploaded per push. Files are held in memory one at a
+	// time while they are uploaded.
+	maxFixFiles     = 50
+	maxFixTotalSize = 256 * 1024 * 1024
+	// The largest blob the Git data API returns
+	maxFixFileSize    = 100 * 1024 * 1024
+	gitattributesFile = ".gitattributes"
+)
+
+// Propose moving the files of a push with suggestions to Git LFS in a draft
+// pull request against the pushed branch, based on the head of the push.
+// The content of the files is uploaded to Git LFS storage and the files are
+// replaced with pointers. The pull request is recorded as an action of the
+// head commit.
+func (watchdog *WatchDog) proposeFix(ctx context.Context, event *github.PushEvent, result *PushResult) {
+	head := event.GetAfter()
+	base := strings.TrimPrefix(event.GetRef(), "refs/heads/")
+	if head == "" || event.GetDeleted() || base == event.GetRef() || strings.HasPrefix(base, fixBranchPrefix) {
+		// Tags and unknown refs have no branch to merge into
+		return
+	}
+	var headResult *CommitResult
+	var findings []Finding
+	seen := make(map[string]bool)
+	for _, commit := range result.Commits {
+		if commit == nil {
+			continue
+		}
+		if commit.SHA == head {
+			headResult = commit
+		}
+		for _, finding := range commit.Findings {
+			if finding.Rule == RuleOversizeFile && !seen[finding.Path] {
+				seen[finding.Path] = true
+				findings = append(findings, finding)
+			}
+		}
+	}
+	if headResult == nil || len(findings) == 0 {
+		return
+	}
+
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	config, err := watchdog.getWatchDogConfig(ctx, owner, repo, configRef(event, head))
+	if err != nil {
+		return
+	}
+	settings, _ := GetInstallationSettings(watchdog.installationID)
+	if !settings.apply(config).LFSFixPullRequestEnabled {
+		return
+	}
+	if DryRun() || settings.DryRun {
+		log.Printf("dry-run: would propose a Git LFS fix for '%s' in '%s'\n", head, event.GetRepo().GetFullName())
+		return
+	}
+
+	commit := &Commit{Owner: owner, Repo: repo, SHA: head, Ref: event.GetRef()}
+	url, err := watchdog.openFixPullRequest(ctx, commit, base, findings)
+	if err != nil {
+		log.Printf("could not propose a Git LFS fix for '%s' in '%s': %v\n", head, commit.FullName(), err)
+	}
+	if url != "" || err != nil {
+		headResult.Actions = append(headResult.Actions, Action{Type: "pull_request", Detail: url, Err: err})
+	}
+}
+
+// Open the draft pull request that moves the files of findings at the head
+// commit of a push to Git LFS. Returns the web URL of the pull request, or
+// an empty string if no pull request was opened.
+func (watchdog *WatchDog) openFixPullRequest(ctx context.Context, commit *Commit, base string, findings []Finding) (string, error) {
+	branch := fixBranchPrefix + shortSHA(commit.SHA)
+	exists, err := watchdog.scm.BranchExists(ctx, commit.Owner, commit.Repo, branch)
+	if err != nil {
+		return "", fmt.Errorf("could not look up branch '%s': %w", branch, err)
+	}
+	if exists {
+		log.Printf("not proposing a fix for '%s' in '%s': branch '%s' exists\n", commit.SHA, commit.FullName(), branch)
+		return "", nil
+	}
+
+	files := make(map[string]string)
+	var moved, skipped []string
+	var total int
+	for _, finding := range findings {
+		// Later commits of the push may have changed or removed the file
+		entry, err := watchdog.getFileEntry(ctx, commit.Owner, commit.Repo, commit.SHA, finding.Path)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(moved) == maxFixFiles || entry.Size > maxFixFileSize || total+entry.Size > maxFixTotalSize {
+			skipped = append(skipped, entry.Path)
+			continue
+		}
+		pointer, err := watchdog.uploadToLFS(ctx, commit, entry)
+		if err != nil {
+			return "", err
+		}
+		files[entry.Path] = pointer
+		moved = append(moved, entry.Path)
+		total += entry.Size
+	}
+	if len(moved) == 0 {
+		return "", nil
+	}
+
+	attributes, err := watchdog.scm.GetFileContent(ctx, commit.Owner, commit.Repo, commit.SHA, gitattributesFile)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("could not get %s: %w", gitattributesFile, err)
+	}
+	files[gitattributesFile] = trackWithLFS(attributes, moved)
+
+	_, err = watchdog.scm.CommitFiles(ctx, commit.Owner, commit.Repo, &scm.Change{
+		Branch:  branch,
+		Parent:  commit.SHA,
+		Message: fmt.Sprintf("Track large files with Git LFS\n\nMoves the large files pushed up to %s to Git LFS.", shortSHA(commit.SHA)),
+		Files:   files,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return watchdog.scm.CreatePullRequest(ctx, commit.Owner, commit.Repo, &scm.PullRequest{
+		Title: fmt.Sprintf("Track large files pushed to %s with Git LFS", base),
+		Body:  fixPullRequestBody(commit, moved, skipped),
+		Head:  branch,
+		Base:  base,
+		Draft: true,
+	})
+}
+
+// Upload the content of a file to Git LFS storage and return its pointer
+func (watchdog *WatchDog) uploadToLFS(ctx context.Context, commit *Commit, entry *scm.Entry) (string, error) {
+	content, err := watchdog.scm.GetBlob(ctx, commit.Owner, commit.Repo, entry.SHA)
+	if err != nil {
+		return "", fmt.Errorf("could not get the content of '%s': %w", entry.Path, err)
+	}
+	oid := fmt.Sprintf("%x", sha256.Sum256(content))
+	if err := watchdog.scm.UploadLFSObject(ctx, commit.Owner, commit.Repo, oid, content); err != nil {
+		return "", fmt.Errorf("could not upload '%s' to Git LFS: %w", entry.Path, err)
+	}
+	return lfsPointer(oid, len(content)), nil
+}
+
+// c.f. https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+func lfsPointer(oid string, size int) string {
+	return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, size)
+}
+
+// Append Git LFS attributes for paths to the content of a .gitattributes
+// file. Each path is anchored at the root and matched literally.
+func trackWithLFS(attributes string, paths []string) string {
+	patterns := make([]string, len(paths))
+	for i, p := range paths {
+		patterns[i] = attributesPattern(p)
+	}
+	return appendLFSPatterns(attributes, patterns)
+}
+
+// Append Git LFS attributes for patterns to the content of a .gitattributes
+// file
+func appendLFSPatterns(attributes string, patterns []string) string {
+	var b strings.Builder
+	b.WriteString(attributes)
+	if attributes != "" && !strings.HasSuffix(attributes, "\n") {
+		b.WriteString("\n")
+	}
+	for _, pattern := range patterns {
+		fmt.Fprintf(&b, "%s filter=lfs diff=lfs merge=lfs -text\n", pattern)
+	}
+	return b.String()
+}
+
+// Escape glob characters and whitespace, which separates attributes
+var attributesEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`*`, `\*`,
+	`?`, `\?`,
+	`[`, `\[`,
+	` `, `[[:space:]]`,
+	"\t", `[[:space:]]`,
+)
+
+func attributesPattern(p string) string {
+	return "/" + attributesEscaper.Replace(p)
+}
+
+func fixPullRequestBody(commit *Commit, moved, skipped []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "This pull request moves the large files pushed up to %s to [Git LFS](https://git-lfs.github.com/). "+
+		"Their content is already in the repository's Git LFS storage.\n\n", commit.SHA)
+	for _, p := range moved {
+		fmt.Fprintf(&b, "- %s\n", codeSpan(p))
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&b, "\nThe following %s could not be moved and need to be migrated manually:\n\n", pluralize(len(skipped), "file", "files"))
+		for _, p := range skipped {
+			fmt.Fprintf(&b, "- %s\n", codeSpan(p))
+		}
+	}
+	b.WriteString("\nMerging keeps later versions of these files out of the Git history, but the " +
+		"versions committed so far remain in it. Check that the files were not changed on the " +
+		"branch since, then mark the pull request as ready for review.\n")
+	return b.String()
+}
@@ -0,0 +1,148 @@
+package watchdog
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Comments end with a hidden footer like
+//
+//	<!-- lfswatchdog {"version":"2.0.0","rules":["LFS001"],"config":"1b4f0e9857ab"} -->
+//
+// which GitHub doesn't render
+const footerPrefix = "<!-- lfswatchdog "
+
+var footerPattern = regexp.MustCompile(`\n*` + regexp.QuoteMeta(footerPrefix) + `(\{[^\n]*\}) -->\n?`)
+
+// CommentFooter identifies what produced a comment, so that later runs can
+// find their earlier comments and support can tell which version and
+// configuration posted a message
+type CommentFooter struct {
+	// Version of the watchdog
+	Version string `json:"version"`
+	// Rules of the findings in the comment
+	Rules []string `json:"rules,omitempty"`
+	// Config is a hash of the repository configuration
+	Config string `json:"config"`
+}
+
+// The version and signature of comments
+var commentSignature = struct {
+	sync.RWMutex
+	version   string
+	signature string
+}{version: "dev"}
+
+// SetVersion sets the watchdog version that comment footers report
+func SetVersion(version string) {
+	if version == "" {
+		return
+	}
+	commentSignature.Lock()
+	defer commentSignature.Unlock()
+	commentSignature.version = version
+}
+
+// SetCommentSignature sets a line of Markdown that every comment ends with,
+// e.g. to name the team running the watchdog. Comments are not signed by
+// default.
+func SetCommentSignature(signature string) {
+	commentSignature.Lock()
+	defer commentSignature.Unlock()
+	commentSignature.signature = strings.TrimSpace(signature)
+}
+
+// Return the footer of a comment about findings under a configuration
+func newCommentFooter(config *Config, rules []string) CommentFooter {
+	commentSignature.RLock()
+	defer commentSignature.RUnlock()
+	return CommentFooter{Version: commentSignature.version, Rules: sortedRules(rules), Config: configHash(config)}
+}
+
+func findingRules(findings []Finding) []string {
+	rules := make([]string, len(findings))
+	for i, finding := range findings {
+		rules[i] = finding.Rule
+	}
+	return rules
+}
+
+func sortedRules(rules []string) []string {
+	seen := make(map[string]bool, len(rules))
+	var sorted []string
+	for _, rule := range rules {
+		if !seen[rule] {
+			seen[rule] = true
+			sorted = append(sorted, rule)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Hash the settings of a configuration, not how they were written
+func configHash(config *Config) string {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%x", sum[:6])
+}
+
+// ParseCommentFooter returns the footer of a comment the watchdog posted
+func ParseCommentFooter(body string) (CommentFooter, bool) {
+	var footer CommentFooter
+	matches := footerPattern.FindAllStringSubmatch(body, -1)
+	if len(matches) == 0 {
+		return footer, false
+	}
+	err := json.Unmarshal([]byte(matches[len(matches)-1][1]), &footer)
+	return footer, err == nil
+}
+
+// Remove the signature and footer from a comment
+func stripFooter(body string) string {
+	loc := footerPattern.FindStringIndex(body)
+	if loc == nil {
+		return body
+	}
+	body = body[:loc[0]]
+	commentSignature.RLock()
+	signature := commentSignature.signature
+	commentSignature.RUnlock()
+	if signature != "" {
+		body = strings.TrimSuffix(strings.TrimRight(body, "\n"), signature)
+	}
+	return strings.TrimRight(body, "\n") + "\n"
+}
+
+// Append the signature and footer to a comment, replacing those it has.
+// The comment is truncated to fit both within the size limit of comments.
+func withFooter(body string, footer CommentFooter) string {
+	suffix := footerSuffix(footer)
+	return truncate(stripFooter(body), maxCommentBody-utf8.RuneCountInString(suffix)) + suffix
+}
+
+// Return the signature and footer that comments end with
+func footerSuffix(footer CommentFooter) string {
+	commentSignature.RLock()
+	signature := commentSignature.signature
+	commentSignature.RUnlock()
+
+	data, _ := json.Marshal(footer)
+	var b strings.Builder
+	if signature != "" {
+		b.WriteString("\n" + signature + "\n")
+	}
+	b.WriteString("\n" + footerPrefix + string(data) + " -->\n")
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// Pushes that create the default branch with at least this many files are
+// treated as the import of an existing repository
+const importFileThreshold = 1000
+
+// Title of the issue that summarizes the audit of an imported repository
+const importIssueTitle = "Git LFS audit of the imported repository"
+
+// Report whether a push imports an existing repository, i.e. creates the
+// default branch with thousands of files at once. Commenting on every
+// commit of its history would flood the new repository with comments.
+func isImport(event *github.PushEvent) bool {
+	if !event.GetCreated() || strings.Trim(event.GetBefore(), "0") != "" || len(event.Commits) == 0 {
+		return false
+	}
+	defaultBranch := event.GetRepo().GetDefaultBranch()
+	if defaultBranch == "" || event.GetRef() != "refs/heads/"+defaultBranch {
+		return false
+	}
+	return len(collapseCommits(event.Commits).Added) >= importFileThreshold
+}
+
+// Check an imported repository at once: all files of the head commit are
+// audited and reported with a single issue. The other commits are reported
+// as skipped.
+func (watchdog *WatchDog) checkImport(ctx context.Context, event *github.PushEvent, result *PushResult) {
+	log.Printf("auditing the import of '%s' with %d commits at the head commit\n", event.GetRepo().GetFullName(), len(event.Commits))
+	last := len(event.Commits) - 1
+	for i, commit := range event.Commits[:last] {
+		skippedCommits.Inc("import")
+		result.Commits[i] = &CommitResult{SHA: commit.GetID(), Skipped: true, SkipReason: "import"}
+		result.retries.report(result.Commits[i])
+	}
+
+	head := collapseCommits(event.Commits)
+	if files, err := watchdog.headFiles(ctx, event); err != nil {
+		// The pushed files are the next best thing
+		log.Printf("could not list the files of the import of '%s', checking the pushed files: %v\n", event.GetRepo().GetFullName(), err)
+	} else {
+		head.Added, head.Modified, head.Removed = files, nil, nil
+	}
+	result.Commits[last] = watchdog.checkCommit(ctx, event, head, len(event.Commits), false, 1, result.retries)
+	result.retries.report(result.Commits[last])
+}
+
+// List all files at the head commit of a push
+func (watchdog *WatchDog) headFiles(ctx context.Context, event *github.PushEvent) ([]string, error) {
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	tree, err := watchdog.scm.GetTree(ctx, owner, repo, event.GetAfter(), true)
+	if err != nil {
+		return nil, err
+	}
+	if tree.Truncated {
+		log.Printf("the tree of '%s' in '%s/%s' is truncated, auditing the listed files only\n", event.GetAfter(), owner, repo)
+	}
+	var files []string
+	for _, entry := range tree.Entries {
+		if entry.Type != "dir" {
+			files = append(files, entry.Path)
+		}
+	}
+	return files, nil
+}
+
+// Open the issue that summarizes the audit of an imported repository
+func (watchdog *WatchDog) openImportIssue(commit *Commit, body string) (string, error) {
+	url, err := watchdog.scm.CreateIssue(context.Background(), commit.Owner, commit.Repo, importIssueTitle, body)
+	if err != nil {
+		return "", fmt.Errorf("could not open the audit issue: %w", err)
+	}
+	return url, nil
+}
+
+// Render the note of a report on an imported repository
+func importNote(commit *Commit) string {
+	return fmt.Sprintf("**Note:** this push imported the repository with %d commits. "+
+		"Instead of commenting on each of them, all files at %s were checked.\n\n", commit.Collapsed, shortSHA(commit.SHA))
+}
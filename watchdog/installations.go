@@ -0,0 +1,104 @@
+package watchdog
+
+import (
+	"fmt"
+	"sync"
+)
+
+// InstallationSettings override the configuration of every repository of
+// an installation, for changes that are impractical to make in hundreds of
+// watchdog.yml files
+type InstallationSettings struct {
+	// DryRun logs the findings of the installation instead of posting them
+	DryRun bool `json:"dryRun,omitempty"`
+	// DisabledRules are rule IDs or names that are not evaluated
+	DisabledRules []string `json:"disabledRules,omitempty"`
+	// HelpContact replaces the help contact of all repositories
+	HelpContact string `json:"helpContact,omitempty"`
+	// CoachingViolations is the number of commits with findings per author
+	// that are only reported in check runs, without commit comments
+	CoachingViolations int `json:"coachingViolations,omitempty"`
+}
+
+// Installation ID -> settings
+var installationSettings = struct {
+	sync.RWMutex
+	settings map[int64]InstallationSettings
+}{settings: make(map[int64]InstallationSettings)}
+
+// Check the settings and key the disabled rules by rule ID
+func (settings *InstallationSettings) validate() error {
+	ids := make([]string, 0, len(settings.DisabledRules))
+	for _, idOrName := range settings.DisabledRules {
+		rule, ok := LookupRule(idOrName)
+		if !ok {
+			return fmt.Errorf("unknown rule '%s'", idOrName)
+		}
+		ids = append(ids, rule.ID)
+	}
+	settings.DisabledRules = ids
+	if settings.CoachingViolations < 0 {
+		return fmt.Errorf("coachingViolations must not be negative, got %d", settings.CoachingViolations)
+	}
+	return checkHelpContact(settings.HelpContact)
+}
+
+// SetInstallationSettings replaces the settings of an installation. Empty
+// settings remove them.
+func SetInstallationSettings(installationID int64, settings InstallationSettings) (InstallationSettings, error) {
+	if err := settings.validate(); err != nil {
+		return settings, err
+	}
+	installationSettings.Lock()
+	defer installationSettings.Unlock()
+	if !settings.DryRun && len(settings.DisabledRules) == 0 && settings.HelpContact == "" && settings.CoachingViolations == 0 {
+		delete(installationSettings.settings, installationID)
+	} else {
+		installationSettings.settings[installationID] = settings
+	}
+	return settings, nil
+}
+
+// GetInstallationSettings returns the settings of an installation
+func GetInstallationSettings(installationID int64) (InstallationSettings, bool) {
+	installationSettings.RLock()
+	defer installationSettings.RUnlock()
+	settings, ok := installationSettings.settings[installationID]
+	return settings, ok
+}
+
+// AllInstallationSettings returns the settings of all installations that
+// have any
+func AllInstallationSettings() map[int64]InstallationSettings {
+	installationSettings.RLock()
+	defer installationSettings.RUnlock()
+	all := make(map[int64]InstallationSettings, len(installationSettings.settings))
+	for id, settings := range installationSettings.settings {
+		all[id] = settings
+	}
+	return all
+}
+
+// Apply the settings to a repository configuration. The configuration may
+// be shared with other commits, so it is copied when it changes.
+func (settings InstallationSettings) apply(config *Config) *Config {
+	if len(settings.DisabledRules) == 0 && settings.HelpContact == "" && settings.CoachingViolations == 0 {
+		return config
+	}
+	overridden := *config
+	overridden.Rules = make(map[string]RuleConfig, len(config.Rules)+len(settings.DisabledRules))
+	for id, ruleConfig := range config.Rules {
+		overridden.Rules[id] = ruleConfig
+	}
+	disabled := false
+	for _, id := range settings.DisabledRules {
+		ruleConfig := overridden.Rules[id]
+		ruleConfig.Enabled = &disabled
+		overridden.Rules[id] = ruleConfig
+	}
+	if settings.HelpContact != "" {
+		overridden.HelpContact = settings.HelpContact
+	}
+	overridden.coachingViolations = settings.CoachingViolations
+	return &overridden
+}
@@ -0,0 +1,47 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+)
+
+// Git LFS objects larger than this are reported by default, GitHub
+// Enterprise rejects objects larger than 5GB
+const defaultLFSObjectSizeThreshold = 1024 * 1024 * 1024
+
+// Check that the Git LFS object threshold is usable
+func (config *Config) validateLFSObjects() error {
+	if config.LFSObjectSizeThreshold < 1 {
+		return fmt.Errorf("lfsObjectSizeThreshold must be at least 1, got %d", config.LFSObjectSizeThreshold)
+	}
+	return nil
+}
+
+// Report whether a file of this size may be a Git LFS pointer
+func maybePointer(size int) bool {
+	return size >= minPointerSize && size <= maxPointerSize
+}
+
+// Read a file that may be a Git LFS pointer. Returns nil if it is none.
+func (watchdog *WatchDog) readPointer(ctx context.Context, commit *Commit, file, sha string) (*pointer, error) {
+	content, err := watchdog.scm.GetBlob(ctx, commit.Owner, commit.Repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the content of '%s': %w", file, err)
+	}
+	return parsePointer(string(content)), nil
+}
+
+// Evaluate the Git LFS object of a pointer file against the object size
+// threshold. The pointer itself is tracked with Git LFS already.
+func evaluateLFSObject(config *Config, file string, p *pointer) (Finding, bool) {
+	if !config.ruleEnabled(RuleOversizeLFSObject) || p.size <= int64(config.LFSObjectSizeThreshold) {
+		return Finding{}, false
+	}
+	return Finding{
+		Path:      file,
+		Size:      int(p.size),
+		Threshold: config.LFSObjectSizeThreshold,
+		Rule:      RuleOversizeLFSObject,
+		Severity:  config.ruleSeverity(RuleOversizeLFSObject),
+	}, true
+}
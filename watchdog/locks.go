@@ -0,0 +1,39 @@
+package watchdog
+
+import (
+	"context"
+	"strings"
+)
+
+// Find the files a commit changes or removes that are locked with Git LFS
+// by someone other than the commit's author or pusher
+func (watchdog *WatchDog) lockedFiles(ctx context.Context, commit *Commit, config *Config) ([]Finding, error) {
+	locks, err := watchdog.scm.ListLFSLocks(ctx, commit.Owner, commit.Repo)
+	if err != nil || len(locks) == 0 {
+		return nil, err
+	}
+
+	owners := make(map[string]string, len(locks))
+	for _, lock := range locks {
+		owners[normalizePath(lock.Path)] = lock.Owner
+	}
+	allowed := map[string]bool{
+		strings.ToLower(watchdog.resolveAuthor(ctx, commit)): true,
+		strings.ToLower(commit.Pusher):                       true,
+	}
+
+	var findings []Finding
+	for _, file := range append(commit.Files(), commit.Removed...) {
+		owner, ok := owners[normalizePath(file)]
+		if !ok || allowed[strings.ToLower(owner)] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Path:     file,
+			Rule:     RuleLockedFile,
+			Severity: config.ruleSeverity(RuleLockedFile),
+			LockedBy: owner,
+		})
+	}
+	return findings, nil
+}
@@ -0,0 +1,38 @@
+package watchdog
+
+import "strings"
+
+// Render text as a Markdown code span, so that file names with Markdown or
+// HTML in them are displayed verbatim and can't inject markup.
+// c.f. https://spec.commonmark.org/0.29/#code-spans
+func codeSpan(text string) string {
+	// A code span ends at a blank line
+	text = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text)
+
+	// The fence must be longer than any run of backticks in the text
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+
+	// One leading and trailing space is stripped if both are present,
+	// which separates the fence from backticks in the text
+	if longest > 0 || (strings.HasPrefix(text, " ") && strings.HasSuffix(text, " ")) {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+// Escape text for a Markdown table cell. GitHub splits cells at pipes even
+// in code spans.
+func tableCell(text string) string {
+	return strings.Replace(text, "|", `\|`, -1)
+}
@@ -0,0 +1,88 @@
+package watchdog
+
+import (
+	"sync"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+)
+
+var (
+	findingsTotal = metrics.NewCounter("lfswatchdog_findings_total", "Reported findings.", "org", "repo", "rule")
+	checkSeconds  = metrics.NewHistogram("lfswatchdog_commit_check_seconds", "Time to check and report a commit.", metrics.DefaultBuckets, "org", "repo")
+)
+
+// otherRepos is the repo label of repositories without their own label
+const otherRepos = "other"
+
+// Number of repositories whose checked commits are counted to find the
+// busiest ones
+const maxCountedRepos = 10000
+
+// Repositories with their own metrics label, and the number of checked
+// commits of recently checked repositories. Every repository label
+// multiplies the number of time series, so they are limited.
+var repoLabels = struct {
+	sync.Mutex
+	limit    int
+	admitted map[string]bool
+	counts   *cache.Cache
+}{admitted: make(map[string]bool), counts: newRepoCounts()}
+
+func newRepoCounts() *cache.Cache {
+	return cache.New("metrics-repo-counts", cache.Options{MaxEntries: maxCountedRepos})
+}
+
+// SetMetricsRepoLimit sets the number of repositories that get their own
+// metrics label. The repositories with the most checked commits since the
+// start get a label, all others are aggregated as "other". Zero, the
+// default, aggregates all repositories.
+func SetMetricsRepoLimit(limit int) {
+	repoLabels.Lock()
+	defer repoLabels.Unlock()
+	repoLabels.limit = limit
+}
+
+// Return the metrics label of a repository for a checked commit
+func repoLabel(repo string) string {
+	repoLabels.Lock()
+	defer repoLabels.Unlock()
+
+	count := repoCount(repo) + 1
+	repoLabels.counts.Add(repo, count)
+	if repoLabels.admitted[repo] {
+		return repo
+	}
+	if len(repoLabels.admitted) < repoLabels.limit {
+		repoLabels.admitted[repo] = true
+		return repo
+	}
+
+	// Replace the labeled repository with the fewest commits once the
+	// repository has twice as many, so that repositories with similar
+	// volumes don't take turns and create ever more time series
+	least, fewest := "", 0
+	for admitted := range repoLabels.admitted {
+		if count := repoCount(admitted); least == "" || count < fewest {
+			least, fewest = admitted, count
+		}
+	}
+	if least != "" && count > 2*fewest {
+		// The series of the replaced repository would be exported forever
+		delete(repoLabels.admitted, least)
+		findingsTotal.Delete("repo", least)
+		checkSeconds.Delete("repo", least)
+		repoLabels.admitted[repo] = true
+		return repo
+	}
+	return otherRepos
+}
+
+// Return the number of checked commits of a repository. The caller must
+// hold the repoLabels lock.
+func repoCount(repo string) int {
+	if count, ok := repoLabels.counts.Get(repo); ok {
+		return count.(int)
+	}
+	return 0
+}
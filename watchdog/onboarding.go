@@ -0,0 +1,78 @@
+package watchdog
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lower case "owner/repo" -> time the App was installed on the repository
+var onboarded = struct {
+	sync.RWMutex
+	since       map[string]time.Time
+	gracePeriod time.Duration
+}{since: make(map[string]time.Time)}
+
+// SetGracePeriod sets the time after the App was installed on a
+// repository during which errors are only reported as warnings. Zero
+// enforces the policy right away.
+func SetGracePeriod(gracePeriod time.Duration) {
+	onboarded.Lock()
+	defer onboarded.Unlock()
+	onboarded.gracePeriod = gracePeriod
+}
+
+// SetOnboarded records when the App was installed on a repository
+func SetOnboarded(repo string, at time.Time) {
+	onboarded.Lock()
+	defer onboarded.Unlock()
+	onboarded.since[strings.ToLower(repo)] = at
+}
+
+// Onboarded returns when the App was installed on a repository, if known
+func Onboarded(repo string) (time.Time, bool) {
+	onboarded.RLock()
+	defer onboarded.RUnlock()
+	at, ok := onboarded.since[strings.ToLower(repo)]
+	return at, ok
+}
+
+// AllOnboarded returns when the App was installed on all known
+// repositories
+func AllOnboarded() map[string]time.Time {
+	onboarded.RLock()
+	defer onboarded.RUnlock()
+	all := make(map[string]time.Time, len(onboarded.since))
+	for repo, at := range onboarded.since {
+		all[repo] = at
+	}
+	return all
+}
+
+// Return the end of a repository's grace period if it didn't end yet
+func gracePeriodEnd(repo string, now time.Time) (time.Time, bool) {
+	onboarded.RLock()
+	defer onboarded.RUnlock()
+	at, ok := onboarded.since[strings.ToLower(repo)]
+	if !ok || onboarded.gracePeriod <= 0 {
+		return time.Time{}, false
+	}
+	end := at.Add(onboarded.gracePeriod)
+	return end, now.Before(end)
+}
+
+// Report errors of repositories in their grace period as warnings, so
+// that they don't fail commit statuses and check runs
+func applyGracePeriod(commit *Commit, result *CommitResult) {
+	end, ok := gracePeriodEnd(commit.FullName(), time.Now())
+	if !ok || !hasErrors(result.Findings) {
+		return
+	}
+	log.Printf("'%s' is in its grace period until %s, reporting errors as warnings\n", commit.FullName(), end.Format(time.RFC3339))
+	for i := range result.Findings {
+		if result.Findings[i].Severity == SeverityError {
+			result.Findings[i].Severity = SeverityWarning
+		}
+	}
+}
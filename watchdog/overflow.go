@@ -0,0 +1,180 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// Pushes with more commits than this are checked at their head commit
+// only, zero checks every commit
+var maxCommitsPerPush int32
+
+// SetMaxCommitsPerPush sets the number of commits above which a push,
+// e.g. a history import, is not checked commit by commit. The files changed
+// by all its commits are checked at the head commit instead.
+func SetMaxCommitsPerPush(max int) {
+	atomic.StoreInt32(&maxCommitsPerPush, int32(max))
+}
+
+// Merge the commits of a push into its head commit, which is checked with
+// all files that the commits added or modified and that still exist at
+// the head commit
+func collapseCommits(commits []*github.HeadCommit) *github.HeadCommit {
+	var head github.HeadCommit
+	if last := commits[len(commits)-1]; last != nil {
+		head = *last
+	}
+	head.Added, head.Modified, head.Removed = nil, nil, nil
+
+	// Path -> whether the file exists after the last commit that changed it
+	exists := make(map[string]bool)
+	// Files that the push added rather than changed
+	added := make(map[string]bool)
+	var paths []string
+	distinct := false
+	for _, commit := range commits {
+		if commit == nil {
+			continue
+		}
+		distinct = distinct || commit.GetDistinct()
+		for _, change := range []struct {
+			paths  []string
+			exists bool
+			added  bool
+		}{{commit.Added, true, true}, {commit.Modified, true, false}, {commit.Removed, false, false}} {
+			for _, path := range change.paths {
+				if _, ok := exists[path]; !ok {
+					paths = append(paths, path)
+					added[path] = change.added
+				}
+				exists[path] = change.exists
+			}
+		}
+	}
+	for _, path := range paths {
+		switch {
+		case exists[path] && added[path]:
+			head.Added = append(head.Added, path)
+		case exists[path]:
+			head.Modified = append(head.Modified, path)
+		default:
+			head.Removed = append(head.Removed, path)
+		}
+	}
+	head.Distinct = &distinct
+	return &head
+}
+
+// Render the note of a report whose commit stands for a whole push
+func overflowNote(commit *Commit) string {
+	if commit.Import {
+		return importNote(commit)
+	}
+	if commit.Collapsed == 0 {
+		return ""
+	}
+	return fmt.Sprintf("**Note:** this push has %d commits, more than are checked one by one. "+
+		"The files changed by all of them were checked at %s instead.\n\n", commit.Collapsed, shortSHA(commit.SHA))
+}
+
+// Check a push with too many commits at its head commit. The other commits
+// are reported as skipped, those a truncated payload omits are counted as
+// skipped without being fetched.
+func (watchdog *WatchDog) checkCollapsed(ctx context.Context, event *github.PushEvent, size int, result *PushResult) {
+	log.Printf("checking the %d commits of a push to '%s' at the head commit\n", size, event.GetRepo().GetFullName())
+	if omitted := size - len(event.Commits); omitted > 0 {
+		skippedCommits.Add(float64(omitted), "too many commits")
+	}
+	last := len(event.Commits) - 1
+	for i, commit := range event.Commits[:last] {
+		skippedCommits.Inc("too many commits")
+		result.Commits[i] = &CommitResult{SHA: commit.GetID(), Skipped: true, SkipReason: "too many commits"}
+		result.retries.report(result.Commits[i])
+	}
+	result.Commits[last] = watchdog.checkCommit(ctx, event, collapseCommits(event.Commits), size, false, 1, result.retries)
+	result.retries.report(result.Commits[last])
+}
+
+// Complete the commits of a push whose payload was truncated: the commits
+// between before and after that the payload omits are compared and
+// fetched, so that they are checked too. Pushes that create a branch are
+// compared with the default branch. Commits that can't be fetched are
+// counted in result.MissingCommits.
+func (watchdog *WatchDog) completeCommits(ctx context.Context, event *github.PushEvent, result *PushResult) *github.PushEvent {
+	size := event.GetSize()
+	if size <= len(event.Commits) || len(event.Commits) == 0 {
+		return event
+	}
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	missing := func(err error) *github.PushEvent {
+		log.Printf("could not list the %d commits omitted from the payload of a push to '%s': %v\n", size-len(event.Commits), event.GetRepo().GetFullName(), err)
+		skippedCommits.Add(float64(size-len(event.Commits)), "truncated payload")
+		result.MissingCommits = size - len(event.Commits)
+		return event
+	}
+
+	base := event.GetBefore()
+	if strings.Trim(base, "0") == "" {
+		base = event.GetRepo().GetDefaultBranch()
+	}
+	if base == "" {
+		return missing(fmt.Errorf("no commit to compare the new branch with"))
+	}
+	shas, total, err := watchdog.scm.CompareCommits(ctx, owner, repo, base, event.GetAfter())
+	if err != nil {
+		return missing(err)
+	}
+	listed := make(map[string]*github.HeadCommit, len(event.Commits))
+	for _, commit := range event.Commits {
+		listed[commit.GetID()] = commit
+	}
+	commits := make([]*github.HeadCommit, 0, len(shas))
+	for _, sha := range shas {
+		if commit, ok := listed[sha]; ok {
+			commits = append(commits, commit)
+			delete(listed, sha)
+			continue
+		}
+		c, err := watchdog.scm.GetCommit(ctx, owner, repo, sha)
+		if err != nil {
+			return missing(fmt.Errorf("could not get commit '%s': %w", sha, err))
+		}
+		// The comparison lists the commits that are new to the branch, or
+		// to the default branch for new branches. Those the payload lists
+		// keep their own distinct flag.
+		commits = append(commits, &github.HeadCommit{
+			ID:       github.String(c.SHA),
+			Distinct: github.Bool(true),
+			Added:    c.Added,
+			Modified: c.Modified,
+			Removed:  c.Removed,
+			Author:   &github.CommitAuthor{Login: github.String(c.Author), Email: github.String(c.AuthorEmail)},
+		})
+	}
+	fetched := len(commits) - (len(event.Commits) - len(listed))
+	if total <= len(shas) && len(listed) > 0 {
+		return missing(fmt.Errorf("the comparison lacks %d commits of the payload", len(listed)))
+	}
+	if total > len(shas) {
+		// GitHub compares at most 250 commits, the oldest. The payload's
+		// commits are the newest, the ones in between are not checked.
+		for _, commit := range event.Commits {
+			if _, ok := listed[commit.GetID()]; ok {
+				commits = append(commits, commit)
+			}
+		}
+		skippedCommits.Add(float64(total-len(commits)), "truncated payload")
+		result.MissingCommits = total - len(commits)
+		log.Printf("checking %d of the %d commits of a push to '%s'\n", len(commits), total, event.GetRepo().GetFullName())
+	}
+	log.Printf("fetched the %d commits omitted from the payload of a push to '%s'\n", fetched, event.GetRepo().GetFullName())
+
+	complete := *event
+	complete.Commits = commits
+	return &complete
+}
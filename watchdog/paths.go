@@ -0,0 +1,23 @@
+package watchdog
+
+import (
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize a path to Unicode NFC. Git stores file names as bytes, and
+// macOS writes names like "Café.psd" decomposed (NFD), so they would not
+// match the same name written composed (NFC) in a configuration file.
+func normalizePath(p string) string {
+	return norm.NFC.String(p)
+}
+
+// Create a filter that matches paths regardless of their Unicode normal
+// form. Paths must be passed through normalizePath before matching.
+func newPathFilter(patterns []string) *filepathfilter.Filter {
+	normalized := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		normalized[i] = normalizePath(pattern)
+	}
+	return filepathfilter.New(normalized, nil)
+}
@@ -0,0 +1,40 @@
+package watchdog
+
+// PreviewFile is a sample file of a comment preview
+type PreviewFile struct {
+	Path string
+	// Size in bytes, files without a size are just above their threshold
+	Size int
+}
+
+// PreviewComment renders the comment a push of the given files would get
+// with config, so that a configuration can be tried without pushing
+// violating files. It returns an empty string if no file is a candidate.
+func PreviewComment(config *Config, files []PreviewFile, author string) (string, error) {
+	var findings []Finding
+	for _, file := range files {
+		size := file.Size
+		if size <= 0 {
+			threshold := config.LFSSizeThreshold
+			if exempt, ok := config.exemptionThreshold(file.Path); ok {
+				threshold = exempt
+			}
+			if threshold == unlimitedSize {
+				continue
+			}
+			size = threshold + 1
+		}
+		finding, violates := evaluateFile(config, file.Path, size)
+		if !violates {
+			continue
+		}
+		if _, suppressed := config.suppression(finding); suppressed {
+			continue
+		}
+		findings = append(findings, finding)
+	}
+	if len(findings) == 0 {
+		return "", nil
+	}
+	return (&WatchDog{}).createComment("preview", config, findings, author)
+}
@@ -0,0 +1,125 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// PullRequestCheckRunName is the name of the check run that summarizes a
+// pull request
+const PullRequestCheckRunName = "LFSWatchDog pull request"
+
+var pullRequestChecks = metrics.NewCounter("lfswatchdog_pull_request_checks_total", "Pull requests checked as a whole.", "conclusion")
+
+// PullRequestRequest is a pull request that was opened or received new
+// commits
+type PullRequestRequest struct {
+	Owner  string
+	Repo   string
+	Number int
+}
+
+// CheckPullRequest evaluates all files that a pull request adds or
+// modifies compared to its base branch at its head commit, and summarizes
+// the findings with a single check run, which reviewers see next to the
+// pull request. It returns nil if pullRequestChecksEnabled is off.
+func (watchdog *WatchDog) CheckPullRequest(ctx context.Context, request PullRequestRequest) (*CommitResult, error) {
+	changes, err := watchdog.scm.ListPullRequestFiles(ctx, request.Owner, request.Repo, request.Number)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the files of pull request #%d: %w", request.Number, err)
+	}
+
+	// Repositories without a configuration use the defaults, which don't
+	// check pull requests. If the configuration can't be read, the opt-in
+	// is unknown and no check run is created.
+	config, err := watchdog.getWatchDogConfig(ctx, request.Owner, request.Repo, changes.SHA)
+	if err != nil {
+		return nil, fmt.Errorf("could not obtain the configuration of pull request #%d: %w", request.Number, err)
+	}
+	settings, _ := GetInstallationSettings(watchdog.installationID)
+	config = settings.apply(config)
+	if !config.PullRequestChecksEnabled {
+		return nil, nil
+	}
+
+	// The commits of the pull request were reported when they were
+	// pushed, so the pull request is only reported with its check run
+	commit := &Commit{
+		Owner:       request.Owner,
+		Repo:        request.Repo,
+		SHA:         changes.SHA,
+		Added:       changes.Added,
+		Modified:    changes.Modified,
+		Removed:     changes.Removed,
+		Author:      changes.Author,
+		AuthorEmail: changes.AuthorEmail,
+		StatusOnly:  true,
+	}
+	checkedAt := shortSHA(commit.SHA)
+	var mergeErr error
+	if config.PullRequestMergeChecksEnabled {
+		merge, err := watchdog.getMergeCommit(ctx, request)
+		switch {
+		case err != nil:
+			mergeErr = fmt.Errorf("could not get the merge commit of pull request #%d: %w", request.Number, err)
+		case merge == nil:
+			checkedAt += ", its head, as GitHub could not merge it into its base branch"
+		default:
+			commit.SHA = merge.SHA
+			commit.Added, commit.Modified, commit.Removed = merge.Added, merge.Modified, merge.Removed
+			checkedAt = fmt.Sprintf("%s, the result of merging it into its base branch", shortSHA(merge.SHA))
+		}
+	}
+	log.Printf("checking the %d files of pull request #%d in '%s'\n", len(commit.Files()), request.Number, commit.FullName())
+	result := watchdog.evaluate(ctx, commit, config)
+	if mergeErr != nil {
+		result.Errors = append([]error{mergeErr}, result.Errors...)
+	}
+
+	note := fmt.Sprintf("**Pull request #%d** adds or modifies %d %s compared to its base branch, all of them were checked at %s.\n\n",
+		request.Number, len(commit.Files()), pluralize(len(commit.Files()), "file", "files"), checkedAt)
+	contact := watchdog.resolveHelpContact(ctx, commit, config.HelpContact)
+	run := watchdog.newCheckRun(request.Owner, request.Repo, commit.SHA, note, result.Findings, result.Errors, contact)
+	run.Name = PullRequestCheckRunName
+	// Check runs of merge commits wouldn't show on the pull request
+	run.HeadSHA = changes.SHA
+	pullRequestChecks.Inc(run.Conclusion)
+	if DryRun() || settings.DryRun {
+		log.Printf("dry-run: would create the check run '%s' for pull request #%d in '%s' (%s: %s)\n", run.Name, request.Number, commit.FullName(), run.Conclusion, run.Title)
+		return result, nil
+	}
+	err = watchdog.scm.CreateCheckRun(ctx, request.Owner, request.Repo, run)
+	result.Actions = append(result.Actions, Action{Type: "check", Detail: run.Name, Err: err})
+	if err != nil {
+		return result, fmt.Errorf("could not create the check run of pull request #%d: %w", request.Number, err)
+	}
+	return result, nil
+}
+
+// Get the merge commit of a pull request with the files it changes compared
+// to its first parent, the base branch. GitHub creates it in the
+// background, so it is requested again a few times. Returns nil if GitHub
+// can't merge the pull request.
+func (watchdog *WatchDog) getMergeCommit(ctx context.Context, request PullRequestRequest) (*scm.Commit, error) {
+	delay := lookupRetryDelay
+	for attempt := 1; ; attempt++ {
+		sha, err := watchdog.scm.GetPullRequestMergeCommit(ctx, request.Owner, request.Repo, request.Number)
+		if err != nil {
+			return nil, err
+		}
+		if sha != "" {
+			return watchdog.scm.GetCommit(ctx, request.Owner, request.Repo, sha)
+		}
+		if attempt > maxLookupRetries {
+			return nil, nil
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		delay *= 2
+	}
+}
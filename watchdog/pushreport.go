@@ -0,0 +1,116 @@
+package watchdog
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// ReportStore keeps the report of every checked push under a stable URL,
+// which commit statuses link to even if comments are disabled
+type ReportStore interface {
+	// URL returns the URL of the report of a push, which is known before
+	// the report is saved
+	URL(repo, sha string) string
+	// Save stores the Markdown report of a push
+	Save(repo, sha string, report []byte) error
+}
+
+var reportStore = struct {
+	sync.RWMutex
+	store ReportStore
+}{}
+
+// SetReportStore stores a report of every checked push and links it from
+// the commit statuses. A nil store disables the reports.
+func SetReportStore(store ReportStore) {
+	reportStore.Lock()
+	defer reportStore.Unlock()
+	reportStore.store = store
+}
+
+func currentReportStore() ReportStore {
+	reportStore.RLock()
+	defer reportStore.RUnlock()
+	return reportStore.store
+}
+
+// Return the URL of the report of a push, or "" if reports are not stored
+func pushReportURL(event *github.PushEvent) string {
+	store := currentReportStore()
+	if store == nil || event.GetAfter() == "" {
+		return ""
+	}
+	return store.URL(event.GetRepo().GetFullName(), event.GetAfter())
+}
+
+// Store the report of a checked push
+func (watchdog *WatchDog) savePushReport(event *github.PushEvent, result *PushResult) {
+	store := currentReportStore()
+	if store == nil || event.GetAfter() == "" {
+		return
+	}
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	report := renderPushReport(result, func(sha, path string) string {
+		return watchdog.scm.FileURL(owner, repo, sha, path)
+	})
+	if err := store.Save(result.Repo, event.GetAfter(), []byte(report)); err != nil {
+		log.Printf("could not store the report of '%s' in '%s': %v\n", event.GetAfter(), result.Repo, err)
+	}
+}
+
+// Render the Markdown report of all commits of a push. Files are linked if
+// fileURL returns their web URL.
+func renderPushReport(result *PushResult, fileURL func(sha, path string) string) string {
+	var withFindings int
+	for _, commit := range result.Commits {
+		if len(commit.Findings) > 0 {
+			withFindings++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Git LFS report of a push to %s in %s\n\n", codeSpan(result.Ref), codeSpan(result.Repo))
+	fmt.Fprintf(&b, "%d %s checked, %d with findings.\n", len(result.Commits), pluralize(len(result.Commits), "commit", "commits"), withFindings)
+	if result.MissingCommits > 0 {
+		fmt.Fprintf(&b, "\n%d more %s of the push could not be fetched and %s not checked.\n",
+			result.MissingCommits, pluralize(result.MissingCommits, "commit", "commits"), pluralize(result.MissingCommits, "was", "were"))
+	}
+	for _, commit := range result.Commits {
+		if commit == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## Commit %s\n\n", codeSpan(shortSHA(commit.SHA)))
+		if commit.Skipped {
+			fmt.Fprintf(&b, "Not evaluated: %s.\n", commit.SkipReason)
+			continue
+		}
+		if !commit.RetryAt.IsZero() {
+			fmt.Fprintf(&b, "The check was rate limited and is retried at %s, the findings are incomplete.\n\n", commit.RetryAt.Format(time.RFC3339))
+		}
+		if commit.TimedOut {
+			b.WriteString("The evaluation timed out, the findings are incomplete.\n\n")
+		}
+		if len(commit.Errors) > 0 {
+			b.WriteString(checkRunErrors(commit.Errors))
+		}
+		if len(commit.Findings) == 0 {
+			b.WriteString("No files need to be tracked with Git LFS.\n")
+			continue
+		}
+		b.WriteString("| File | Rule | Severity | Size |\n|---|---|---|---:|\n")
+		for _, finding := range commit.Findings {
+			file := codeSpan(finding.Path)
+			if url := fileURL(commit.SHA, finding.Path); url != "" {
+				file = fmt.Sprintf("[%s](%s)", file, url)
+			}
+			rule, _ := LookupRule(finding.Rule)
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", tableCell(file), tableCell(rule.String()), finding.Severity, formatSize(finding.Size))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// Report whether a push changed the configuration file on the default
+// branch. Pushes that delete the branch have no head to evaluate.
+func configChanged(event *github.PushEvent) bool {
+	defaultBranch := event.GetRepo().GetDefaultBranch()
+	if defaultBranch == "" || event.GetRef() != "refs/heads/"+defaultBranch {
+		return false
+	}
+	if event.GetDeleted() || strings.Trim(event.GetAfter(), "0") == "" {
+		return false
+	}
+	for _, commit := range event.Commits {
+		for _, paths := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, path := range paths {
+				if path == configFile {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Evaluate all files at the head of the default branch again if the push
+// changed the configuration and the new one asks for it, so that a
+// tightened policy shows in the status and check run of the branch head
+// right away. Comments are left to the commits that add the files.
+func (watchdog *WatchDog) reevaluateHead(ctx context.Context, event *github.PushEvent, result *PushResult) {
+	if !configChanged(event) || isImport(event) {
+		return
+	}
+	owner, repo, head := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), event.GetAfter()
+	config, err := watchdog.getWatchDogConfig(ctx, owner, repo, head)
+	if err != nil || !config.ReevaluateOnConfigChange {
+		return
+	}
+
+	files, err := watchdog.headFiles(ctx, event)
+	if err != nil {
+		log.Printf("could not list the files of '%s' in '%s' to evaluate them again: %v\n", head, event.GetRepo().GetFullName(), err)
+		result.Reevaluated = &CommitResult{SHA: head, Errors: []error{fmt.Errorf("could not list the files: %w", err)}}
+		return
+	}
+	log.Printf("the configuration of '%s' changed, evaluating the %d files at '%s' again\n", event.GetRepo().GetFullName(), len(files), head)
+	headCommit := &github.HeadCommit{ID: &head, Added: files}
+	if event.HeadCommit != nil {
+		headCommit.Author = event.HeadCommit.Author
+	}
+	result.Reevaluated = watchdog.checkCommit(ctx, event, headCommit, 0, true, 1, result.retries)
+}
+
+// Render the note of a report whose commit was evaluated again with all
+// its files
+func reevaluationNote(commit *Commit) string {
+	if !commit.Reevaluated {
+		return ""
+	}
+	return fmt.Sprintf("**Note:** `%s` changed, so all files at %s were checked again with the new configuration.\n\n", configFile, shortSHA(commit.SHA))
+}
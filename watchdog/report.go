@@ -0,0 +1,280 @@
+package watchdog
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Reporter publishes the evaluation of a commit
+type Reporter interface {
+	// Start is called before a commit is evaluated
+	Start(commit *Commit, config *Config) []Action
+	// Report is called with the result of an evaluated commit. The result
+	// has findings and errors, but no actions yet.
+	Report(commit *Commit, config *Config, result *CommitResult) []Action
+}
+
+// resolutionReporter is implemented by reporters that publish findings
+// resolved by a later commit
+type resolutionReporter interface {
+	Resolve(commit *Commit, config *Config, resolved []violation) []Action
+}
+
+// retryReporter is implemented by reporters that publish that a check
+// could not complete and will be retried
+type retryReporter interface {
+	Retry(commit *Commit, config *Config, at time.Time) []Action
+}
+
+// gitHubReporter posts commit comments and statuses
+type gitHubReporter struct {
+	watchdog *WatchDog
+}
+
+func (r *gitHubReporter) Start(commit *Commit, config *Config) []Action {
+	if !config.LFSCommitStatusEnabled {
+		return nil
+	}
+
+	var actions []Action
+	for _, group := range statusGroups(config, nil) {
+		err := r.watchdog.pendingCommitStatus(commit.Owner, commit.Repo, commit.SHA, group.context, commit.ReportURL)
+		if err != nil {
+			log.Printf("could not set a pending '%s' status for '%s': %v\n", group.context, commit.FullName(), err)
+			// If we can't update the status to "pending",
+			// we nevertheless attempt adding comments and updating status to
+			// "success" or "failure".
+		}
+		actions = append(actions, Action{Type: "status", Detail: "pending", Err: err})
+	}
+	return actions
+}
+
+func (r *gitHubReporter) Report(commit *Commit, config *Config, result *CommitResult) []Action {
+	var actions []Action
+	findings := result.Findings
+	if config.DifferentialReporting {
+		findings = newFindings(findings)
+	}
+	// Coached authors get a check run even if check runs are disabled
+	coaching := len(findings) > 0 && !commit.StatusOnly && !commit.Import && coached(commit, config)
+
+	if config.LFSChecksEnabled || coaching {
+		note := overflowNote(commit) + reevaluationNote(commit) + timeoutNote(result)
+		if coaching {
+			note += coachingNote(config)
+		}
+		err := r.watchdog.createCheckRun(commit.Owner, commit.Repo, commit.SHA, note, result.Findings, result.Errors, config.HelpContact)
+		actions = append(actions, Action{Type: "check", Detail: checkRunName, Err: err})
+	}
+
+	if config.LFSCommitStatusEnabled {
+		actions = append(actions, r.reportStatuses(commit, config, result)...)
+	}
+
+	if config.DifferentialReporting && len(findings) == 0 && len(result.Findings) > 0 {
+		log.Printf("not commenting on '%s' in '%s': all findings were reported on the branch before\n", commit.SHA, commit.FullName())
+	}
+
+	if len(findings) == 0 || commit.StatusOnly {
+		return actions
+	}
+	if coaching {
+		log.Printf("not commenting on '%s' in '%s': coaching its author with the check run\n", commit.SHA, commit.FullName())
+		return actions
+	}
+
+	log.Printf("detected potential Git LFS files in '%s'\n", commit.FullName())
+
+	var author string
+	if config.MentionAuthor {
+		author = r.watchdog.resolveAuthor(context.Background(), commit)
+	}
+
+	comment, err := r.watchdog.createComment(commit.FullName(), config, findings, author)
+	if err != nil {
+		log.Printf("could not create the LFSWatchdog comment for '%s' in '%s': %v\n", commit.SHA, commit.FullName(), err)
+		// We can't create the comment, no sense trying to post it.
+		return append(actions, Action{Type: "comment", Err: err})
+	}
+
+	if commit.Import {
+		url, err := r.watchdog.openImportIssue(commit, overflowNote(commit)+timeoutNote(result)+comment)
+		if err != nil {
+			log.Printf("could not open the audit issue for '%s' in '%s': %v\n", commit.SHA, commit.FullName(), err)
+		}
+		actions = append(actions, Action{Type: "issue", Detail: url, Err: err})
+	} else {
+		footer := newCommentFooter(config, findingRules(findings))
+		comment, err = r.watchdog.postCommentWithCooldown(commit, config, overflowNote(commit)+timeoutNote(result)+comment, footer)
+		if err != nil {
+			log.Printf("could not post the LFSWatchdog comment for '%s' in '%s': %v\n", commit.SHA, commit.FullName(), err)
+		}
+		actions = append(actions, Action{Type: "comment", Detail: comment, Err: err})
+	}
+
+	// Fixes are proposed once per push, see proposeFix
+	if config.LFSAttributesPullRequestEnabled && !config.LFSFixPullRequestEnabled {
+		url, err := r.watchdog.proposeAttributes(context.Background(), commit, findings)
+		if err != nil {
+			log.Printf("could not propose Git LFS patterns for '%s' in '%s': %v\n", commit.SHA, commit.FullName(), err)
+		}
+		if url != "" || err != nil {
+			actions = append(actions, Action{Type: "pull_request", Detail: url, Err: err})
+		}
+	}
+	return actions
+}
+
+func (r *gitHubReporter) Resolve(commit *Commit, config *Config, resolved []violation) []Action {
+	if !config.ResolvedCommentEnabled || commit.StatusOnly {
+		return nil
+	}
+
+	rules := make([]string, len(resolved))
+	for i, v := range resolved {
+		rules[i] = v.Rule
+	}
+	comment := withFooter(resolvedComment(resolved), newCommentFooter(config, rules))
+	err := r.watchdog.postComment(commit.Owner, commit.Repo, commit.SHA, &comment)
+	if err != nil {
+		log.Printf("could not post the resolved comment for '%s' in '%s': %v\n", commit.SHA, commit.FullName(), err)
+	}
+	return []Action{{Type: "comment", Detail: comment, Err: err}}
+}
+
+func (r *gitHubReporter) Retry(commit *Commit, config *Config, at time.Time) []Action {
+	if !config.LFSCommitStatusEnabled {
+		return nil
+	}
+
+	var actions []Action
+	for _, group := range statusGroups(config, nil) {
+		// This likely fails while the installation is rate limited, but
+		// secondary rate limits may still let it through
+		err := r.watchdog.updateCommitStatusContext(commit.Owner, commit.Repo, commit.SHA, group.context, "error", "check could not complete, will retry", commit.ReportURL)
+		if err != nil {
+			log.Printf("could not update '%s' with an error '%s' status: %v\n", commit.FullName(), group.context, err)
+		}
+		actions = append(actions, Action{Type: "status", Detail: "error", Err: err})
+	}
+	return actions
+}
+
+// statusGroup is a commit status context and the findings reported under it
+type statusGroup struct {
+	context  string
+	findings []Finding
+}
+
+// statusGroups splits findings into one group per rule family if
+// CommitStatusPerRule is set, or a single group with the legacy context
+func statusGroups(config *Config, findings []Finding) []statusGroup {
+	if !config.CommitStatusPerRule {
+		return []statusGroup{{context: defaultStatusContext, findings: findings}}
+	}
+
+	var groups []statusGroup
+	for _, family := range config.families() {
+		group := statusGroup{context: "watchdog/" + family}
+		for _, finding := range findings {
+			if ruleFamily(finding.Rule) == family {
+				group.findings = append(group.findings, finding)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// Set the failure state for policy violations, but the error state if the
+// watchdog could not evaluate the commit completely, so that users can tell
+// a blocked change from an infrastructure problem. Checks that timed out
+// always get the error state, their findings are incomplete.
+func (r *gitHubReporter) reportStatuses(commit *Commit, config *Config, result *CommitResult) []Action {
+	errs := result.Errors
+	var actions []Action
+	for _, group := range statusGroups(config, result.Findings) {
+		if result.TimedOut {
+			err := r.watchdog.updateCommitStatusContext(commit.Owner, commit.Repo, commit.SHA, group.context, "error", timeoutDescription, commit.ReportURL)
+			if err != nil {
+				log.Printf("could not update '%s' with an error '%s' status: %v\n", commit.FullName(), group.context, err)
+			}
+			actions = append(actions, Action{Type: "status", Detail: "error", Err: err})
+			continue
+		}
+		if hasErrors(group.findings) {
+			err := r.watchdog.failCommitStatus(commit.Owner, commit.Repo, commit.SHA, group.context, commit.ReportURL, group.findings)
+			if err != nil {
+				log.Printf("could not update '%s' with a failed '%s' status: %v\n", commit.FullName(), group.context, err)
+			}
+			actions = append(actions, Action{Type: "status", Detail: "failure", Err: err})
+			continue
+		}
+		if len(errs) > 0 {
+			err := r.watchdog.updateCommitStatusContext(commit.Owner, commit.Repo, commit.SHA, group.context, "error", errorDescription(errs), commit.ReportURL)
+			if err != nil {
+				log.Printf("could not update '%s' with an error '%s' status: %v\n", commit.FullName(), group.context, err)
+			}
+			actions = append(actions, Action{Type: "status", Detail: "error", Err: err})
+			continue
+		}
+		// Warnings and notices are commented on, but don't fail the commit
+		err := r.watchdog.passCommitStatus(commit.Owner, commit.Repo, commit.SHA, group.context, commit.ReportURL)
+		if err != nil {
+			log.Printf("could not update '%s' with a success '%s' status: %v\n", commit.FullName(), group.context, err)
+		}
+		actions = append(actions, Action{Type: "status", Detail: "success", Err: err})
+	}
+	return actions
+}
+
+// DryRunReporter logs what would be reported without posting anything
+type DryRunReporter struct{}
+
+func (DryRunReporter) Start(commit *Commit, config *Config) []Action {
+	return nil
+}
+
+func (DryRunReporter) Report(commit *Commit, config *Config, result *CommitResult) []Action {
+	if commit.Import && len(result.Findings) > 0 {
+		log.Printf("dry-run: would open an audit issue with %d findings in '%s'\n", len(result.Findings), commit.FullName())
+	}
+	for _, finding := range result.Findings {
+		if finding.Rule == RuleLockedFile {
+			log.Printf("dry-run: '%s' at '%s' in '%s' is locked by '%s'\n", finding.Path, commit.SHA, commit.FullName(), finding.LockedBy)
+			continue
+		}
+		if finding.Rule == RuleSymlink {
+			log.Printf("dry-run: '%s' at '%s' in '%s' is a symlink to '%s'\n", finding.Path, commit.SHA, commit.FullName(), finding.Target)
+			continue
+		}
+		if finding.Rule == RuleBinaryChurn {
+			log.Printf("dry-run: binary '%s' at '%s' in '%s' changed %d times\n", finding.Path, commit.SHA, commit.FullName(), finding.Changes)
+			continue
+		}
+		if finding.Rule == RuleVendoredPointer {
+			log.Printf("dry-run: '%s' at '%s' in '%s' is a Git LFS pointer in a vendored directory\n", finding.Path, commit.SHA, commit.FullName())
+			continue
+		}
+		if finding.Rule == RuleBuildOutput {
+			log.Printf("dry-run: '%s' at '%s' in '%s' is a compiled binary (%s)\n", finding.Path, commit.SHA, commit.FullName(), finding.Format)
+			continue
+		}
+		if finding.Rule == RuleBypassedLFS {
+			log.Printf("dry-run: '%s' at '%s' in '%s' bypassed Git LFS\n", finding.Path, commit.SHA, commit.FullName())
+			continue
+		}
+		if finding.Rule == RuleOversizeLFSObject {
+			log.Printf("dry-run: Git LFS object of '%s' at '%s' in '%s' is larger than %d bytes\n", finding.Path, commit.SHA, commit.FullName(), finding.Threshold)
+			continue
+		}
+		if ruleFamily(finding.Rule) == "submodule" {
+			log.Printf("dry-run: submodule '%s' at '%s' in '%s' violates %s\n", finding.Path, commit.SHA, commit.FullName(), finding.Rule)
+			continue
+		}
+		log.Printf("dry-run: '%s' at '%s' in '%s' is larger than %d bytes\n", finding.Path, commit.SHA, commit.FullName(), finding.Threshold)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package watchdog
+
+import (
+	"sync"
+	"time"
+)
+
+// PushResult is the outcome of checking all commits of a push
+type PushResult struct {
+	Repo    string
+	Ref     string
+	Commits []*CommitResult
+	// Reevaluated is the head of the default branch, evaluated again with
+	// all its files because the push changed the configuration
+	Reevaluated *CommitResult `json:",omitempty"`
+	// MissingCommits is the number of commits that the truncated payload
+	// of the push omitted and that could not be fetched, they were not
+	// checked
+	MissingCommits int `json:",omitempty"`
+
+	retries *retryGroup
+}
+
+// WaitRetries blocks until the commits of the push that were rate limited
+// have been checked again
+func (r *PushResult) WaitRetries() {
+	if r.retries != nil {
+		r.retries.Wait()
+	}
+}
+
+// retryGroup tracks the rate limited commits of a push until they have been
+// checked again, and reports the final result of every commit to checked,
+// if not nil
+type retryGroup struct {
+	sync.WaitGroup
+	checked func(*CommitResult)
+}
+
+// Report the result of a commit unless it will be checked again
+func (r *retryGroup) report(result *CommitResult) {
+	if r != nil && r.checked != nil && result.RetryAt.IsZero() {
+		r.checked(result)
+	}
+}
+
+// CommitResult is the outcome of checking a single commit
+type CommitResult struct {
+	SHA string
+	// Skipped is set if the commit was not evaluated, see SkipReason
+	Skipped    bool
+	SkipReason string
+	// Findings lists the files that should be tracked with Git LFS
+	Findings []Finding
+	// Suppressed lists findings that are suppressed by the configuration.
+	// They are recorded for audit purposes, but not reported.
+	Suppressed []Finding
+	// Resolved lists findings of earlier commits that this commit resolved
+	Resolved []Finding
+	// Actions lists the comments and statuses the watchdog attempted to post
+	Actions []Action
+	// Errors lists problems that occurred while evaluating the commit
+	Errors []error
+	// RetryAt is set if the check was rate limited and will be retried
+	RetryAt time.Time `json:",omitempty"`
+	// TimedOut is set if the check ran out of time, the findings are
+	// incomplete
+	TimedOut bool `json:",omitempty"`
+	// Timings records when the stages of the check finished
+	Timings Timings
+	// Trace records how each file was evaluated while debug logging is on
+	Trace []FileTrace `json:",omitempty"`
+
+	// Files that were measured and don't violate the policy
+	cleared []string
+	// Modified files that count towards binary churn
+	changed []string
+}
+
+// Timings are the times at which the stages of a commit check finished.
+// Stages that did not run are zero.
+type Timings struct {
+	Started       time.Time
+	ConfigFetched time.Time
+	SizesFetched  time.Time
+	Reported      time.Time
+}
+
+// Finding is a file that violates the LFS policy
+type Finding struct {
+	Path string
+	Size int
+	// Threshold is the size limit the file exceeded
+	Threshold int
+	Rule      string
+	Severity  string
+	// LockedBy is the owner of the Git LFS lock of a locked-file finding
+	LockedBy string `json:",omitempty"`
+	// Target is the target of a symlink finding or the URL of a submodule
+	// finding
+	Target string `json:",omitempty"`
+	// Commit is the missing commit of an unknown-submodule-commit finding
+	Commit string `json:",omitempty"`
+	// Changes is the number of modifications of a binary-churn finding
+	// within the churn window
+	Changes int `json:",omitempty"`
+	// Format is the binary format of an extensionless file, detected by its
+	// magic number
+	Format string `json:",omitempty"`
+	// SuppressionReason is the configured reason of a suppressed finding
+	SuppressionReason string `json:",omitempty"`
+	// PreExisting is set if the file was reported on the branch before
+	PreExisting bool `json:",omitempty"`
+	// Modified is set if the commit modified the file rather than adding
+	// it, so that earlier versions are in the history already
+	Modified bool `json:",omitempty"`
+}
+
+// Action is a mutation the watchdog attempted on GitHub
+type Action struct {
+	// Type is "status", "comment", "check", "pull_request" or "issue"
+	Type string
+	// Detail is the status state, the comment body or the pull request or
+	// issue URL
+	Detail string
+	// Err is set if the action failed
+	Err error
+}
+
+// Failed reports whether any commit has findings with error severity
+func (result *PushResult) Failed() bool {
+	for _, commit := range result.Commits {
+		if hasErrors(commit.Findings) {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns all errors that occurred while checking the push
+func (result *PushResult) Errors() []error {
+	var errs []error
+	for _, commit := range result.Commits {
+		errs = append(errs, commit.Errors...)
+		for _, action := range commit.Actions {
+			if action.Err != nil {
+				errs = append(errs, action.Err)
+			}
+		}
+	}
+	return errs
+}
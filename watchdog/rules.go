@@ -0,0 +1,359 @@
+package watchdog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Stable IDs of all rules. IDs never change or get reused, so they can be
+// referenced in suppressions, reports and support requests.
+const (
+	// Files larger than the size threshold that should be tracked with Git LFS
+	RuleOversizeFile = "LFS001"
+	// Files locked with Git LFS by someone other than the author or pusher
+	RuleLockedFile = "LFS002"
+	// Symlinks, depending on the symlinks option
+	RuleSymlink = "LFS003"
+	// Submodules added by a commit
+	RuleNewSubmodule = "LFS004"
+	// Submodules with URLs outside the allowed hosts
+	RuleSubmoduleURL = "LFS005"
+	// Submodules pointing to commits their repository doesn't have
+	RuleSubmoduleCommit = "LFS006"
+	// Binary files below the size threshold that are modified often
+	RuleBinaryChurn = "LFS007"
+	// Git LFS objects larger than the object size threshold
+	RuleOversizeLFSObject = "LFS008"
+	// Git LFS pointers in vendored directories
+	RuleVendoredPointer = "LFS009"
+	// Extensionless files that are compiled binaries
+	RuleBuildOutput = "LFS010"
+	// Files tracked with Git LFS by .gitattributes that are no pointers
+	RuleBypassedLFS = "LFS011"
+)
+
+// Severities of findings. Only errors fail the commit status or check run.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNotice  = "notice"
+)
+
+// RuleInfo describes a rule
+type RuleInfo struct {
+	ID string `json:"id"`
+	// Name is a human readable alias of the ID
+	Name string `json:"name"`
+	// Family groups related rules, e.g. for commit status contexts
+	Family          string `json:"family"`
+	Summary         string `json:"summary"`
+	Description     string `json:"description"`
+	DefaultSeverity string `json:"defaultSeverity"`
+	// Optional rules are only evaluated if enabled in the rules section
+	Optional bool `json:"optional,omitempty"`
+	// Headline introduces the findings of the rule in comments. It is a
+	// template of the comment group, e.g. for its threshold.
+	Headline string `json:"-"`
+	// Remediation is appended to every finding of the rule in comments. It
+	// is a template of the Finding.
+	Remediation string `json:"-"`
+
+	// enabled reports whether a rule that predates the rules section is
+	// enabled by its own option
+	enabled func(config *Config) bool
+}
+
+var ruleRegistry = []RuleInfo{
+	{
+		ID:      RuleOversizeFile,
+		Name:    "oversize-file",
+		Family:  "lfs",
+		Summary: "File is larger than the size threshold and should be tracked with Git LFS",
+		Description: "Large binary files bloat the repository because every version is kept forever and " +
+			"downloaded by every clone. Files larger than `lfsSizeThreshold` should be tracked with Git LFS. " +
+			"Files matching `lfsSizeExemptions` (typically large text files) are allowed up to " +
+			"`lfsSizeExemptionsThreshold` or the size given on their line.",
+		DefaultSeverity: SeverityError,
+		Headline: ":warning: The following {{ if .Exempt }}exempt {{ end }}files are larger than {{ .Threshold }} " +
+			"and may need to be tracked with [Git LFS](https://git-lfs.github.com/)",
+		Remediation: "{{ if .Modified }}: already in the history, rewrite it with {{ code (printf \"git lfs migrate import --include=%q\" .Path) }}" +
+			"{{ else }}: new, track it with {{ code (printf \"git lfs track --filename %q\" .Path) }} and amend the commit before merging{{ end }}",
+		enabled: func(config *Config) bool { return config.LFSSuggestionsEnabled },
+	},
+	{
+		ID:      RuleLockedFile,
+		Name:    "locked-file",
+		Family:  "lfs",
+		Summary: "File is locked with Git LFS by another user",
+		Description: "Binary files can't be merged, so teams lock them with `git lfs lock` while they " +
+			"edit them. Changes to a file that someone else locked will conflict with their work. " +
+			"Locks are read from the Git LFS locks API, which costs an API request per commit, so " +
+			"the rule has to be enabled in the `rules` section.",
+		DefaultSeverity: SeverityWarning,
+		Optional:        true,
+		Headline:        ":lock: The following files are locked with Git LFS by other users, coordinate your changes with them",
+	},
+	{
+		ID:      RuleSymlink,
+		Name:    "symlink",
+		Family:  "symlink",
+		Summary: "File is a symlink",
+		Description: "Symlinks pointing outside the repository break on other machines, and some build " +
+			"systems and Windows checkouts can't handle symlinks at all. The rule is enabled with the " +
+			"`symlinks` option: `warn` reports symlinks pointing outside the repository, `finding` " +
+			"reports all symlinks.",
+		DefaultSeverity: SeverityWarning,
+		Optional:        true,
+		Headline:        ":link: The following files are symlinks, which may not work on other machines",
+		enabled: func(config *Config) bool {
+			return config.Symlinks == SymlinksWarn || config.Symlinks == SymlinksFinding
+		},
+	},
+	{
+		ID:      RuleNewSubmodule,
+		Name:    "new-submodule",
+		Family:  "submodule",
+		Summary: "Submodule was added",
+		Description: "Submodules complicate cloning, building and mirroring a repository, so some teams " +
+			"review every new one. The rule has to be enabled in the `rules` section.",
+		DefaultSeverity: SeverityWarning,
+		Optional:        true,
+		Headline:        ":package: Submodule was added",
+	},
+	{
+		ID:      RuleSubmoduleURL,
+		Name:    "submodule-url",
+		Family:  "submodule",
+		Summary: "Submodule URL is not on an allowed host",
+		Description: "Submodules on external hosts break builds that can't reach them and may disappear. " +
+			"Relative URLs and URLs on this GitHub or on one of the `submoduleHosts` are allowed. " +
+			"The rule has to be enabled in the `rules` section.",
+		DefaultSeverity: SeverityError,
+		Optional:        true,
+		Headline:        ":package: Submodule URL is not on an allowed host",
+	},
+	{
+		ID:      RuleSubmoduleCommit,
+		Name:    "unknown-submodule-commit",
+		Family:  "submodule",
+		Summary: "Submodule points to a commit that its repository doesn't have",
+		Description: "A submodule pointer to a commit that was never pushed upstream can't be checked out " +
+			"by anyone else. Only submodules on this GitHub are checked, and the App needs read access " +
+			"to their repositories, otherwise they are reported as well. The rule costs an API request " +
+			"per changed submodule and has to be enabled in the `rules` section.",
+		DefaultSeverity: SeverityWarning,
+		Optional:        true,
+		Headline:        ":package: Submodule points to a commit that its repository doesn't have",
+	},
+	{
+		ID:      RuleBinaryChurn,
+		Name:    "binary-churn",
+		Family:  "lfs",
+		Summary: "Binary file changes often and should be tracked with Git LFS",
+		Description: "Every version of a binary file is kept forever, so a small binary file that changes " +
+			"often bloats the repository as much as a large one. Binary files below the size threshold " +
+			"that were modified `binaryChurnThreshold` times within `binaryChurnWindow` should be tracked " +
+			"with Git LFS. Modifications are counted in memory, or in the store of LFSWATCHDOG_STORE. " +
+			"The rule has to be enabled in the `rules` section.",
+		DefaultSeverity: SeverityWarning,
+		Optional:        true,
+		Headline:        ":repeat: The following binary files change often and may need to be tracked with [Git LFS](https://git-lfs.github.com/)",
+	},
+	{
+		ID:      RuleOversizeLFSObject,
+		Name:    "oversize-lfs-object",
+		Family:  "lfs",
+		Summary: "Git LFS object is larger than the object size threshold",
+		Description: "Files tracked with Git LFS are never reported as oversize files, but enormous assets " +
+			"still slow down checkouts and may exceed the storage limits of GitHub. Pointers to objects " +
+			"larger than `lfsObjectSizeThreshold` are reported if `reportOversizeLFSObjects` is set. " +
+			"The rule costs an API request per pointer-sized file.",
+		DefaultSeverity: SeverityWarning,
+		Optional:        true,
+		Headline:        ":elephant: The following Git LFS objects are larger than {{ .Threshold }}, consider splitting or compressing them",
+		enabled:         func(config *Config) bool { return config.ReportOversizeLFSObjects },
+	},
+	{
+		ID:      RuleVendoredPointer,
+		Name:    "vendored-lfs-pointer",
+		Family:  "lfs",
+		Summary: "File in a vendored directory is a Git LFS pointer",
+		Description: "Vendored copies are often consumed by builds that don't fetch Git LFS objects, which " +
+			"then get the pointer instead of the file and fail in confusing ways. Files in vendored " +
+			"directories should be committed without Git LFS. The rule is enabled by listing the " +
+			"vendored directories in `vendorPaths` and costs an API request per pointer-sized file.",
+		DefaultSeverity: SeverityError,
+		Optional:        true,
+		Headline: ":no_entry: The following files in vendored directories are Git LFS pointers, " +
+			"consumers without Git LFS only get the pointer",
+		enabled: func(config *Config) bool { return len(config.VendorPaths) > 0 },
+	},
+	{
+		ID:      RuleBuildOutput,
+		Name:    "build-output",
+		Family:  "lfs",
+		Summary: "Extensionless file is a compiled binary",
+		Description: "Executables and libraries are build outputs that belong in a package registry, not in " +
+			"the repository. They are often named without an extension and escape patterns like `*.exe`, " +
+			"so the first bytes of every extensionless file are read to detect ELF, PE, Mach-O, WebAssembly " +
+			"and static library files. The rule has to be enabled in the `rules` section and costs an " +
+			"API request per extensionless file.",
+		DefaultSeverity: SeverityError,
+		Optional:        true,
+		Headline:        ":no_entry: The following files are compiled binaries, publish build outputs to a package registry instead",
+	},
+	{
+		ID:      RuleBypassedLFS,
+		Name:    "bypassed-lfs",
+		Family:  "lfs",
+		Summary: "File matches a filter=lfs pattern but was committed without Git LFS",
+		Description: "Files committed on a machine without Git LFS, or with a client that ignores it, are " +
+			"stored in Git although `.gitattributes` tracks them with Git LFS. Other clones then report " +
+			"them as modified right after checkout. Files matching a `filter=lfs` pattern of the " +
+			"`.gitattributes` files of the commit must be Git LFS pointers. The rule costs an API request " +
+			"for the tree of every commit and per pointer-sized file, and has to be enabled in the " +
+			"`rules` section.",
+		DefaultSeverity: SeverityError,
+		Optional:        true,
+		Headline: ":no_entry: The following files bypassed Git LFS: `.gitattributes` tracks them with Git LFS, " +
+			"but they were committed without it",
+		Remediation: ": install Git LFS with `git lfs install`, then replace the file by a pointer with " +
+			"{{ code (printf \"git add --renormalize %q\" .Path) }} and commit",
+	},
+}
+
+// Parsed headlines and remediations of all rules by their text
+var ruleTemplates = parseRuleTemplates()
+
+func parseRuleTemplates() map[string]*template.Template {
+	templates := make(map[string]*template.Template)
+	for _, rule := range ruleRegistry {
+		for _, text := range []string{rule.Headline, rule.Remediation} {
+			templates[text] = template.Must(template.New(rule.ID).Funcs(template.FuncMap{"code": codeSpan}).Parse(text))
+		}
+	}
+	return templates
+}
+
+// Render the headline or remediation of a rule
+func (rule RuleInfo) render(text string, data interface{}) (string, error) {
+	var b strings.Builder
+	if err := ruleTemplates[text].Execute(&b, data); err != nil {
+		return "", fmt.Errorf("could not render a template of rule '%s': %v", rule, err)
+	}
+	return b.String(), nil
+}
+
+// Rules returns all known rules ordered by ID
+func Rules() []RuleInfo {
+	rules := append([]RuleInfo(nil), ruleRegistry...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// LookupRule finds a rule by ID or name
+func LookupRule(idOrName string) (RuleInfo, bool) {
+	for _, rule := range ruleRegistry {
+		if strings.EqualFold(rule.ID, idOrName) || rule.Name == idOrName {
+			return rule, true
+		}
+	}
+	return RuleInfo{}, false
+}
+
+// String returns e.g. "LFS001 oversize-file"
+func (rule RuleInfo) String() string {
+	return rule.ID + " " + rule.Name
+}
+
+// Explain renders a rule as Markdown
+func (rule RuleInfo) Explain() string {
+	explanation := fmt.Sprintf("## %s\n\n%s.\n\n%s\n\nDefault severity: %s\n", rule, rule.Summary, rule.Description, rule.DefaultSeverity)
+	if rule.Optional {
+		explanation += "\nDisabled by default.\n"
+	}
+	return explanation
+}
+
+// RuleConfig enables, disables and grades a rule for a repository
+type RuleConfig struct {
+	// Enabled defaults to true if unset
+	Enabled  *bool  `yaml:"enabled"`
+	Severity string `yaml:"severity"`
+}
+
+// Check that all configured rules and severities are known and key the
+// rule settings by rule ID
+func (config *Config) validateRules() error {
+	rules := make(map[string]RuleConfig, len(config.Rules))
+	for idOrName, ruleConfig := range config.Rules {
+		rule, ok := LookupRule(idOrName)
+		if !ok {
+			var known []string
+			for _, rule := range Rules() {
+				known = append(known, rule.String())
+			}
+			return fmt.Errorf("unknown rule '%s', known rules are: %s", idOrName, strings.Join(known, ", "))
+		}
+		switch ruleConfig.Severity {
+		case "", SeverityError, SeverityWarning, SeverityNotice:
+		default:
+			return fmt.Errorf("unknown severity '%s' for rule '%s'", ruleConfig.Severity, idOrName)
+		}
+		rules[rule.ID] = ruleConfig
+	}
+	config.Rules = rules
+	return nil
+}
+
+// ruleEnabled reports whether a rule should be evaluated
+func (config *Config) ruleEnabled(id string) bool {
+	if ruleConfig, ok := config.Rules[id]; ok && ruleConfig.Enabled != nil {
+		return *ruleConfig.Enabled
+	}
+	rule, _ := LookupRule(id)
+	if rule.enabled != nil {
+		return rule.enabled(config)
+	}
+	return !rule.Optional
+}
+
+// ruleSeverity returns the configured or default severity of a rule
+func (config *Config) ruleSeverity(id string) string {
+	if ruleConfig, ok := config.Rules[id]; ok && ruleConfig.Severity != "" {
+		return ruleConfig.Severity
+	}
+	rule, _ := LookupRule(id)
+	return rule.DefaultSeverity
+}
+
+// hasErrors reports whether any finding has error severity
+func hasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// families returns the families of all enabled rules in order
+func (config *Config) families() []string {
+	var families []string
+	seen := make(map[string]bool)
+	for _, rule := range Rules() {
+		if config.ruleEnabled(rule.ID) && !seen[rule.Family] {
+			seen[rule.Family] = true
+			families = append(families, rule.Family)
+		}
+	}
+	return families
+}
+
+// ruleFamily returns the family of a rule ID
+func ruleFamily(id string) string {
+	rule, _ := LookupRule(id)
+	return rule.Family
+}
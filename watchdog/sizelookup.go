@@ -0,0 +1,56 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// Strategies to look up the sizes of files, set with the sizeLookup option
+const (
+	// Sizes are read from the contents listing of the directory of every
+	// file, which is one request per directory of a commit
+	SizeLookupContents = "contents"
+	// Sizes are read from the recursive Git tree of a commit, which is one
+	// request per commit. The commit and compare endpoints list the changed
+	// files but not their sizes, their tree has both.
+	SizeLookupTree = "tree"
+)
+
+// Check that the sizeLookup option is known
+func (config *Config) validateSizeLookup() error {
+	switch config.SizeLookup {
+	case "", SizeLookupContents, SizeLookupTree:
+		return nil
+	}
+	return fmt.Errorf("unknown size lookup '%s', known lookups are: %s, %s",
+		config.SizeLookup, SizeLookupContents, SizeLookupTree)
+}
+
+// entryLookup looks up the entry of a file at ref
+type entryLookup func(ctx context.Context, org, repo, ref, file string) (*scm.Entry, error)
+
+// Return the function that looks up the entries of the files of a commit
+// with the size lookup strategy of config. Files that are not found are
+// not retried, see lookupEntries.
+func (watchdog *WatchDog) fileEntryLookup(ctx context.Context, commit *Commit, config *Config) entryLookup {
+	if config.SizeLookup != SizeLookupTree {
+		return watchdog.lookupFileEntry
+	}
+	// Fetch the tree before the concurrent lookups share it. Errors are
+	// reported by the lookups.
+	if len(commit.Added)+len(commit.Modified) > 0 {
+		_, _ = watchdog.getTree(ctx, commit.Owner, commit.Repo, commit.SHA, true)
+	}
+	return watchdog.lookupTreeFileEntry
+}
+
+// Look up the entry of a file in the Git tree of a commit
+func (watchdog *WatchDog) lookupTreeFileEntry(ctx context.Context, org, repo, ref, file string) (*scm.Entry, error) {
+	entry, err := watchdog.lookupTreeEntry(ctx, org, repo, ref, file)
+	if err != nil {
+		return nil, err
+	}
+	return watchdog.resolveEntry(ctx, org, repo, ref, file, entry)
+}
@@ -0,0 +1,111 @@
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+)
+
+// Number of bytes read from extensionless files to detect their format
+const sniffPrefixSize = 512
+
+// binaryFormat is a file format recognized by its magic number
+type binaryFormat struct {
+	name   string
+	magic  []byte
+	offset int
+	// executable formats are build outputs rather than assets
+	executable bool
+}
+
+// Formats in the order they are tried. Names are shown next to findings.
+var binaryFormats = []binaryFormat{
+	{name: "ELF executable", magic: []byte("\x7fELF"), executable: true},
+	{name: "Mach-O executable", magic: []byte{0xfe, 0xed, 0xfa, 0xce}, executable: true},
+	{name: "Mach-O executable", magic: []byte{0xfe, 0xed, 0xfa, 0xcf}, executable: true},
+	{name: "Mach-O executable", magic: []byte{0xce, 0xfa, 0xed, 0xfe}, executable: true},
+	{name: "Mach-O executable", magic: []byte{0xcf, 0xfa, 0xed, 0xfe}, executable: true},
+	{name: "Mach-O universal binary", magic: []byte{0xca, 0xfe, 0xba, 0xbe}, executable: true},
+	{name: "PE executable", magic: []byte("MZ"), executable: true},
+	{name: "WebAssembly module", magic: []byte("\x00asm"), executable: true},
+	{name: "static library", magic: []byte("!<arch>\n"), executable: true},
+	{name: "PNG image", magic: []byte("\x89PNG\r\n\x1a\n")},
+	{name: "JPEG image", magic: []byte{0xff, 0xd8, 0xff}},
+	{name: "GIF image", magic: []byte("GIF87a")},
+	{name: "GIF image", magic: []byte("GIF89a")},
+	{name: "Photoshop document", magic: []byte("8BPS")},
+	{name: "FBX model", magic: []byte("Kaydara FBX Binary  \x00")},
+	{name: "PDF document", magic: []byte("%PDF-")},
+	{name: "SQLite database", magic: []byte("SQLite format 3\x00")},
+	{name: "ZIP archive", magic: []byte("PK\x03\x04")},
+	{name: "gzip archive", magic: []byte{0x1f, 0x8b}},
+	{name: "7-Zip archive", magic: []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+	{name: "tar archive", magic: []byte("ustar"), offset: 257},
+}
+
+// Detect the binary format of a file by the magic number at the start of
+// its content. Unknown formats, which are likely text, have no name.
+func sniffFormat(prefix []byte) binaryFormat {
+	for _, format := range binaryFormats {
+		end := format.offset + len(format.magic)
+		if end <= len(prefix) && bytes.Equal(prefix[format.offset:end], format.magic) {
+			return format
+		}
+	}
+	return binaryFormat{}
+}
+
+// Report whether a file needs sniffing: files without an extension escape
+// both the exemption patterns and the usual checks for build outputs
+func (config *Config) sniffable(file string, size int) bool {
+	if path.Ext(file) != "" || size == 0 {
+		return false
+	}
+	if config.ruleEnabled(RuleBuildOutput) {
+		return true
+	}
+	// Exempt files get the larger threshold for text files
+	return config.ruleEnabled(RuleOversizeFile) && size > config.LFSSizeThreshold &&
+		config.LFSExemptionsFilter != nil && config.LFSExemptionsFilter.Allows(normalizePath(file))
+}
+
+// Read the first bytes of a file and detect its format
+func (watchdog *WatchDog) sniffFile(ctx context.Context, commit *Commit, file, sha string) (binaryFormat, error) {
+	prefix, err := watchdog.scm.GetBlobPrefix(ctx, commit.Owner, commit.Repo, sha, sniffPrefixSize)
+	if err != nil {
+		return binaryFormat{}, fmt.Errorf("could not get the content of '%s': %w", file, err)
+	}
+	return sniffFormat(prefix), nil
+}
+
+// Evaluate an extensionless file by its format. Executables are build
+// outputs, other binary files are measured against the threshold for
+// binary files even if they match lfsSizeExemptions.
+func evaluateSniffed(config *Config, file string, size int, format binaryFormat, finding Finding, violates bool) (Finding, bool) {
+	if format.name == "" {
+		return finding, violates
+	}
+	if format.executable && config.ruleEnabled(RuleBuildOutput) {
+		return Finding{
+			Path:     file,
+			Size:     size,
+			Rule:     RuleBuildOutput,
+			Severity: config.ruleSeverity(RuleBuildOutput),
+			Format:   format.name,
+		}, true
+	}
+	if !violates && config.ruleEnabled(RuleOversizeFile) && size > config.LFSSizeThreshold {
+		finding, violates = Finding{
+			Path:      file,
+			Size:      size,
+			Threshold: config.LFSSizeThreshold,
+			Rule:      RuleOversizeFile,
+			Severity:  config.ruleSeverity(RuleOversizeFile),
+		}, true
+	}
+	if violates && finding.Rule == RuleOversizeFile {
+		finding.Format = format.name
+	}
+	return finding, violates
+}
@@ -0,0 +1,194 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+const gitmodulesFile = ".gitmodules"
+
+// Report whether any submodule rule is enabled
+func (config *Config) submoduleRulesEnabled() bool {
+	return config.ruleEnabled(RuleNewSubmodule) || config.ruleEnabled(RuleSubmoduleURL) || config.ruleEnabled(RuleSubmoduleCommit)
+}
+
+// Apply the submodule rules to the submodules a commit adds or moves.
+// Submodules are identified by the commit's .gitmodules file, because the
+// contents API lists them as files. entries are the looked up files of the
+// commit, in the order of commit.Files().
+func (watchdog *WatchDog) submoduleFindings(ctx context.Context, commit *Commit, config *Config, entries []*scm.Entry) ([]Finding, error) {
+	content, err := watchdog.scm.GetFileContent(ctx, commit.Owner, commit.Repo, commit.SHA, gitmodulesFile)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s: %w", gitmodulesFile, err)
+	}
+	urls := parseGitmodules(content)
+
+	var findings []Finding
+	for i, file := range commit.Files() {
+		submoduleURL, ok := urls[normalizePath(file)]
+		if !ok || entries[i] == nil {
+			continue
+		}
+		finding := Finding{Path: file, Target: submoduleURL}
+
+		if i < len(commit.Added) && config.ruleEnabled(RuleNewSubmodule) {
+			finding.Rule, finding.Severity = RuleNewSubmodule, config.ruleSeverity(RuleNewSubmodule)
+			findings = append(findings, finding)
+		}
+		if config.ruleEnabled(RuleSubmoduleURL) && !watchdog.allowedSubmoduleURL(commit, config, submoduleURL) {
+			finding.Rule, finding.Severity = RuleSubmoduleURL, config.ruleSeverity(RuleSubmoduleURL)
+			findings = append(findings, finding)
+		}
+		if !config.ruleEnabled(RuleSubmoduleCommit) {
+			continue
+		}
+		owner, repo, ok := watchdog.upstreamRepo(commit, submoduleURL)
+		if !ok {
+			// Only repositories on this GitHub can be looked up
+			continue
+		}
+		sha := entries[i].SHA
+		_, err := watchdog.scm.GetCommit(ctx, owner, repo, sha)
+		if errors.Is(err, ErrNotFound) {
+			log.Printf("submodule '%s' at '%s' in '%s' points to '%s', which is not in '%s/%s'\n", file, commit.SHA, commit.FullName(), sha, owner, repo)
+			finding.Rule, finding.Severity, finding.Commit = RuleSubmoduleCommit, config.ruleSeverity(RuleSubmoduleCommit), sha
+			findings = append(findings, finding)
+			continue
+		}
+		if err != nil {
+			return findings, fmt.Errorf("could not look up the commit of submodule '%s': %w", file, err)
+		}
+	}
+	return findings, nil
+}
+
+// Parse the submodule URLs of a .gitmodules file by normalized path
+// c.f. https://git-scm.com/docs/gitmodules
+func parseGitmodules(content string) map[string]string {
+	type submodule struct{ path, url string }
+	var submodules []*submodule
+	var current *submodule
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			current = nil
+			if strings.HasPrefix(line, "[submodule ") {
+				current = &submodule{}
+				submodules = append(submodules, current)
+			}
+		case current != nil:
+			i := strings.Index(line, "=")
+			if i < 0 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(line[:i]))
+			value := strings.Trim(strings.TrimSpace(line[i+1:]), `"`)
+			switch key {
+			case "path":
+				current.path = value
+			case "url":
+				current.url = value
+			}
+		}
+	}
+
+	urls := make(map[string]string, len(submodules))
+	for _, s := range submodules {
+		if s.path != "" {
+			urls[normalizePath(s.path)] = s.url
+		}
+	}
+	return urls
+}
+
+// Report whether a submodule URL is relative to the repository, on this
+// GitHub, or on one of the configured submodule hosts
+func (watchdog *WatchDog) allowedSubmoduleURL(commit *Commit, config *Config, submoduleURL string) bool {
+	if isRelativeURL(submoduleURL) {
+		return true
+	}
+	host, _, ok := splitGitURL(submoduleURL)
+	if !ok {
+		return false
+	}
+	if host == watchdog.webHost(commit) {
+		return true
+	}
+	for _, allowed := range config.SubmoduleHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the repository of a submodule URL on this GitHub
+func (watchdog *WatchDog) upstreamRepo(commit *Commit, submoduleURL string) (string, string, bool) {
+	var p string
+	if isRelativeURL(submoduleURL) {
+		// Relative to the URL of the repository
+		p = path.Join(commit.Owner, commit.Repo, submoduleURL)
+	} else {
+		host, urlPath, ok := splitGitURL(submoduleURL)
+		if !ok || host != watchdog.webHost(commit) {
+			return "", "", false
+		}
+		p = urlPath
+	}
+	segments := strings.Split(strings.TrimSuffix(strings.Trim(p, "/"), ".git"), "/")
+	if len(segments) != 2 || segments[0] == "" || segments[0] == ".." || segments[1] == "" {
+		return "", "", false
+	}
+	return segments[0], segments[1], true
+}
+
+// The host of this GitHub, or an empty string if it is unknown
+func (watchdog *WatchDog) webHost(commit *Commit) string {
+	u, err := url.Parse(watchdog.scm.FileURL(commit.Owner, commit.Repo, commit.SHA, gitmodulesFile))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func isRelativeURL(submoduleURL string) bool {
+	return strings.HasPrefix(submoduleURL, "./") || strings.HasPrefix(submoduleURL, "../")
+}
+
+// Split a URL like "https://host/path", "ssh://git@host:22/path" or the
+// scp-like "git@host:path" into its lower case host and path
+func splitGitURL(gitURL string) (string, string, bool) {
+	if strings.Contains(gitURL, "://") {
+		u, err := url.Parse(gitURL)
+		if err != nil || u.Hostname() == "" {
+			return "", "", false
+		}
+		return strings.ToLower(u.Hostname()), u.Path, true
+	}
+	colon := strings.Index(gitURL, ":")
+	if colon <= 1 || strings.Contains(gitURL[:colon], "/") {
+		// A local path, also on Windows
+		return "", "", false
+	}
+	host := gitURL[:colon]
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	if host == "" {
+		return "", "", false
+	}
+	return strings.ToLower(host), gitURL[colon+1:], true
+}
@@ -0,0 +1,46 @@
+package watchdog
+
+import (
+	"fmt"
+
+	"github.com/git-lfs/git-lfs/filepathfilter"
+)
+
+// Suppression exempts the findings of a rule for matching paths
+type Suppression struct {
+	// Rule is a rule ID or name
+	Rule string `yaml:"rule"`
+	// Path is a file path or a gitignore style pattern
+	Path   string `yaml:"path"`
+	Reason string `yaml:"reason"`
+
+	filter *filepathfilter.Filter
+}
+
+// Check that all suppressions reference known rules and key them by rule ID
+func (config *Config) validateSuppressions() error {
+	for i := range config.Suppressions {
+		s := &config.Suppressions[i]
+		rule, ok := LookupRule(s.Rule)
+		if !ok {
+			return fmt.Errorf("suppression for '%s' references unknown rule '%s'", s.Path, s.Rule)
+		}
+		if s.Path == "" {
+			return fmt.Errorf("suppression for rule '%s' has no path", s.Rule)
+		}
+		s.Rule = rule.ID
+		s.filter = newPathFilter([]string{s.Path})
+	}
+	return nil
+}
+
+// suppression returns the suppression matching a finding, if any
+func (config *Config) suppression(finding Finding) (*Suppression, bool) {
+	for i := range config.Suppressions {
+		s := &config.Suppressions[i]
+		if s.Rule == finding.Rule && s.filter != nil && s.filter.Allows(normalizePath(finding.Path)) {
+			return s, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,73 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Treatments of symlinks, set with the symlinks option
+const (
+	// Symlinks are reported as errors that the file can't be evaluated
+	SymlinksError = "error"
+	// Symlinks are ignored
+	SymlinksSkip = "skip"
+	// Symlinks pointing outside the repository are findings
+	SymlinksWarn = "warn"
+	// All symlinks are findings
+	SymlinksFinding = "finding"
+)
+
+// Check that the symlinks option is known
+func (config *Config) validateSymlinks() error {
+	switch config.Symlinks {
+	case "", SymlinksError, SymlinksSkip, SymlinksWarn, SymlinksFinding:
+		return nil
+	}
+	return fmt.Errorf("unknown symlinks treatment '%s', known treatments are: %s, %s, %s, %s",
+		config.Symlinks, SymlinksError, SymlinksSkip, SymlinksWarn, SymlinksFinding)
+}
+
+// Evaluate a symlink of a commit according to the symlinks option.
+// Returns a finding if the symlink violates the policy, or an error if
+// symlinks are not evaluated.
+func (watchdog *WatchDog) evaluateSymlink(ctx context.Context, commit *Commit, config *Config, file, sha string) (Finding, bool, error) {
+	switch config.Symlinks {
+	case SymlinksSkip:
+		return Finding{}, false, nil
+	case SymlinksWarn, SymlinksFinding:
+	default:
+		return Finding{}, false, fmt.Errorf("for file '%s' at ref '%s', name '%s' matches, but object is a symlink", file, commit.SHA, file)
+	}
+	if !config.ruleEnabled(RuleSymlink) {
+		return Finding{}, false, nil
+	}
+
+	// The blob of a symlink is its target
+	content, err := watchdog.scm.GetBlob(ctx, commit.Owner, commit.Repo, sha)
+	if err != nil {
+		return Finding{}, false, fmt.Errorf("could not get the target of symlink '%s': %w", file, err)
+	}
+	target := string(content)
+	if config.Symlinks == SymlinksWarn && !pointsOutside(file, target) {
+		return Finding{}, false, nil
+	}
+	return Finding{
+		Path:     file,
+		Rule:     RuleSymlink,
+		Severity: config.ruleSeverity(RuleSymlink),
+		Target:   target,
+	}, true, nil
+}
+
+// Report whether the target of the symlink at file resolves to a path
+// outside the repository
+func pointsOutside(file, target string) bool {
+	if strings.HasPrefix(target, "/") || strings.HasPrefix(target, `\`) || (len(target) > 1 && target[1] == ':') {
+		// Absolute, also on Windows
+		return true
+	}
+	resolved := path.Join(path.Dir(file), strings.Replace(target, `\`, "/", -1))
+	return resolved == ".." || strings.HasPrefix(resolved, "../")
+}
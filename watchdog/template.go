@@ -0,0 +1,113 @@
+package watchdog
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// Reconcile branches are named after the template, so that repeated audits
+// don't open a second pull request until the template changes
+const attributesBranchPrefix = "lfswatchdog/attributes-"
+
+// The org-standard .gitattributes that repositories are compared to
+var attributesTemplate = struct {
+	sync.RWMutex
+	content string
+}{}
+
+// SetAttributesTemplate sets the content of the standard .gitattributes of
+// the organizations, whose filter=lfs patterns every repository should have
+func SetAttributesTemplate(content string) {
+	attributesTemplate.Lock()
+	defer attributesTemplate.Unlock()
+	attributesTemplate.content = content
+}
+
+// AttributesTemplate returns the standard .gitattributes, or an empty
+// string if there is none
+func AttributesTemplate() string {
+	attributesTemplate.RLock()
+	defer attributesTemplate.RUnlock()
+	return attributesTemplate.content
+}
+
+// Return the filter=lfs rules of the template whose pattern is not among
+// the filter=lfs patterns of a repository
+func missingPatterns(template []filterRule, patterns []string) []filterRule {
+	present := make(map[string]bool, len(patterns))
+	for _, pattern := range patterns {
+		present[pattern] = true
+	}
+	var missing []filterRule
+	for _, rule := range template {
+		if rule.lfs && !present[rule.pattern] {
+			missing = append(missing, rule)
+			present[rule.pattern] = true
+		}
+	}
+	return missing
+}
+
+// Propose adding the missing template lines to the root .gitattributes of a
+// repository in a pull request against its default branch. Returns the web
+// URL of the pull request, or an empty string if one was proposed for the
+// template before.
+func (watchdog *WatchDog) reconcileAttributes(ctx context.Context, owner string, repo *RepoAttributesAudit, attributes string, template []filterRule) (string, error) {
+	sum := sha256.Sum256([]byte(AttributesTemplate()))
+	branch := fmt.Sprintf("%s%x", attributesBranchPrefix, sum[:4])
+	exists, err := watchdog.scm.BranchExists(ctx, owner, repo.Repo, branch)
+	if err != nil {
+		return "", fmt.Errorf("could not look up branch '%s': %w", branch, err)
+	}
+	if exists {
+		log.Printf("not reconciling the .gitattributes of '%s/%s': branch '%s' exists\n", owner, repo.Repo, branch)
+		return "", nil
+	}
+	parent, err := watchdog.scm.GetCommit(ctx, owner, repo.Repo, repo.Ref)
+	if err != nil {
+		return "", fmt.Errorf("could not get the head of '%s': %w", repo.Ref, err)
+	}
+
+	var b strings.Builder
+	b.WriteString(attributes)
+	if attributes != "" && !strings.HasSuffix(attributes, "\n") {
+		b.WriteString("\n")
+	}
+	for _, rule := range missingPatterns(template, repo.Patterns) {
+		b.WriteString(rule.line + "\n")
+	}
+	_, err = watchdog.scm.CommitFiles(ctx, owner, repo.Repo, &scm.Change{
+		Branch:  branch,
+		Parent:  parent.SHA,
+		Message: "Track the standard file types with Git LFS\n\nAdds the missing patterns of the organization's .gitattributes template.",
+		Files:   map[string]string{gitattributesFile: b.String()},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return watchdog.scm.CreatePullRequest(ctx, owner, repo.Repo, &scm.PullRequest{
+		Title: "Track the standard file types with Git LFS",
+		Body:  reconcilePullRequestBody(repo.MissingPatterns),
+		Head:  branch,
+		Base:  repo.Ref,
+	})
+}
+
+func reconcilePullRequestBody(patterns []string) string {
+	var b strings.Builder
+	b.WriteString("This pull request adds the following patterns of the organization's standard " +
+		"`.gitattributes` template, so that new files of these types are stored in [Git LFS](https://git-lfs.github.com/):\n\n")
+	for _, pattern := range patterns {
+		fmt.Fprintf(&b, "- %s\n", codeSpan(pattern))
+	}
+	b.WriteString("\nFiles of these types that are already committed stay in Git until they are migrated, " +
+		"e.g. with `git lfs migrate import --no-rewrite`. Until then, Git LFS warns that they should have been pointers.\n")
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+)
+
+const (
+	// Pushes are checked for at most this long by default
+	defaultCheckTimeout = 10 * time.Minute
+
+	// Description of the error status of checks that timed out
+	timeoutDescription = "partial results, evaluation timed out"
+)
+
+// Time after which the commits of a push are reported with the findings
+// gathered so far, zero checks without a deadline
+var checkTimeout = int64(defaultCheckTimeout)
+
+var checkTimeouts = metrics.NewCounter("lfswatchdog_check_timeouts_total",
+	"Commit checks that timed out and were reported with partial results.")
+
+// SetCheckTimeout sets the deadline of checking a push. Commits that are
+// not completely evaluated by then are reported with the findings gathered
+// so far and an error status. Zero disables the deadline.
+func SetCheckTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&checkTimeout, int64(timeout))
+}
+
+// Return the context of checking a push, which is done at its deadline
+func checkContext() (context.Context, context.CancelFunc) {
+	timeout := time.Duration(atomic.LoadInt64(&checkTimeout))
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// Report whether a check ran out of time
+func timedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// Render the note of a report with partial results
+func timeoutNote(result *CommitResult) string {
+	if !result.TimedOut {
+		return ""
+	}
+	return fmt.Sprintf("**Note:** partial results, the evaluation timed out after %s. "+
+		"Files that were not measured by then are not listed.\n\n", time.Duration(atomic.LoadInt64(&checkTimeout)))
+}
@@ -0,0 +1,186 @@
+package watchdog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+)
+
+// Git trees by repository and tree or commit SHA. Trees are immutable, so
+// all files of a push are looked up in the same tree, and the trees of
+// directories that later commits don't change are not fetched again. The
+// listings are compressed, as the trees of monorepos have hundreds of
+// thousands of entries.
+var treeCache = cache.New("trees", cache.Options{MaxBytes: 64 << 20, TTL: 24 * time.Hour})
+
+// Recently used trees decompressed, as the files of a commit are looked up
+// concurrently in the same trees
+var treeIndexCache = cache.New("tree-indexes", cache.Options{MaxBytes: 32 << 20, TTL: time.Minute})
+
+// Directories beyond the 1,000 entries of the contents API by repository
+// and path. Their files are looked up in the trees right away instead of
+// listing the first 1,000 entries again.
+var largeDirCache = cache.New("large-dirs", cache.Options{MaxEntries: 10000, TTL: 24 * time.Hour})
+
+// Approximate memory footprint of an entry of a decompressed tree
+const treeEntrySize = 200
+
+// The entries of a tree by normalized path
+type treeIndex struct {
+	entries   map[string]*scm.Entry
+	truncated bool
+}
+
+func (t *treeIndex) Size() int { return len(t.entries) * treeEntrySize }
+
+// compressedTree is the gzipped listing of a tree, with the path, type, SHA
+// and size of every entry terminated by NUL, which Git forbids in paths
+type compressedTree struct {
+	listing   []byte
+	truncated bool
+}
+
+func (t *compressedTree) Size() int { return len(t.listing) }
+
+func compressTree(tree *scm.Tree) *compressedTree {
+	var buf bytes.Buffer
+	// Writes to a buffer don't fail
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	for _, entry := range tree.Entries {
+		fmt.Fprintf(zw, "%s\x00%s\x00%s\x00%d\x00", entry.Path, entry.Type, entry.SHA, entry.Size)
+	}
+	zw.Close()
+	return &compressedTree{listing: buf.Bytes(), truncated: tree.Truncated}
+}
+
+// Decompress the listing into an index of its entries
+func (t *compressedTree) index() (*treeIndex, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(t.listing))
+	if err != nil {
+		return nil, err
+	}
+	listing, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(string(listing), "\x00")
+	index := &treeIndex{entries: make(map[string]*scm.Entry, len(fields)/4), truncated: t.truncated}
+	for i := 0; i+4 <= len(fields); i += 4 {
+		size, err := strconv.Atoi(fields[i+3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid size of '%s': %w", fields[i], err)
+		}
+		entry := &scm.Entry{Name: fields[i], Path: fields[i], Type: fields[i+1], SHA: fields[i+2], Size: size}
+		index.entries[normalizePath(entry.Path)] = entry
+	}
+	return index, nil
+}
+
+// Get a tree, identified by a tree or commit SHA, from the caches or GitHub
+func (watchdog *WatchDog) getTree(ctx context.Context, org, repo, sha string, recursive bool) (*treeIndex, error) {
+	key := strings.Join([]string{org + "/" + repo, sha, strconv.FormatBool(recursive)}, "\x00")
+	if t, ok := treeIndexCache.Get(key); ok {
+		return t.(*treeIndex), nil
+	}
+	if t, ok := treeCache.Get(key); ok {
+		index, err := t.(*compressedTree).index()
+		if err == nil {
+			treeIndexCache.Add(key, index)
+			return index, nil
+		}
+		log.Printf("discarding the cached tree '%s' of '%s/%s': %v\n", sha, org, repo, err)
+		treeCache.Remove(key)
+	}
+	tree, err := watchdog.scm.GetTree(ctx, org, repo, sha, recursive)
+	if err != nil {
+		return nil, err
+	}
+	index := &treeIndex{entries: make(map[string]*scm.Entry, len(tree.Entries)), truncated: tree.Truncated}
+	for _, entry := range tree.Entries {
+		index.entries[normalizePath(entry.Path)] = entry
+	}
+	treeCache.Add(key, compressTree(tree))
+	treeIndexCache.Add(key, index)
+	return index, nil
+}
+
+// Look up the entry of a file in the recursive tree of a commit, for files
+// whose directory listing was cut off by the contents API. GitHub truncates
+// the recursive trees of huge repositories, then the directories of the
+// file are descended one tree at a time.
+func (watchdog *WatchDog) lookupTreeEntry(ctx context.Context, org, repo, ref, file string) (*scm.Entry, error) {
+	name := normalizePath(file)
+	tree, err := watchdog.getTree(ctx, org, repo, ref, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the tree of ref '%s': %w", ref, err)
+	}
+	entry, ok := tree.entries[name]
+	if !ok && tree.truncated {
+		entry, err = watchdog.descendTree(ctx, org, repo, ref, name)
+		if err != nil {
+			return nil, err
+		}
+		ok = entry != nil
+	}
+	if !ok {
+		return nil, &missingFileError{file, ref, org + "/" + repo}
+	}
+
+	return namedEntry(entry, file), nil
+}
+
+// Look up the entry of a file in a directory beyond the 1,000 entries of
+// the contents API by descending the trees of the commit, whose cached
+// trees are shared with other commits
+func (watchdog *WatchDog) lookupLargeDirEntry(ctx context.Context, org, repo, ref, file string) (*scm.Entry, error) {
+	entry, err := watchdog.descendTree(ctx, org, repo, ref, normalizePath(file))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, &missingFileError{file, ref, org + "/" + repo}
+	}
+	return namedEntry(entry, file), nil
+}
+
+// Tree entries are named by their path, name them like listings
+func namedEntry(entry *scm.Entry, file string) *scm.Entry {
+	found := *entry
+	found.Name = path.Base(file)
+	found.Path = file
+	return &found
+}
+
+// Descend from the root tree of a commit to the entry of a file, or return
+// nil if a directory on the way does not exist. Subtrees are requested by
+// their SHA, so only the trees of changed directories are fetched for
+// every commit.
+func (watchdog *WatchDog) descendTree(ctx context.Context, org, repo, ref, file string) (*scm.Entry, error) {
+	sha := ref
+	names := strings.Split(file, "/")
+	for i, name := range names {
+		tree, err := watchdog.getTree(ctx, org, repo, sha, false)
+		if err != nil {
+			return nil, fmt.Errorf("could not get the tree of '%s' at ref '%s': %w", strings.Join(names[:i], "/"), ref, err)
+		}
+		entry, ok := tree.entries[name]
+		if !ok || i == len(names)-1 {
+			return entry, nil
+		}
+		if entry.Type != "dir" {
+			return nil, nil
+		}
+		sha = entry.SHA
+	}
+	return nil, nil
+}
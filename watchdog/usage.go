@@ -0,0 +1,106 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Pointers in the canonical format, without extensions, are within
+	// these sizes. Smaller and larger files are not read.
+	minPointerSize = 120
+	maxPointerSize = 200
+	// Bounds the blobs read per usage report
+	maxPointerLookups = 10000
+)
+
+// LFSUsage is the Git LFS storage referenced by a tree
+type LFSUsage struct {
+	Ref string
+	// Objects is the number of distinct Git LFS objects
+	Objects int
+	// Size is the total size of the distinct objects in bytes
+	Size int64
+	// Truncated is set if not all files could be read, e.g. in very
+	// large repositories
+	Truncated bool `json:",omitempty"`
+}
+
+// LFSUsage reports the Git LFS objects referenced by the pointer files at
+// ref. Objects only referenced by earlier commits, e.g. earlier versions of
+// files, are not counted, so the storage used on the server is at least
+// the reported size.
+func (watchdog *WatchDog) LFSUsage(ctx context.Context, owner, repo, ref string) (*LFSUsage, error) {
+	tree, err := watchdog.scm.GetTree(ctx, owner, repo, ref, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the tree of '%s': %w", ref, err)
+	}
+
+	usage := &LFSUsage{Ref: ref, Truncated: tree.Truncated}
+	// Copies of a pointer share its blob
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, entry := range tree.Entries {
+		if entry.Type == "file" && entry.Size >= minPointerSize && entry.Size <= maxPointerSize && !seen[entry.SHA] {
+			seen[entry.SHA] = true
+			candidates = append(candidates, entry.SHA)
+		}
+	}
+	if len(candidates) > maxPointerLookups {
+		candidates = candidates[:maxPointerLookups]
+		usage.Truncated = true
+	}
+
+	pointers := make([]*pointer, len(candidates))
+	errs := make([]error, len(candidates))
+	forEachLookup(len(candidates), func(i int) {
+		if errs[i] = ctx.Err(); errs[i] == nil {
+			var content []byte
+			content, errs[i] = watchdog.scm.GetBlob(ctx, owner, repo, candidates[i])
+			pointers[i] = parsePointer(string(content))
+		}
+	})
+
+	sizes := make(map[string]int64)
+	for i, p := range pointers {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("could not get blob '%s': %w", candidates[i], errs[i])
+		}
+		if p != nil {
+			sizes[p.oid] = p.size
+		}
+	}
+	for _, size := range sizes {
+		usage.Objects++
+		usage.Size += size
+	}
+	log.Printf("'%s/%s' references %d Git LFS objects at '%s'\n", owner, repo, usage.Objects, ref)
+	return usage, nil
+}
+
+// pointer is a parsed Git LFS pointer file
+type pointer struct {
+	oid  string
+	size int64
+}
+
+// Parse a pointer in the canonical format, or return nil
+// c.f. https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+func parsePointer(content string) *pointer {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "version https://git-lfs.github.com/spec/v1" {
+		return nil
+	}
+	oid := strings.TrimPrefix(lines[1], "oid sha256:")
+	if oid == lines[1] || len(oid) != 64 {
+		return nil
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(lines[2], "size "), 10, 64)
+	if err != nil || !strings.HasPrefix(lines[2], "size ") || size < 0 {
+		return nil
+	}
+	return &pointer{oid: oid, size: size}
+}
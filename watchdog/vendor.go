@@ -0,0 +1,22 @@
+package watchdog
+
+// Report whether a file is in one of the vendored directories of the
+// vendorPaths option
+func (config *Config) vendored(file string) bool {
+	return config.VendorFilter != nil && config.VendorFilter.Allows(normalizePath(file))
+}
+
+// Evaluate a Git LFS pointer in a vendored directory. Consumers of vendored
+// copies usually don't fetch Git LFS objects, so they get the pointer
+// instead of the file.
+func evaluateVendoredPointer(config *Config, file string, p *pointer) (Finding, bool) {
+	if !config.ruleEnabled(RuleVendoredPointer) || !config.vendored(file) {
+		return Finding{}, false
+	}
+	return Finding{
+		Path:     file,
+		Size:     int(p.size),
+		Rule:     RuleVendoredPointer,
+		Severity: config.ruleSeverity(RuleVendoredPointer),
+	}, true
+}
@@ -0,0 +1,288 @@
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"git.autodesk.com/github-solutions/lfswatchdog/store"
+)
+
+// Open findings are forgotten after this long without a push that reports
+// or resolves them
+const violationTTL = 90 * 24 * time.Hour
+
+// Open findings by repository, branch and path. A finding is resolved when
+// a later commit to its branch shrinks the file below its threshold, e.g. by
+// replacing it with a Git LFS pointer, or removes it.
+var violationCache = cache.New("violations", cache.Options{MaxEntries: 100000, TTL: violationTTL})
+
+// Rules of the open findings by repository, branch and path, to tell new
+// findings on a branch from those pushed to it before
+var branchViolationCache = cache.New("branch_violations", cache.Options{MaxEntries: 100000, TTL: violationTTL})
+
+// Repositories with checked commits, keyed by their lower-cased name, to
+// tell repositories without open findings from those never checked
+var auditedRepos = cache.New("audited_repos", cache.Options{MaxEntries: 100000, TTL: violationTTL})
+
+// Buckets of the caches of open findings in the store
+const (
+	violationsBucket       = "violations"
+	branchViolationsBucket = "branch_violations"
+	auditedReposBucket     = "audited_repos"
+	cooldownsBucket        = "comment_cooldowns"
+	churnBucket            = "churn"
+)
+
+// The store that open findings are persisted in, if any
+var violationStore = struct {
+	sync.RWMutex
+	store store.Store
+}{}
+
+// persistedEntry is a cache entry of open findings in the store. Cache keys
+// contain NUL bytes, which Postgres does not allow in text, so the store
+// key is escaped and the value carries the key.
+type persistedEntry struct {
+	Key   string
+	Value json.RawMessage
+	At    time.Time
+}
+
+// SetStore persists the open findings, the comment cooldowns and the
+// modifications counted for binary churn in a store and loads those
+// persisted before, so that resolved comments, pre-existing findings,
+// badges, combined comments and churn survive restarts. Findings and churn
+// older than 90 days and cooldowns older than a day are removed from the
+// store.
+func SetStore(s store.Store) error {
+	buckets := []struct {
+		name   string
+		cache  *cache.Cache
+		ttl    time.Duration
+		decode func([]byte) (interface{}, error)
+	}{
+		{violationsBucket, violationCache, violationTTL, func(data []byte) (interface{}, error) {
+			var v violation
+			err := json.Unmarshal(data, &v)
+			return v, err
+		}},
+		{branchViolationsBucket, branchViolationCache, violationTTL, func(data []byte) (interface{}, error) {
+			var rule string
+			err := json.Unmarshal(data, &rule)
+			return rule, err
+		}},
+		{auditedReposBucket, auditedRepos, violationTTL, func([]byte) (interface{}, error) { return true, nil }},
+		{cooldownsBucket, cooldownCache, cooldownTTL, func(data []byte) (interface{}, error) {
+			var c persistedCooldown
+			err := json.Unmarshal(data, &c)
+			return &cooldown{id: c.ID, body: c.Body, posted: c.Posted}, err
+		}},
+		{churnBucket, churnCache, churnTTL, func(data []byte) (interface{}, error) {
+			var persisted []persistedChange
+			err := json.Unmarshal(data, &persisted)
+			changes := make([]change, len(persisted))
+			for i, c := range persisted {
+				changes[i] = change{sha: c.SHA, at: c.At}
+			}
+			return changes, err
+		}},
+	}
+	for _, bucket := range buckets {
+		if err := loadEntries(context.Background(), s, bucket.name, bucket.ttl, bucket.cache, bucket.decode); err != nil {
+			return err
+		}
+	}
+
+	violationStore.Lock()
+	defer violationStore.Unlock()
+	violationStore.store = s
+	return nil
+}
+
+func loadEntries(ctx context.Context, s store.Store, bucket string, ttl time.Duration, c *cache.Cache, decode func([]byte) (interface{}, error)) error {
+	items, err := s.List(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("could not load '%s': %w", bucket, err)
+	}
+	for _, item := range items {
+		var entry persistedEntry
+		if err := json.Unmarshal(item.Value, &entry); err != nil {
+			return fmt.Errorf("invalid entry '%s' of '%s': %w", item.Key, bucket, err)
+		}
+		if clock().Sub(entry.At) >= ttl {
+			if err := s.Delete(ctx, bucket, item.Key); err != nil {
+				return fmt.Errorf("could not remove the expired entry '%s' of '%s': %w", item.Key, bucket, err)
+			}
+			continue
+		}
+		value, err := decode(entry.Value)
+		if err != nil {
+			return fmt.Errorf("invalid entry '%s' of '%s': %w", item.Key, bucket, err)
+		}
+		c.Add(entry.Key, value)
+	}
+	return nil
+}
+
+func currentViolationStore() store.Store {
+	violationStore.RLock()
+	defer violationStore.RUnlock()
+	return violationStore.store
+}
+
+// Add an entry to a cache of open findings and persist it. Failures to
+// persist are logged, the cache stays authoritative until a restart.
+func addViolation(bucket string, c *cache.Cache, key string, value interface{}) {
+	c.Add(key, value)
+	persistEntry(bucket, key, value)
+}
+
+// Persist an entry of a cache, if there is a store
+func persistEntry(bucket string, key string, value interface{}) {
+	s := currentViolationStore()
+	if s == nil {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err == nil {
+		data, err = json.Marshal(persistedEntry{Key: key, Value: data, At: clock()})
+	}
+	if err == nil {
+		err = s.Put(context.Background(), bucket, url.QueryEscape(key), data)
+	}
+	if err != nil {
+		log.Printf("could not persist an entry of '%s': %v\n", bucket, err)
+	}
+}
+
+// Remove an entry from a cache of open findings and from the store
+func removeViolation(bucket string, c *cache.Cache, key string) {
+	c.Remove(key)
+	s := currentViolationStore()
+	if s == nil {
+		return
+	}
+	if err := s.Delete(context.Background(), bucket, url.QueryEscape(key)); err != nil {
+		log.Printf("could not remove an entry of '%s': %v\n", bucket, err)
+	}
+}
+
+// violation is an open finding and the commit it was reported on
+type violation struct {
+	Finding
+	SHA string
+}
+
+// Keys of a file are the same whatever Unicode normal form its path is in,
+// the payload and the contents API may disagree on it
+func violationKey(commit *Commit, path string) string {
+	return commit.FullName() + "\x00" + commit.Ref + "\x00" + normalizePath(path)
+}
+
+// Mark the findings of a commit that are open on its branch from earlier
+// pushes. Commits of the same push are checked concurrently, so a file
+// reported twice within a push may be marked either way.
+func markPreExisting(commit *Commit, result *CommitResult) {
+	if commit.Ref == "" {
+		return
+	}
+	for i, finding := range result.Findings {
+		if rule, ok := branchViolationCache.Get(violationKey(commit, finding.Path)); ok && rule.(string) == finding.Rule {
+			result.Findings[i].PreExisting = true
+		}
+	}
+}
+
+// Return the findings that are new on their branch
+func newFindings(findings []Finding) []Finding {
+	var added []Finding
+	for _, finding := range findings {
+		if !finding.PreExisting {
+			added = append(added, finding)
+		}
+	}
+	return added
+}
+
+// Record the findings of a commit and resolve open findings of files that
+// the commit cleared. Commits of a push are checked concurrently, so a
+// finding and its resolution within the same push may be seen out of order.
+func recordViolations(commit *Commit, result *CommitResult) []violation {
+	addViolation(auditedReposBucket, auditedRepos, strings.ToLower(commit.FullName()), true)
+	for _, finding := range result.Findings {
+		if finding.Rule == RuleLockedFile {
+			// Locks come and go independently of commits
+			continue
+		}
+		if ruleFamily(finding.Rule) == "submodule" || finding.Rule == RuleBinaryChurn {
+			// Moving a submodule or changing a file again doesn't resolve
+			// these findings
+			continue
+		}
+		addViolation(violationsBucket, violationCache, violationKey(commit, finding.Path), violation{finding, commit.SHA})
+		if commit.Ref != "" {
+			addViolation(branchViolationsBucket, branchViolationCache, violationKey(commit, finding.Path), finding.Rule)
+		}
+	}
+
+	var resolved []violation
+	for _, path := range append(result.cleared, commit.Removed...) {
+		if commit.Ref != "" {
+			removeViolation(branchViolationsBucket, branchViolationCache, violationKey(commit, path))
+		}
+		key := violationKey(commit, path)
+		if v, ok := violationCache.Get(key); ok {
+			removeViolation(violationsBucket, violationCache, key)
+			log.Printf("resolved %s for '%s' in '%s' at '%s'\n", v.(violation).Rule, path, commit.FullName(), commit.SHA)
+			resolved = append(resolved, v.(violation))
+		}
+	}
+	return resolved
+}
+
+// OpenViolations returns the number of files of a repository ("owner/repo")
+// with open findings on any branch and whether any of its commits were
+// checked since the watchdog started
+func OpenViolations(repo string) (int, bool) {
+	if _, ok := auditedRepos.Get(strings.ToLower(repo)); !ok {
+		return 0, false
+	}
+	paths := make(map[string]bool)
+	violationCache.Range(func(key string, value interface{}) bool {
+		if i := strings.IndexByte(key, 0); i >= 0 && strings.EqualFold(key[:i], repo) {
+			paths[key[strings.LastIndexByte(key, 0)+1:]] = true
+		}
+		return true
+	})
+	return len(paths), true
+}
+
+// Create a comment that lists resolved findings
+func resolvedComment(resolved []violation) string {
+	comment, _ := fitComment(len(resolved), func(shown int) (string, error) {
+		var b strings.Builder
+		b.WriteString("**:white_check_mark: Resolved:** the following files no longer violate the Git LFS policy:\n\n")
+		for _, v := range resolved[:shown] {
+			fmt.Fprintf(&b, "- %s (reported on %s)\n", codeSpan(v.Path), shortSHA(v.SHA))
+		}
+		if n := len(resolved) - shown; n > 0 {
+			fmt.Fprintf(&b, "- …and %d more %s\n", n, pluralize(n, "file", "files"))
+		}
+		return b.String(), nil
+	})
+	return comment
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -7,9 +7,19 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
+	"time"
+	"unicode/utf8"
 
+	"git.autodesk.com/github-solutions/lfswatchdog/cache"
+	"git.autodesk.com/github-solutions/lfswatchdog/logging"
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"git.autodesk.com/github-solutions/lfswatchdog/telemetry"
 	"github.com/git-lfs/git-lfs/filepathfilter"
 	"github.com/google/go-github/v35/github"
 	yaml "gopkg.in/yaml.v2"
@@ -23,200 +33,600 @@ const (
 
 	lfsHelpContact     = "@github-solutions"
 	lfsMessageTemplate = "" +
-		"{{ if .LFSCandidates }}" +
-		"**:warning: The following files are larger than {{ .LFSSizeThresholdKB }}KB and may need to be tracked with [Git LFS](https://git-lfs.github.com/):**" +
-		"{{ range .LFSCandidates}}\n- {{ . }}{{ end }}\n\n" +
+		"{{ if or .Groups .LFSOmitted }}" +
+		"{{ if .Author }}@{{ .Author }} {{ end }}" +
+		"{{ range $i, $group := .Groups }}{{ if $i }}\n\n{{ end }}" +
+		"**{{ $group.Headline }} ({{ $group.Rule }}):**" +
+		"{{ range $group.Candidates }}\n- {{ . }}{{ end }}" +
+		"{{ end }}" +
+		"{{ if .LFSOmitted }}\n- …and {{ .LFSOmitted }}{{ end }}\n\n" +
 		"{{ end }}" +
 		"> Watch the [Git LFS tutorial](https://www.youtube.com/watch?v=YQzNfb4IwEY) or contact {{ .LFSHelpContact }} for help."
 )
 
-var errGetContentsUpperLimit = errors.New(
-	"reached Git contents API upper limit of 1,000 files for a directory")
+const (
+	// GitHub rejects commit status descriptions longer than this
+	maxStatusDescription = 140
+	// GitHub rejects comment bodies with more characters than this
+	maxCommentBody = 65536
+
+	defaultStatusContext = "LFSWatchDog"
+
+	maxConfigStaleness = time.Hour
+
+	// Rate limited checks are retried this often, this long after the reset
+	maxRateLimitRetries = 3
+	retryDelay          = 5 * time.Second
+
+	// SHA of the empty blob, the only file that really has a size of 0
+	emptyBlobSHA = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
+	// Lookups of files missing from a listing are retried this often,
+	// doubling the delay from this one
+	maxLookupRetries = 3
+	lookupRetryDelay = time.Second
+)
+
+// Schedules retries, replaced in tests
+var afterFunc = time.AfterFunc
 
-type watchdogConfig struct {
-	HelpContact                string `yaml:"helpContact"`
-	LFSSuggestionsEnabled      bool   `yaml:"lfsSuggestionsEnabled"`
-	LFSSizeThreshold           int    `yaml:"lfsSizeThreshold"`
-	LFSSizeExemptions          string `yaml:"lfsSizeExemptions"`
-	LFSSizeExemptionsThreshold int    `yaml:"lfsSizeExemptionsThreshold"`
-	LFSExemptionsFilter        *filepathfilter.Filter
-	LFSCommitStatusEnabled     bool `yaml:"lfsCommitStatusEnabled,omitempty"`
+// Waits between lookup retries unless ctx is done, replaced in tests
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	skippedCommits  = metrics.NewCounter("lfswatchdog_commits_skipped_total", "Commits that were not evaluated.", "reason")
+	configFallbacks = metrics.NewCounter("lfswatchdog_config_fallbacks_total", "Configuration fetches that failed and fell back to the last known configuration.")
+	lookupRetries   = metrics.NewCounter("lfswatchdog_lookup_retries_total", "File size lookups that were retried because GitHub had not caught up with a push.", "reason")
+)
+
+// Last known-good configuration by repository. It is used for at most
+// maxConfigStaleness if fetching the configuration fails.
+var configCache = cache.New("configs", cache.Options{MaxEntries: 10000, TTL: maxConfigStaleness})
+
+// Config is the per repository configuration read from .github/watchdog.yml
+type Config struct {
+	HelpContact                string                 `yaml:"helpContact"`
+	LFSSuggestionsEnabled      bool                   `yaml:"lfsSuggestionsEnabled"`
+	LFSSizeThreshold           int                    `yaml:"lfsSizeThreshold"`
+	LFSSizeExemptions          string                 `yaml:"lfsSizeExemptions"`
+	LFSSizeExemptionsThreshold int                    `yaml:"lfsSizeExemptionsThreshold"`
+	LFSExemptionsFilter        *filepathfilter.Filter `yaml:"-"`
+	LFSCommitStatusEnabled     bool                   `yaml:"lfsCommitStatusEnabled,omitempty"`
+	LFSChecksEnabled           bool                   `yaml:"lfsChecksEnabled,omitempty"`
+	// PullRequestChecksEnabled summarizes all files of a pull request with
+	// a single check run when it is opened or receives new commits
+	PullRequestChecksEnabled bool `yaml:"pullRequestChecksEnabled,omitempty"`
+	// PullRequestMergeChecksEnabled checks the commit GitHub creates to
+	// test merging a pull request instead of its head, so that the check
+	// reflects the state after merging, including conflict resolutions
+	PullRequestMergeChecksEnabled bool `yaml:"pullRequestMergeChecksEnabled,omitempty"`
+	// CommitStatusPerRule posts a separate "watchdog/<family>" status per
+	// rule family instead of the single "LFSWatchDog" status, so that branch
+	// protection can require only the relevant subset
+	CommitStatusPerRule bool `yaml:"commitStatusPerRule,omitempty"`
+	// MentionAuthor @mentions the commit author in comments
+	MentionAuthor bool `yaml:"mentionAuthor,omitempty"`
+	// ProcessNonDistinctCommits evaluates commits that were pushed before,
+	// e.g. when a branch is promoted, and reports them with a status only
+	ProcessNonDistinctCommits bool `yaml:"processNonDistinctCommits,omitempty"`
+	// ReevaluateOnConfigChange evaluates all files at the head of the
+	// default branch again when a push changes the configuration there, so
+	// that its status reflects the new policy
+	ReevaluateOnConfigChange bool `yaml:"reevaluateOnConfigChange,omitempty"`
+	// ResolvedCommentEnabled comments on commits that resolve earlier findings
+	ResolvedCommentEnabled bool `yaml:"resolvedCommentEnabled,omitempty"`
+	// DifferentialReporting only comments on findings that are new on the
+	// branch, so that files reported before don't ping every author again
+	DifferentialReporting bool `yaml:"differentialReporting,omitempty"`
+	// LFSFixPullRequestEnabled opens a draft pull request that moves the
+	// files of a push with suggestions to Git LFS
+	LFSFixPullRequestEnabled bool `yaml:"lfsFixPullRequestEnabled,omitempty"`
+	// LFSAttributesPullRequestEnabled opens a pull request that adds
+	// filter=lfs patterns for the file types of a commit's suggestions to
+	// .gitattributes, unless LFSFixPullRequestEnabled moves the files
+	LFSAttributesPullRequestEnabled bool `yaml:"lfsAttributesPullRequestEnabled,omitempty"`
+	// CommentCooldown is the minimum time between comments on a branch.
+	// Findings pushed to the branch within it are added to the last comment.
+	CommentCooldown time.Duration `yaml:"commentCooldown,omitempty"`
+	// SizeLookup is the strategy to look up file sizes: "contents"
+	// (default) lists the directory of every file, "tree" reads the Git
+	// tree of a commit once, which takes fewer requests for large pushes
+	SizeLookup string `yaml:"sizeLookup,omitempty"`
+	// Symlinks is the treatment of symlinks: "error" (default), "skip",
+	// "warn" about symlinks pointing outside the repository, or "finding"
+	Symlinks string `yaml:"symlinks,omitempty"`
+	// SubmoduleHosts are the hosts submodule URLs may point to besides this
+	// GitHub, e.g. "git.example.com" or "*.example.com"
+	SubmoduleHosts []string `yaml:"submoduleHosts,omitempty"`
+	// BinaryChurnThreshold is the number of modifications within
+	// BinaryChurnWindow that make a binary file a binary-churn finding
+	BinaryChurnThreshold int           `yaml:"binaryChurnThreshold,omitempty"`
+	BinaryChurnWindow    time.Duration `yaml:"binaryChurnWindow,omitempty"`
+	// ReportOversizeLFSObjects reports pointers to Git LFS objects larger
+	// than LFSObjectSizeThreshold
+	ReportOversizeLFSObjects bool `yaml:"reportOversizeLFSObjects,omitempty"`
+	LFSObjectSizeThreshold   int  `yaml:"lfsObjectSizeThreshold,omitempty"`
+	// VendorPaths are patterns of vendored directories, e.g. "third_party/",
+	// whose files must not be Git LFS pointers
+	VendorPaths  []string               `yaml:"vendorPaths,omitempty"`
+	VendorFilter *filepathfilter.Filter `yaml:"-"`
+	// Extends lists configurations whose settings this one overrides:
+	// paths in the same commit, or "owner/repo:path" in the default branch
+	// of another repository
+	Extends []string `yaml:"extends,omitempty"`
+	// Rules enables, disables and grades individual rules by name
+	Rules map[string]RuleConfig `yaml:"rules,omitempty"`
+	// Suppressions exempt individual paths from individual rules
+	Suppressions []Suppression `yaml:"suppress,omitempty"`
+
+	// Commits with findings per author that are only reported in check
+	// runs, set by the installation settings
+	coachingViolations int
+	// Entries of lfsSizeExemptions with their own ceilings
+	sizeExemptions []sizeExemption
+}
+
+// DefaultConfig returns the configuration used for repositories without
+// a valid .github/watchdog.yml file
+func DefaultConfig() *Config {
+	return defaultWatchDogConfig()
 }
 
 // Return sensible defaults no matter what the error scenario
-func defaultWatchDogConfig() *watchdogConfig {
-	return &watchdogConfig{
-		HelpContact:                lfsHelpContact,
+func defaultWatchDogConfig() *Config {
+	return &Config{
+		HelpContact:                DefaultHelpContact(),
 		LFSSuggestionsEnabled:      true,
-		LFSSizeThreshold:           512000,
+		LFSSizeThreshold:           lfsSizeThreshold,
 		LFSSizeExemptionsThreshold: 20000000,
 		LFSCommitStatusEnabled:     false,
+		BinaryChurnThreshold:       defaultChurnThreshold,
+		BinaryChurnWindow:          defaultChurnWindow,
+		LFSObjectSizeThreshold:     defaultLFSObjectSizeThreshold,
 	}
 }
 
 // WatchDog holds all the state related to interacting with GitHub
 type WatchDog struct {
-	*github.Client
+	scm      scm.Client
+	reporter Reporter
+	// installationID selects the InstallationSettings, if any
+	installationID int64
 }
 
-// Check all commits of a push for LFS problems
-func (watchdog *WatchDog) Check(event *github.PushEvent) {
-	for _, commit := range event.Commits {
+// Check all commits of a push for LFS problems.
+// Check returns once all commits have been processed.
+func (watchdog *WatchDog) Check(event *github.PushEvent) *PushResult {
+	return watchdog.CheckWithProgress(event, nil)
+}
 
-		log.Printf("processing '%s' in '%s'\n", commit.GetID(), *event.GetRepo().FullName)
+// CheckWithProgress is like Check, but calls checked, if not nil, as soon
+// as each commit has been processed. Rate limited commits are passed to
+// checked once they have been checked again, see PushResult.WaitRetries.
+// checked may be called concurrently.
+func (watchdog *WatchDog) CheckWithProgress(event *github.PushEvent, checked func(*CommitResult)) *PushResult {
+	result := &PushResult{
+		Repo:    event.GetRepo().GetFullName(),
+		Ref:     event.GetRef(),
+		Commits: make([]*CommitResult, len(event.Commits)),
+		retries: &retryGroup{checked: checked},
+	}
+	defer watchdog.savePushReport(event, result)
+	ctx, cancel := checkContext()
+	defer cancel()
 
-		if !*commit.Distinct {
-			// Only process and comment on "distinct" commits
-			// https://developer.github.com/enterprise/2.12/v3/activity/events/types/#events-api-payload-29
-			// the .Distinct field indicates
-			// "Whether this commit is distinct from any that have been pushed before."
-			log.Printf("'%s' is not distinct in '%s'\n", commit.GetID(), *event.GetRepo().FullName)
-			continue
-		}
+	if isImport(event) {
+		watchdog.checkImport(ctx, event, result)
+		watchdog.proposeFix(ctx, event, result)
+		return result
+	}
+
+	// Payloads list at most 20 commits, the size counts all of them. Pushes
+	// above the limit are checked at their head commit, so the commits the
+	// payload omits are only fetched for pushes checked commit by commit.
+	size := len(event.Commits)
+	if event.GetSize() > size {
+		size = event.GetSize()
+	}
+	if max := int(atomic.LoadInt32(&maxCommitsPerPush)); max > 0 && size > max && len(event.Commits) > 0 {
+		watchdog.checkCollapsed(ctx, event, size, result)
+		watchdog.reevaluateHead(ctx, event, result)
+		watchdog.proposeFix(ctx, event, result)
+		return result
+	}
+
+	event = watchdog.completeCommits(ctx, event, result)
+	result.Commits = make([]*CommitResult, len(event.Commits))
+
+	var wg sync.WaitGroup
+	for i, commit := range event.Commits {
+
+		log.Printf("processing '%s' in '%s'\n", commit.GetID(), event.GetRepo().GetFullName())
 
 		// TODO: Limit the parallelism of the goroutine
 		// If someone pushes a lot of commits then we could generate an
 		// a large amount of parallel API requests against GitHub here.
-		go func(sha string, added []string, modified []string) {
-			var lfsCandidates []string
+		wg.Add(1)
+		go func(i int, commit *github.HeadCommit) {
+			defer wg.Done()
+			result.Commits[i] = watchdog.checkCommit(ctx, event, commit, 0, false, 1, result.retries)
+			result.retries.report(result.Commits[i])
+		}(i, commit)
+	}
+	wg.Wait()
 
-			config, err := watchdog.getWatchDogConfig(*event.GetRepo().GetOwner().Login, *event.GetRepo().Name, sha)
-			if err != nil {
-				log.Printf("could not obtain Watchdog configuration file for '%s': %v\n", *event.GetRepo().FullName, err)
-			}
+	watchdog.reevaluateHead(ctx, event, result)
+	watchdog.proposeFix(ctx, event, result)
+	return result
+}
 
-			if config.LFSCommitStatusEnabled {
-				if err := watchdog.pendingCommitStatus(*event.GetRepo().GetOwner().Login, *event.GetRepo().Name, sha); err != nil {
-					log.Printf("could not set a pending status for '%s': %v\n", *event.GetRepo().FullName, err)
-					// If we can't update the status to "pending",
-					// we nevertheless attempt adding comments and updating status to
-					// "success" or "failure".
-				}
-			}
+// Recheck evaluates a commit that was pushed before, e.g. while the watchdog
+// was down, with the current configuration and reports it like a new push
+func (watchdog *WatchDog) Recheck(ctx context.Context, owner, repo, sha string) (*CommitResult, error) {
+	c, err := watchdog.scm.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("could not get commit '%s': %w", sha, err)
+	}
 
-			files := added[:]
-			files = append(files, modified...)
+	log.Printf("rechecking '%s' in '%s/%s'\n", c.SHA, owner, repo)
+	event := &github.PushEvent{
+		Repo: &github.PushEventRepository{
+			Owner:    &github.User{Login: &owner},
+			Name:     &repo,
+			FullName: github.String(owner + "/" + repo),
+		},
+	}
+	headCommit := &github.HeadCommit{
+		ID:       &c.SHA,
+		Distinct: github.Bool(true),
+		Added:    c.Added,
+		Modified: c.Modified,
+		Removed:  c.Removed,
+		Author:   &github.CommitAuthor{Login: &c.Author, Email: &c.AuthorEmail},
+	}
+	return watchdog.checkCommit(ctx, event, headCommit, 0, false, 1, nil), nil
+}
 
-			for _, file := range files {
-				size, err := watchdog.getFileSize(*event.GetRepo().GetOwner().Login, *event.GetRepo().Name, sha, file)
-				if err != nil {
-					log.Printf("could not obtain file size for '%s' at '%s' in '%s': %v\n", file, sha, *event.GetRepo().FullName, err)
-					continue
-				}
+// Check a single commit of a push for LFS problems until ctx is done.
+// collapsed is the number of commits of the push that headCommit stands
+// for, if any. reevaluated is set if headCommit is the branch head with all
+// its files, evaluated again after the push changed the configuration.
+// Rate limited commits are checked again in retries, if not nil.
+func (watchdog *WatchDog) checkCommit(ctx context.Context, event *github.PushEvent, headCommit *github.HeadCommit, collapsed int, reevaluated bool, attempt int, retries *retryGroup) *CommitResult {
+	timings := Timings{Started: time.Now()}
+	if headCommit == nil {
+		headCommit = &github.HeadCommit{}
+	}
+	commit := &Commit{
+		Owner:       event.GetRepo().GetOwner().GetLogin(),
+		Repo:        event.GetRepo().GetName(),
+		SHA:         headCommit.GetID(),
+		Ref:         event.GetRef(),
+		Added:       headCommit.Added,
+		Modified:    headCommit.Modified,
+		Removed:     headCommit.Removed,
+		Author:      headCommit.GetAuthor().GetLogin(),
+		AuthorEmail: headCommit.GetAuthor().GetEmail(),
+		Pusher:      event.GetPusher().GetName(),
+		Collapsed:   collapsed,
+		Import:      collapsed > 0 && isImport(event),
+		Reevaluated: reevaluated,
+		ReportURL:   pushReportURL(event),
+		// The .Distinct field indicates "Whether this commit is distinct
+		// from any that have been pushed before." Commits pushed before were
+		// already commented on.
+		// https://developer.github.com/enterprise/2.12/v3/activity/events/types/#events-api-payload-29
+		StatusOnly: !headCommit.GetDistinct() || reevaluated,
+	}
 
-				log.Printf("'%s' has '%s' of size %d \n", *event.GetRepo().FullName, file, size)
-
-				if config.LFSSuggestionsEnabled {
-					if config.LFSExemptionsFilter != nil && config.LFSExemptionsFilter.Allows(file) {
-						if size > config.LFSSizeExemptionsThreshold { // Super large text file
-							lfsCandidates = append(lfsCandidates, file)
-						}
-					} else {
-						if size > config.LFSSizeThreshold { // Large binary file
-							lfsCandidates = append(lfsCandidates, file)
-						}
-					}
-				}
-			}
+	if commit.SHA == "" || commit.Owner == "" || commit.Repo == "" {
+		// Nothing can be looked up or reported without them
+		log.Printf("skipping commit '%s' in '%s': malformed push payload\n", commit.SHA, commit.FullName())
+		skippedCommits.Inc("malformed payload")
+		return &CommitResult{SHA: commit.SHA, Skipped: true, SkipReason: "malformed payload", Timings: timings}
+	}
 
-			if len(lfsCandidates) > 0 {
-				log.Printf("detected potential Git LFS files in '%s'\n", *event.GetRepo().FullName)
-				if config.LFSCommitStatusEnabled {
-					if err := watchdog.failCommitStatus(*event.GetRepo().GetOwner().Login, *event.GetRepo().Name, sha); err != nil {
-						log.Printf("could not update '%s' with a failed status: %v\n", *event.GetRepo().FullName, err)
-					}
-				}
+	nonDistinct := commit.StatusOnly && !commit.Reevaluated
+	skipNonDistinct := func() *CommitResult {
+		log.Printf("'%s' is not distinct in '%s'\n", commit.SHA, commit.FullName())
+		skippedCommits.Inc("not distinct")
+		return &CommitResult{SHA: commit.SHA, Skipped: true, SkipReason: "not distinct", Timings: timings}
+	}
+	// Most repositories don't process non-distinct commits. Unless the push
+	// changes the configuration, the last known one tells without
+	// requesting it again.
+	ref := configRef(event, commit.SHA)
+	if cached, ok := configCache.Get(commit.FullName()); ok && nonDistinct && ref != commit.SHA && !cached.(*Config).ProcessNonDistinctCommits {
+		return skipNonDistinct()
+	}
 
-				comment, err := watchdog.createComment(event.GetRepo().GetFullName(), lfsCandidates, config.HelpContact)
-				if err != nil {
-					log.Printf("could not create the LFSWatchdog comment for '%s' in '%s': %v\n", sha, *event.GetRepo().FullName, err)
-					// We can't create the comment, no sense trying to post it.
-					return
-				}
+	config, err := watchdog.getWatchDogConfig(ctx, commit.Owner, commit.Repo, ref)
+	if err != nil {
+		log.Printf("could not obtain Watchdog configuration file for '%s': %v\n", commit.FullName(), err)
+		err = fmt.Errorf("could not obtain configuration: %w", err)
+	}
+	timings.ConfigFetched = time.Now()
 
-				err = watchdog.postComment(*event.GetRepo().GetOwner().Login, *event.GetRepo().Name, sha, &comment)
-				if err != nil {
-					log.Printf("could not post the LFSWatchdog comment for '%s' in '%s': %v\n", sha, *event.GetRepo().FullName, err)
-				}
+	if nonDistinct && !config.ProcessNonDistinctCommits {
+		return skipNonDistinct()
+	}
+
+	settings, _ := GetInstallationSettings(watchdog.installationID)
+	config = settings.apply(config)
+
+	if contact := watchdog.resolveHelpContact(ctx, commit, config.HelpContact); contact != config.HelpContact {
+		// The configuration may be shared with other commits
+		resolved := *config
+		resolved.HelpContact = contact
+		config = &resolved
+	}
 
-			} else {
-				if config.LFSCommitStatusEnabled {
-					if err := watchdog.passCommitStatus(*event.GetRepo().GetOwner().Login, *event.GetRepo().Name, sha); err != nil {
-						log.Printf("could not update '%s' with a success status: %v\n", *event.GetRepo().FullName, err)
-					}
+	start := time.Now()
+	org, repo := commit.Owner, repoLabel(commit.FullName())
+	defer func() {
+		checkSeconds.Observe(time.Since(start).Seconds(), org, repo)
+	}()
+
+	reporter := watchdog.currentReporter(settings)
+	actions := reporter.Start(commit, config)
+
+	var result *CommitResult
+	if len(commit.Files()) == 0 {
+		// Nothing to measure, but the commit still gets its status and its
+		// removed files resolve earlier findings
+		logging.Debugf("not evaluating '%s' in '%s': no added or modified files\n", commit.SHA, commit.FullName())
+		skippedCommits.Inc("no files")
+		result = &CommitResult{SHA: commit.SHA, Skipped: true, SkipReason: "no files"}
+	} else {
+		result = watchdog.evaluate(ctx, commit, config)
+	}
+	if timedOut(ctx) {
+		log.Printf("checking '%s' in '%s' timed out, reporting partial results\n", commit.SHA, commit.FullName())
+		checkTimeouts.Inc()
+		result.TimedOut = true
+	}
+	applyGracePeriod(commit, result)
+	timings.SizesFetched = time.Now()
+	result.Timings = timings
+	if err != nil {
+		result.Errors = append([]error{err}, result.Errors...)
+	}
+
+	if reset, limited := rateLimited(append([]error{err}, result.Errors...)); limited && attempt <= maxRateLimitRetries {
+		// Findings are incomplete, report them once the limit is reset
+		log.Printf("checking '%s' in '%s' was rate limited, retrying at %s\n", commit.SHA, commit.FullName(), reset.Format(time.RFC3339))
+		result.RetryAt = reset
+		if r, ok := reporter.(retryReporter); ok {
+			actions = append(actions, r.Retry(commit, config, reset)...)
+		}
+		result.Actions = actions
+		if retries != nil {
+			retries.Add(1)
+		}
+		afterFunc(time.Until(reset)+retryDelay, func() {
+			ctx, cancel := checkContext()
+			defer cancel()
+			retried := watchdog.checkCommit(ctx, event, headCommit, collapsed, reevaluated, attempt+1, retries)
+			if retries != nil {
+				// The head evaluated again isn't one of the pushed commits
+				if !reevaluated {
+					retries.report(retried)
 				}
+				retries.Done()
 			}
+		})
+		return result
+	}
+
+	markPreExisting(commit, result)
+	result.Actions = append(actions, reporter.Report(commit, config, result)...)
+	if commit.Reevaluated {
+		// The files didn't change, their findings were counted and recorded
+		// when they were pushed
+		result.Timings.Reported = time.Now()
+		return result
+	}
+	rules := make([]string, len(result.Findings))
+	for i, finding := range result.Findings {
+		findingsTotal.Inc(org, repo, finding.Rule)
+		rules[i] = finding.Rule
+	}
+	telemetry.RecordCommit(commit.FullName(), rules)
+
+	if DryRun() || settings.DryRun {
+		// Dry runs neither open nor resolve findings
+		result.Timings.Reported = time.Now()
+		return result
+	}
+	resolved := recordViolations(commit, result)
+	recordChanges(commit, result.changed, config.BinaryChurnWindow)
+	for _, v := range resolved {
+		result.Resolved = append(result.Resolved, v.Finding)
+	}
+	if r, ok := reporter.(resolutionReporter); ok && len(resolved) > 0 {
+		result.Actions = append(result.Actions, r.Resolve(commit, config, resolved)...)
+	}
+	result.Timings.Reported = time.Now()
+	return result
+}
 
-		}(commit.GetID(), commit.Added, commit.Modified)
+// rateLimited returns the latest reset time of all rate limit errors
+func rateLimited(errs []error) (time.Time, bool) {
+	var latest time.Time
+	var limited bool
+	for _, err := range errs {
+		if reset, ok := scm.RateLimitReset(err); ok {
+			limited = true
+			if reset.After(latest) {
+				latest = reset
+			}
+		}
 	}
+	return latest, limited
 }
 
-func (watchdog *WatchDog) getWatchDogConfig(org, repo, ref string) (*watchdogConfig, error) {
-	content, err := watchdog.getFileContent(org, repo, ref, configFile)
+func (watchdog *WatchDog) getWatchDogConfig(ctx context.Context, org, repo, ref string) (*Config, error) {
+	key := org + "/" + repo
+	content, err := watchdog.getConfigContent(ctx, org, repo, ref)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			// Repositories without a configuration use the defaults
+			configCache.Add(key, defaultWatchDogConfig())
+			return defaultWatchDogConfig(), nil
+		}
+		// Don't change enforcement because of a transient error
+		if config, ok := configCache.Get(key); ok {
+			log.Printf("using the last known configuration of '%s': %v\n", key, err)
+			configFallbacks.Inc()
+			return config.(*Config), nil
+		}
+		return defaultWatchDogConfig(), err
+	}
+
+	documents, err := watchdog.resolveExtends(ctx, configSource{org, repo, ref, configFile}, []byte(content))
 	if err != nil {
+		if config, ok := configCache.Get(key); ok && transientExtendsError(err) {
+			log.Printf("using the last known configuration of '%s': %v\n", key, err)
+			configFallbacks.Inc()
+			return config.(*Config), nil
+		}
 		return defaultWatchDogConfig(), err
 	}
 
-	config := &watchdogConfig{}
-	err = yaml.UnmarshalStrict([]byte(content), config)
+	config, err := parseConfigDocuments(documents)
+	if err == nil {
+		configCache.Add(key, config)
+	}
+	return config, err
+}
+
+// ParseConfig parses the content of a .github/watchdog.yml file.
+// Settings missing from the file keep their default values.
+// It returns the default configuration if the content is invalid.
+// Configurations listed in extends are not read.
+func ParseConfig(content []byte) (*Config, error) {
+	return parseConfigDocuments([][]byte{content})
+}
+
+// Parse configuration documents in order, later documents override the
+// settings of earlier ones
+func parseConfigDocuments(documents [][]byte) (*Config, error) {
+	config := defaultWatchDogConfig()
+	var err error
+	for _, content := range documents {
+		if err = yaml.UnmarshalStrict(content, config); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = config.validateRules()
+	}
+	if err == nil {
+		err = config.validateSuppressions()
+	}
+	if err == nil {
+		err = config.validateSymlinks()
+	}
+	if err == nil {
+		err = config.validateSizeLookup()
+	}
+	if err == nil {
+		err = config.validateChurn()
+	}
+	if err == nil {
+		err = config.validateLFSObjects()
+	}
+	if err == nil {
+		err = config.validateHelpContact()
+	}
+	if err == nil {
+		err = config.validateExemptions()
+	}
 	if err != nil {
 		return defaultWatchDogConfig(), err
 	}
 
-	config.LFSExemptionsFilter = filepathfilter.New(strings.Fields(config.LFSSizeExemptions), nil)
+	if len(config.VendorPaths) > 0 {
+		config.VendorFilter = newPathFilter(config.VendorPaths)
+	}
 	return config, nil
 }
 
 // New creates a new WatchDog object
-func New(client *github.Client) *WatchDog {
-	return &WatchDog{
-		Client: client,
+func New(client scm.Client) *WatchDog {
+	watchdog := &WatchDog{
+		scm: client,
 	}
+	watchdog.reporter = &gitHubReporter{watchdog}
+	return watchdog
 }
 
-// GetFile returns the content of a file from a GitHub repository.
-func (watchdog *WatchDog) getFileContent(org, repo, ref, file string) (string, error) {
-	fileContent, _, _, err := watchdog.Repositories.GetContents(
-		context.Background(),
-		org,
-		repo,
-		file,
-		&github.RepositoryContentGetOptions{Ref: ref},
-	)
+// SCM returns the client of the watchdog's installation
+func (watchdog *WatchDog) SCM() scm.Client {
+	return watchdog.scm
+}
 
-	if err != nil {
-		return "", err
-	}
+// SetInstallation applies the InstallationSettings of an installation to
+// all checks
+func (watchdog *WatchDog) SetInstallation(installationID int64) {
+	watchdog.installationID = installationID
+}
+
+// SetReporter replaces the reporter that posts comments and statuses to GitHub
+func (watchdog *WatchDog) SetReporter(reporter Reporter) {
+	watchdog.reporter = reporter
+}
+
+// Set while all watchdogs only log what they would report
+var dryRun int32
 
-	if fileContent == nil {
-		return "", fmt.Errorf("unexpected missing content for file %s at sha %s", file, ref)
+// SetDryRun turns the global dry-run mode on or off. In dry-run mode all
+// watchdogs log their findings instead of posting to GitHub.
+func SetDryRun(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
 	}
+	atomic.StoreInt32(&dryRun, v)
+}
 
-	content, err := fileContent.GetContent()
-	if err != nil {
-		return "", err
+// DryRun reports whether the global dry-run mode is on
+func DryRun() bool {
+	return atomic.LoadInt32(&dryRun) != 0
+}
+
+func (watchdog *WatchDog) currentReporter(settings InstallationSettings) Reporter {
+	if DryRun() || settings.DryRun {
+		return DryRunReporter{}
 	}
+	return watchdog.reporter
+}
 
-	return content, nil
+// GetFile returns the content of a file from a GitHub repository.
+func (watchdog *WatchDog) getFileContent(ctx context.Context, org, repo, ref, file string) (string, error) {
+	return watchdog.scm.GetFileContent(ctx, org, repo, ref, file)
 }
 
 // Retrieve the metadata of a directory to obtain file size information
 // c.f. https://developer.github.com/v3/repos/contents/
-func (watchdog *WatchDog) getDirContent(org, repo, ref, path string) ([]*github.RepositoryContent, error) {
-	_, dirContent, _, err := watchdog.Repositories.GetContents(
-		context.Background(),
-		org,
-		repo,
-		path,
-		&github.RepositoryContentGetOptions{Ref: ref},
-	)
+func (watchdog *WatchDog) getDirContent(ctx context.Context, org, repo, ref, path string) ([]*scm.Entry, error) {
+	dirContent, err := watchdog.scm.GetDirContent(ctx, org, repo, ref, path)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if dirContent == nil {
-		return nil, fmt.Errorf("directory '%s' in '%s/%s' has no content", path, org, repo)
+		return nil, &emptyDirError{path, org + "/" + repo}
 	}
 
 	if len(dirContent) >= 1000 {
@@ -226,111 +636,497 @@ func (watchdog *WatchDog) getDirContent(org, repo, ref, path string) ([]*github.
 	return dirContent, nil
 }
 
-func (watchdog *WatchDog) getFileSize(org, repo, ref, file string) (int, error) {
-	directory := filepath.Dir(file)
-	dirContent, err := watchdog.getDirContent(org, repo, ref, directory)
-
-	switch err {
-	case nil:
-		// process directory
-	case errGetContentsUpperLimit:
-		// process directory, despite reaching API limit
-		// The result set might not contain our desired file.
-	default:
+func (watchdog *WatchDog) getFileSize(ctx context.Context, org, repo, ref, file string) (int, error) {
+	entry, err := watchdog.getFileEntry(ctx, org, repo, ref, file)
+	if err != nil {
 		return -1, err
 	}
+	if entry.Type != "file" {
+		return -1, fmt.Errorf("for file '%s' at ref '%s', name '%s' matches, but object is a %s", file, ref, file, entry.Type)
+	}
+	return entry.Size, nil
+}
+
+// Look up the directory entry of a file. Replicas may serve a pushed
+// commit before they have it, or before its directory listings are
+// complete, e.g. for commits created in the web UI or with the contents
+// API. Lookups of files that are not found are retried.
+func (watchdog *WatchDog) getFileEntry(ctx context.Context, org, repo, ref, file string) (*scm.Entry, error) {
+	return watchdog.retryLookup(ctx, org, repo, ref, file, watchdog.lookupFileEntry)
+}
+
+// Look up the entry of a file with lookup, retrying files that are not found
+func (watchdog *WatchDog) retryLookup(ctx context.Context, org, repo, ref, file string, lookup entryLookup) (*scm.Entry, error) {
+	delay := lookupRetryDelay
+	for attempt := 1; ; attempt++ {
+		entry, err := lookup(ctx, org, repo, ref, file)
+		reason := lookupRetryReason(err)
+		if reason == "" || attempt > maxLookupRetries {
+			return entry, err
+		}
+		lookupRetries.Inc(reason)
+		log.Printf("'%s' is %s at '%s' in '%s/%s', retrying in %s\n", file, reason, ref, org, repo, delay)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		delay *= 2
+	}
+}
 
-	for _, entry := range dirContent {
-		if entry.GetPath() == file {
-			if entry.GetType() == "file" {
-				return entry.GetSize(), nil
+// Look up the entries of files concurrently with lookup, retrying the files
+// that are not found in rounds. Lookups hold a slot of the lookup pool, the
+// delays between rounds don't.
+func (watchdog *WatchDog) lookupEntries(ctx context.Context, commit *Commit, files []string, lookup entryLookup) ([]*scm.Entry, []error) {
+	entries := make([]*scm.Entry, len(files))
+	errs := make([]error, len(files))
+	pending := make([]int, len(files))
+	for i := range pending {
+		pending[i] = i
+	}
+	delay := lookupRetryDelay
+	for attempt := 1; ; attempt++ {
+		forEachLookup(len(pending), func(j int) {
+			i := pending[j]
+			if errs[i] = ctx.Err(); errs[i] == nil {
+				entries[i], errs[i] = lookup(ctx, commit.Owner, commit.Repo, commit.SHA, files[i])
+			}
+		})
+		if attempt > maxLookupRetries {
+			return entries, errs
+		}
+		retry := pending[:0]
+		for _, i := range pending {
+			reason := lookupRetryReason(errs[i])
+			if reason == "" {
+				continue
 			}
-			return -1, fmt.Errorf("for file '%s' at ref '%s', name '%s' matches, but object is a %s", file, ref, file, entry.GetType())
+			lookupRetries.Inc(reason)
+			log.Printf("'%s' is %s at '%s' in '%s', retrying in %s\n", files[i], reason, commit.SHA, commit.FullName(), delay)
+			retry = append(retry, i)
 		}
+		if len(retry) == 0 {
+			return entries, errs
+		}
+		if err := sleep(ctx, delay); err != nil {
+			for _, i := range retry {
+				entries[i], errs[i] = nil, err
+			}
+			return entries, errs
+		}
+		pending = retry
+		delay *= 2
 	}
+}
 
-	switch err {
-	case errGetContentsUpperLimit:
-		// The result set indeed did not contain our desired file.
-		// TODO: Use the Get Trees API if we run into the 1,000 file limit.
-		// https://developer.github.com/v3/git/trees/#get-a-tree
-		return -1, err
-	default:
-		// The push webhook payload referenced a file that is not available!
-		return -1, fmt.Errorf("something is seriously wrong with file '%s' at ref '%s' in repo '%s/%s'", file, ref, org, repo)
+// Returns why a lookup that failed with err should be retried, or an empty
+// string if it should not
+func lookupRetryReason(err error) string {
+	var missing *missingFileError
+	var empty *emptyDirError
+	switch {
+	// Both are ErrNotFound, but GitHub has the commit already
+	case errors.As(err, &missing), errors.As(err, &empty):
+		return "missing"
+	case errors.Is(err, ErrNotFound):
+		return "not found"
 	}
+	return ""
 }
 
-// Create a comment message based on the found failures
-func (watchdog *WatchDog) createComment(repoFullName string, lfsCandidates []string, helpContact string) (string, error) {
-	t, err := template.New("master").Parse(lfsMessageTemplate)
+// missingFileError is returned for files of the push payload that are
+// missing from their directory listing
+type missingFileError struct {
+	file, ref, repo string
+}
+
+func (e *missingFileError) Error() string {
+	return fmt.Sprintf("something is seriously wrong with file '%s' at ref '%s' in repo '%s'", e.file, e.ref, e.repo)
+}
+
+func (e *missingFileError) Is(target error) bool { return target == ErrNotFound }
+
+// emptyDirError is returned for directories of the push payload without
+// entries
+type emptyDirError struct {
+	dir, repo string
+}
+
+func (e *emptyDirError) Error() string {
+	return fmt.Sprintf("directory '%s' in '%s' has no content", e.dir, e.repo)
+}
+
+func (e *emptyDirError) Is(target error) bool { return target == ErrNotFound }
+
+func (watchdog *WatchDog) lookupFileEntry(ctx context.Context, org, repo, ref, file string) (*scm.Entry, error) {
+	directory := filepath.Dir(file)
+	largeDir := org + "/" + repo + "\x00" + directory
+	if _, ok := largeDirCache.Get(largeDir); ok {
+		entry, err := watchdog.lookupLargeDirEntry(ctx, org, repo, ref, file)
+		if err != nil {
+			return nil, err
+		}
+		return watchdog.resolveEntry(ctx, org, repo, ref, file, entry)
+	}
+	dirContent, err := watchdog.getDirContent(ctx, org, repo, ref, directory)
+
+	if err != nil && !errors.Is(err, ErrTooLarge) {
+		return nil, err
+	}
+	// Process the directory despite reaching the API limit, the result set
+	// might not contain our desired file
+
+	// The payload and the contents API may disagree on the normal form
+	for _, entry := range dirContent {
+		if normalizePath(entry.Path) == normalizePath(file) {
+			return watchdog.resolveEntry(ctx, org, repo, ref, file, entry)
+		}
+	}
+
+	if errors.Is(err, ErrTooLarge) {
+		// The result set indeed did not contain our desired file, but Git
+		// trees do not have a limit
+		largeDirCache.Add(largeDir, true)
+		entry, err := watchdog.lookupLargeDirEntry(ctx, org, repo, ref, file)
+		if err != nil {
+			return nil, err
+		}
+		return watchdog.resolveEntry(ctx, org, repo, ref, file, entry)
+	}
+	// The push webhook payload referenced a file that is not available!
+	return nil, &missingFileError{file, ref, org + "/" + repo}
+}
+
+// Return the entry of a file, measuring its size if it isn't listed
+func (watchdog *WatchDog) resolveEntry(ctx context.Context, org, repo, ref, file string, entry *scm.Entry) (*scm.Entry, error) {
+	if entry.Type == "file" && entry.Size == 0 && entry.SHA != emptyBlobSHA {
+		return watchdog.lookupRawSize(ctx, org, repo, ref, entry)
+	}
+	if entry.Type != "dir" {
+		return entry, nil
+	}
+	return nil, fmt.Errorf("for file '%s' at ref '%s', name '%s' matches, but object is a %s", file, ref, file, entry.Type)
+}
+
+// Measure a file whose listing reports a size of 0 although it isn't
+// empty, which GitHub does for very large blobs
+func (watchdog *WatchDog) lookupRawSize(ctx context.Context, org, repo, ref string, entry *scm.Entry) (*scm.Entry, error) {
+	size, err := watchdog.scm.GetRawSize(ctx, org, repo, ref, entry.Path)
 	if err != nil {
-		return "", fmt.Errorf("parsing comment template failed: %v", err)
+		return nil, fmt.Errorf("could not measure '%s' at ref '%s': %w", entry.Path, ref, err)
 	}
+	log.Printf("'%s' at '%s' in '%s/%s' is listed without its size of %d bytes\n", entry.Path, ref, org, repo, size)
+	measured := *entry
+	measured.Size = size
+	return &measured, nil
+}
 
-	values := struct {
-		LFSCandidates      []string
-		LFSHelpContact     string
-		LFSSizeThresholdKB int
-	}{
-		lfsCandidates,
-		helpContact,
-		lfsSizeThreshold / 1024,
+// Create a comment message based on the found failures. Candidates are
+// listed by the rule and threshold they violate, candidates that don't fit
+// into a comment are summarized.
+func (watchdog *WatchDog) createComment(repoFullName string, config *Config, findings []Finding, author string) (string, error) {
+	t, err := template.New("master").Parse(lfsMessageTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parsing comment template failed: %v", err)
 	}
 
-	var buf bytes.Buffer
-	err = t.Execute(&buf, values)
+	groups, err := commentGroups(config, findings)
 	if err != nil {
 		return "", fmt.Errorf("could not generate error message for '%s': %v", repoFullName, err)
 	}
+	return fitComment(len(findings), func(shown int) (string, error) {
+		var omitted string
+		if n := len(findings) - shown; n > 0 {
+			omitted = fmt.Sprintf("%d more %s", n, pluralize(n, "file", "files"))
+		}
+
+		// Show the first candidates in group order
+		var shownGroups []commentGroup
+		for _, group := range groups {
+			if shown == 0 {
+				break
+			}
+			if len(group.Candidates) > shown {
+				group.Candidates = group.Candidates[:shown]
+			}
+			shown -= len(group.Candidates)
+			shownGroups = append(shownGroups, group)
+		}
 
-	return buf.String(), nil
+		values := struct {
+			Groups         []commentGroup
+			LFSOmitted     string
+			LFSHelpContact string
+			Author         string
+		}{
+			shownGroups,
+			omitted,
+			config.HelpContact,
+			author,
+		}
+
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, values); err != nil {
+			return "", fmt.Errorf("could not generate error message for '%s': %v", repoFullName, err)
+		}
+		return buf.String(), nil
+	})
+}
+
+// commentGroup lists the candidates that violate the same rule and threshold
+type commentGroup struct {
+	Rule      RuleInfo
+	Threshold string
+	// Exempt is set for files matching lfsSizeExemptions
+	Exempt bool
+	// Headline is the headline of the rule rendered for the group
+	Headline   string
+	Candidates []string
+
+	threshold int
+}
+
+// Group findings by rule and threshold, ordered by rule ID and threshold
+func commentGroups(config *Config, findings []Finding) ([]commentGroup, error) {
+	type key struct {
+		rule      string
+		threshold int
+		exempt    bool
+	}
+	index := make(map[key]int)
+	var groups []commentGroup
+	for _, finding := range findings {
+		exempt := finding.Rule == RuleOversizeFile && config.LFSExemptionsFilter != nil && config.LFSExemptionsFilter.Allows(normalizePath(finding.Path))
+		k := key{finding.Rule, finding.Threshold, exempt}
+		i, ok := index[k]
+		if !ok {
+			rule, _ := LookupRule(finding.Rule)
+			group := commentGroup{
+				Rule:      rule,
+				Threshold: formatSize(finding.Threshold),
+				Exempt:    exempt,
+				threshold: finding.Threshold,
+			}
+			headline, err := rule.render(rule.Headline, group)
+			if err != nil {
+				return nil, err
+			}
+			group.Headline = headline
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, group)
+		}
+		candidate := codeSpan(finding.Path)
+		if finding.Rule == RuleLockedFile {
+			candidate += fmt.Sprintf(" (locked by %s)", finding.LockedBy)
+		}
+		if finding.Rule == RuleSymlink || groups[i].Rule.Family == "submodule" {
+			candidate += " → " + codeSpan(finding.Target)
+		}
+		if finding.Commit != "" {
+			candidate += fmt.Sprintf(" (commit %s not found)", codeSpan(shortSHA(finding.Commit)))
+		}
+		if finding.Rule == RuleBinaryChurn {
+			candidate += fmt.Sprintf(" (changed %d times in %s)", finding.Changes, formatWindow(config.BinaryChurnWindow))
+		}
+		if finding.Rule == RuleOversizeLFSObject {
+			candidate += fmt.Sprintf(" (%s)", formatSize(finding.Size))
+		}
+		if finding.Format != "" {
+			candidate += fmt.Sprintf(" (%s)", finding.Format)
+		}
+		rule := groups[i].Rule
+		remediation, err := rule.render(rule.Remediation, finding)
+		if err != nil {
+			return nil, err
+		}
+		candidate += remediation
+		groups[i].Candidates = append(groups[i].Candidates, candidate)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Rule.ID != groups[j].Rule.ID {
+			return groups[i].Rule.ID < groups[j].Rule.ID
+		}
+		return groups[i].threshold < groups[j].threshold
+	})
+	return groups, nil
+}
+
+// Render a comment listing as many of n items as fit into a comment body.
+// render is called with the number of items to show.
+func fitComment(n int, render func(shown int) (string, error)) (string, error) {
+	comment, err := render(n)
+	if err != nil || utf8.RuneCountInString(comment) <= maxCommentBody {
+		return comment, err
+	}
+
+	// Find the largest number of items that fit
+	lo, hi := 0, n-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		comment, err := render(mid)
+		if err != nil {
+			return "", err
+		}
+		if utf8.RuneCountInString(comment) <= maxCommentBody {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	comment, err = render(lo)
+	if err != nil {
+		return "", err
+	}
+	return truncate(comment, maxCommentBody), nil
 }
 
 // Post a comment to a given commit
 func (watchdog *WatchDog) postComment(org, repo, ref string, comment *string) error {
-	_, _, err := watchdog.Repositories.CreateComment(
-		context.Background(),
-		org,
-		repo,
-		ref,
-		&github.RepositoryComment{Body: comment},
-	)
-
+	_, err := watchdog.scm.CreateComment(context.Background(), org, repo, ref, *comment)
 	return err
 }
 
 func (watchdog *WatchDog) updateCommitStatus(org, repo, ref string, state string, description string) error {
-	statusContext := "LFSWatchDog"
-	commitStatus := &github.RepoStatus{
-		Context:     &statusContext,
-		State:       &state,
-		Description: &description,
-	}
-	_, _, err := watchdog.Repositories.CreateStatus(
-		context.Background(),
-		org,
-		repo,
-		ref,
-		commitStatus,
-	)
-	return err
+	return watchdog.updateCommitStatusContext(org, repo, ref, defaultStatusContext, state, description, "")
+}
+
+// Set a commit status that links to targetURL, if not empty
+func (watchdog *WatchDog) updateCommitStatusContext(org, repo, ref, statusContext, state, description, targetURL string) error {
+	commitStatus := &scm.Status{
+		Context:     statusContext,
+		State:       state,
+		Description: description,
+		TargetURL:   targetURL,
+	}
+	return watchdog.scm.CreateStatus(context.Background(), org, repo, ref, commitStatus)
 }
 
-func (watchdog *WatchDog) failCommitStatus(org, repo, ref string) error {
+func (watchdog *WatchDog) failCommitStatus(org, repo, ref, statusContext, targetURL string, findings []Finding) error {
 	state := "failure"
-	description := "LFS error! See commit comments..."
-	return watchdog.updateCommitStatus(org, repo, ref, state, description)
+	description := statusDescription(findings)
+	return watchdog.updateCommitStatusContext(org, repo, ref, statusContext, state, description, targetURL)
+}
+
+// Summarize findings like "3 files >500KB, 1 file >19MB, 1 file locked, 2 symlinks"
+func statusDescription(findings []Finding) string {
+	counts := make(map[int]int)
+	var thresholds []int
+	locked, symlinks, submodules, churn, lfsObjects, vendored, buildOutputs, bypassed := 0, 0, 0, 0, 0, 0, 0, 0
+	for _, finding := range findings {
+		if finding.Rule == RuleBypassedLFS {
+			bypassed++
+			continue
+		}
+		if finding.Rule == RuleBuildOutput {
+			buildOutputs++
+			continue
+		}
+		if finding.Rule == RuleVendoredPointer {
+			vendored++
+			continue
+		}
+		if finding.Rule == RuleBinaryChurn {
+			churn++
+			continue
+		}
+		if finding.Rule == RuleOversizeLFSObject {
+			lfsObjects++
+			continue
+		}
+		if ruleFamily(finding.Rule) == "submodule" {
+			submodules++
+			continue
+		}
+		if finding.Rule == RuleLockedFile {
+			locked++
+			continue
+		}
+		if finding.Rule == RuleSymlink {
+			symlinks++
+			continue
+		}
+		if counts[finding.Threshold] == 0 {
+			thresholds = append(thresholds, finding.Threshold)
+		}
+		counts[finding.Threshold]++
+	}
+	sort.Ints(thresholds)
+
+	var parts []string
+	for _, threshold := range thresholds {
+		noun := "files"
+		if counts[threshold] == 1 {
+			noun = "file"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s >%s", counts[threshold], noun, formatSize(threshold)))
+	}
+	if locked > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s locked", locked, pluralize(locked, "file", "files")))
+	}
+	if symlinks > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", symlinks, pluralize(symlinks, "symlink", "symlinks")))
+	}
+	if churn > 0 {
+		parts = append(parts, fmt.Sprintf("%d binary %s changed often", churn, pluralize(churn, "file", "files")))
+	}
+	if lfsObjects > 0 {
+		parts = append(parts, fmt.Sprintf("%d large Git LFS %s", lfsObjects, pluralize(lfsObjects, "object", "objects")))
+	}
+	if vendored > 0 {
+		parts = append(parts, fmt.Sprintf("%d vendored Git LFS %s", vendored, pluralize(vendored, "pointer", "pointers")))
+	}
+	if buildOutputs > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", buildOutputs, pluralize(buildOutputs, "build output", "build outputs")))
+	}
+	if bypassed > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s bypassed Git LFS", bypassed, pluralize(bypassed, "file", "files")))
+	}
+	if submodules > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", submodules, pluralize(submodules, "submodule finding", "submodule findings")))
+	}
+
+	description := strings.Join(parts, ", ")
+	if description == "" {
+		description = "LFS error! See commit comments..."
+	}
+	return truncate(description, maxStatusDescription)
+}
+
+// Format a size in bytes in the same units as the comment template
+func formatSize(size int) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%dMB", size/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%dKB", size/1024)
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
+
+// Shorten s to at most max characters
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// Describe why a commit could not be evaluated
+func errorDescription(errs []error) string {
+	return fmt.Sprintf("could not evaluate the commit (%d %s)", len(errs), pluralize(len(errs), "error", "errors"))
 }
 
-func (watchdog *WatchDog) passCommitStatus(org, repo, ref string) error {
+func (watchdog *WatchDog) passCommitStatus(org, repo, ref, statusContext, targetURL string) error {
 	state := "success"
 	description := "all clear!"
-	return watchdog.updateCommitStatus(org, repo, ref, state, description)
+	return watchdog.updateCommitStatusContext(org, repo, ref, statusContext, state, description, targetURL)
 }
 
-func (watchdog *WatchDog) pendingCommitStatus(org, repo, ref string) error {
+func (watchdog *WatchDog) pendingCommitStatus(org, repo, ref, statusContext, targetURL string) error {
 	state := "pending"
 	description := "Checking for LFS errors and files ..."
-	return watchdog.updateCommitStatus(org, repo, ref, state, description)
+	return watchdog.updateCommitStatusContext(org, repo, ref, statusContext, state, description, targetURL)
 }
@@ -1,35 +1,57 @@
 package watchdog
 
 import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"net/http/httptest"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"git.autodesk.com/github-solutions/lfswatchdog/githubtest"
+	"git.autodesk.com/github-solutions/lfswatchdog/logging"
+	"git.autodesk.com/github-solutions/lfswatchdog/metrics"
+	"git.autodesk.com/github-solutions/lfswatchdog/scm"
+	"git.autodesk.com/github-solutions/lfswatchdog/store"
+	"github.com/git-lfs/git-lfs/filepathfilter"
 	"github.com/google/go-github/v35/github"
 	"github.com/stretchr/testify/assert"
 )
 
-// Setup a HTTP test server to serve mocked API responses.
-func setup() (mux *http.ServeMux, server *httptest.Server) {
-	mux = http.NewServeMux()
-	server = httptest.NewServer(mux)
-	return mux, server
+// Setup a fake GitHub server to serve mocked API responses.
+func setup() (mux *http.ServeMux, server *githubtest.Server) {
+	server = githubtest.NewServer()
+	return server.Mux, server
 }
 
-// Shutdown HTTP test server.
-func teardown(server *httptest.Server) {
+// Shutdown fake GitHub server.
+func teardown(server *githubtest.Server) {
 	server.Close()
 }
 
+// Build a push of commits to a repository ("owner/repo")
+func pushEvent(repo string, commits []*github.HeadCommit) *github.PushEvent {
+	parts := strings.SplitN(repo, "/", 2)
+	owner, name := parts[0], parts[1]
+	return &github.PushEvent{
+		Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: commits,
+	}
+}
+
 func newWatchDog(url string) *WatchDog {
 	http := http.DefaultClient
 	client, _ := github.NewEnterpriseClient(url, url, http)
-	w := New(client)
+	w := New(scm.NewGitHub(client))
 	return w
 }
 func TestGetFile(t *testing.T) {
@@ -54,7 +76,7 @@ func TestGetFile(t *testing.T) {
 			fmt.Fprintf(rw, "%s", payload)
 		},
 	)
-	retrieved, err := w.getFileContent("test-org", "test-repo", "abc123", path)
+	retrieved, err := w.getFileContent(context.Background(), "test-org", "test-repo", "abc123", path)
 	assert.Nil(t, err)
 	assert.Equal(t, "something else", retrieved)
 }
@@ -78,11 +100,11 @@ func TestGetDirContent(t *testing.T) {
 		},
 	)
 
-	dir, err := w.getDirContent("test-org", "test-repo", "abc123", path)
+	dir, err := w.getDirContent(context.Background(), "test-org", "test-repo", "abc123", path)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(dir))
-	assert.Equal(t, *dir[0].Name, "file1")
-	assert.Equal(t, *dir[1].Name, "file2")
+	assert.Equal(t, dir[0].Name, "file1")
+	assert.Equal(t, dir[1].Name, "file2")
 }
 
 func TestGetFileSize(t *testing.T) {
@@ -104,27 +126,176 @@ func TestGetFileSize(t *testing.T) {
 		},
 	)
 
-	size, err := w.getFileSize("test-org", "test-repo", "abc123", "some/path/file1")
+	size, err := w.getFileSize(context.Background(), "test-org", "test-repo", "abc123", "some/path/file1")
 	assert.Nil(t, err)
 	assert.Equal(t, 5, size)
-	_, err = w.getFileSize("test-org", "test-repo", "abc123", "some/path/file2")
+	_, err = w.getFileSize(context.Background(), "test-org", "test-repo", "abc123", "some/path/file2")
 	assert.NotNil(t, err)
 	assert.True(t, strings.HasPrefix(err.Error(), "for file 'some/path/file2' at ref 'abc123', name 'some/path/file2' matches, but object is a symlink"))
 }
 
+func TestGetFileSizeFromFakeRepo(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	server.AddFileWithSize("test-org/test-repo", "abc123", "assets/textures/big.png", 700000)
+	server.AddFile("test-org/test-repo", "abc123", "assets/README.md", []byte("hello"))
+	server.InjectError("GET", "repos/test-org/test-repo/contents/assets/textures", http.StatusBadGateway, 1)
+
+	_, err := w.getFileSize(context.Background(), "test-org", "test-repo", "abc123", "assets/textures/big.png")
+	assert.NotNil(t, err)
+
+	size, err := w.getFileSize(context.Background(), "test-org", "test-repo", "abc123", "assets/textures/big.png")
+	assert.Nil(t, err)
+	assert.Equal(t, 700000, size)
+	assert.Equal(t, 2, server.Calls("GET repos/test-org/test-repo/contents/assets/textures"))
+}
+
+func TestGetFileSizeBeyondContentsLimit(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	treeCache.Clear()
+	treeIndexCache.Clear()
+	largeDirCache.Clear()
+
+	for i := 0; i < 1000; i++ {
+		server.AddFile("test-org/huge-repo", "abc123", fmt.Sprintf("generated/%04d.json", i), []byte("{}"))
+	}
+	server.AddFileWithSize("test-org/huge-repo", "abc123", "generated/mesh.bin", 700000)
+	server.AddFileWithSize("test-org/huge-repo", "abc123", "generated/texture.png", 300000)
+
+	// Both files are listed after the first 1,000 entries
+	size, err := w.getFileSize(context.Background(), "test-org", "huge-repo", "abc123", "generated/mesh.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, 700000, size)
+	size, err = w.getFileSize(context.Background(), "test-org", "huge-repo", "abc123", "generated/texture.png")
+	assert.Nil(t, err)
+	assert.Equal(t, 300000, size)
+
+	// The tree is fetched once for all files of the commit
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/huge-repo/git/trees/abc123"))
+
+	size, err = w.getFileSize(context.Background(), "test-org", "huge-repo", "abc123", "generated/0001.json")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, size)
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/huge-repo/git/trees/abc123"))
+}
+
+func TestLargeDirectoryTreesAcrossCommits(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	treeCache.Clear()
+	treeIndexCache.Clear()
+	largeDirCache.Clear()
+
+	repo := "test-org/mono-repo"
+	for _, ref := range []string{"sha1", "sha2"} {
+		for i := 0; i < 1000; i++ {
+			server.AddFile(repo, ref, fmt.Sprintf("assets/generated/%04d.json", i), []byte("{}"))
+		}
+		server.AddFileWithSize(repo, ref, "assets/generated/mesh.bin", 700000)
+	}
+	// The second commit only changes another directory
+	server.AddFile(repo, "sha1", "src/main.go", []byte("package main"))
+	server.AddFile(repo, "sha2", "src/main.go", []byte("package main\n"))
+
+	size, err := w.getFileSize(context.Background(), "test-org", "mono-repo", "sha1", "assets/generated/mesh.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, 700000, size)
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/mono-repo/contents/assets/generated"))
+	trees := server.Calls("GET repos/test-org/mono-repo/git/trees/")
+	assert.Equal(t, 3, trees)
+
+	// The directory is known to be large and its tree is unchanged, only
+	// the root tree of the commit is fetched
+	server.ResetCalls()
+	size, err = w.getFileSize(context.Background(), "test-org", "mono-repo", "sha2", "assets/generated/mesh.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, 700000, size)
+	assert.Equal(t, 0, server.Calls("GET repos/test-org/mono-repo/contents/"))
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/mono-repo/git/trees/"))
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/mono-repo/git/trees/sha2"))
+
+	// Trees are kept compressed
+	treeCache.Range(func(key string, value interface{}) bool {
+		if strings.Contains(key, "mono-repo") {
+			index, err := value.(*compressedTree).index()
+			assert.Nil(t, err)
+			assert.Less(t, value.(*compressedTree).Size(), index.Size())
+		}
+		return true
+	})
+}
+
+func TestSizeLookupTree(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	treeCache.Clear()
+	treeIndexCache.Clear()
+
+	repo := "test-org/tree-repo"
+	owner, name := "test-org", "tree-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 100000\nsizeLookup: tree\n"))
+	files := []string{"art/hero.psd", "art/textures/wall.tga", "docs/notes.txt", "levels/a/map.bin", "levels/b/map.bin"}
+	server.AddFileWithSize(repo, "sha1", "art/hero.psd", 3000000)
+	server.AddFile(repo, "sha1", "art/textures/wall.tga", make([]byte, 300))
+	server.AddFile(repo, "sha1", "docs/notes.txt", []byte("notes"))
+	server.AddFileWithSize(repo, "sha1", "levels/a/map.bin", 200000)
+	server.AddFile(repo, "sha1", "levels/b/map.bin", make([]byte, 300))
+	result := w.Check(&github.PushEvent{
+		Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: files}},
+	})
+
+	assert.Empty(t, result.Commits[0].Errors)
+	var paths []string
+	for _, finding := range result.Commits[0].Findings {
+		paths = append(paths, finding.Path)
+	}
+	assert.Equal(t, []string{"art/hero.psd", "levels/a/map.bin"}, paths)
+	// One request for the tree instead of one per directory
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/tree-repo/git/trees/sha1"))
+	for _, dir := range []string{"art", "docs", "levels"} {
+		assert.Equal(t, 0, server.Calls("GET repos/test-org/tree-repo/contents/"+dir))
+	}
+
+	_, err := ParseConfig([]byte("sizeLookup: compare\n"))
+	assert.NotNil(t, err)
+}
+
+// Findings of files above the default threshold
+func oversize(paths ...string) []Finding {
+	var findings []Finding
+	for _, p := range paths {
+		findings = append(findings, Finding{Path: p, Size: lfsSizeThreshold + 1, Threshold: lfsSizeThreshold, Rule: RuleOversizeFile, Severity: SeverityError})
+	}
+	return findings
+}
+
+func commentConfig(helpContact string) *Config {
+	config := defaultWatchDogConfig()
+	config.HelpContact = helpContact
+	return config
+}
+
 func TestCommentAll(t *testing.T) {
 	w := newWatchDog("http://testserver.com")
 
 	comment, err := w.createComment(
 		"test-org/test-repo",
-		[]string{"path/to/large/file1", "other/path/to/large/file2"},
-		"[#tech-git](https://autodesk.slack.com/messages/C0E0BH9T5)",
+		commentConfig("[#tech-git](https://autodesk.slack.com/messages/C0E0BH9T5)"),
+		oversize("path/to/large/file1", "other/path/to/large/file2"),
+		"",
 	)
 	assert.Nil(t, err)
 	assert.Equal(t, strings.Replace(
-		`**:warning: The following files are larger than 500KB and may need to be tracked with [Git LFS](https://git-lfs.github.com/):**
-		- path/to/large/file1
-		- other/path/to/large/file2
+		`**:warning: The following files are larger than 500KB and may need to be tracked with [Git LFS](https://git-lfs.github.com/) (LFS001 oversize-file):**
+		- `+"`path/to/large/file1`: new, track it with `git lfs track --filename \"path/to/large/file1\"` and amend the commit before merging"+`
+		- `+"`other/path/to/large/file2`: new, track it with `git lfs track --filename \"other/path/to/large/file2\"` and amend the commit before merging"+`
 
 		> Watch the [Git LFS tutorial](https://www.youtube.com/watch?v=YQzNfb4IwEY) or contact [#tech-git](https://autodesk.slack.com/messages/C0E0BH9T5) for help.`, "\t", "", -1),
 		comment,
@@ -136,19 +307,103 @@ func TestCommentLargeFiles(t *testing.T) {
 
 	comment, err := w.createComment(
 		"test-org/test-repo",
-		[]string{"path/to/large/file1", "other/path/to/large/file2"},
-		"someone@somecompany.com",
+		commentConfig("someone@somecompany.com"),
+		oversize("path/to/large/file1", "other/path/to/large/file2"),
+		"",
 	)
 	assert.Nil(t, err)
 	assert.Equal(t, strings.Replace(
-		`**:warning: The following files are larger than 500KB and may need to be tracked with [Git LFS](https://git-lfs.github.com/):**
-		- path/to/large/file1
-		- other/path/to/large/file2
+		`**:warning: The following files are larger than 500KB and may need to be tracked with [Git LFS](https://git-lfs.github.com/) (LFS001 oversize-file):**
+		- `+"`path/to/large/file1`: new, track it with `git lfs track --filename \"path/to/large/file1\"` and amend the commit before merging"+`
+		- `+"`other/path/to/large/file2`: new, track it with `git lfs track --filename \"other/path/to/large/file2\"` and amend the commit before merging"+`
 
 		> Watch the [Git LFS tutorial](https://www.youtube.com/watch?v=YQzNfb4IwEY) or contact someone@somecompany.com for help.`, "\t", "", -1),
 		comment,
 	)
 }
+
+func TestCommentThresholds(t *testing.T) {
+	w := newWatchDog("http://testserver.com")
+
+	config, err := ParseConfig([]byte("lfsSizeThreshold: 1000\n"))
+	assert.Nil(t, err)
+	comment, err := w.createComment("test-org/test-repo", config, []Finding{{Path: "large.bin", Size: 2000, Threshold: 1000, Rule: RuleOversizeFile}}, "")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(comment, "**:warning: The following files are larger than 1000B and may need"))
+}
+
+func TestCommentRuleAttribution(t *testing.T) {
+	w := newWatchDog("http://testserver.com")
+
+	config, err := ParseConfig([]byte("lfsSizeThreshold: 2097152\nlfsSizeExemptions: \"*.xml\"\nlfsSizeExemptionsThreshold: 10485760\n"))
+	assert.Nil(t, err)
+	findings := []Finding{
+		{Path: "huge.xml", Size: 20000000, Threshold: 10485760, Rule: RuleOversizeFile},
+		{Path: "large.bin", Size: 3000000, Threshold: 2097152, Rule: RuleOversizeFile},
+		{Path: "large.psd", Size: 3000000, Threshold: 2097152, Rule: RuleOversizeFile},
+	}
+	comment, err := w.createComment("test-org/test-repo", config, findings, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "**:warning: The following files are larger than 2MB and may need to be tracked with [Git LFS](https://git-lfs.github.com/) (LFS001 oversize-file):**\n"+
+		"- `large.bin`: new, track it with `git lfs track --filename \"large.bin\"` and amend the commit before merging\n"+
+		"- `large.psd`: new, track it with `git lfs track --filename \"large.psd\"` and amend the commit before merging\n\n"+
+		"**:warning: The following exempt files are larger than 10MB and may need to be tracked with [Git LFS](https://git-lfs.github.com/) (LFS001 oversize-file):**\n"+
+		"- `huge.xml`: new, track it with `git lfs track --filename \"huge.xml\"` and amend the commit before merging\n\n"+
+		"> Watch the [Git LFS tutorial](https://www.youtube.com/watch?v=YQzNfb4IwEY) or contact @github-solutions for help.", comment)
+}
+
+func TestCommentRemediation(t *testing.T) {
+	w := newWatchDog("http://testserver.com")
+
+	config, err := ParseConfig([]byte("lfsSizeThreshold: 1000\n"))
+	assert.Nil(t, err)
+	findings := []Finding{
+		{Path: "new asset.psd", Size: 2000, Threshold: 1000, Rule: RuleOversizeFile},
+		{Path: "existing.psd", Size: 2000, Threshold: 1000, Rule: RuleOversizeFile, Modified: true},
+	}
+	comment, err := w.createComment("test-org/test-repo", config, findings, "")
+	assert.Nil(t, err)
+	assert.Contains(t, comment, "\n- `new asset.psd`: new, track it with `git lfs track --filename \"new asset.psd\"` and amend the commit before merging\n")
+	assert.Contains(t, comment, "\n- `existing.psd`: already in the history, rewrite it with `git lfs migrate import --include=\"existing.psd\"`\n")
+}
+
+func TestCommentTooLong(t *testing.T) {
+	w := newWatchDog("http://testserver.com")
+
+	var candidates []string
+	for i := 0; i < 2000; i++ {
+		candidates = append(candidates, fmt.Sprintf("assets/textures/%s/texture%04d.png", strings.Repeat("x", 40), i))
+	}
+	comment, err := w.createComment("test-org/test-repo", commentConfig("@someone"), oversize(candidates...), "")
+	assert.Nil(t, err)
+	assert.True(t, utf8.RuneCountInString(comment) <= maxCommentBody)
+	shown := strings.Count(comment, "- `assets/")
+	// Every file comes with a remediation of about twice its path length
+	assert.True(t, shown > 250)
+	assert.Contains(t, comment, fmt.Sprintf("- …and %d more files\n", len(candidates)-shown))
+	assert.True(t, strings.HasSuffix(comment, "contact @someone for help."))
+
+	// Huge help contacts are truncated rather than dropping the comment
+	comment, err = w.createComment("test-org/test-repo", commentConfig(strings.Repeat("x", maxCommentBody)), oversize(candidates[0]), "")
+	assert.Nil(t, err)
+	assert.Equal(t, maxCommentBody, utf8.RuneCountInString(comment))
+}
+
+func TestCommentEscapesPaths(t *testing.T) {
+	w := newWatchDog("http://testserver.com")
+
+	comment, err := w.createComment("test-org/test-repo", commentConfig("@someone"), oversize("<img src=x>.png", "a|b_*c*.bin", "weird`name``.psd"), "")
+	assert.Nil(t, err)
+	assert.Contains(t, comment, "\n- `<img src=x>.png`: ")
+	assert.Contains(t, comment, "\n- `a|b_*c*.bin`: ")
+	assert.Contains(t, comment, "\n- ``` weird`name``.psd ```: ")
+	assert.Contains(t, comment, "``` git lfs track --filename \"weird`name``.psd\" ```")
+
+	assert.Equal(t, "`a b`", codeSpan("a\nb"))
+	assert.Equal(t, "`  spaced  `", codeSpan(" spaced "))
+	assert.Equal(t, "| `a\\|b` |", "| "+tableCell(codeSpan("a|b"))+" |")
+}
+
 func TestPostComment(t *testing.T) {
 	mux, server := setup()
 	defer teardown(server)
@@ -164,7 +419,7 @@ func TestPostComment(t *testing.T) {
 	)
 
 	suggestions := []string{"a/large/file", "largish"}
-	comment, err := w.createComment("test-org/test-repo", suggestions, "@someone")
+	comment, err := w.createComment("test-org/test-repo", commentConfig("@someone"), oversize(suggestions...), "")
 	assert.Nil(t, err)
 	err = w.postComment("test-org", "test-repo", sha, &comment)
 	assert.Nil(t, err)
@@ -217,7 +472,7 @@ func TestWatchDogConfigFile(t *testing.T) {
 		},
 	)
 
-	c, err := w.getWatchDogConfig("test-org", "test-repo", sha)
+	c, err := w.getWatchDogConfig(context.Background(), "test-org", "test-repo", sha)
 	assert.Nil(t, err)
 	assert.Equal(t, 512000, c.LFSSizeThreshold)
 	assert.Equal(t, 20000000, c.LFSSizeExemptionsThreshold)
@@ -281,3 +536,2773 @@ func TestUpdateCommitStatus(t *testing.T) {
 	err := w.updateCommitStatus("test-org", "test-repo", sha, "success", "Build has completed successfully")
 	assert.Nil(t, err)
 }
+
+// fakeSCM serves directory listings from memory
+type fakeSCM struct {
+	scm.Client
+	dirs map[string][]*scm.Entry
+}
+
+func (f *fakeSCM) GetDirContent(ctx context.Context, owner, repo, ref, path string) ([]*scm.Entry, error) {
+	return f.dirs[path], nil
+}
+
+func TestGetFileSizeWithFakeSCM(t *testing.T) {
+	w := New(&fakeSCM{dirs: map[string][]*scm.Entry{
+		"assets": {{Name: "big.bin", Path: "assets/big.bin", Type: "file", Size: 600000}},
+	}})
+
+	size, err := w.getFileSize(context.Background(), "test-org", "test-repo", "abc123", "assets/big.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, 600000, size)
+}
+
+// Make lookup retries return immediately and count them
+func skipRetryDelays() (retries *int32, restore func()) {
+	retries = new(int32)
+	sleep = func(ctx context.Context, d time.Duration) error {
+		atomic.AddInt32(retries, 1)
+		return ctx.Err()
+	}
+	return retries, func() { sleep = realSleep }
+}
+
+var realSleep = sleep
+
+func TestCheckResult(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	_, restore := skipRetryDelays()
+	defer restore()
+
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSuggestionsEnabled: Yes\nlfsSizeThreshold: 1000\nlfsSizeExemptions: \"*.xml\"\nlfsSizeExemptionsThreshold: 5000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+	server.AddFileWithSize("test-org/test-repo", "sha1", "small.txt", 10)
+
+	event := pushEvent("test-org/test-repo", []*github.HeadCommit{
+		{ID: github.String("sha0"), Distinct: github.Bool(false)},
+		{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}, Modified: []string{"small.txt", "missing.txt"}},
+	})
+	event.Ref = github.String("refs/heads/main")
+
+	result := w.Check(event)
+	assert.Equal(t, "test-org/test-repo", result.Repo)
+	assert.Equal(t, 2, len(result.Commits))
+	assert.True(t, result.Commits[0].Skipped)
+
+	commit := result.Commits[1]
+	assert.Equal(t, []Finding{{Path: "large.bin", Size: 2000, Threshold: 1000, Rule: RuleOversizeFile, Severity: SeverityError}}, commit.Findings)
+	assert.Equal(t, 1, len(commit.Errors))
+	assert.Equal(t, []string{"status", "status", "comment"}, []string{commit.Actions[0].Type, commit.Actions[1].Type, commit.Actions[2].Type})
+	assert.Equal(t, "failure", commit.Actions[1].Detail)
+	assert.True(t, result.Failed())
+
+	timings := commit.Timings
+	assert.False(t, timings.ConfigFetched.Before(timings.Started))
+	assert.False(t, timings.SizesFetched.Before(timings.ConfigFetched))
+	assert.False(t, timings.Reported.Before(timings.SizesFetched))
+	assert.True(t, result.Commits[0].Timings.Reported.IsZero())
+}
+
+func TestEvaluateFile(t *testing.T) {
+	config := defaultWatchDogConfig()
+	config.LFSExemptionsFilter = filepathfilter.New([]string{"*.xml"}, nil)
+
+	finding, violates := evaluateFile(config, "assets/large.bin", 600000)
+	assert.True(t, violates)
+	assert.Equal(t, Finding{Path: "assets/large.bin", Size: 600000, Threshold: 512000, Rule: RuleOversizeFile, Severity: SeverityError}, finding)
+
+	_, violates = evaluateFile(config, "assets/small.bin", 1000)
+	assert.False(t, violates)
+
+	_, violates = evaluateFile(config, "data/large.xml", 600000)
+	assert.False(t, violates)
+
+	_, violates = evaluateFile(config, "data/huge.xml", 30000000)
+	assert.True(t, violates)
+
+	config.LFSSuggestionsEnabled = false
+	_, violates = evaluateFile(config, "assets/large.bin", 600000)
+	assert.False(t, violates)
+
+	// The rules section takes precedence over lfsSuggestionsEnabled
+	enabled := true
+	config.Rules = map[string]RuleConfig{RuleOversizeFile: {Enabled: &enabled, Severity: SeverityWarning}}
+	finding, violates = evaluateFile(config, "assets/large.bin", 600000)
+	assert.True(t, violates)
+	assert.Equal(t, SeverityWarning, finding.Severity)
+}
+
+func TestLookupRule(t *testing.T) {
+	rule, ok := LookupRule("oversize-file")
+	assert.True(t, ok)
+	assert.Equal(t, "LFS001 oversize-file", rule.String())
+	rule, ok = LookupRule("lfs001")
+	assert.True(t, ok)
+	assert.Equal(t, "oversize-file", rule.Name)
+	_, ok = LookupRule("LFS999")
+	assert.False(t, ok)
+}
+
+func TestRuleHeadlines(t *testing.T) {
+	for _, rule := range Rules() {
+		assert.NotEmpty(t, rule.Headline, rule.String())
+		headline, err := rule.render(rule.Headline, commentGroup{Rule: rule, Threshold: "500.0 KB"})
+		assert.Nil(t, err)
+		assert.NotContains(t, headline, "{{", rule.String())
+		_, err = rule.render(rule.Remediation, Finding{Path: "a.bin", Rule: rule.ID})
+		assert.Nil(t, err)
+	}
+}
+
+func TestParseConfigRules(t *testing.T) {
+	config, err := ParseConfig([]byte("rules:\n  oversize-file:\n    enabled: false\n"))
+	assert.Nil(t, err)
+	assert.False(t, config.ruleEnabled(RuleOversizeFile))
+	// Unset settings keep their defaults
+	assert.Equal(t, 512000, config.LFSSizeThreshold)
+	assert.Nil(t, config.LFSExemptionsFilter)
+
+	_, err = ParseConfig([]byte("rules:\n  no-such-rule:\n    enabled: false\n"))
+	assert.NotNil(t, err)
+	_, err = ParseConfig([]byte("rules:\n  oversize-file:\n    severity: fatal\n"))
+	assert.NotNil(t, err)
+}
+
+func TestExemptionCeilings(t *testing.T) {
+	config, err := ParseConfig([]byte("lfsSizeThreshold: 1000\n" +
+		"lfsSizeExemptions: |\n  *.xml *.json\n  Regression/*.txt 50MB\n  Fixtures/** unlimited\n" +
+		"lfsSizeExemptionsThreshold: 5000\n"))
+	assert.Nil(t, err)
+
+	threshold, ok := config.exemptionThreshold("data.json")
+	assert.True(t, ok)
+	assert.Equal(t, 5000, threshold)
+	threshold, ok = config.exemptionThreshold("Regression/log.txt")
+	assert.True(t, ok)
+	assert.Equal(t, 50*1024*1024, threshold)
+	_, ok = config.exemptionThreshold("other/log.txt")
+	assert.False(t, ok)
+
+	_, violates := evaluateFile(config, "Regression/log.txt", 40*1024*1024)
+	assert.False(t, violates)
+	finding, violates := evaluateFile(config, "Regression/log.txt", 60*1024*1024)
+	assert.True(t, violates)
+	assert.Equal(t, 50*1024*1024, finding.Threshold)
+	_, violates = evaluateFile(config, "Fixtures/a/huge.bin", 1<<30)
+	assert.False(t, violates)
+	_, violates = evaluateFile(config, "other/log.txt", 2000)
+	assert.True(t, violates)
+
+	_, err = ParseConfig([]byte("lfsSizeExemptions: \"*.txt 0MB\"\n"))
+	assert.NotNil(t, err)
+}
+
+// recordingReporter remembers reported findings
+type recordingReporter struct {
+	findings []Finding
+}
+
+func (r *recordingReporter) Start(commit *Commit, config *Config) []Action {
+	return nil
+}
+
+func (r *recordingReporter) Report(commit *Commit, config *Config, result *CommitResult) []Action {
+	r.findings = append(r.findings, result.Findings...)
+	return []Action{{Type: "comment", Detail: "recorded"}}
+}
+
+func TestCheckWithReporter(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	reporter := &recordingReporter{}
+	w.SetReporter(reporter)
+
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSuggestionsEnabled: Yes\nlfsSizeThreshold: 1000\nlfsSizeExemptions: \"*.xml\"\nlfsSizeExemptionsThreshold: 5000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+
+	result := w.Check(pushEvent("test-org/test-repo", []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}}}))
+
+	assert.Equal(t, []Finding{{Path: "large.bin", Size: 2000, Threshold: 1000, Rule: RuleOversizeFile, Severity: SeverityError}}, reporter.findings)
+	assert.Equal(t, "recorded", result.Commits[0].Actions[0].Detail)
+	assert.Equal(t, 0, len(server.Comments()))
+	assert.Equal(t, 0, len(server.Statuses()))
+}
+
+func TestEvaluate(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	_, restore := skipRetryDelays()
+	defer restore()
+
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+	server.AddFileWithSize("test-org/test-repo", "sha1", "small.bin", 20)
+	config := DefaultConfig()
+	config.LFSSizeThreshold = 1000
+
+	findings, err := Evaluate(context.Background(), scm.NewGitHub(server.Client()), EvalRequest{
+		Owner:  "test-org",
+		Repo:   "test-repo",
+		SHA:    "sha1",
+		Files:  []string{"large.bin", "small.bin", "missing.bin"},
+		Config: config,
+	})
+
+	assert.Equal(t, Findings{{Path: "large.bin", Size: 2000, Threshold: 1000, Rule: RuleOversizeFile, Severity: SeverityError}}, findings)
+	var evalErr *EvaluationError
+	assert.True(t, errors.As(err, &evalErr))
+	assert.Equal(t, 1, len(evalErr.Errors))
+
+	// Repositories without a configuration are evaluated with the defaults
+	server.AddFileWithSize("test-org/unconfigured-repo", "sha1", "large.bin", 600000)
+	findings, err = Evaluate(context.Background(), scm.NewGitHub(server.Client()), EvalRequest{
+		Owner: "test-org",
+		Repo:  "unconfigured-repo",
+		SHA:   "sha1",
+		Files: []string{"large.bin"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, Findings{{Path: "large.bin", Size: 600000, Threshold: lfsSizeThreshold, Rule: RuleOversizeFile, Severity: SeverityError}}, findings)
+}
+
+func TestStatusDescription(t *testing.T) {
+	assert.Equal(t, "2 files >500KB, 1 file >19MB", statusDescription([]Finding{
+		{Path: "a.bin", Size: 600000, Threshold: 512000},
+		{Path: "b.xml", Size: 30000000, Threshold: 20000000},
+		{Path: "c.bin", Size: 700000, Threshold: 512000},
+	}))
+
+	var many []Finding
+	for i := 0; i < 50; i++ {
+		many = append(many, Finding{Path: "a.bin", Threshold: (i + 1) * 1024})
+	}
+	description := statusDescription(many)
+	assert.Equal(t, maxStatusDescription, len([]rune(description)))
+	assert.True(t, strings.HasSuffix(description, "…"))
+}
+
+func TestCheckRunSummary(t *testing.T) {
+	findings := []Finding{{Path: "huge.xml", Size: 30 * 1024 * 1024, Threshold: 20000000}}
+	for i := 0; i < 11; i++ {
+		findings = append(findings, Finding{Path: fmt.Sprintf("large%d.bin", i), Size: 600 * 1024, Threshold: 512000})
+	}
+
+	summary := checkRunSummary(findings, "@someone", func(string) string { return "" })
+	assert.True(t, strings.HasPrefix(summary, "### LFS001 oversize-file: 11 files larger than 500KB\n\n<details><summary>Show 11 files</summary>\n\n| File | Size |\n|---|---:|\n| `large0.bin` | 600KB |\n"))
+	assert.Contains(t, summary, "### LFS001 oversize-file: 1 file larger than 19MB\n\n| File | Size |\n|---|---:|\n| `huge.xml` | 30MB |\n")
+	assert.Contains(t, summary, "git lfs migrate import")
+	assert.True(t, strings.HasSuffix(summary, "Contact @someone for help.\n"))
+}
+
+func TestCheckCreatesCheckRun(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSuggestionsEnabled: Yes\nlfsSizeThreshold: 1000\nlfsSizeExemptions: \"*.xml\"\nlfsSizeExemptionsThreshold: 5000\nlfsChecksEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+
+	w.Check(pushEvent("test-org/test-repo", []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}}}))
+
+	runs := server.CheckRuns()
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, "failure", runs[0].GetConclusion())
+	assert.Equal(t, "1 file >1000B", runs[0].Output.GetTitle())
+	assert.Contains(t, runs[0].Output.GetSummary(), "| [`large.bin`]("+server.URL+"/test-org/test-repo/blob/sha1/large.bin) | 1KB |")
+	if assert.Len(t, runs[0].Output.Annotations, 1) {
+		annotation := runs[0].Output.Annotations[0]
+		assert.Equal(t, "large.bin", annotation.GetPath())
+		assert.Equal(t, "failure", annotation.GetAnnotationLevel())
+		assert.Equal(t, "LFS001 oversize-file", annotation.GetTitle())
+		assert.Equal(t, "File is larger than the size threshold and should be tracked with Git LFS: 1KB, larger than 1000B.", annotation.GetMessage())
+	}
+	if assert.Len(t, runs[0].Actions, 1) {
+		assert.Equal(t, RecheckAction, runs[0].Actions[0].Identifier)
+	}
+}
+
+func TestCheckRunAnnotations(t *testing.T) {
+	var findings []Finding
+	for i := 0; i < 60; i++ {
+		findings = append(findings, Finding{Path: fmt.Sprintf("lib%d", i), Rule: RuleBuildOutput, Severity: SeverityNotice})
+	}
+	annotations := checkRunAnnotations(findings)
+	assert.Len(t, annotations, maxCheckAnnotations)
+	assert.Equal(t, "notice", annotations[0].Level)
+	assert.Equal(t, "Extensionless file is a compiled binary.", annotations[0].Message)
+}
+
+func TestCommitStatusPerRule(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\ncommitStatusPerRule: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+
+	w.Check(pushEvent("test-org/test-repo", []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}}}))
+
+	statuses := server.Statuses()
+	assert.Equal(t, 2, len(statuses))
+	for _, status := range statuses {
+		assert.Equal(t, "watchdog/lfs", status.Context)
+	}
+	assert.Equal(t, "pending", statuses[0].State)
+	assert.Equal(t, "failure", statuses[1].State)
+}
+
+func TestProcessNonDistinctCommits(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFile("test-org/test-repo", "sha2", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\nprocessNonDistinctCommits: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+	server.AddFileWithSize("test-org/test-repo", "sha2", "large.bin", 2000)
+
+	result := w.Check(pushEvent("test-org/test-repo", []*github.HeadCommit{
+		{ID: github.String("sha1"), Distinct: github.Bool(false), Added: []string{"large.bin"}},
+		{ID: github.String("sha2"), Distinct: github.Bool(false), Added: []string{"large.bin"}},
+	}))
+
+	assert.True(t, result.Commits[0].Skipped)
+	assert.False(t, result.Commits[1].Skipped)
+	assert.Equal(t, 1, len(result.Commits[1].Findings))
+
+	// The non-distinct commit gets a status, but no comment
+	assert.Equal(t, 0, len(server.Comments()))
+	statuses := server.Statuses()
+	assert.Equal(t, 2, len(statuses))
+	assert.Equal(t, "sha2", statuses[1].SHA)
+	assert.Equal(t, "failure", statuses[1].State)
+
+	// Non-distinct commits pushed to a branch are skipped with the last
+	// known configuration, without requesting it
+	server.AddFile("test-org/other-repo", "refs/heads/main", configFile, []byte("lfsSizeThreshold: 1000\n"))
+	server.AddFileWithSize("test-org/other-repo", "sha3", "large.bin", 2000)
+	push := func(distinct bool) *CommitResult {
+		event := pushEvent("test-org/other-repo", []*github.HeadCommit{{ID: github.String("sha3"), Distinct: github.Bool(distinct), Added: []string{"large.bin"}}})
+		event.Ref = github.String("refs/heads/main")
+		return w.Check(event).Commits[0]
+	}
+	assert.False(t, push(true).Skipped)
+	calls := server.Calls("")
+	assert.True(t, push(false).Skipped)
+	assert.Equal(t, calls, server.Calls(""))
+}
+
+func TestResolveFindings(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/resolve-repo"
+	config := []byte("lfsSizeThreshold: 1000\nresolvedCommentEnabled: Yes\n")
+	server.AddFile(repo, "sha1", configFile, config)
+	server.AddFile(repo, "sha2", configFile, config)
+	server.AddFileWithSize(repo, "sha1", "a.bin", 2000)
+	server.AddFileWithSize(repo, "sha1", "b.bin", 2000)
+	server.AddFileWithSize(repo, "sha2", "a.bin", 130) // Git LFS pointer
+
+	owner, name := "test-org", "resolve-repo"
+	push := func(commit *github.HeadCommit) *CommitResult {
+		return w.Check(&github.PushEvent{
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{commit},
+		}).Commits[0]
+	}
+
+	result := push(&github.HeadCommit{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"a.bin", "b.bin"}})
+	assert.Equal(t, 2, len(result.Findings))
+	assert.Equal(t, 0, len(result.Resolved))
+
+	result = push(&github.HeadCommit{ID: github.String("sha2"), Distinct: github.Bool(true), Modified: []string{"a.bin"}, Removed: []string{"b.bin"}})
+	assert.Equal(t, 0, len(result.Findings))
+	assert.Equal(t, 2, len(result.Resolved))
+
+	comments := server.Comments()
+	assert.Equal(t, 2, len(comments))
+	assert.Equal(t, "sha2", comments[1].SHA)
+	assert.Contains(t, comments[1].Body, "- `a.bin` (reported on sha1)")
+	assert.Contains(t, comments[1].Body, "- `b.bin` (reported on sha1)")
+}
+
+func TestResolveFindingsOnBranch(t *testing.T) {
+	main := &Commit{Owner: "test-org", Repo: "branch-resolve-repo", SHA: "sha1", Ref: "refs/heads/main"}
+	recordViolations(main, &CommitResult{Findings: []Finding{{Path: "a.bin", Rule: RuleOversizeFile}}})
+
+	// Removing the file on another branch leaves it open on main
+	feature := &Commit{Owner: "test-org", Repo: "branch-resolve-repo", SHA: "sha2", Ref: "refs/heads/feature", Removed: []string{"a.bin"}}
+	assert.Empty(t, recordViolations(feature, &CommitResult{}))
+	n, _ := OpenViolations("test-org/branch-resolve-repo")
+	assert.Equal(t, 1, n)
+
+	main = &Commit{Owner: "test-org", Repo: "branch-resolve-repo", SHA: "sha3", Ref: "refs/heads/main", Removed: []string{"a.bin"}}
+	assert.Equal(t, 1, len(recordViolations(main, &CommitResult{})))
+	n, _ = OpenViolations("test-org/branch-resolve-repo")
+	assert.Equal(t, 0, n)
+}
+
+func TestPersistFindings(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	items := store.NewMemory()
+	assert.Nil(t, SetStore(items))
+	defer func() { violationStore.store = nil }()
+
+	repo := "test-org/persist-repo"
+	config := []byte("lfsSizeThreshold: 1000\nresolvedCommentEnabled: Yes\n")
+	server.AddFile(repo, "sha1", configFile, config)
+	server.AddFile(repo, "sha2", configFile, config)
+	server.AddFileWithSize(repo, "sha1", "a.bin", 2000)
+	server.AddFileWithSize(repo, "sha1", "b.bin", 2000)
+	server.AddFileWithSize(repo, "sha2", "a.bin", 130)
+
+	owner, name := "test-org", "persist-repo"
+	push := func(commit *github.HeadCommit) *CommitResult {
+		return w.Check(&github.PushEvent{
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Ref:     github.String("refs/heads/main"),
+			Commits: []*github.HeadCommit{commit},
+		}).Commits[0]
+	}
+	result := push(&github.HeadCommit{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"a.bin", "b.bin"}})
+	assert.Equal(t, 2, len(result.Findings))
+
+	// A restarted watchdog knows the open findings
+	violationCache.Clear()
+	branchViolationCache.Clear()
+	auditedRepos.Clear()
+	assert.Nil(t, SetStore(items))
+	open, audited := OpenViolations(repo)
+	assert.True(t, audited)
+	assert.Equal(t, 2, open)
+
+	result = push(&github.HeadCommit{ID: github.String("sha2"), Distinct: github.Bool(true), Modified: []string{"a.bin"}, Removed: []string{"b.bin"}})
+	assert.Equal(t, 2, len(result.Resolved))
+	persisted, err := items.List(context.Background(), violationsBucket)
+	assert.Nil(t, err)
+	assert.Empty(t, persisted)
+	persisted, err = items.List(context.Background(), branchViolationsBucket)
+	assert.Nil(t, err)
+	assert.Empty(t, persisted)
+}
+
+func TestExpirePersistedFindings(t *testing.T) {
+	defer func() { clock = time.Now }()
+	defer func() { violationStore.store = nil }()
+	items := store.NewMemory()
+	assert.Nil(t, SetStore(items))
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return now }
+	commit := &Commit{Owner: "test-org", Repo: "expire-repo", SHA: "sha1"}
+	recordViolations(commit, &CommitResult{Findings: []Finding{{Path: "a.bin", Rule: RuleOversizeFile}}})
+
+	violationCache.Clear()
+	clock = func() time.Time { return now.Add(violationTTL) }
+	assert.Nil(t, SetStore(items))
+	_, ok := violationCache.Get(violationKey(commit, "a.bin"))
+	assert.False(t, ok)
+	persisted, err := items.List(context.Background(), violationsBucket)
+	assert.Nil(t, err)
+	assert.Empty(t, persisted)
+}
+
+func TestResolveFindingsNormalForm(t *testing.T) {
+	nfc, nfd := "Caf\u00e9.bin", "Cafe\u0301.bin"
+	commit := &Commit{Owner: "test-org", Repo: "normal-form-repo", SHA: "sha1"}
+	recordViolations(commit, &CommitResult{Findings: []Finding{{Path: nfd, Rule: RuleOversizeFile}}})
+
+	// The file is removed with its path in another normal form
+	commit = &Commit{Owner: "test-org", Repo: "normal-form-repo", SHA: "sha2", Removed: []string{nfc}}
+	resolved := recordViolations(commit, &CommitResult{})
+	assert.Equal(t, 1, len(resolved))
+}
+
+func TestPersistChurn(t *testing.T) {
+	defer func() { violationStore.store = nil }()
+	items := store.NewMemory()
+	assert.Nil(t, SetStore(items))
+
+	commit := &Commit{Owner: "test-org", Repo: "persist-churn-repo", SHA: "sha1"}
+	recordChanges(commit, []string{"icon.png"}, time.Hour)
+	commit.SHA = "sha2"
+	assert.Equal(t, 2, countChanges(commit, "icon.png", time.Hour))
+	recordChanges(commit, []string{"icon.png"}, time.Hour)
+
+	// A restarted watchdog keeps counting
+	churnCache.Clear()
+	assert.Nil(t, SetStore(items))
+	commit.SHA = "sha3"
+	assert.Equal(t, 3, countChanges(commit, "icon.png", time.Hour))
+}
+
+func TestSkipCommitsWithoutFiles(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/delete-repo"
+	config := []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\nresolvedCommentEnabled: Yes\n")
+	server.AddFile(repo, "sha1", configFile, config)
+	server.AddFileWithSize(repo, "sha1", "large.bin", 2000)
+	server.AddFile(repo, "sha2", configFile, config)
+
+	owner, name := "test-org", "delete-repo"
+	push := func(commit *github.HeadCommit) *CommitResult {
+		return w.Check(&github.PushEvent{
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{commit},
+		}).Commits[0]
+	}
+	assert.Len(t, push(&github.HeadCommit{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}}).Findings, 1)
+
+	// Commits that only remove files are not evaluated, but reported
+	server.ResetCalls()
+	result := push(&github.HeadCommit{ID: github.String("sha2"), Distinct: github.Bool(true), Removed: []string{"large.bin"}})
+	assert.True(t, result.Skipped)
+	assert.Equal(t, "no files", result.SkipReason)
+	assert.Equal(t, 0, server.Calls("GET repos/"+repo+"/contents/large.bin"))
+	assert.Len(t, result.Resolved, 1)
+
+	statuses := server.Statuses()
+	assert.Equal(t, "sha2", statuses[len(statuses)-1].SHA)
+	assert.Equal(t, "success", statuses[len(statuses)-1].State)
+	comments := server.Comments()
+	assert.Contains(t, comments[len(comments)-1].Body, "- `large.bin` (reported on sha1)")
+}
+
+func TestForEachLookupBounded(t *testing.T) {
+	defer func(n int) { lookupsPerCommit = n }(lookupsPerCommit)
+	lookupsPerCommit = 3
+
+	var mu sync.Mutex
+	running, max, calls := 0, 0, 0
+	forEachLookup(20, func(i int) {
+		mu.Lock()
+		running++
+		calls++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	assert.Equal(t, 20, calls)
+	assert.True(t, max <= 3, "at most 3 concurrent lookups, got %d", max)
+}
+
+func TestBackgroundLookupsOwnPool(t *testing.T) {
+	// Background jobs proceed while pushes hold every lookup slot
+	defer func(pool chan struct{}) { lookupPool = pool }(lookupPool)
+	lookupPool = make(chan struct{}, 1)
+	lookupPool <- struct{}{}
+
+	var mu sync.Mutex
+	calls := 0
+	forEachBackgroundLookup(3, func(i int) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	})
+	assert.Equal(t, 3, calls)
+}
+
+func TestConfigFallback(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/fallback-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\n"))
+	server.AddFile(repo, "sha2", configFile, []byte("lfsSizeThreshold: 1000\n"))
+
+	config, err := w.getWatchDogConfig(context.Background(), "test-org", "fallback-repo", "sha1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, config.LFSSizeThreshold)
+
+	// A transient error falls back to the last known configuration
+	server.InjectError("GET", "repos/"+repo+"/contents/", http.StatusBadGateway, 1)
+	config, err = w.getWatchDogConfig(context.Background(), "test-org", "fallback-repo", "sha2")
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, config.LFSSizeThreshold)
+
+	// A missing configuration means defaults, which is not an error
+	config, err = w.getWatchDogConfig(context.Background(), "test-org", "fallback-repo", "sha3")
+	assert.Nil(t, err)
+	assert.Equal(t, lfsSizeThreshold, config.LFSSizeThreshold)
+}
+
+func TestConfigContentCache(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	configContentCache.Clear()
+	defer SetConfigTTL(0)
+
+	repo := "test-org/cached-config-repo"
+	path := "GET repos/" + repo + "/contents/" + configFile
+	server.AddFile(repo, "main", configFile, []byte("lfsSizeThreshold: 1000\n"))
+	get := func() *Config {
+		config, err := w.getWatchDogConfig(context.Background(), "test-org", "cached-config-repo", "main")
+		assert.Nil(t, err)
+		return config
+	}
+
+	// Without a TTL, unchanged configurations are requested conditionally
+	assert.Equal(t, 1000, get().LFSSizeThreshold)
+	assert.Equal(t, 1000, get().LFSSizeThreshold)
+	assert.Equal(t, 2, server.Calls(path))
+
+	// Within the TTL they are not requested at all
+	SetConfigTTL(time.Hour)
+	assert.Equal(t, 1000, get().LFSSizeThreshold)
+	assert.Equal(t, 2, server.Calls(path))
+
+	// Changes are downloaded once the TTL passed
+	server.AddFile(repo, "main", configFile, []byte("lfsSizeThreshold: 2000\n"))
+	SetConfigTTL(0)
+	assert.Equal(t, 2000, get().LFSSizeThreshold)
+	assert.Equal(t, 3, server.Calls(path))
+
+	// Missing configurations are cached as well
+	SetConfigTTL(time.Hour)
+	for i := 0; i < 2; i++ {
+		config, err := w.getWatchDogConfig(context.Background(), "test-org", "cached-config-repo", "other")
+		assert.Nil(t, err)
+		assert.Equal(t, lfsSizeThreshold, config.LFSSizeThreshold)
+	}
+	assert.Equal(t, 4, server.Calls(path))
+}
+
+func TestConfigOfPushedBranch(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	configContentCache.Clear()
+	SetConfigTTL(time.Hour)
+	defer SetConfigTTL(0)
+
+	repo := "test-org/branch-config-repo"
+	owner, name := "test-org", "branch-config-repo"
+	contents := "GET repos/" + repo + "/contents/" + configFile
+	push := func(sha string, files ...string) *CommitResult {
+		server.AddFile(repo, sha, configFile, []byte("lfsSizeThreshold: 1000\n"))
+		for _, file := range files {
+			if file != configFile {
+				server.AddFileWithSize(repo, sha, file, 2000)
+			}
+		}
+		result := w.Check(&github.PushEvent{
+			Ref:     github.String("refs/heads/main"),
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{ID: github.String(sha), Distinct: github.Bool(true), Added: files}},
+		})
+		return result.Commits[0]
+	}
+
+	// Pushes to a branch share its configuration
+	assert.Len(t, push("sha1", "a.bin").Findings, 1)
+	assert.Len(t, push("sha2", "b.bin").Findings, 1)
+	assert.Equal(t, 1, server.Calls(contents))
+
+	// Pushes that change it read it at their commits
+	assert.Len(t, push("sha3", configFile, "c.bin").Findings, 1)
+	assert.Equal(t, 2, server.Calls(contents))
+}
+
+func TestConfigExtends(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	extendsCache.Clear()
+
+	repo := "test-org/extends-repo"
+	get := func(sha string) (*Config, error) {
+		return w.getWatchDogConfig(context.Background(), "test-org", "extends-repo", sha)
+	}
+
+	// Settings of the extending configuration win, the chain spans
+	// repositories
+	server.AddFile(repo, "sha1", configFile, []byte("extends: [.github/team.yml]\nlfsSizeThreshold: 1000\n"))
+	server.AddFile(repo, "sha1", ".github/team.yml", []byte("extends: [\"test-org/policies:base.yml\"]\nlfsSizeThreshold: 2000\nmentionAuthor: true\n"))
+	server.AddFile("test-org/policies", "", "base.yml", []byte("lfsSizeExemptions: \"*.xml\"\nlfsCommitStatusEnabled: true\n"))
+	config, err := get("sha1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, config.LFSSizeThreshold)
+	assert.True(t, config.MentionAuthor)
+	assert.True(t, config.LFSCommitStatusEnabled)
+	assert.True(t, config.LFSExemptionsFilter.Allows("a.xml"))
+
+	// Extended configurations are cached
+	_, err = get("sha1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/policies/contents/base.yml"))
+
+	// Cycles, missing and invalid configurations are errors, not defaults
+	server.AddFile(repo, "sha2", configFile, []byte("extends: [a.yml]\n"))
+	server.AddFile(repo, "sha2", "a.yml", []byte("extends: [b.yml]\n"))
+	server.AddFile(repo, "sha2", "b.yml", []byte("extends: [a.yml]\n"))
+	_, err = get("sha2")
+	var extendsErr *ExtendsError
+	assert.True(t, errors.As(err, &extendsErr))
+	assert.Contains(t, err.Error(), "form a cycle")
+	assert.Len(t, extendsErr.Chain, 3)
+
+	server.AddFile(repo, "sha3", configFile, []byte("extends: [missing.yml]\n"))
+	_, err = get("sha3")
+	assert.True(t, errors.As(err, &extendsErr))
+	assert.True(t, errors.Is(err, scm.ErrNotFound))
+
+	server.AddFile(repo, "sha4", configFile, []byte("extends: [bad.yml]\n"))
+	server.AddFile(repo, "sha4", "bad.yml", []byte("noSuchSetting: 1\n"))
+	_, err = get("sha4")
+	assert.NotNil(t, err)
+
+	// Chains are limited in depth
+	for i := 0; i <= maxExtendsDepth; i++ {
+		server.AddFile(repo, "sha5", fmt.Sprintf("%d.yml", i), []byte(fmt.Sprintf("extends: [%d.yml]\n", i+1)))
+	}
+	server.AddFile(repo, "sha5", configFile, []byte("extends: [0.yml]\n"))
+	_, err = get("sha5")
+	assert.Contains(t, err.Error(), "levels deep")
+}
+
+func TestDryRun(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	SetDryRun(true)
+	defer SetDryRun(false)
+
+	server.AddFile("test-org/dry-run-repo", "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/dry-run-repo", "sha1", "large.bin", 2000)
+
+	result := w.Check(pushEvent("test-org/dry-run-repo", []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}}}))
+
+	assert.Equal(t, 1, len(result.Commits[0].Findings))
+	assert.Equal(t, 0, len(server.Comments()))
+	assert.Equal(t, 0, len(server.Statuses()))
+
+	// Nothing is recorded that later pushes would resolve
+	_, audited := OpenViolations("test-org/dry-run-repo")
+	assert.False(t, audited)
+}
+
+func TestSuppressions(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	config, err := ParseConfig([]byte("lfsSizeThreshold: 1000\n" +
+		"suppress:\n" +
+		"  - rule: oversize-file\n" +
+		"    path: Data/huge.bin\n" +
+		"    reason: needed by the legacy importer\n" +
+		"  - rule: LFS001\n" +
+		"    path: \"fixtures/**\"\n"))
+	assert.Nil(t, err)
+
+	server.AddFileWithSize("test-org/test-repo", "sha1", "Data/huge.bin", 2000)
+	server.AddFileWithSize("test-org/test-repo", "sha1", "Data/other.bin", 2000)
+	server.AddFileWithSize("test-org/test-repo", "sha1", "fixtures/a/b.bin", 2000)
+
+	result := w.evaluate(context.Background(), &Commit{
+		Owner: "test-org", Repo: "test-repo", SHA: "sha1",
+		Added: []string{"Data/huge.bin", "Data/other.bin", "fixtures/a/b.bin"},
+	}, config)
+
+	assert.Equal(t, 1, len(result.Findings))
+	assert.Equal(t, "Data/other.bin", result.Findings[0].Path)
+	assert.Equal(t, 2, len(result.Suppressed))
+	assert.Equal(t, "needed by the legacy importer", result.Suppressed[0].SuppressionReason)
+
+	_, err = ParseConfig([]byte("suppress:\n  - rule: LFS999\n    path: a.bin\n"))
+	assert.NotNil(t, err)
+}
+
+func TestMentionAuthor(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	server.AddUser("jdoe", "jane.doe@example.com")
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSizeThreshold: 1000\nmentionAuthor: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+
+	event := pushEvent("test-org/test-repo", []*github.HeadCommit{{
+		ID:       github.String("sha1"),
+		Distinct: github.Bool(true),
+		Added:    []string{"large.bin"},
+		Author:   &github.CommitAuthor{Email: github.String("Jane.Doe@example.com")},
+	}})
+	w.Check(event)
+	w.Check(event)
+
+	comments := server.Comments()
+	assert.Equal(t, 2, len(comments))
+	assert.True(t, strings.HasPrefix(comments[0].Body, "@jdoe **:warning:"))
+	// The second lookup is served from the cache
+	assert.Equal(t, 1, server.Calls("GET search/users"))
+}
+
+func TestRepoLabel(t *testing.T) {
+	reset := func() {
+		SetMetricsRepoLimit(0)
+		repoLabels.admitted = make(map[string]bool)
+		repoLabels.counts = newRepoCounts()
+	}
+	reset()
+	defer reset()
+	assert.Equal(t, otherRepos, repoLabel("test-org/label-repo-a"))
+
+	SetMetricsRepoLimit(2)
+	assert.Equal(t, "test-org/label-repo-a", repoLabel("test-org/label-repo-a"))
+	assert.Equal(t, "test-org/label-repo-b", repoLabel("test-org/label-repo-b"))
+	assert.Equal(t, otherRepos, repoLabel("test-org/label-repo-c"))
+	assert.Equal(t, "test-org/label-repo-a", repoLabel("test-org/label-repo-a"))
+
+	// A busier repository takes the label of the one with the fewest
+	// commits, whose series are removed
+	findingsTotal.Inc("test-org", "test-org/label-repo-b", RuleOversizeFile)
+	assert.Equal(t, otherRepos, repoLabel("test-org/label-repo-c"))
+	assert.Equal(t, "test-org/label-repo-c", repoLabel("test-org/label-repo-c"))
+	assert.Equal(t, otherRepos, repoLabel("test-org/label-repo-b"))
+	assert.Equal(t, "test-org/label-repo-a", repoLabel("test-org/label-repo-a"))
+	var b strings.Builder
+	assert.Nil(t, metrics.Write(&b))
+	assert.NotContains(t, b.String(), "test-org/label-repo-b")
+}
+
+// rateLimitedSCM fails directory listings with a rate limit error until reset
+type rateLimitedSCM struct {
+	scm.Client
+	reset time.Time
+	limit bool
+}
+
+func (r *rateLimitedSCM) GetDirContent(ctx context.Context, owner, repo, ref, path string) ([]*scm.Entry, error) {
+	if r.limit {
+		return nil, &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: r.reset}}, Message: "API rate limit exceeded"}
+	}
+	return r.Client.GetDirContent(ctx, owner, repo, ref, path)
+}
+
+func TestRateLimitedRetry(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+
+	var retry func()
+	var delay time.Duration
+	afterFunc = func(d time.Duration, f func()) *time.Timer {
+		delay, retry = d, f
+		return nil
+	}
+	defer func() { afterFunc = time.AfterFunc }()
+
+	client, _ := github.NewEnterpriseClient(server.URL, server.URL, http.DefaultClient)
+	limited := &rateLimitedSCM{Client: scm.NewGitHub(client), reset: time.Now().Add(time.Hour), limit: true}
+	w := New(limited)
+
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+
+	var checked []*CommitResult
+	result := w.CheckWithProgress(pushEvent("test-org/test-repo", []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}}}), func(commit *CommitResult) { checked = append(checked, commit) })
+
+	assert.Equal(t, limited.reset, result.Commits[0].RetryAt)
+	assert.Empty(t, checked)
+	assert.True(t, delay > 59*time.Minute)
+	statuses := server.Statuses()
+	assert.Equal(t, 2, len(statuses))
+	assert.Equal(t, "error", statuses[1].State)
+	assert.Equal(t, "check could not complete, will retry", statuses[1].Description)
+	assert.Equal(t, 0, len(server.Comments()))
+
+	// The push is only complete once the commit was checked again
+	waited := make(chan struct{})
+	go func() {
+		result.WaitRetries()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("the retry is still pending")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	limited.limit = false
+	retry()
+	<-waited
+
+	statuses = server.Statuses()
+	assert.Equal(t, "failure", statuses[len(statuses)-1].State)
+	assert.Equal(t, 1, len(server.Comments()))
+	assert.Equal(t, 1, len(checked))
+	assert.Equal(t, 1, len(checked[0].Findings))
+}
+
+func TestErrorStatusForIncompleteEvaluation(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\nlfsChecksEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "assets/small.bin", 100)
+	server.InjectError("GET", "repos/test-org/test-repo/contents/assets", http.StatusBadGateway, 1)
+
+	w.Check(pushEvent("test-org/test-repo", []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"assets/small.bin"}}}))
+
+	statuses := server.Statuses()
+	assert.Equal(t, "error", statuses[len(statuses)-1].State)
+	assert.Equal(t, "could not evaluate the commit (1 error)", statuses[len(statuses)-1].Description)
+
+	runs := server.CheckRuns()
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, "cancelled", runs[0].GetConclusion())
+	assert.Contains(t, runs[0].Output.GetSummary(), "could not obtain file size for 'assets/small.bin'")
+
+	// Repositories without a configuration are evaluated with the defaults
+	server.AddFileWithSize("test-org/unconfigured-repo", "sha1", "assets/small.bin", 100)
+	result := w.Check(pushEvent("test-org/unconfigured-repo", []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"assets/small.bin"}}}))
+	assert.Empty(t, result.Commits[0].Errors)
+}
+
+func TestCheckWithProgress(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	event := pushEvent("test-org/progress-repo", []*github.HeadCommit{
+		{ID: github.String("sha1"), Distinct: github.Bool(true)},
+		{ID: github.String("sha2"), Distinct: github.Bool(true)},
+	})
+
+	var mu sync.Mutex
+	var checked []string
+	w.CheckWithProgress(event, func(commit *CommitResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		checked = append(checked, commit.SHA)
+	})
+	assert.ElementsMatch(t, []string{"sha1", "sha2"}, checked)
+}
+
+func TestUnicodeNormalization(t *testing.T) {
+	nfc, nfd := "Caf\u00e9", "Cafe\u0301"
+
+	config, err := ParseConfig([]byte("lfsSizeExemptions: \"" + nfc + "/*.txt\"\nsuppress:\n  - rule: LFS001\n    path: \"" + nfc + "/*.psd\"\n    reason: legacy\n"))
+	assert.Nil(t, err)
+	_, violates := evaluateFile(config, nfd+"/notes.txt", 600000)
+	assert.False(t, violates)
+	finding, violates := evaluateFile(config, nfd+"/logo.psd", 600000)
+	assert.True(t, violates)
+	_, suppressed := config.suppression(finding)
+	assert.True(t, suppressed)
+
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	server.AddFileWithSize("test-org/test-repo", "sha1", nfc+".psd", 1234)
+	size, err := w.getFileSize(context.Background(), "test-org", "test-repo", "sha1", nfd+".psd")
+	assert.Nil(t, err)
+	assert.Equal(t, 1234, size)
+}
+
+func TestCommentCooldown(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	now := time.Now()
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+
+	repo := "test-org/cooldown-repo"
+	config := []byte("lfsSizeThreshold: 1000\ncommentCooldown: 10m\n")
+	for _, sha := range []string{"sha1", "sha2", "sha3", "sha4"} {
+		server.AddFile(repo, sha, configFile, config)
+		server.AddFileWithSize(repo, sha, sha+".bin", 2000)
+	}
+
+	owner, name := "test-org", "cooldown-repo"
+	push := func(ref, sha string) {
+		w.Check(&github.PushEvent{
+			Ref:     &ref,
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{ID: &sha, Distinct: github.Bool(true), Added: []string{sha + ".bin"}}},
+		})
+	}
+
+	push("refs/heads/main", "sha1")
+	now = now.Add(5 * time.Minute)
+	push("refs/heads/main", "sha2")
+
+	comments := server.Comments()
+	assert.Equal(t, 1, len(comments))
+	assert.Equal(t, "sha1", comments[0].SHA)
+	assert.Contains(t, comments[0].Body, "- `sha1.bin`")
+	assert.Contains(t, comments[0].Body, "**Also pushed to this branch in sha2:**")
+	assert.Contains(t, comments[0].Body, "- `sha2.bin`")
+	assert.Equal(t, 1, strings.Count(comments[0].Body, footerPrefix))
+
+	// Other branches have their own cooldown
+	push("refs/heads/feature", "sha3")
+	assert.Equal(t, 2, len(server.Comments()))
+
+	// The cooldown starts with the first comment, not the last update
+	now = now.Add(6 * time.Minute)
+	push("refs/heads/main", "sha4")
+	comments = server.Comments()
+	assert.Equal(t, 3, len(comments))
+	assert.Equal(t, "sha4", comments[2].SHA)
+	assert.NotContains(t, comments[0].Body, "sha4.bin")
+}
+
+func TestPersistCommentCooldowns(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	items := store.NewMemory()
+	assert.Nil(t, SetStore(items))
+	defer func() { violationStore.store = nil }()
+
+	repo := "test-org/persist-cooldown-repo"
+	config := []byte("lfsSizeThreshold: 1000\ncommentCooldown: 10m\n")
+	for _, sha := range []string{"sha1", "sha2"} {
+		server.AddFile(repo, sha, configFile, config)
+		server.AddFileWithSize(repo, sha, sha+".bin", 2000)
+	}
+
+	owner, name := "test-org", "persist-cooldown-repo"
+	push := func(sha string) {
+		w.Check(&github.PushEvent{
+			Ref:     github.String("refs/heads/main"),
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{ID: &sha, Distinct: github.Bool(true), Added: []string{sha + ".bin"}}},
+		})
+	}
+	push("sha1")
+
+	// A restarted watchdog adds to the last comment on the branch
+	cooldownCache.Clear()
+	assert.Nil(t, SetStore(items))
+	push("sha2")
+	comments := server.Comments()
+	assert.Equal(t, 1, len(comments))
+	assert.Contains(t, comments[0].Body, "**Also pushed to this branch in sha2:**")
+}
+
+func TestCommentFooter(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	SetVersion("2.0.0")
+	SetCommentSignature("Posted by the LFS watchdog of the platform team")
+	defer SetVersion("dev")
+	defer SetCommentSignature("")
+
+	repo := "test-org/footer-repo"
+	config := []byte("lfsSizeThreshold: 1000\nresolvedCommentEnabled: Yes\n")
+	server.AddFile(repo, "sha1", configFile, config)
+	server.AddFile(repo, "sha2", configFile, config)
+	server.AddFileWithSize(repo, "sha1", "a.bin", 2000)
+	server.AddFileWithSize(repo, "sha2", "a.bin", 130)
+
+	owner, name := "test-org", "footer-repo"
+	push := func(commit *github.HeadCommit) {
+		w.Check(&github.PushEvent{
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{commit},
+		})
+	}
+	push(&github.HeadCommit{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"a.bin"}})
+	push(&github.HeadCommit{ID: github.String("sha2"), Distinct: github.Bool(true), Modified: []string{"a.bin"}})
+
+	comments := server.Comments()
+	if assert.Equal(t, 2, len(comments)) {
+		footer, ok := ParseCommentFooter(comments[0].Body)
+		assert.True(t, ok)
+		assert.Equal(t, "2.0.0", footer.Version)
+		assert.Equal(t, []string{RuleOversizeFile}, footer.Rules)
+		assert.Len(t, footer.Config, 12)
+		assert.Contains(t, comments[0].Body, "\nPosted by the LFS watchdog of the platform team\n\n<!-- lfswatchdog {")
+
+		// The resolved comment has the same configuration
+		resolved, ok := ParseCommentFooter(comments[1].Body)
+		assert.True(t, ok)
+		assert.Equal(t, footer, resolved)
+	}
+
+	// The footer is replaced, not repeated
+	body := withFooter(comments[0].Body, CommentFooter{Version: "2.0.1"})
+	assert.Equal(t, 1, strings.Count(body, footerPrefix))
+	assert.Equal(t, 1, strings.Count(body, "Posted by the LFS watchdog"))
+	footer, _ := ParseCommentFooter(body)
+	assert.Equal(t, "2.0.1", footer.Version)
+
+	_, ok := ParseCommentFooter("A comment by someone else")
+	assert.False(t, ok)
+}
+
+func TestConfigHash(t *testing.T) {
+	a, err := ParseConfig([]byte("lfsSizeThreshold: 1000\n"))
+	assert.Nil(t, err)
+	b, err := ParseConfig([]byte("# Tightened\nlfsSizeThreshold:   1000\n"))
+	assert.Nil(t, err)
+	c, err := ParseConfig([]byte("lfsSizeThreshold: 2000\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, configHash(a), configHash(b))
+	assert.NotEqual(t, configHash(a), configHash(c))
+}
+
+func TestProposeFix(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/fix-repo"
+	for _, sha := range []string{"sha1", "sha2"} {
+		server.AddFile(repo, sha, configFile, []byte("lfsSizeThreshold: 10\nlfsFixPullRequestEnabled: Yes\n"))
+		server.AddFile(repo, sha, ".gitattributes", []byte("*.psd filter=lfs diff=lfs merge=lfs -text"))
+		server.AddFile(repo, sha, "assets/large file.bin", []byte("large binary content"))
+		server.AddFile(repo, sha, "small.txt", []byte("small"))
+	}
+	server.AddFile(repo, "sha2", "second.bin", []byte("more binary content"))
+
+	owner, name, ref := "test-org", "fix-repo", "refs/heads/main"
+	event := &github.PushEvent{
+		Ref:   &ref,
+		After: github.String("sha2"),
+		Repo:  &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{
+			{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"assets/large file.bin", "small.txt"}},
+			{ID: github.String("sha2"), Distinct: github.Bool(true), Added: []string{"second.bin"}},
+		},
+	}
+	result := w.Check(event)
+
+	// One pull request for the whole push, based on its head
+	prs := server.PullRequests()
+	assert.Equal(t, 1, len(prs))
+	assert.Equal(t, "lfswatchdog/fix-sha2", prs[0].GetHead())
+	assert.Equal(t, "main", prs[0].GetBase())
+	assert.True(t, prs[0].GetDraft())
+	assert.Contains(t, prs[0].GetBody(), "- `assets/large file.bin`\n- `second.bin`\n")
+	for _, action := range result.Commits[0].Actions {
+		assert.NotEqual(t, "pull_request", action.Type)
+	}
+	assert.Contains(t, result.Commits[1].Actions, Action{Type: "pull_request", Detail: server.URL + "/test-org/fix-repo/pull/1"})
+
+	content := []byte("large binary content")
+	oid := fmt.Sprintf("%x", sha256.Sum256(content))
+	stored, ok := server.LFSObject(oid)
+	assert.True(t, ok)
+	assert.Equal(t, content, stored)
+
+	head, _ := server.Branch(repo, "lfswatchdog/fix-sha2")
+	pointer, _ := server.File(repo, head, "assets/large file.bin")
+	assert.Equal(t, "version https://git-lfs.github.com/spec/v1\noid sha256:"+oid+"\nsize 20\n", string(pointer.Content))
+	attributes, _ := server.File(repo, head, ".gitattributes")
+	assert.Equal(t, "*.psd filter=lfs diff=lfs merge=lfs -text\n/assets/large[[:space:]]file.bin filter=lfs diff=lfs merge=lfs -text\n"+
+		"/second.bin filter=lfs diff=lfs merge=lfs -text\n", string(attributes.Content))
+	small, _ := server.File(repo, head, "small.txt")
+	assert.Equal(t, "small", string(small.Content))
+
+	// A redelivered push doesn't open another pull request
+	w.Check(event)
+	assert.Equal(t, 1, len(server.PullRequests()))
+}
+
+func TestProposeAttributes(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/track-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 10\nlfsAttributesPullRequestEnabled: Yes\n"))
+	server.AddFile(repo, "sha1", ".gitattributes", []byte("*.psd filter=lfs diff=lfs merge=lfs -text\n"))
+	server.AddFile(repo, "sha1", "art/hero.tga", []byte("large binary content"))
+	server.AddFile(repo, "sha1", "art/villain.tga", []byte("large binary content"))
+	server.AddFile(repo, "sha1", "tools/it's a tool", []byte("large binary content"))
+
+	owner, name, ref := "test-org", "track-repo", "refs/heads/feature"
+	event := &github.PushEvent{
+		Ref:  &ref,
+		Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true),
+			Added: []string{"art/hero.tga", "art/villain.tga", "tools/it's a tool"}}},
+	}
+	result := w.Check(event)
+
+	prs := server.PullRequests()
+	if assert.Equal(t, 1, len(prs)) {
+		assert.Equal(t, "lfswatchdog/track-sha1", prs[0].GetHead())
+		assert.Equal(t, "feature", prs[0].GetBase())
+		assert.Contains(t, prs[0].GetBody(), "- `*.tga`\n- `/tools/it's[[:space:]]a[[:space:]]tool`\n")
+		assert.Contains(t, prs[0].GetBody(), `git lfs migrate import --no-rewrite 'art/hero.tga' 'art/villain.tga' 'tools/it'\''s a tool'`)
+	}
+	assert.Contains(t, result.Commits[0].Actions, Action{Type: "pull_request", Detail: server.URL + "/test-org/track-repo/pull/1"})
+
+	head, _ := server.Branch(repo, "lfswatchdog/track-sha1")
+	attributes, _ := server.File(repo, head, ".gitattributes")
+	assert.Equal(t, "*.psd filter=lfs diff=lfs merge=lfs -text\n*.tga filter=lfs diff=lfs merge=lfs -text\n"+
+		"/tools/it's[[:space:]]a[[:space:]]tool filter=lfs diff=lfs merge=lfs -text\n", string(attributes.Content))
+	// The files stay in Git until they are migrated
+	file, _ := server.File(repo, head, "art/hero.tga")
+	assert.Equal(t, "large binary content", string(file.Content))
+
+	// A redelivered push doesn't open another pull request
+	w.Check(event)
+	assert.Equal(t, 1, len(server.PullRequests()))
+}
+
+func TestSuggestedPatterns(t *testing.T) {
+	findings := []Finding{
+		{Path: "a/model.FBX", Rule: RuleOversizeFile},
+		{Path: "b/model.FBX", Rule: RuleOversizeFile},
+		{Path: "bin/.hidden", Rule: RuleOversizeFile},
+		{Path: "locked.psd", Rule: RuleLockedFile},
+		{Path: "lib/tool", Rule: RuleBinaryChurn},
+	}
+	assert.Equal(t, []string{"*.FBX", "/bin/.hidden", "/lib/tool"}, suggestedPatterns(findings))
+}
+
+func TestLFSUsage(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/usage-repo"
+	a := lfsPointer(strings.Repeat("a", 64), 3000000)
+	server.AddFile(repo, "main", "a.psd", []byte(a))
+	server.AddFile(repo, "main", "copy/a.psd", []byte(a))
+	server.AddFile(repo, "main", "b.psd", []byte(lfsPointer(strings.Repeat("b", 64), 12345)))
+	// Not a pointer, but within the size of pointers
+	server.AddFile(repo, "main", "notes.txt", []byte(strings.Repeat("x", 130)))
+	server.AddFileWithSize(repo, "main", "large.bin", 2000)
+
+	usage, err := w.LFSUsage(context.Background(), "test-org", "usage-repo", "main")
+	assert.Nil(t, err)
+	assert.Equal(t, &LFSUsage{Ref: "main", Objects: 2, Size: 3012345}, usage)
+	assert.Equal(t, 3, server.Calls("GET repos/test-org/usage-repo/git/blobs/"))
+}
+
+func TestLockedFiles(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/locks-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\n"+
+		"lfsCommitStatusEnabled: Yes\n"+
+		"lfsChecksEnabled: Yes\n"+
+		"rules:\n"+
+		"  locked-file:\n"+
+		"    enabled: true\n"))
+	server.AddFileWithSize(repo, "sha1", "art/hero.psd", 500)
+	server.AddFileWithSize(repo, "sha1", "art/mine.psd", 500)
+	server.AddFileWithSize(repo, "sha1", "art/large.bin", 2000)
+	server.AddLFSLock(repo, "art/hero.psd", "alice")
+	server.AddLFSLock(repo, "art/mine.psd", "bob")
+	server.AddLFSLock(repo, "art/untouched.psd", "alice")
+
+	owner, name := "test-org", "locks-repo"
+	result := w.Check(&github.PushEvent{
+		Repo:   &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Pusher: &github.User{Name: github.String("Bob")},
+		Commits: []*github.HeadCommit{{
+			ID:       github.String("sha1"),
+			Distinct: github.Bool(true),
+			Modified: []string{"art/hero.psd", "art/mine.psd", "art/large.bin"},
+		}},
+	})
+
+	findings := result.Commits[0].Findings
+	if assert.Equal(t, 2, len(findings)) {
+		assert.Equal(t, Finding{Path: "art/hero.psd", Rule: RuleLockedFile, Severity: SeverityWarning, LockedBy: "alice"}, findings[1])
+	}
+
+	comments := server.Comments()
+	if assert.Equal(t, 1, len(comments)) {
+		assert.Contains(t, comments[0].Body, "**:lock: The following files are locked with Git LFS by other users, coordinate your changes with them (LFS002 locked-file):**\n"+
+			"- `art/hero.psd` (locked by alice)")
+	}
+	statuses := server.Statuses()
+	assert.Equal(t, "1 file >1000B, 1 file locked", statuses[len(statuses)-1].Description)
+	checkRuns := server.CheckRuns()
+	if assert.Equal(t, 1, len(checkRuns)) {
+		summary := checkRuns[0].Output.GetSummary()
+		assert.Contains(t, summary, "### LFS002 locked-file: 1 file locked by other users\n\n| File | Locked by |\n|---|---|\n")
+		assert.Contains(t, summary, "| alice |")
+	}
+
+	// Optional rules are disabled by default
+	config, err := ParseConfig([]byte("lfsSizeThreshold: 1000\n"))
+	assert.Nil(t, err)
+	assert.False(t, config.ruleEnabled(RuleLockedFile))
+}
+
+// laggingSCM omits files from directory listings until they were listed
+// `lag` times, like a replica that hasn't caught up with a push
+type laggingSCM struct {
+	scm.Client
+	lag   int
+	calls int32
+}
+
+func (l *laggingSCM) GetDirContent(ctx context.Context, owner, repo, ref, path string) ([]*scm.Entry, error) {
+	entries, err := l.Client.GetDirContent(ctx, owner, repo, ref, path)
+	if int(atomic.AddInt32(&l.calls, 1)) > l.lag {
+		return entries, err
+	}
+	var complete []*scm.Entry
+	for _, entry := range entries {
+		if entry.Type == "dir" {
+			complete = append(complete, entry)
+		}
+	}
+	return complete, err
+}
+
+func TestWebUICommit(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/web-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\nmentionAuthor: Yes\n"))
+	server.AddFileWithSize(repo, "sha1", "upload.zip", 2000)
+
+	// Uploads in the web UI have no author username and are committed by
+	// "web-flow"
+	owner, name := "test-org", "web-repo"
+	result := w.Check(&github.PushEvent{
+		Ref:    github.String("refs/heads/main"),
+		Repo:   &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Pusher: &github.User{Name: github.String("jdoe"), Email: github.String("12345+jdoe@users.noreply.github.com")},
+		Commits: []*github.HeadCommit{{
+			ID:        github.String("sha1"),
+			Distinct:  github.Bool(true),
+			Message:   github.String("Add files via upload"),
+			Author:    &github.CommitAuthor{Name: github.String("Jane Doe"), Email: github.String("12345+jdoe@users.noreply.github.com")},
+			Committer: &github.CommitAuthor{Name: github.String("GitHub"), Email: github.String("noreply@github.com"), Login: github.String("web-flow")},
+			Added:     []string{"upload.zip"},
+		}},
+	})
+
+	assert.Equal(t, 1, len(result.Commits[0].Findings))
+	comments := server.Comments()
+	if assert.Equal(t, 1, len(comments)) {
+		assert.True(t, strings.HasPrefix(comments[0].Body, "@jdoe "))
+	}
+	// The login is taken from the noreply address
+	assert.Equal(t, 0, server.Calls("GET search/users"))
+}
+
+func TestAPICreatedCommitWithReplicationLag(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	retries, restore := skipRetryDelays()
+	defer restore()
+
+	repo := "test-org/api-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\n"))
+	server.AddFileWithSize(repo, "sha1", "generated/data/model.bin", 2000)
+	client := &laggingSCM{Client: scm.NewGitHub(server.Client()), lag: 2}
+	w := New(client)
+
+	// Commits created with the contents API by an App have a single file,
+	// often in a new directory, and no author username
+	owner, name := "test-org", "api-repo"
+	result := w.Check(&github.PushEvent{
+		Ref:    github.String("refs/heads/main"),
+		Repo:   &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Pusher: &github.User{Name: github.String("release-bot[bot]")},
+		Commits: []*github.HeadCommit{{
+			ID:       github.String("sha1"),
+			Distinct: github.Bool(true),
+			Author:   &github.CommitAuthor{Name: github.String("release-bot[bot]"), Email: github.String("release-bot[bot]@example.com")},
+			Added:    []string{"generated/data/model.bin"},
+		}},
+	})
+
+	commit := result.Commits[0]
+	assert.Empty(t, commit.Errors)
+	if assert.Equal(t, 1, len(commit.Findings)) {
+		assert.Equal(t, "generated/data/model.bin", commit.Findings[0].Path)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(retries))
+
+	// Retries are bounded
+	atomic.StoreInt32(retries, 0)
+	client.lag, client.calls = 100, 0
+	_, err := w.getFileSize(context.Background(), owner, name, "sha1", "generated/data/model.bin")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(maxLookupRetries), atomic.LoadInt32(retries))
+}
+
+func TestRetryLookupsNotFound(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	retries, restore := skipRetryDelays()
+	defer restore()
+
+	// The replica doesn't have the commit yet
+	server.AddFileWithSize("test-org/test-repo", "sha1", "assets/large.bin", 2000)
+	server.InjectError("GET", "repos/test-org/test-repo/contents/assets", http.StatusNotFound, 2)
+
+	size, err := w.getFileSize(context.Background(), "test-org", "test-repo", "sha1", "assets/large.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, 2000, size)
+	assert.Equal(t, int32(2), atomic.LoadInt32(retries))
+
+	// Other errors are not retried
+	atomic.StoreInt32(retries, 0)
+	server.InjectError("GET", "repos/test-org/test-repo/contents/assets", http.StatusBadGateway, 1)
+	_, err = w.getFileSize(context.Background(), "test-org", "test-repo", "sha1", "assets/large.bin")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(retries))
+}
+
+func TestRetryLookupsReleaseSlots(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	// The backoff between retries doesn't hold a slot of the lookup pool
+	held := make([]int, 0)
+	sleep = func(ctx context.Context, d time.Duration) error {
+		held = append(held, len(lookupPool))
+		return ctx.Err()
+	}
+	defer func() { sleep = realSleep }()
+
+	repo := "test-org/test-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\n"))
+	server.AddFileWithSize(repo, "sha1", "assets/large.bin", 2000)
+	server.AddFileWithSize(repo, "sha1", "small.txt", 10)
+	server.InjectError("GET", "repos/test-org/test-repo/contents/assets", http.StatusNotFound, 2)
+
+	owner, name := "test-org", "test-repo"
+	result := w.Check(&github.PushEvent{
+		Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{{
+			ID:       github.String("sha1"),
+			Distinct: github.Bool(true),
+			Added:    []string{"assets/large.bin", "small.txt"},
+		}},
+	})
+	assert.Equal(t, []int{0, 0}, held)
+	assert.Equal(t, 0, len(result.Commits[0].Errors))
+	assert.Equal(t, 1, len(result.Commits[0].Findings))
+}
+
+func TestSymlinks(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/symlinks-repo"
+	server.AddFileWithSize(repo, "sha1", "lib/large.bin", 2000)
+	server.AddObject(repo, "sha1", "lib/current", &githubtest.Object{Type: "symlink", Content: []byte("v2")})
+	server.AddObject(repo, "sha1", "lib/shared", &githubtest.Object{Type: "symlink", Content: []byte("../../shared/lib")})
+	server.AddObject(repo, "sha1", "lib/home", &githubtest.Object{Type: "symlink", Content: []byte("/home/alice")})
+
+	check := func(config string) *CommitResult {
+		server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"+config))
+		owner, name := "test-org", "symlinks-repo"
+		result := w.Check(&github.PushEvent{
+			Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{
+				ID:       github.String("sha1"),
+				Distinct: github.Bool(true),
+				Added:    []string{"lib/large.bin", "lib/current", "lib/shared", "lib/home"},
+			}},
+		})
+		return result.Commits[0]
+	}
+
+	// Symlinks can't be evaluated by default
+	result := check("")
+	assert.Equal(t, 1, len(result.Findings))
+	if assert.Equal(t, 3, len(result.Errors)) {
+		assert.Contains(t, result.Errors[0].Error(), "could not resolve symlink 'lib/current'")
+	}
+
+	result = check("symlinks: skip\n")
+	assert.Equal(t, 1, len(result.Findings))
+	assert.Equal(t, 0, len(result.Errors))
+
+	// Only symlinks pointing outside the repository are reported
+	result = check("symlinks: warn\n")
+	assert.Equal(t, 0, len(result.Errors))
+	if assert.Equal(t, 3, len(result.Findings)) {
+		assert.Equal(t, Finding{Path: "lib/shared", Rule: RuleSymlink, Severity: SeverityWarning, Target: "../../shared/lib"}, result.Findings[1])
+		assert.Equal(t, "lib/home", result.Findings[2].Path)
+	}
+	comments := server.Comments()
+	assert.Contains(t, comments[len(comments)-1].Body, "**:link: The following files are symlinks, which may not work on other machines (LFS003 symlink):**\n"+
+		"- `lib/shared` → `../../shared/lib`\n- `lib/home` → `/home/alice`")
+	statuses := server.Statuses()
+	assert.Equal(t, "1 file >1000B, 2 symlinks", statuses[len(statuses)-1].Description)
+
+	result = check("symlinks: finding\nrules:\n  symlink:\n    severity: error\n")
+	if assert.Equal(t, 4, len(result.Findings)) {
+		assert.Equal(t, Finding{Path: "lib/current", Rule: RuleSymlink, Severity: SeverityError, Target: "v2"}, result.Findings[1])
+	}
+
+	_, err := ParseConfig([]byte("symlinks: follow\n"))
+	assert.NotNil(t, err)
+}
+
+func TestPointsOutside(t *testing.T) {
+	assert.False(t, pointsOutside("a/link", "b"))
+	assert.False(t, pointsOutside("a/link", "../b"))
+	assert.False(t, pointsOutside("a/link", "./../a/../b"))
+	assert.True(t, pointsOutside("a/link", "../../b"))
+	assert.True(t, pointsOutside("link", ".."))
+	assert.True(t, pointsOutside("a/link", "/etc/passwd"))
+	assert.True(t, pointsOutside("a/link", `C:\Windows`))
+	assert.True(t, pointsOutside("a/link", `..\..\b`))
+}
+
+func TestSubmodules(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/submodules-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsCommitStatusEnabled: Yes\n"+
+		"lfsChecksEnabled: Yes\n"+
+		"submoduleHosts: ['*.example.com']\n"+
+		"rules:\n"+
+		"  new-submodule:\n"+
+		"    enabled: true\n"+
+		"  submodule-url:\n"+
+		"    enabled: true\n"+
+		"  unknown-submodule-commit:\n"+
+		"    enabled: true\n"))
+	server.AddFile(repo, "sha1", gitmodulesFile, []byte(`[submodule "internal"]
+	path = lib/internal
+	url = ../internal.git
+[submodule "external"]
+	path = lib/external
+	url = https://github.com/foo/bar.git
+[submodule "vendor"]
+	path = lib/vendor
+	url = git@git.example.com:team/vendor.git
+[submodule "tools"]
+	path = lib/tools
+	url = `+server.URL+`/test-org/tools.git
+`))
+	for _, name := range []string{"internal", "external", "vendor", "tools"} {
+		server.AddObject(repo, "sha1", "lib/"+name, &githubtest.Object{Type: "submodule", Content: []byte(name)})
+	}
+	internal, _ := server.File(repo, "sha1", "lib/internal")
+	server.AddCommit("test-org/internal", &github.RepositoryCommit{SHA: github.String(fmt.Sprintf("%x", sha1.Sum(internal.Content)))})
+
+	owner, name := "test-org", "submodules-repo"
+	result := w.Check(&github.PushEvent{
+		Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{{
+			ID:       github.String("sha1"),
+			Distinct: github.Bool(true),
+			Added:    []string{"lib/internal", "lib/external"},
+			Modified: []string{"lib/vendor", "lib/tools", gitmodulesFile},
+		}},
+	})
+
+	commit := result.Commits[0]
+	assert.Equal(t, 0, len(commit.Errors))
+	tools := fmt.Sprintf("%x", sha1.Sum([]byte("tools")))
+	assert.Equal(t, []Finding{
+		{Path: "lib/internal", Rule: RuleNewSubmodule, Severity: SeverityWarning, Target: "../internal.git"},
+		{Path: "lib/external", Rule: RuleNewSubmodule, Severity: SeverityWarning, Target: "https://github.com/foo/bar.git"},
+		{Path: "lib/external", Rule: RuleSubmoduleURL, Severity: SeverityError, Target: "https://github.com/foo/bar.git"},
+		{Path: "lib/tools", Rule: RuleSubmoduleCommit, Severity: SeverityWarning, Target: server.URL + "/test-org/tools.git", Commit: tools},
+	}, commit.Findings)
+
+	comments := server.Comments()
+	if assert.Equal(t, 1, len(comments)) {
+		assert.Contains(t, comments[0].Body, "**:package: Submodule URL is not on an allowed host (LFS005 submodule-url):**\n"+
+			"- `lib/external` → `https://github.com/foo/bar.git`")
+		assert.Contains(t, comments[0].Body, fmt.Sprintf("(commit `%s` not found)", tools[:7]))
+	}
+	statuses := server.Statuses()
+	assert.Equal(t, "failure", statuses[len(statuses)-1].State)
+	assert.Equal(t, "4 submodule findings", statuses[len(statuses)-1].Description)
+	checkRuns := server.CheckRuns()
+	if assert.Equal(t, 1, len(checkRuns)) {
+		assert.Contains(t, checkRuns[0].Output.GetSummary(), "### LFS004 new-submodule: 2 submodules\n\nSubmodule was added.\n\n| Submodule | URL |\n")
+	}
+}
+
+func TestSplitGitURL(t *testing.T) {
+	for _, test := range []struct{ url, host, path string }{
+		{"https://GitHub.example.com/org/repo.git", "github.example.com", "/org/repo.git"},
+		{"ssh://git@github.example.com:22/org/repo", "github.example.com", "/org/repo"},
+		{"git@github.example.com:org/repo.git", "github.example.com", "org/repo.git"},
+	} {
+		host, p, ok := splitGitURL(test.url)
+		assert.True(t, ok, test.url)
+		assert.Equal(t, test.host, host)
+		assert.Equal(t, test.path, p)
+	}
+	for _, url := range []string{"/srv/git/repo.git", `C:\git\repo`, "file:///srv/git/repo.git", "repo"} {
+		_, _, ok := splitGitURL(url)
+		assert.False(t, ok, url)
+	}
+}
+
+func TestBinaryChurn(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	now := time.Now()
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+
+	repo := "test-org/churn-repo"
+	owner, name := "test-org", "churn-repo"
+	check := func(sha string) *CommitResult {
+		server.AddFile(repo, sha, configFile, []byte("lfsCommitStatusEnabled: Yes\n"+
+			"binaryChurnThreshold: 3\n"+
+			"binaryChurnWindow: 168h\n"+
+			"rules:\n"+
+			"  binary-churn:\n"+
+			"    enabled: true\n"))
+		server.AddFile(repo, sha, "assets/icon.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"+sha))
+		server.AddFile(repo, sha, "docs/notes.txt", []byte("notes "+sha))
+		result := w.Check(&github.PushEvent{
+			Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{
+				ID:       github.String(sha),
+				Distinct: github.Bool(true),
+				Modified: []string{"assets/icon.png", "docs/notes.txt"},
+			}},
+		})
+		return result.Commits[0]
+	}
+
+	assert.Equal(t, 0, len(check("sha1").Findings))
+	assert.Equal(t, 0, len(check("sha2").Findings))
+	// Redelivered commits are counted once
+	assert.Equal(t, 0, len(check("sha2").Findings))
+
+	// Text files are not reported
+	result := check("sha3")
+	assert.Equal(t, []Finding{{Path: "assets/icon.png", Size: 20, Rule: RuleBinaryChurn, Severity: SeverityWarning, Changes: 3, Modified: true}}, result.Findings)
+	comments := server.Comments()
+	assert.Contains(t, comments[len(comments)-1].Body, "**:repeat: The following binary files change often and may need to be tracked with "+
+		"[Git LFS](https://git-lfs.github.com/) (LFS007 binary-churn):**\n- `assets/icon.png` (changed 3 times in 7 days)")
+	assert.Equal(t, "1 binary file changed often", statusDescription(result.Findings))
+	// Files with text content stop counting once they are read
+	assert.Equal(t, 3, countChanges(&Commit{Owner: owner, Repo: name, SHA: "sha6"}, "docs/notes.txt", time.Hour))
+
+	// Modifications outside the window are forgotten
+	now = now.Add(8 * 24 * time.Hour)
+	assert.Equal(t, 0, len(check("sha4").Findings))
+
+	// Dry runs don't count, sha4 and the next commit do
+	SetDryRun(true)
+	check("sha5")
+	SetDryRun(false)
+	assert.Equal(t, 2, countChanges(&Commit{Owner: owner, Repo: name, SHA: "sha6"}, "assets/icon.png", time.Hour))
+
+	_, err := ParseConfig([]byte("binaryChurnThreshold: 0\n"))
+	assert.NotNil(t, err)
+}
+
+func TestErrorKinds(t *testing.T) {
+	assert.True(t, errors.Is(errGetContentsUpperLimit, ErrTooLarge))
+	assert.True(t, errors.Is(fmt.Errorf("wrapped: %w", &missingFileError{"a.bin", "sha1", "o/r"}), ErrNotFound))
+	assert.True(t, errors.Is(&emptyDirError{"dir", "o/r"}, ErrNotFound))
+	assert.False(t, errors.Is(errGetContentsUpperLimit, ErrNotFound))
+
+	// Files missing from a listing are retried for another reason than
+	// files GitHub does not know
+	assert.Equal(t, "missing", lookupRetryReason(&missingFileError{"a.bin", "sha1", "o/r"}))
+	assert.Equal(t, "not found", lookupRetryReason(fmt.Errorf("lookup: %w", ErrNotFound)))
+	assert.Equal(t, "", lookupRetryReason(errGetContentsUpperLimit))
+}
+
+func TestMalformedCommits(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	event := &github.PushEvent{
+		Repo: &github.PushEventRepository{
+			Name:     github.String("malformed-repo"),
+			FullName: github.String("test-org/malformed-repo"),
+			Owner:    &github.User{Login: github.String("test-org")},
+		},
+		Commits: []*github.HeadCommit{nil, {Added: []string{"large.bin"}}},
+	}
+	result := w.Check(event)
+	assert.Equal(t, 2, len(result.Commits))
+	for _, commit := range result.Commits {
+		assert.True(t, commit.Skipped)
+		assert.Equal(t, "malformed payload", commit.SkipReason)
+	}
+	assert.Equal(t, 0, len(server.Statuses()))
+}
+
+func TestHelpContactTeams(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	server.AddTeam("test-org", "lfs-help")
+
+	repo := "test-org/contact-repo"
+	owner, name := "test-org", "contact-repo"
+	check := func(sha, contact string) string {
+		server.AddFile(repo, sha, configFile, []byte("helpContact: \""+contact+"\"\n"))
+		server.AddFileWithSize(repo, sha, "large.bin", lfsSizeThreshold+1)
+		w.Check(&github.PushEvent{
+			Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{
+				ID:       github.String(sha),
+				Distinct: github.Bool(true),
+				Added:    []string{"large.bin"},
+			}},
+		})
+		comments := server.Comments()
+		return comments[len(comments)-1].Body
+	}
+
+	assert.Contains(t, check("sha1", "@test-org/lfs-help"), "contact @test-org/lfs-help for help")
+	// Mentions of teams that don't exist would notify nobody
+	assert.Contains(t, check("sha2", "@test-org/no-team"), "contact "+lfsHelpContact+" for help")
+
+	SetDefaultHelpContact("@test-org/lfs-help")
+	defer SetDefaultHelpContact(lfsHelpContact)
+	assert.Contains(t, check("sha3", "@test-org/no-team"), "contact @test-org/lfs-help for help")
+	assert.Equal(t, "@test-org/lfs-help", defaultWatchDogConfig().HelpContact)
+	// Team lookups are cached
+	assert.Equal(t, 1, server.Calls("GET orgs/test-org/teams/no-team"))
+
+	for _, contact := range []string{"@test-org/", "@/lfs-help", "@test-org/lfs/help"} {
+		_, err := ParseConfig([]byte("helpContact: \"" + contact + "\"\n"))
+		assert.NotNil(t, err, contact)
+	}
+	for _, contact := range []string{"@jdoe", "[#lfs](https://chat.example.com/lfs)", "@jdoe or https://wiki.example.com/lfs"} {
+		_, err := ParseConfig([]byte("helpContact: \"" + contact + "\"\n"))
+		assert.Nil(t, err, contact)
+	}
+}
+
+func TestPreviewComment(t *testing.T) {
+	config, err := ParseConfig([]byte("helpContact: \"@test-org/lfs-help\"\n" +
+		"lfsSizeThreshold: 1000\n" +
+		"lfsSizeExemptions: \"*.txt\"\n" +
+		"suppress:\n" +
+		"  - path: vendor/**\n" +
+		"    rule: oversize-file\n" +
+		"    reason: third-party\n"))
+	assert.Nil(t, err)
+
+	comment, err := PreviewComment(config, []PreviewFile{
+		{Path: "assets/a.psd"},
+		{Path: "notes.txt"},
+		{Path: "small.bin", Size: 10},
+		{Path: "vendor/lib.so", Size: 5000},
+	}, "jdoe")
+	assert.Nil(t, err)
+	assert.Contains(t, comment, "@jdoe ")
+	assert.Contains(t, comment, "larger than 1000B")
+	assert.Contains(t, comment, "- `assets/a.psd`")
+	assert.Contains(t, comment, "- `notes.txt`")
+	assert.NotContains(t, comment, "small.bin")
+	assert.NotContains(t, comment, "vendor/lib.so")
+	assert.Contains(t, comment, "contact @test-org/lfs-help for help")
+
+	comment, err = PreviewComment(config, []PreviewFile{{Path: "small.bin", Size: 10}}, "jdoe")
+	assert.Nil(t, err)
+	assert.Equal(t, "", comment)
+}
+
+func TestOversizeLFSObjects(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/lfs-object-repo"
+	owner, name := "test-org", "lfs-object-repo"
+	pointer := func(size int) []byte {
+		return []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", strings.Repeat("a", 64), size))
+	}
+	check := func(sha, config string) *CommitResult {
+		server.AddFile(repo, sha, configFile, []byte(config))
+		server.AddFile(repo, sha, "huge.psd", pointer(3000000))
+		server.AddFile(repo, sha, "small.psd", pointer(500))
+		result := w.Check(&github.PushEvent{
+			Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{
+				ID:       github.String(sha),
+				Distinct: github.Bool(true),
+				Added:    []string{"huge.psd", "small.psd"},
+			}},
+		})
+		return result.Commits[0]
+	}
+
+	// Pointers are not oversize files, even below a tiny threshold
+	result := check("sha1", "lfsSizeThreshold: 100\n")
+	assert.Equal(t, 0, len(result.Findings))
+	assert.Equal(t, 0, len(result.Errors))
+
+	result = check("sha2", "lfsSizeThreshold: 100\nreportOversizeLFSObjects: Yes\nlfsObjectSizeThreshold: 1048576\n")
+	assert.Equal(t, []Finding{{Path: "huge.psd", Size: 3000000, Threshold: 1048576, Rule: RuleOversizeLFSObject, Severity: SeverityWarning}}, result.Findings)
+	comments := server.Comments()
+	assert.Contains(t, comments[len(comments)-1].Body, "**:elephant: The following Git LFS objects are larger than 1MB, consider splitting or compressing them "+
+		"(LFS008 oversize-lfs-object):**\n- `huge.psd` (2MB)")
+	assert.Equal(t, "1 large Git LFS object", statusDescription(result.Findings))
+	assert.Contains(t, checkRunSummary(result.Findings, lfsHelpContact, func(string) string { return "" }), "LFS008 oversize-lfs-object: 1 Git LFS object larger than 1MB")
+
+	_, err := ParseConfig([]byte("lfsObjectSizeThreshold: -1\n"))
+	assert.NotNil(t, err)
+}
+
+func TestAdviseThresholds(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/advice-repo"
+	server.AddFile(repo, "main", configFile, []byte("lfsSizeThreshold: 100000\n"))
+	for i := 1; i <= 20; i++ {
+		// Textures of 10KB to 200KB, one of them an outlier
+		size := i * 10000
+		if i == 20 {
+			size = 5000000
+		}
+		server.AddFileWithSize(repo, "main", fmt.Sprintf("textures/t%d.PNG", i), size)
+	}
+	for i := 1; i <= 5; i++ {
+		server.AddFileWithSize(repo, "main", fmt.Sprintf("art/a%d.psd", i), 3000000)
+	}
+	server.AddFileWithSize(repo, "main", "README", 2000)
+
+	advice, err := w.AdviseThresholds(context.Background(), "test-org", "advice-repo", "main")
+	assert.Nil(t, err)
+	assert.Equal(t, "main", advice.Ref)
+	assert.Equal(t, 27, advice.Files)
+	assert.Equal(t, 100000, advice.Threshold)
+	if assert.Equal(t, 4, len(advice.Extensions)) {
+		assert.Equal(t, ExtensionAdvice{Extension: ".psd", Files: 5, TotalSize: 15000000, MedianSize: 3000000, P95Size: 3000000, MaxSize: 3000000, TrackWithLFS: true}, advice.Extensions[0])
+		assert.Equal(t, ExtensionAdvice{Extension: ".png", Files: 20, TotalSize: 6900000, MedianSize: 100000, P95Size: 190000, MaxSize: 5000000, Threshold: 262144}, advice.Extensions[1])
+		// Too few files to advise
+		assert.Equal(t, ExtensionAdvice{Extension: "", Files: 1, TotalSize: 2000, MedianSize: 2000, P95Size: 2000, MaxSize: 2000}, advice.Extensions[2])
+	}
+
+	_, err = w.AdviseThresholds(context.Background(), "test-org", "advice-repo", "missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestInstallationSettings(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	w.SetInstallation(77)
+	defer SetInstallationSettings(77, InstallationSettings{})
+
+	_, err := SetInstallationSettings(77, InstallationSettings{DisabledRules: []string{"LFS999"}})
+	assert.NotNil(t, err)
+	_, err = SetInstallationSettings(77, InstallationSettings{HelpContact: "@org/"})
+	assert.NotNil(t, err)
+
+	settings, err := SetInstallationSettings(77, InstallationSettings{DryRun: true, DisabledRules: []string{"oversize-file"}, HelpContact: "@test-org/lfs-help"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{RuleOversizeFile}, settings.DisabledRules)
+	assert.Len(t, AllInstallationSettings(), 1)
+
+	config, err := ParseConfig([]byte("lfsSizeThreshold: 1000\nrules:\n  binary-churn:\n    severity: notice\n"))
+	assert.Nil(t, err)
+	overridden := settings.apply(config)
+	assert.False(t, overridden.ruleEnabled(RuleOversizeFile))
+	assert.Equal(t, SeverityNotice, overridden.ruleSeverity(RuleBinaryChurn))
+	assert.Equal(t, "@test-org/lfs-help", overridden.HelpContact)
+	assert.True(t, config.ruleEnabled(RuleOversizeFile), "the configuration is copied")
+
+	server.AddFile("test-org/test-repo", "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize("test-org/test-repo", "sha1", "large.bin", 2000)
+
+	event := pushEvent("test-org/test-repo", []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}}})
+	result := w.Check(event)
+	assert.Empty(t, result.Commits[0].Findings)
+	assert.Empty(t, server.Statuses())
+
+	// Other installations are not affected
+	other := newWatchDog(server.URL)
+	other.SetInstallation(78)
+	result = other.Check(event)
+	assert.Len(t, result.Commits[0].Findings, 1)
+	assert.NotEmpty(t, server.Statuses())
+
+	_, err = SetInstallationSettings(77, InstallationSettings{})
+	assert.Nil(t, err)
+	_, ok := GetInstallationSettings(77)
+	assert.False(t, ok)
+}
+
+// fakeArtifactStore keeps artifacts in memory
+type fakeArtifactStore struct {
+	artifacts map[string][]byte
+}
+
+func (s *fakeArtifactStore) Save(name string, content []byte) (string, error) {
+	s.artifacts[name] = content
+	return "https://watchdog.example.com/artifacts/" + name, nil
+}
+
+func TestExportResults(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	store := &fakeArtifactStore{artifacts: make(map[string][]byte)}
+	SetArtifactStore(store)
+	defer SetArtifactStore(nil)
+
+	server.AddFile("test-org/test-repo", "sha1234567", configFile, []byte("lfsSizeThreshold: 1000\nlfsChecksEnabled: Yes\n"))
+	var added []string
+	for i := 0; i <= collapseThreshold; i++ {
+		path := fmt.Sprintf("large%d.bin", i)
+		server.AddFileWithSize("test-org/test-repo", "sha1234567", path, 2000)
+		added = append(added, path)
+	}
+
+	event := pushEvent("test-org/test-repo", []*github.HeadCommit{{ID: github.String("sha1234567"), Distinct: github.Bool(true), Added: added}})
+	w.Check(event)
+
+	runs := server.CheckRuns()
+	if assert.Len(t, runs, 1) {
+		assert.True(t, strings.HasPrefix(runs[0].Output.GetSummary(), "Download the complete results of all 11 findings as "+
+			"[JSON](https://watchdog.example.com/artifacts/test-org-test-repo-sha1234.json) or "+
+			"[CSV](https://watchdog.example.com/artifacts/test-org-test-repo-sha1234.csv).\n\n"))
+	}
+	var results Results
+	assert.Nil(t, json.Unmarshal(store.artifacts["test-org-test-repo-sha1234.json"], &results))
+	assert.Equal(t, "test-org/test-repo", results.Repo)
+	assert.Len(t, results.Findings, 11)
+	csv := string(store.artifacts["test-org-test-repo-sha1234.csv"])
+	assert.True(t, strings.HasPrefix(csv, "path,rule,severity,size,threshold,lockedBy,target,commit,changes\n"))
+	assert.Contains(t, csv, "large10.bin,LFS001,error,2000,1000,,,,0\n")
+
+	// Short results are not exported
+	store.artifacts = make(map[string][]byte)
+	event.Commits[0].Added = added[:1]
+	w.Check(event)
+	assert.Empty(t, store.artifacts)
+}
+
+func TestDifferentialReporting(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/legacy-repo"
+	config := []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\ndifferentialReporting: Yes\n")
+	for _, sha := range []string{"sha1", "sha2", "sha3"} {
+		server.AddFile(repo, sha, configFile, config)
+		server.AddFileWithSize(repo, sha, "legacy.bin", 2000)
+		server.AddFileWithSize(repo, sha, "new.bin", 2000)
+	}
+
+	owner, name := "test-org", "legacy-repo"
+	push := func(ref, sha string, modified ...string) *CommitResult {
+		return w.Check(&github.PushEvent{
+			Ref:     github.String(ref),
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{ID: github.String(sha), Distinct: github.Bool(true), Modified: modified}},
+		}).Commits[0]
+	}
+
+	result := push("refs/heads/feature", "sha1", "legacy.bin")
+	if assert.Len(t, result.Findings, 1) {
+		assert.False(t, result.Findings[0].PreExisting)
+	}
+	assert.Len(t, server.Comments(), 1)
+
+	// Changing the legacy file again doesn't ping the author
+	result = push("refs/heads/feature", "sha2", "legacy.bin", "new.bin")
+	if assert.Len(t, result.Findings, 2) {
+		for _, finding := range result.Findings {
+			assert.Equal(t, finding.Path == "legacy.bin", finding.PreExisting, finding.Path)
+		}
+	}
+	comments := server.Comments()
+	if assert.Len(t, comments, 2) {
+		assert.Contains(t, comments[1].Body, "new.bin")
+		assert.NotContains(t, comments[1].Body, "legacy.bin")
+	}
+	statuses := server.Statuses()
+	assert.Equal(t, "failure", statuses[len(statuses)-1].State)
+
+	result = push("refs/heads/feature", "sha3", "legacy.bin")
+	assert.True(t, result.Findings[0].PreExisting)
+	assert.Len(t, server.Comments(), 2)
+
+	// Other branches have their own findings
+	result = push("refs/heads/other", "sha3", "legacy.bin")
+	assert.False(t, result.Findings[0].PreExisting)
+	assert.Len(t, server.Comments(), 3)
+
+	summary := checkRunSummary([]Finding{{Path: "legacy.bin", Size: 2000, Threshold: 1000, Rule: RuleOversizeFile, PreExisting: true}}, "@someone", func(string) string { return "" })
+	assert.Contains(t, summary, "| `legacy.bin` (reported before) | 1KB |")
+}
+
+func TestTruncatedPayload(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/truncated-repo"
+	owner, name := "test-org", "truncated-repo"
+	// 25 commits on top of "base", each adding a file
+	var payload []*github.HeadCommit
+	parent := "base"
+	for i := 0; i < 25; i++ {
+		sha, file := fmt.Sprintf("sha%02d", i), fmt.Sprintf("file%02d.bin", i)
+		size := 10
+		if i == 2 {
+			size = 2000
+		}
+		server.AddFile(repo, sha, configFile, []byte("lfsSizeThreshold: 1000\n"))
+		server.AddFileWithSize(repo, sha, file, size)
+		server.AddCommit(repo, &github.RepositoryCommit{
+			SHA:     github.String(sha),
+			Parents: []*github.Commit{{SHA: github.String(parent)}},
+			Files:   []*github.CommitFile{{Filename: github.String(file), Status: github.String("added")}},
+		})
+		parent = sha
+		// The payload lists the last 20 commits
+		if i >= 5 {
+			payload = append(payload, &github.HeadCommit{ID: github.String(sha), Distinct: github.Bool(true), Added: []string{file}})
+		}
+	}
+	server.AddCommit(repo, &github.RepositoryCommit{SHA: github.String("base")})
+	event := &github.PushEvent{
+		Repo:         &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Before:       github.String("base"),
+		After:        github.String("sha24"),
+		Size:         github.Int(25),
+		DistinctSize: github.Int(25),
+		Commits:      payload,
+	}
+
+	result := w.Check(event)
+	assert.Zero(t, result.MissingCommits)
+	if assert.Len(t, result.Commits, 25) {
+		assert.Equal(t, "sha00", result.Commits[0].SHA)
+		assert.Equal(t, "sha24", result.Commits[24].SHA)
+		if assert.Len(t, result.Commits[2].Findings, 1) {
+			assert.Equal(t, "file02.bin", result.Commits[2].Findings[0].Path)
+		}
+	}
+	// One comparison, and the omitted commits one by one
+	assert.Equal(t, 1, server.Calls("GET repos/test-org/truncated-repo/compare/base...sha24"))
+	assert.Equal(t, 5, server.Calls("GET repos/test-org/truncated-repo/commits/"))
+
+	// Commits that can't be listed are counted, the payload's are checked
+	server.InjectError("GET", "repos/test-org/truncated-repo/compare/", http.StatusBadGateway, 1)
+	result = w.Check(event)
+	assert.Equal(t, 5, result.MissingCommits)
+	assert.Len(t, result.Commits, 20)
+	assert.Contains(t, renderPushReport(result, func(string, string) string { return "" }), "5 more commits of the push could not be fetched and were not checked.")
+
+	// A new branch is compared with the default branch. Its commits are
+	// distinct although the payload counts some commits as pushed before.
+	server.AddBranch(repo, "main", "base")
+	violationCache.Clear()
+	branch := *event
+	branch.Before = github.String("0000000000000000000000000000000000000000")
+	branch.Created = github.Bool(true)
+	branch.DistinctSize = github.Int(20)
+	branch.Repo = &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}, DefaultBranch: github.String("main")}
+	result = w.Check(&branch)
+	assert.Zero(t, result.MissingCommits)
+	if assert.Len(t, result.Commits, 25) {
+		assert.False(t, result.Commits[2].Skipped)
+		assert.Len(t, result.Commits[2].Findings, 1)
+	}
+
+	// A push above the limit is checked at its head commit, the omitted
+	// commits are not fetched
+	SetMaxCommitsPerPush(10)
+	defer SetMaxCommitsPerPush(0)
+	violationCache.Clear()
+	commits := server.Calls("GET repos/test-org/truncated-repo/commits/")
+	compares := server.Calls("GET repos/test-org/truncated-repo/compare/")
+	result = w.Check(event)
+	assert.Zero(t, result.MissingCommits)
+	if assert.Len(t, result.Commits, 20) {
+		assert.True(t, result.Commits[0].Skipped)
+		assert.Equal(t, "sha24", result.Commits[19].SHA)
+	}
+	assert.Equal(t, commits, server.Calls("GET repos/test-org/truncated-repo/commits/"))
+	assert.Equal(t, compares, server.Calls("GET repos/test-org/truncated-repo/compare/"))
+}
+
+func TestMaxCommitsPerPush(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	SetMaxCommitsPerPush(2)
+	defer SetMaxCommitsPerPush(0)
+
+	repo := "test-org/import-repo"
+	server.AddFile(repo, "sha3", configFile, []byte("lfsSizeThreshold: 1000\nlfsChecksEnabled: Yes\n"))
+	server.AddFileWithSize(repo, "sha3", "large.bin", 2000)
+	server.AddFileWithSize(repo, "sha3", "README.md", 10)
+
+	owner, name := "test-org", "import-repo"
+	result := w.Check(&github.PushEvent{
+		Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{
+			{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin", "tmp.bin"}},
+			{ID: github.String("sha2"), Distinct: github.Bool(true), Added: []string{"README.md"}, Removed: []string{"tmp.bin"}},
+			{ID: github.String("sha3"), Distinct: github.Bool(true), Modified: []string{"README.md"}},
+		},
+	})
+
+	if assert.Len(t, result.Commits, 3) {
+		for _, commit := range result.Commits[:2] {
+			assert.True(t, commit.Skipped)
+			assert.Equal(t, "too many commits", commit.SkipReason)
+		}
+		head := result.Commits[2]
+		assert.Equal(t, "sha3", head.SHA)
+		if assert.Len(t, head.Findings, 1) {
+			assert.Equal(t, "large.bin", head.Findings[0].Path)
+		}
+	}
+	comments := server.Comments()
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, "sha3", comments[0].SHA)
+		assert.True(t, strings.HasPrefix(comments[0].Body, "**Note:** this push has 3 commits, more than are checked one by one. "+
+			"The files changed by all of them were checked at sha3 instead.\n\n"))
+	}
+	runs := server.CheckRuns()
+	if assert.Len(t, runs, 1) {
+		assert.Contains(t, runs[0].Output.GetSummary(), "this push has 3 commits")
+	}
+
+	collapsed := collapseCommits([]*github.HeadCommit{
+		{Added: []string{"a", "b"}, Modified: []string{"c"}},
+		{Removed: []string{"b", "c"}, Modified: []string{"a"}},
+		{Added: []string{"c"}},
+	})
+	assert.Equal(t, []string{"a"}, collapsed.Added)
+	assert.Equal(t, []string{"c"}, collapsed.Modified)
+	assert.Equal(t, []string{"b"}, collapsed.Removed)
+}
+
+func TestReevaluateOnConfigChange(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/policy"
+	config := "lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\nlfsChecksEnabled: Yes\nreevaluateOnConfigChange: Yes\n"
+	server.AddFile(repo, "sha1", configFile, []byte(config))
+	server.AddFileWithSize(repo, "sha1", "assets/legacy.bin", 2000)
+	server.AddFileWithSize(repo, "sha1", "src/main.c", 10)
+
+	owner, name, branch := "test-org", "policy", "main"
+	push := func(ref, sha string) *PushResult {
+		return w.Check(&github.PushEvent{
+			Ref:        github.String(ref),
+			Before:     github.String("sha0"),
+			After:      github.String(sha),
+			Repo:       &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}, DefaultBranch: &branch},
+			Commits:    []*github.HeadCommit{{ID: github.String(sha), Distinct: github.Bool(true), Modified: []string{configFile}}},
+			HeadCommit: &github.HeadCommit{ID: github.String(sha)},
+		})
+	}
+
+	// Other branches keep their configuration to themselves
+	result := push("refs/heads/feature", "sha1")
+	assert.Nil(t, result.Reevaluated)
+
+	result = push("refs/heads/main", "sha1")
+	assert.Empty(t, result.Commits[0].Findings)
+	if assert.NotNil(t, result.Reevaluated) {
+		assert.Equal(t, "sha1", result.Reevaluated.SHA)
+		if assert.Len(t, result.Reevaluated.Findings, 1) {
+			assert.Equal(t, "assets/legacy.bin", result.Reevaluated.Findings[0].Path)
+		}
+	}
+	assert.Empty(t, server.Comments())
+	statuses := server.Statuses()
+	if assert.NotEmpty(t, statuses) {
+		last := statuses[len(statuses)-1]
+		assert.Equal(t, "sha1", last.SHA)
+		assert.Equal(t, "failure", last.State)
+	}
+	runs := server.CheckRuns()
+	if assert.NotEmpty(t, runs) {
+		assert.Contains(t, runs[len(runs)-1].Output.GetSummary(), "**Note:** `.github/watchdog.yml` changed, so all files at sha1 were checked again with the new configuration.")
+	}
+
+	// The reevaluation is opt-in
+	server.AddFile(repo, "sha2", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize(repo, "sha2", "assets/legacy.bin", 2000)
+	result = push("refs/heads/main", "sha2")
+	assert.Nil(t, result.Reevaluated)
+}
+
+func TestImportIsAuditedWithIssue(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/imported"
+	server.AddFile(repo, "sha2", configFile, []byte("lfsSizeThreshold: 1000\n"))
+	server.AddFileWithSize(repo, "sha2", "assets/large.bin", 2000)
+	var added []string
+	for i := 0; i < importFileThreshold; i++ {
+		path := fmt.Sprintf("src/%d/file%d.c", i%50, i)
+		server.AddFileWithSize(repo, "sha2", path, 10)
+		added = append(added, path)
+	}
+
+	owner, name, branch := "test-org", "imported", "main"
+	event := &github.PushEvent{
+		Ref:     github.String("refs/heads/main"),
+		Before:  github.String(strings.Repeat("0", 40)),
+		After:   github.String("sha2"),
+		Created: github.Bool(true),
+		Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}, DefaultBranch: &branch},
+		Commits: []*github.HeadCommit{
+			{ID: github.String("sha1"), Distinct: github.Bool(true), Added: added},
+			{ID: github.String("sha2"), Distinct: github.Bool(true), Modified: []string{"src/0/file0.c"}},
+		},
+	}
+	assert.True(t, isImport(event))
+	result := w.Check(event)
+
+	if assert.Len(t, result.Commits, 2) {
+		assert.True(t, result.Commits[0].Skipped)
+		assert.Equal(t, "import", result.Commits[0].SkipReason)
+		head := result.Commits[1]
+		// The file of the tree was audited although no commit of the push
+		// lists it
+		if assert.Len(t, head.Findings, 1) {
+			assert.Equal(t, "assets/large.bin", head.Findings[0].Path)
+		}
+	}
+	assert.Empty(t, server.Comments())
+	issues := server.Issues()
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, repo, issues[0].Repo)
+		assert.Equal(t, importIssueTitle, issues[0].Title)
+		assert.True(t, strings.HasPrefix(issues[0].Body, "**Note:** this push imported the repository with 2 commits. "))
+		assert.Contains(t, issues[0].Body, "assets/large.bin")
+	}
+
+	// Pushes to other branches and pushes with few files are regular pushes
+	event.Ref = github.String("refs/heads/feature")
+	assert.False(t, isImport(event))
+	event.Ref = github.String("refs/heads/main")
+	event.Commits[0].Added = added[:10]
+	assert.False(t, isImport(event))
+}
+
+func TestUnlistedSizeIsMeasuredWithHEAD(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/huge-blobs"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\n"))
+	server.AddObject(repo, "sha1", "huge.bin", &githubtest.Object{Type: "file", Size: 150000000, Unlisted: true})
+	server.AddFile(repo, "sha1", "empty.txt", nil)
+
+	owner, name := "test-org", "huge-blobs"
+	result := w.Check(&github.PushEvent{
+		Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{
+			{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"huge.bin", "empty.txt"}},
+		},
+	})
+
+	if assert.Len(t, result.Commits, 1) {
+		assert.Empty(t, result.Commits[0].Errors)
+		if assert.Len(t, result.Commits[0].Findings, 1) {
+			assert.Equal(t, "huge.bin", result.Commits[0].Findings[0].Path)
+			assert.Equal(t, 150000000, result.Commits[0].Findings[0].Size)
+		}
+	}
+	assert.Equal(t, 1, server.Calls("HEAD repos/test-org/huge-blobs/contents/huge.bin"))
+}
+
+func TestVendoredLFSPointers(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/vendor-repo"
+	owner, name := "test-org", "vendor-repo"
+	pointer := []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize 3000000\n", strings.Repeat("a", 64)))
+	check := func(sha, config string) *CommitResult {
+		server.AddFile(repo, sha, configFile, []byte(config))
+		server.AddFile(repo, sha, "third_party/lib/model.bin", pointer)
+		server.AddFile(repo, sha, "assets/model.bin", pointer)
+		result := w.Check(&github.PushEvent{
+			Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{
+				ID:       github.String(sha),
+				Distinct: github.Bool(true),
+				Added:    []string{"third_party/lib/model.bin", "assets/model.bin"},
+			}},
+		})
+		return result.Commits[0]
+	}
+
+	// Pointers are fine without vendored directories
+	result := check("sha1", "lfsSizeThreshold: 100\n")
+	assert.Empty(t, result.Findings)
+
+	result = check("sha2", "lfsSizeThreshold: 100\nvendorPaths: [third_party/]\n")
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, []Finding{{Path: "third_party/lib/model.bin", Size: 3000000, Rule: RuleVendoredPointer, Severity: SeverityError}}, result.Findings)
+	comments := server.Comments()
+	assert.Contains(t, comments[len(comments)-1].Body, "**:no_entry: The following files in vendored directories are Git LFS pointers, "+
+		"consumers without Git LFS only get the pointer (LFS009 vendored-lfs-pointer):**\n- `third_party/lib/model.bin`")
+	assert.Equal(t, "1 vendored Git LFS pointer", statusDescription(result.Findings))
+	assert.Contains(t, checkRunSummary(result.Findings, lfsHelpContact, func(string) string { return "" }), "LFS009 vendored-lfs-pointer: 1 Git LFS pointer in vendored directories")
+
+	// The rule can be disabled like any other
+	result = check("sha3", "lfsSizeThreshold: 100\nvendorPaths: [third_party/]\nrules:\n  vendored-lfs-pointer:\n    enabled: false\n")
+	assert.Empty(t, result.Findings)
+}
+
+func TestBypassedLFS(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/bypass-repo"
+	owner, name := "test-org", "bypass-repo"
+	pointer := []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize 3000000\n", strings.Repeat("a", 64)))
+	files := []string{"art/hero.psd", "art/pointer.psd", "art/textures/wall.tga", "art/empty.psd", "docs/notes.txt", "wall.tga"}
+	check := func(sha, config string) *CommitResult {
+		server.AddFile(repo, sha, configFile, []byte(config))
+		server.AddFile(repo, sha, ".gitattributes", []byte("*.psd filter=lfs diff=lfs merge=lfs -text\n"))
+		server.AddFile(repo, sha, "art/textures/.gitattributes", []byte("*.tga filter=lfs diff=lfs merge=lfs -text\n"))
+		server.AddFile(repo, sha, "art/hero.psd", []byte("8BPS binary layers"))
+		server.AddFile(repo, sha, "art/pointer.psd", pointer)
+		server.AddFile(repo, sha, "art/textures/wall.tga", make([]byte, 300))
+		server.AddFile(repo, sha, "art/empty.psd", nil)
+		server.AddFile(repo, sha, "docs/notes.txt", []byte("notes"))
+		server.AddFile(repo, sha, "wall.tga", make([]byte, 300))
+		result := w.Check(&github.PushEvent{
+			Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{ID: github.String(sha), Distinct: github.Bool(true), Added: files}},
+		})
+		return result.Commits[0]
+	}
+
+	// The rule is disabled by default
+	result := check("sha1", "lfsSizeThreshold: 100000\n")
+	assert.Empty(t, result.Findings)
+	assert.Equal(t, 0, server.Calls("GET repos/test-org/bypass-repo/git/trees/sha1"))
+
+	result = check("sha2", "lfsSizeThreshold: 100000\nlfsCommitStatusEnabled: Yes\nrules:\n  bypassed-lfs:\n    enabled: true\n")
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, []Finding{
+		{Path: "art/hero.psd", Size: 18, Rule: RuleBypassedLFS, Severity: SeverityError},
+		{Path: "art/textures/wall.tga", Size: 300, Rule: RuleBypassedLFS, Severity: SeverityError},
+	}, result.Findings)
+
+	comments := server.Comments()
+	body := comments[len(comments)-1].Body
+	assert.Contains(t, body, "**:no_entry: The following files bypassed Git LFS: `.gitattributes` tracks them with Git LFS, "+
+		"but they were committed without it (LFS011 bypassed-lfs):**\n"+
+		"- `art/hero.psd`: install Git LFS with `git lfs install`, then replace the file by a pointer with `git add --renormalize \"art/hero.psd\"` and commit\n")
+	statuses := server.Statuses()
+	assert.Equal(t, "failure", statuses[len(statuses)-1].State)
+	assert.Equal(t, "2 files bypassed Git LFS", statuses[len(statuses)-1].Description)
+	summary := checkRunSummary(result.Findings, lfsHelpContact, func(string) string { return "" })
+	assert.Contains(t, summary, "### LFS011 bypassed-lfs: 2 files committed without Git LFS")
+	assert.Contains(t, summary, "### Files that bypassed Git LFS")
+}
+
+func TestSniffFormat(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+	for content, expected := range map[string]string{
+		"\x7fELF\x02\x01\x01":          "ELF executable",
+		"MZ\x90\x00":                   "PE executable",
+		"\xcf\xfa\xed\xfe\x07":         "Mach-O executable",
+		"\x89PNG\r\n\x1a\n\x00":        "PNG image",
+		"Kaydara FBX Binary  \x00\x1a": "FBX model",
+		string(tar):                    "tar archive",
+		"#!/bin/sh\necho hello\n":      "",
+		"\x7fEL":                       "",
+	} {
+		assert.Equal(t, expected, sniffFormat([]byte(content)).name, "%q", content)
+	}
+}
+
+func TestExtensionlessBinaries(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/sniff-repo"
+	owner, name := "test-org", "sniff-repo"
+	elf := append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 2000)...)
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 2000)...)
+	check := func(sha, config string) *CommitResult {
+		server.AddFile(repo, sha, configFile, []byte(config))
+		server.AddFile(repo, sha, "bin/server", elf)
+		server.AddFile(repo, sha, "data/atlas", png)
+		server.AddFile(repo, sha, "data/notes", []byte(strings.Repeat("notes\n", 500)))
+		result := w.Check(&github.PushEvent{
+			Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{
+				ID:       github.String(sha),
+				Distinct: github.Bool(true),
+				Added:    []string{"bin/server", "data/atlas", "data/notes"},
+			}},
+		})
+		return result.Commits[0]
+	}
+
+	// Binary files matching the exemptions for text files are measured
+	// against the regular threshold
+	server.ResetCalls()
+	result := check("sha1", "lfsSizeThreshold: 1000\nlfsSizeExemptions: data/**\nlfsSizeExemptionsThreshold: 100000\n")
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, []Finding{
+		{Path: "bin/server", Size: 2007, Threshold: 1000, Rule: RuleOversizeFile, Severity: SeverityError},
+		{Path: "data/atlas", Size: 2008, Threshold: 1000, Rule: RuleOversizeFile, Severity: SeverityError, Format: "PNG image"},
+	}, result.Findings)
+	comments := server.Comments()
+	assert.Contains(t, comments[len(comments)-1].Body, "- `data/atlas` (PNG image)")
+
+	// Executables are build outputs once the rule is enabled
+	result = check("sha2", "lfsSizeThreshold: 1000\nrules:\n  build-output:\n    enabled: true\n")
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, []Finding{
+		{Path: "bin/server", Size: 2007, Rule: RuleBuildOutput, Severity: SeverityError, Format: "ELF executable"},
+		{Path: "data/atlas", Size: 2008, Threshold: 1000, Rule: RuleOversizeFile, Severity: SeverityError, Format: "PNG image"},
+		{Path: "data/notes", Size: 3000, Threshold: 1000, Rule: RuleOversizeFile, Severity: SeverityError},
+	}, result.Findings)
+	comments = server.Comments()
+	assert.Contains(t, comments[len(comments)-1].Body, "**:no_entry: The following files are compiled binaries, "+
+		"publish build outputs to a package registry instead (LFS010 build-output):**\n- `bin/server` (ELF executable)")
+	assert.Equal(t, "2 files >1000B, 1 build output", statusDescription(result.Findings))
+	assert.Contains(t, checkRunSummary(result.Findings, lfsHelpContact, func(string) string { return "" }), "LFS010 build-output: 1 compiled binary")
+
+	// Every extensionless file is read with the rule enabled
+	assert.Equal(t, 5, server.Calls("GET repos/test-org/sniff-repo/git/blobs/"))
+}
+
+// fakeReportStore keeps push reports in memory
+type fakeReportStore struct {
+	reports map[string]string
+}
+
+func (s *fakeReportStore) URL(repo, sha string) string {
+	return "https://watchdog.example.com/reports/" + repo + "/" + sha
+}
+
+func (s *fakeReportStore) Save(repo, sha string, report []byte) error {
+	s.reports[repo+"@"+sha] = string(report)
+	return nil
+}
+
+func TestPushReport(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	store := &fakeReportStore{reports: make(map[string]string)}
+	SetReportStore(store)
+	defer SetReportStore(nil)
+
+	repo := "test-org/report-repo"
+	for _, sha := range []string{"sha1", "sha2"} {
+		server.AddFile(repo, sha, configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	}
+	server.AddFileWithSize(repo, "sha1", "large.bin", 2000)
+
+	owner, name := "test-org", "report-repo"
+	w.Check(&github.PushEvent{
+		Ref:   github.String("refs/heads/main"),
+		After: github.String("sha2"),
+		Repo:  &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{
+			{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}},
+			{ID: github.String("sha2"), Distinct: github.Bool(true), Removed: []string{"large.bin"}},
+		},
+	})
+
+	// Every status of the push links its report
+	statuses := server.Statuses()
+	if assert.NotEmpty(t, statuses) {
+		for _, status := range statuses {
+			assert.Equal(t, "https://watchdog.example.com/reports/test-org/report-repo/sha2", status.TargetURL)
+		}
+	}
+	report := store.reports["test-org/report-repo@sha2"]
+	assert.Contains(t, report, "# Git LFS report of a push to `refs/heads/main` in `test-org/report-repo`\n\n2 commits checked, 1 with findings.\n")
+	assert.Contains(t, report, "## Commit `sha1`\n\n| File | Rule | Severity | Size |\n|---|---|---|---:|\n"+
+		"| [`large.bin`]("+server.URL+"/test-org/report-repo/blob/sha1/large.bin) | LFS001 oversize-file | error | 1KB |\n")
+	assert.Contains(t, report, "## Commit `sha2`\n\nNot evaluated: no files.\n")
+}
+
+func TestCheckTimeout(t *testing.T) {
+	mux, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	SetCheckTimeout(200 * time.Millisecond)
+	defer SetCheckTimeout(defaultCheckTimeout)
+
+	repo := "test-org/slow-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+	server.AddFileWithSize(repo, "sha1", "large.bin", 2000)
+	server.AddFileWithSize(repo, "sha1", "slow/large.bin", 2000)
+	// The listing of the slow directory never completes
+	mux.HandleFunc("/api/v3/repos/test-org/slow-repo/contents/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	owner, name := "test-org", "slow-repo"
+	result := w.Check(&github.PushEvent{
+		Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{
+			{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin", "slow/large.bin"}},
+		},
+	})
+
+	commit := result.Commits[0]
+	assert.True(t, commit.TimedOut)
+	if assert.Len(t, commit.Findings, 1) {
+		assert.Equal(t, "large.bin", commit.Findings[0].Path)
+	}
+	statuses := server.Statuses()
+	if assert.NotEmpty(t, statuses) {
+		last := statuses[len(statuses)-1]
+		assert.Equal(t, "error", last.State)
+		assert.Equal(t, timeoutDescription, last.Description)
+	}
+	comments := server.Comments()
+	if assert.Len(t, comments, 1) {
+		assert.True(t, strings.HasPrefix(comments[0].Body, "**Note:** partial results, the evaluation timed out after 200ms. "+
+			"Files that were not measured by then are not listed.\n\n"))
+		assert.Contains(t, comments[0].Body, "`large.bin`")
+	}
+}
+
+func TestCoaching(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	w.SetInstallation(78)
+	defer SetInstallationSettings(78, InstallationSettings{})
+
+	_, err := SetInstallationSettings(78, InstallationSettings{CoachingViolations: -1})
+	assert.NotNil(t, err)
+	_, err = SetInstallationSettings(78, InstallationSettings{CoachingViolations: 1})
+	assert.Nil(t, err)
+
+	repo := "test-org/coaching-repo"
+	owner, name := "test-org", "coaching-repo"
+	check := func(sha, author string) {
+		server.AddFile(repo, sha, configFile, []byte("lfsSizeThreshold: 1000\nlfsCommitStatusEnabled: Yes\n"))
+		server.AddFileWithSize(repo, sha, "large.bin", 2000)
+		w.Check(&github.PushEvent{
+			Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+			Commits: []*github.HeadCommit{{
+				ID:       github.String(sha),
+				Distinct: github.Bool(true),
+				Added:    []string{"large.bin"},
+				Author:   &github.CommitAuthor{Login: github.String(author)},
+			}},
+		})
+	}
+
+	// The first commit with findings is only reported in a check run
+	check("sha1", "new-hire")
+	assert.Empty(t, server.Comments())
+	runs := server.CheckRuns()
+	if assert.Len(t, runs, 1) {
+		assert.True(t, strings.HasPrefix(runs[0].Output.GetSummary(), "**Note:** as your first commit with Git LFS findings, this commit is only reported here. "))
+	}
+	statuses := server.Statuses()
+	assert.Equal(t, "failure", statuses[len(statuses)-1].State, "coaching doesn't change enforcement")
+
+	// Later ones are commented on as usual, without a check run
+	check("sha2", "New-Hire")
+	comments := server.Comments()
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, "sha2", comments[0].SHA)
+	}
+	assert.Len(t, server.CheckRuns(), 1)
+}
+
+func TestTrackedWithLFS(t *testing.T) {
+	attributes := []attributesFile{
+		{rules: parseFilterRules("# assets\n*.psd filter=lfs diff=lfs merge=lfs -text\n/*.png filter=lfs\nlegacy/*.psd -filter\n[attr]binary -diff -merge -text\n")},
+		{dir: "textures", rules: parseFilterRules("*.tga filter=lfs diff=lfs merge=lfs -text\n")},
+	}
+	assert.True(t, trackedWithLFS(attributes, "art/hero.psd"))
+	assert.False(t, trackedWithLFS(attributes, "legacy/old.psd"), "later lines take precedence")
+	assert.True(t, trackedWithLFS(attributes, "logo.png"))
+	assert.False(t, trackedWithLFS(attributes, "art/logo.png"), "patterns with a slash are anchored")
+	assert.True(t, trackedWithLFS(attributes, "textures/stone/wall.tga"))
+	assert.False(t, trackedWithLFS(attributes, "wall.tga"), "nested attributes only apply below their directory")
+}
+
+func TestCheckPullRequestDisabled(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/pr-off-repo"
+	server.AddFile(repo, "head1", configFile, []byte("lfsSizeThreshold: 1000\nlfsChecksEnabled: Yes\n"))
+	server.AddFileWithSize(repo, "head1", "art/hero.psd", 2000)
+	server.AddPullRequest(repo, &github.PullRequest{Number: github.Int(3), Head: &github.PullRequestBranch{SHA: github.String("head1")}},
+		[]*github.CommitFile{{Filename: github.String("art/hero.psd"), Status: github.String("added")}})
+
+	result, err := w.CheckPullRequest(context.Background(), PullRequestRequest{Owner: "test-org", Repo: "pr-off-repo", Number: 3})
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+	assert.Empty(t, server.CheckRuns())
+
+	_, err = w.CheckPullRequest(context.Background(), PullRequestRequest{Owner: "test-org", Repo: "pr-off-repo", Number: 4})
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// Repositories without a configuration don't check pull requests
+	unconfigured := "test-org/pr-unconfigured-repo"
+	server.AddFileWithSize(unconfigured, "head1", "art/hero.psd", 2000)
+	server.AddPullRequest(unconfigured, &github.PullRequest{Number: github.Int(5), Head: &github.PullRequestBranch{SHA: github.String("head1")}},
+		[]*github.CommitFile{{Filename: github.String("art/hero.psd"), Status: github.String("added")}})
+	result, err = w.CheckPullRequest(context.Background(), PullRequestRequest{Owner: "test-org", Repo: "pr-unconfigured-repo", Number: 5})
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+
+	// Nor do repositories whose configuration can't be read
+	server.InjectError("GET", "repos/test-org/pr-unconfigured-repo/contents/", http.StatusBadGateway, 1)
+	configContentCache.Clear()
+	configCache.Clear()
+	result, err = w.CheckPullRequest(context.Background(), PullRequestRequest{Owner: "test-org", Repo: "pr-unconfigured-repo", Number: 5})
+	assert.NotNil(t, err)
+	assert.Nil(t, result)
+	assert.Empty(t, server.CheckRuns())
+}
+
+func TestCheckPullRequestMerge(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	retries, restore := skipRetryDelays()
+	defer restore()
+	w := newWatchDog(server.URL)
+
+	repo := "test-org/pr-merge-repo"
+	config := []byte("lfsSizeThreshold: 1000\npullRequestChecksEnabled: Yes\npullRequestMergeChecksEnabled: Yes\n")
+	server.AddFile(repo, "head1", configFile, config)
+	server.AddFileWithSize(repo, "head1", "src/main.c", 100)
+	// Resolving a conflict added a large file that neither branch has
+	server.AddFileWithSize(repo, "merge1", "src/main.c", 100)
+	server.AddFileWithSize(repo, "merge1", "art/resolved.psd", 2000)
+	server.AddCommit(repo, &github.RepositoryCommit{
+		SHA:     github.String("merge1"),
+		Parents: []*github.Commit{{SHA: github.String("base1")}, {SHA: github.String("head1")}},
+		Files: []*github.CommitFile{
+			{Filename: github.String("src/main.c"), Status: github.String("added")},
+			{Filename: github.String("art/resolved.psd"), Status: github.String("added")},
+		},
+	})
+	files := []*github.CommitFile{{Filename: github.String("src/main.c"), Status: github.String("added")}}
+	server.AddPullRequest(repo, &github.PullRequest{
+		Number:         github.Int(5),
+		Head:           &github.PullRequestBranch{SHA: github.String("head1")},
+		Mergeable:      github.Bool(true),
+		MergeCommitSHA: github.String("merge1"),
+	}, files)
+
+	result, err := w.CheckPullRequest(context.Background(), PullRequestRequest{Owner: "test-org", Repo: "pr-merge-repo", Number: 5})
+	assert.Nil(t, err)
+	if assert.Len(t, result.Findings, 1) {
+		assert.Equal(t, "art/resolved.psd", result.Findings[0].Path)
+	}
+	runs := server.CheckRuns()
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, "head1", runs[0].HeadSHA)
+		assert.Contains(t, runs[0].Output.GetSummary(), "checked at merge1, the result of merging it into its base branch")
+	}
+
+	// Pull requests with conflicts are checked at their head
+	server.AddPullRequest(repo, &github.PullRequest{
+		Number:    github.Int(6),
+		Head:      &github.PullRequestBranch{SHA: github.String("head1")},
+		Mergeable: github.Bool(false),
+	}, files)
+	result, err = w.CheckPullRequest(context.Background(), PullRequestRequest{Owner: "test-org", Repo: "pr-merge-repo", Number: 6})
+	assert.Nil(t, err)
+	assert.Empty(t, result.Findings)
+	assert.Equal(t, int32(maxLookupRetries), atomic.LoadInt32(retries))
+	runs = server.CheckRuns()
+	if assert.Len(t, runs, 2) {
+		assert.Contains(t, runs[1].Output.GetSummary(), "checked at head1, its head, as GitHub could not merge it into its base branch")
+	}
+}
+
+func TestEvaluationTrace(t *testing.T) {
+	_, server := setup()
+	defer teardown(server)
+	w := newWatchDog(server.URL)
+	_, restore := skipRetryDelays()
+	defer restore()
+	logging.SetDebug(true)
+	defer logging.SetDebug(false)
+
+	repo := "test-org/trace-repo"
+	server.AddFile(repo, "sha1", configFile, []byte("lfsSizeThreshold: 1000\nlfsSizeExemptions: |\n  *.log 50KB\n  *.txt\n"+
+		"lfsSizeExemptionsThreshold: 5000\nsuppress:\n  - path: legacy.bin\n    rule: oversize-file\n    reason: migrated later\n"))
+	server.AddFileWithSize(repo, "sha1", "large.bin", 2000)
+	server.AddFileWithSize(repo, "sha1", "build.log", 20000)
+	server.AddFileWithSize(repo, "sha1", "notes.txt", 3000)
+	server.AddFileWithSize(repo, "sha1", "legacy.bin", 3000)
+
+	owner, name := "test-org", "trace-repo"
+	result := w.Check(&github.PushEvent{
+		Repo: &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true),
+			Added: []string{"large.bin", "build.log", "notes.txt", "legacy.bin", "missing.bin"}}},
+	})
+
+	trace := result.Commits[0].Trace
+	if assert.Len(t, trace, 5) {
+		assert.Equal(t, FileTrace{Path: "large.bin", Type: "file", Size: 2000, Threshold: 1000, Decision: "finding", Rule: RuleOversizeFile}, trace[0])
+		assert.Equal(t, FileTrace{Path: "build.log", Type: "file", Size: 20000, Threshold: 50 * 1024, Exemption: "*.log", Decision: "cleared"}, trace[1])
+		assert.Equal(t, FileTrace{Path: "notes.txt", Type: "file", Size: 3000, Threshold: 5000, Exemption: "*.txt", Decision: "cleared"}, trace[2])
+		assert.Equal(t, "suppressed", trace[3].Decision)
+		assert.Equal(t, "error", trace[4].Decision)
+		assert.NotEmpty(t, trace[4].Error)
+	}
+
+	// Traces are not kept without debug logging
+	logging.SetDebug(false)
+	result = w.Check(&github.PushEvent{
+		Repo:    &github.PushEventRepository{Name: &name, FullName: &repo, Owner: &github.User{Login: &owner}},
+		Commits: []*github.HeadCommit{{ID: github.String("sha1"), Distinct: github.Bool(true), Added: []string{"large.bin"}}},
+	})
+	assert.Empty(t, result.Commits[0].Trace)
+}